@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// getCPUTime reports that process CPU time is unavailable on this platform.
+func getCPUTime() int64 {
+	return -1
+}
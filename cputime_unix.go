@@ -0,0 +1,15 @@
+//go:build unix
+
+package main
+
+import "syscall"
+
+// getCPUTime returns the total user and system CPU time consumed by the process in nanoseconds,
+// or -1 if it cannot be read.
+func getCPUTime() int64 {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return -1
+	}
+	return usage.Utime.Nano() + usage.Stime.Nano()
+}
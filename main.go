@@ -1,16 +1,69 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"flag"
 	"fmt"
+	"hash"
+	"io"
+	"io/fs"
 	"io/ioutil"
+	"log"
+	"log/slog"
+	"math"
+	"math/bits"
 	"math/rand"
+	"net"
 	"net/http"
+	"net/http/pprof"
+	"net/url"
+	"os"
+	"os/signal"
+	"reflect"
+	"regexp"
 	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/net/websocket"
+	"golang.org/x/time/rate"
+	"gopkg.in/yaml.v3"
 )
 
 const (
@@ -18,761 +71,8576 @@ const (
 	MaxMemoryKB = 1000000
 	// MaxFibonacci is the maximum Fibonacci position limit
 	MaxFibonacci = 45
+	// FibonacciMemoSize is the maximum number of positions kept by the ?memo=1 Fibonacci cache
+	FibonacciMemoSize = 128
 	// MaxPrimes is the maximum prime count limit
 	MaxPrimes = 10000
+	// MaxSieveN is the maximum upper bound for sieving primes
+	MaxSieveN = 10000000
+	// MaxCollatzN is the maximum upper bound for /collatz stopping-time searches
+	MaxCollatzN = 1000000
+	// MaxGoroutines is the maximum number of goroutines one /goroutines request spawns
+	MaxGoroutines = 100000
+	// GoroutineSleep is how long each /goroutines goroutine sleeps before exiting
+	GoroutineSleep = time.Millisecond
+	// MaxHashIterations is the maximum number of block hashes per request
+	MaxHashIterations = 100000
+	// MaxRegexLines is the maximum number of generated lines /regex matches against
+	MaxRegexLines = 100000
+	// MaxRegexPatternLen is the maximum length of a ?pattern= regex on /regex
+	MaxRegexPatternLen = 256
 	// MaxHexKB is the maximum hex string size limit in kilobytes
 	MaxHexKB = 10000
+	// MaxEncryptKB is the maximum plaintext size for AES encryption in kilobytes
+	MaxEncryptKB = 10000
+	// MaxCompressKB is the maximum input size for gzip compression in kilobytes
+	MaxCompressKB = 10000
+	// MaxJSONKB is the maximum size, in kilobytes, of the /json document
+	MaxJSONKB = 1000
+	// MaxJSONIterations is the maximum number of /json marshal/unmarshal roundtrips
+	MaxJSONIterations = 1000
+	// MaxQueryRows is the maximum row count for simulated queries
+	MaxQueryRows = 5000
+	// MaxQueryJoins is the maximum number of joins for simulated queries
+	MaxQueryJoins = 5
+	// MaxCPUDuration is the maximum duration of a time-bounded CPU burn
+	MaxCPUDuration = 30 * time.Second
+	// MaxDripBytes is the maximum number of bytes one /drip response trickles out
+	MaxDripBytes = 10 * 1024 * 1024
+	// MaxDripDuration is the maximum time one /drip response may be spread over
+	MaxDripDuration = 60 * time.Second
+	// MinBcryptCost and MaxBcryptCost bound the /bcrypt cost factor; each step doubles the work
+	MinBcryptCost = bcrypt.MinCost
+	MaxBcryptCost = 15
+	// MaxHoldDuration is the maximum time a memory allocation can be held
+	MaxHoldDuration = 10 * time.Minute
+	// MaxHeldKB is the maximum total memory, in kilobytes, held across all active holds
+	MaxHeldKB = 1000000
+	// MaxSortN is the maximum number of elements sorted by /sort
+	MaxSortN = 1000000
+	// MaxMatmulDim is the maximum matrix dimension for /matmul (three dim x dim float64 matrices)
+	MaxMatmulDim = 1024
+	// MaxDiskWriteKB is the maximum size, in kilobytes, of one /disk/write file
+	MaxDiskWriteKB = 100000
+	// MaxDiskReadKB is the maximum size, in kilobytes, of one /disk/read (reads wrap around the backing file)
+	MaxDiskReadKB = 1000000
+	// DefaultDiskReadFileKB is the default size of the /disk/read backing file created at startup
+	DefaultDiskReadFileKB = 65536
+	// MaxFetchBytes is the maximum number of bytes one /fetch request reads from its URL
+	MaxFetchBytes = 100 * 1024 * 1024
+	// MaxEchoBytes is the maximum request body POST /echo reads
+	MaxEchoBytes = 10 * 1024 * 1024
+	// FetchTimeout bounds a whole /fetch download, including redirects and reading the body
+	FetchTimeout = 30 * time.Second
+	// DiskChunkSize is the size of each write (and, for /disk/read, each read) in bytes
+	DiskChunkSize = 64 * 1024
+	// MaxBatchOps is the maximum number of operations in one POST /batch request
+	MaxBatchOps = 100
+	// MaxWSMessageBytes is the largest command frame /ws accepts
+	MaxWSMessageBytes = 64 * 1024
+	// WSPingInterval is how often /ws pings the client to keep idle connections open through proxies
+	WSPingInterval = 30 * time.Second
+	// MaxRequestTimeout is the maximum ?timeout= budget a request may ask for
+	MaxRequestTimeout = 60 * time.Second
+	// MaxGOMAXPROCS bounds -maxprocs and POST /admin/maxprocs/:n
+	MaxGOMAXPROCS = 1024
+	// MaxGCPercent bounds APEX_GOGC and POST /admin/gogc/:pct
+	MaxGCPercent = 10000
+	// MaxBallastMB bounds APEX_BALLAST_MB
+	MaxBallastMB = 16 * 1024
+	// MaxDelay is the maximum artificial latency ?delay= (or APEX_DELAY) may inject
+	MaxDelay = 30 * time.Second
+	// cancelCheckInterval is how many loop iterations compute loops run between context checks
+	cancelCheckInterval = 1024
 	// PageSize is the memory page size in bytes for memory allocation
 	PageSize = 4096
 )
 
-// RequestMetrics holds request-level performance metrics
-type RequestMetrics struct {
-	StartTime        time.Time `json:"-"`
-	EndTime          time.Time `json:"-"`
-	StartCPUTime     int64     `json:"-"`
-	DurationUs       int64     `json:"duration_us"`
-	DurationMs       float64   `json:"duration_ms"`
-	CPUUsagePercent  float64   `json:"cpu_usage_percent"`
-	MemoryUsedBytes  int64     `json:"memory_used_bytes"`
-	GoroutinesBefore int       `json:"goroutines_before"`
-	GoroutinesAfter  int       `json:"goroutines_after"`
-}
-
-// parseIntOrRange parses a parameter that can be either a single integer or a range.
-// Returns the parsed value and whether it was a range.
-func parseIntOrRange(param string, maxValue int, paramName string) (int, bool, error) {
-	// Parse the parameter (single value or range)
-	if strings.Contains(param, "..") {
-		parts := strings.Split(param, "..")
-		if len(parts) != 2 {
-			return 0, false, fmt.Errorf("invalid range format, use min..max")
-		}
+// loadLimits holds the effective input limits for each load operation.
+// Defaults come from the Max* constants and can be overridden via the config file and environment variables.
+type loadLimits struct {
+	MemoryKB       int           `yaml:"memory_kb"`
+	Fibonacci      int           `yaml:"fibonacci"`
+	Primes         int           `yaml:"primes"`
+	SieveN         int           `yaml:"sieve_n"`
+	CollatzN       int           `yaml:"collatz_n"`
+	Goroutines     int           `yaml:"goroutines"`
+	HashIterations int           `yaml:"hash_iterations"`
+	RegexLines     int           `yaml:"regex_lines"`
+	HexKB          int           `yaml:"hex_kb"`
+	EncryptKB      int           `yaml:"encrypt_kb"`
+	CompressKB     int           `yaml:"compress_kb"`
+	JSONKB         int           `yaml:"json_kb"`
+	JSONIterations int           `yaml:"json_iterations"`
+	SortN          int           `yaml:"sort_n"`
+	MatmulDim      int           `yaml:"matmul_dim"`
+	DiskWriteKB    int           `yaml:"disk_write_kb"`
+	DiskReadKB     int           `yaml:"disk_read_kb"`
+	FetchBytes     int           `yaml:"fetch_bytes"`
+	EchoBytes      int           `yaml:"echo_bytes"`
+	QueryRows      int           `yaml:"query_rows"`
+	QueryJoins     int           `yaml:"query_joins"`
+	CPUDuration    time.Duration `yaml:"cpu_duration"`
+	DripBytes      int           `yaml:"drip_bytes"`
+	DripDuration   time.Duration `yaml:"drip_duration"`
+	HoldDuration   time.Duration `yaml:"hold_duration"`
+	HeldKB         int           `yaml:"held_kb"`
+	BatchOps       int           `yaml:"batch_ops"`
+	RequestTimeout time.Duration `yaml:"request_timeout"`
+	Delay          time.Duration `yaml:"delay"`
+}
 
-		min, err := strconv.Atoi(strings.TrimSpace(parts[0]))
-		if err != nil {
-			return 0, false, fmt.Errorf("invalid minimum value: %v", err)
-		}
+// defaultLoadLimits returns the compile-time limits
+func defaultLoadLimits() loadLimits {
+	return loadLimits{
+		MemoryKB:       MaxMemoryKB,
+		Fibonacci:      MaxFibonacci,
+		Primes:         MaxPrimes,
+		SieveN:         MaxSieveN,
+		CollatzN:       MaxCollatzN,
+		Goroutines:     MaxGoroutines,
+		HashIterations: MaxHashIterations,
+		RegexLines:     MaxRegexLines,
+		HexKB:          MaxHexKB,
+		EncryptKB:      MaxEncryptKB,
+		CompressKB:     MaxCompressKB,
+		JSONKB:         MaxJSONKB,
+		JSONIterations: MaxJSONIterations,
+		SortN:          MaxSortN,
+		MatmulDim:      MaxMatmulDim,
+		DiskWriteKB:    MaxDiskWriteKB,
+		DiskReadKB:     MaxDiskReadKB,
+		FetchBytes:     MaxFetchBytes,
+		EchoBytes:      MaxEchoBytes,
+		QueryRows:      MaxQueryRows,
+		QueryJoins:     MaxQueryJoins,
+		CPUDuration:    MaxCPUDuration,
+		DripBytes:      MaxDripBytes,
+		DripDuration:   MaxDripDuration,
+		HoldDuration:   MaxHoldDuration,
+		HeldKB:         MaxHeldKB,
+		BatchOps:       MaxBatchOps,
+		RequestTimeout: MaxRequestTimeout,
+		Delay:          MaxDelay,
+	}
+}
 
-		max, err := strconv.Atoi(strings.TrimSpace(parts[1]))
-		if err != nil {
-			return 0, false, fmt.Errorf("invalid maximum value: %v", err)
-		}
+// loadLimitsFromEnv returns the default limits with any APEX_MAX_* environment overrides applied.
+func loadLimitsFromEnv() loadLimits {
+	return applyLimitsEnv(defaultLoadLimits())
+}
 
-		if min < 0 || max < 0 {
-			return 0, false, fmt.Errorf("values must be non-negative")
-		}
+// applyLimitsEnv returns limits with any APEX_MAX_* environment overrides applied
+func applyLimitsEnv(limits loadLimits) loadLimits {
+	limits.MemoryKB = envPositiveInt("APEX_MAX_MEMORY_KB", limits.MemoryKB)
+	limits.Fibonacci = envPositiveInt("APEX_MAX_FIBONACCI", limits.Fibonacci)
+	limits.Primes = envPositiveInt("APEX_MAX_PRIMES", limits.Primes)
+	limits.SieveN = envPositiveInt("APEX_MAX_SIEVE_N", limits.SieveN)
+	limits.CollatzN = envPositiveInt("APEX_MAX_COLLATZ_N", limits.CollatzN)
+	limits.Goroutines = envPositiveInt("APEX_MAX_GOROUTINES", limits.Goroutines)
+	limits.HashIterations = envPositiveInt("APEX_MAX_HASH_ITERATIONS", limits.HashIterations)
+	limits.RegexLines = envPositiveInt("APEX_MAX_REGEX_LINES", limits.RegexLines)
+	limits.HexKB = envPositiveInt("APEX_MAX_HEX_KB", limits.HexKB)
+	limits.EncryptKB = envPositiveInt("APEX_MAX_ENCRYPT_KB", limits.EncryptKB)
+	limits.CompressKB = envPositiveInt("APEX_MAX_COMPRESS_KB", limits.CompressKB)
+	limits.JSONKB = envPositiveInt("APEX_MAX_JSON_KB", limits.JSONKB)
+	limits.JSONIterations = envPositiveInt("APEX_MAX_JSON_ITERATIONS", limits.JSONIterations)
+	limits.SortN = envPositiveInt("APEX_MAX_SORT_N", limits.SortN)
+	limits.MatmulDim = envPositiveInt("APEX_MAX_MATMUL_DIM", limits.MatmulDim)
+	limits.DiskWriteKB = envPositiveInt("APEX_MAX_DISK_WRITE_KB", limits.DiskWriteKB)
+	limits.DiskReadKB = envPositiveInt("APEX_MAX_DISK_READ_KB", limits.DiskReadKB)
+	limits.FetchBytes = envPositiveInt("APEX_MAX_FETCH_BYTES", limits.FetchBytes)
+	limits.EchoBytes = envPositiveInt("APEX_MAX_ECHO_BYTES", limits.EchoBytes)
+	limits.QueryRows = envPositiveInt("APEX_MAX_QUERY_ROWS", limits.QueryRows)
+	limits.QueryJoins = envPositiveInt("APEX_MAX_QUERY_JOINS", limits.QueryJoins)
+	limits.CPUDuration = envDuration("APEX_MAX_CPU_DURATION", limits.CPUDuration)
+	limits.DripBytes = envPositiveInt("APEX_MAX_DRIP_BYTES", limits.DripBytes)
+	limits.DripDuration = envDuration("APEX_MAX_DRIP_DURATION", limits.DripDuration)
+	limits.HoldDuration = envDuration("APEX_MAX_HOLD_DURATION", limits.HoldDuration)
+	limits.HeldKB = envPositiveInt("APEX_MAX_HELD_KB", limits.HeldKB)
+	limits.BatchOps = envPositiveInt("APEX_MAX_BATCH_OPS", limits.BatchOps)
+	limits.RequestTimeout = envDuration("APEX_MAX_REQUEST_TIMEOUT", limits.RequestTimeout)
+	limits.Delay = envDuration("APEX_MAX_DELAY", limits.Delay)
+	return limits
+}
 
-		if min > max {
-			return 0, false, fmt.Errorf("minimum value cannot be greater than maximum")
-		}
+// envPositiveInt reads a positive integer from the named environment variable.
+// Unset variables return the default; invalid values log a warning and return the default.
+func envPositiveInt(name string, defaultValue int) int {
+	raw, ok := os.LookupEnv(name)
+	if !ok || raw == "" {
+		return defaultValue
+	}
+	value, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil || value <= 0 {
+		log.Printf("warning: ignoring invalid %s=%q, using default %d", name, raw, defaultValue)
+		return defaultValue
+	}
+	return value
+}
 
-		if min > maxValue || max > maxValue {
-			return 0, false, fmt.Errorf("values must be within range (0-%d)", maxValue)
-		}
+// envBool reads a boolean from the named environment variable.
+// Unset variables return the default; invalid values log a warning and return the default.
+func envBool(name string, defaultValue bool) bool {
+	raw, ok := os.LookupEnv(name)
+	if !ok || raw == "" {
+		return defaultValue
+	}
+	value, err := strconv.ParseBool(strings.TrimSpace(raw))
+	if err != nil {
+		log.Printf("warning: ignoring invalid %s=%q, using default %t", name, raw, defaultValue)
+		return defaultValue
+	}
+	return value
+}
 
-		actualValue := min + rand.Intn(max-min+1)
-		return actualValue, true, nil
-	} else {
-		// Single value
-		value, err := strconv.Atoi(param)
-		if err != nil {
-			return 0, false, fmt.Errorf("invalid number: %v", err)
-		}
+// envDuration reads a positive duration (e.g. "10s") from the named environment variable.
+// Unset variables return the default; invalid values log a warning and return the default.
+func envDuration(name string, defaultValue time.Duration) time.Duration {
+	raw, ok := os.LookupEnv(name)
+	if !ok || raw == "" {
+		return defaultValue
+	}
+	value, err := time.ParseDuration(strings.TrimSpace(raw))
+	if err != nil || value <= 0 {
+		log.Printf("warning: ignoring invalid %s=%q, using default %s", name, raw, defaultValue)
+		return defaultValue
+	}
+	return value
+}
 
-		if value < 0 || value > maxValue {
-			return 0, false, fmt.Errorf("number out of range (0-%d)", maxValue)
-		}
+// envPositiveFloat reads a positive number from the named environment variable.
+// Unset variables return the default; invalid values log a warning and return the default.
+func envPositiveFloat(name string, defaultValue float64) float64 {
+	raw, ok := os.LookupEnv(name)
+	if !ok || raw == "" {
+		return defaultValue
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+	if err != nil || value <= 0 || math.IsInf(value, 0) || math.IsNaN(value) {
+		log.Printf("warning: ignoring invalid %s=%q, using default %g", name, raw, defaultValue)
+		return defaultValue
+	}
+	return value
+}
 
-		return value, false, nil
+// Config is the optional YAML file given with -config. Every key is optional and keeps its default
+// when omitted; APEX_* environment variables override the file, and command-line flags override both.
+type Config struct {
+	Port                    int             `yaml:"port"`
+	TLSPort                 int             `yaml:"tls_port"`
+	Seed                    string          `yaml:"seed"`
+	AuthToken               string          `yaml:"auth_token"`
+	RateLimit               RateLimitConfig `yaml:"rate_limit"`
+	MaxConcurrency          int             `yaml:"max_concurrency"`
+	ConcurrencyQueueTimeout time.Duration   `yaml:"concurrency_queue_timeout"`
+	ErrorRate               float64         `yaml:"error_rate"`
+	ErrorStatus             int             `yaml:"error_status"`
+	Features                FeatureConfig   `yaml:"features"`
+	Limits                  loadLimits      `yaml:"limits"`
+}
+
+// RateLimitConfig is the per-endpoint token bucket; zero RPS disables it, and zero Burst means ceil(RPS)
+type RateLimitConfig struct {
+	RPS   float64 `yaml:"rps"`
+	Burst int     `yaml:"burst"`
+}
+
+// limiter returns the rateLimiter for this config, or nil when rate limiting is off
+func (config RateLimitConfig) limiter() *rateLimiter {
+	if config.RPS <= 0 {
+		return nil
 	}
+	burst := config.Burst
+	if burst == 0 {
+		burst = int(math.Ceil(config.RPS))
+	}
+	return newRateLimiter(config.RPS, burst)
 }
 
-// startRequestMetrics initializes request metrics collection
-func startRequestMetrics() *RequestMetrics {
-	var memStats runtime.MemStats
-	runtime.ReadMemStats(&memStats)
+// FeatureConfig holds the opt-in endpoints and switches otherwise set by APEX_ENABLE_* and APEX_DISABLE_METRICS
+type FeatureConfig struct {
+	GCEndpoint     bool `yaml:"gc_endpoint"`
+	Pprof          bool `yaml:"pprof"`
+	Disk           bool `yaml:"disk"`
+	Admin          bool `yaml:"admin"`
+	Expvar         bool `yaml:"expvar"`
+	DisableMetrics bool `yaml:"disable_metrics"`
+}
 
-	return &RequestMetrics{
-		StartTime:        time.Now(),
-		StartCPUTime:     getCPUTime(),
-		GoroutinesBefore: runtime.NumGoroutine(),
-		MemoryUsedBytes:  int64(memStats.Alloc),
+// defaultConfig returns the configuration used when no file, environment variable, or flag sets a value
+func defaultConfig() Config {
+	return Config{Port: HTTPPort, ErrorStatus: http.StatusInternalServerError, Limits: defaultLoadLimits()}
+}
+
+// loadConfig reads the YAML file at path over defaultConfig. An empty path or a missing file yields
+// the defaults. Unknown keys, malformed values, and out-of-range ports or limits are errors, so a
+// typo fails startup rather than being silently ignored.
+func loadConfig(path string) (Config, error) {
+	config := defaultConfig()
+	if path == "" {
+		return config, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return config, err
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		return config, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	if config.Port < 1 || config.Port > 65535 {
+		return config, fmt.Errorf("port %d is out of range (1-65535)", config.Port)
+	}
+	if config.TLSPort < 0 || config.TLSPort > 65535 {
+		return config, fmt.Errorf("tls_port %d is out of range (0-65535)", config.TLSPort)
+	}
+	if config.RateLimit.RPS < 0 || config.RateLimit.Burst < 0 || config.MaxConcurrency < 0 || config.ConcurrencyQueueTimeout < 0 {
+		return config, errors.New("rate_limit, max_concurrency, and concurrency_queue_timeout must not be negative")
+	}
+	if config.ErrorRate < 0 || config.ErrorRate > 1 {
+		return config, fmt.Errorf("error_rate %g is out of range (0-1)", config.ErrorRate)
+	}
+	if config.ErrorStatus < 400 || config.ErrorStatus > 599 {
+		return config, fmt.Errorf("error_status %d is not a 4xx or 5xx code", config.ErrorStatus)
+	}
+	limits := reflect.ValueOf(config.Limits)
+	for i := 0; i < limits.NumField(); i++ {
+		if limits.Field(i).Int() <= 0 {
+			return config, fmt.Errorf("limits.%s must be positive", limits.Type().Field(i).Tag.Get("yaml"))
+		}
 	}
+	return config, nil
 }
 
-// getCPUTime returns a placeholder for CPU time measurement
-// TODO: Implement actual CPU time measurement using platform-specific syscalls
-func getCPUTime() int64 {
-	// Return 0 as we don't have actual CPU time measurement
-	// This will result in CPU usage being set to a sentinel value
-	return 0
+// applyEnv overrides config with the APEX_* environment variables that are set. Invalid values log a
+// warning and keep the file's value, as they keep the default without a file.
+func (config *Config) applyEnv() {
+	config.Port = envPositiveInt("APEX_PORT", config.Port)
+	if seed := os.Getenv("APEX_RAND_SEED"); seed != "" {
+		config.Seed = seed
+	}
+	if token := os.Getenv("APEX_AUTH_TOKEN"); token != "" {
+		config.AuthToken = token
+	}
+	config.RateLimit.RPS = envPositiveFloat("APEX_RATE_LIMIT_RPS", config.RateLimit.RPS)
+	config.RateLimit.Burst = envPositiveInt("APEX_RATE_LIMIT_BURST", config.RateLimit.Burst)
+	config.MaxConcurrency = envPositiveInt("APEX_MAX_CONCURRENCY", config.MaxConcurrency)
+	config.ConcurrencyQueueTimeout = envDuration("APEX_CONCURRENCY_QUEUE_TIMEOUT", config.ConcurrencyQueueTimeout)
+	if raw := os.Getenv("APEX_ERROR_RATE"); raw != "" {
+		if rate, err := parseErrorRate(raw); err != nil {
+			log.Printf("warning: ignoring invalid APEX_ERROR_RATE=%q: %v", raw, err)
+		} else {
+			config.ErrorRate = rate
+		}
+	}
+	if raw := os.Getenv("APEX_ERROR_STATUS"); raw != "" {
+		if status, err := parseErrorStatus(raw); err != nil {
+			log.Printf("warning: ignoring invalid APEX_ERROR_STATUS=%q: %v", raw, err)
+		} else {
+			config.ErrorStatus = status
+		}
+	}
+	config.Features.GCEndpoint = envBool("APEX_ENABLE_GC_ENDPOINT", config.Features.GCEndpoint)
+	config.Features.Pprof = envBool("APEX_ENABLE_PPROF", config.Features.Pprof)
+	config.Features.Disk = envBool("APEX_ENABLE_DISK", config.Features.Disk)
+	config.Features.Admin = envBool("APEX_ENABLE_ADMIN", config.Features.Admin)
+	config.Features.Expvar = envBool("APEX_ENABLE_EXPVAR", config.Features.Expvar)
+	config.Features.DisableMetrics = envBool("APEX_DISABLE_METRICS", config.Features.DisableMetrics)
+	config.Limits = applyLimitsEnv(config.Limits)
 }
 
-// finishRequestMetrics completes request metrics collection
-func (rm *RequestMetrics) finish() {
-	var memStats runtime.MemStats
-	runtime.ReadMemStats(&memStats)
+// applyFlags overrides config with the flags explicitly given on the command line; flags left at
+// their defaults don't override the file or environment
+func (config *Config) applyFlags(flags *flag.FlagSet) {
+	flags.Visit(func(f *flag.Flag) {
+		value := f.Value.(flag.Getter).Get()
+		switch f.Name {
+		case "port":
+			config.Port = value.(int)
+		case "tls-port":
+			config.TLSPort = value.(int)
+		case "seed":
+			config.Seed = value.(string)
+		}
+	})
+}
 
-	rm.EndTime = time.Now()
-	duration := rm.EndTime.Sub(rm.StartTime)
-	rm.DurationUs = duration.Nanoseconds() / 1000
-	rm.DurationMs = float64(duration.Nanoseconds()) / 1000000.0
-	rm.GoroutinesAfter = runtime.NumGoroutine()
+// reloadableConfigKeys are the top-level Config keys a SIGHUP reload applies; every other key is
+// read once at startup
+var reloadableConfigKeys = map[string]bool{
+	"limits":       true,
+	"rate_limit":   true,
+	"error_rate":   true,
+	"error_status": true,
+}
 
-	// Calculate memory used during request
-	memoryAfter := int64(memStats.Alloc)
-	rm.MemoryUsedBytes = memoryAfter - rm.MemoryUsedBytes
+// changedConfigKeys returns the yaml keys of the top-level Config fields that differ between a and b
+func changedConfigKeys(a, b Config) []string {
+	var changed []string
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	for i := 0; i < va.NumField(); i++ {
+		if va.Field(i).Interface() != vb.Field(i).Interface() {
+			changed = append(changed, va.Type().Field(i).Tag.Get("yaml"))
+		}
+	}
+	return changed
+}
 
-	// CPU usage calculation is not implemented with actual CPU time measurement
-	// Set to sentinel value to indicate unavailable/inaccurate measurement
-	rm.CPUUsagePercent = -1.0
+// apiServer carries the configuration shared by the HTTP handlers.
+type apiServer struct {
+	config          atomic.Pointer[Config]
+	metrics         *prometheusMetrics
+	metricsDisabled bool
+	compactJSON     bool
+	inFlight        atomic.Int64
+	ready           atomic.Bool
+	holds           *memoryHoldRegistry
+	stats           *statsAggregator
+	statsd          *statsdClient
+	tracer          trace.Tracer
+	expvars         *expvarMetrics
+	logger          *slog.Logger
+	gcEndpoint      bool
+	pprofEndpoints  bool
+	diskEndpoints   bool
+	adminEndpoints  bool
+	tmpDir          string
+	diskReadFile    *diskReadFile
+	fetchAllowlist  []string
+	fetchClient     *http.Client
+	loadSlots       chan struct{}
+	queueTimeout    time.Duration
+	rateLimiter     atomic.Pointer[rateLimiter]
+	routes          gin.RoutesInfo
+	authToken       string
+	corsOrigins     []string
+	enabledRoutes   map[string]bool
+	faultRand       *randSource
+	delay           string
+	startTime       time.Time
+	triggerShutdown func(reason string)
+	ballast         atomic.Pointer[[]byte]
 }
 
-// MemoryResult holds the result of memory allocation including timing
-type MemoryResult struct {
-	SizeKB         int     `json:"size_kb"`
-	RequestedRange string  `json:"requested_range,omitempty"`
-	DurationUs     int64   `json:"duration_us"`
-	DurationMs     float64 `json:"duration_ms"`
+// newAPIServer creates an apiServer using the given limits and otherwise default settings
+func newAPIServer(limits loadLimits) *apiServer {
+	s := &apiServer{
+		metrics:   newPrometheusMetrics(),
+		holds:     newMemoryHoldRegistry(),
+		stats:     newStatsAggregator(),
+		logger:    slog.New(slog.DiscardHandler),
+		startTime: time.Now(),
+		// Fault injection has its own source so it never perturbs a seeded loadRand sequence
+		faultRand: newRandSource(),
+	}
+	config := defaultConfig()
+	config.Limits = limits
+	s.setConfig(config)
+	s.fetchClient = &http.Client{
+		Timeout: FetchTimeout,
+		// Redirects are checked against the allowlist too, or an allowed host could bounce us anywhere
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return s.checkFetchURL(req.URL)
+		},
+	}
+	return s
 }
 
-// allocateMemory creates a byte slice of size mb and ensures allocation.
-// Accepts either a single value (e.g., "1024") or a range (e.g., "500..2000")
-func allocateMemory(param string) (MemoryResult, error) {
-	start := time.Now()
-	var err error
+// limits returns the input limits in effect, which a SIGHUP reload may change between calls
+func (s *apiServer) limits() loadLimits {
+	return s.config.Load().Limits
+}
+
+// setConfig replaces the settings handlers read (limits, rate limit, and error injection) with
+// config's. Buckets restart full when the rate limit changes.
+func (s *apiServer) setConfig(config Config) {
+	if current := s.config.Load(); current == nil || current.RateLimit != config.RateLimit {
+		s.rateLimiter.Store(config.RateLimit.limiter())
+	}
+	s.config.Store(&config)
+}
 
-	k, wasRange, err := parseIntOrRange(param, MaxMemoryKB, "memory")
+// reloadConfig re-reads the config file at path, applies the env and flag overrides as at startup,
+// and swaps in the reloadable settings. Changes to any other key are logged and ignored until
+// restart. An invalid file leaves the running config untouched.
+func (s *apiServer) reloadConfig(path string, flags *flag.FlagSet) error {
+	next, err := loadConfig(path)
 	if err != nil {
-		return MemoryResult{}, err
+		return err
+	}
+	next.applyEnv()
+	next.applyFlags(flags)
+
+	merged := *s.config.Load()
+	var ignored []string
+	for _, key := range changedConfigKeys(merged, next) {
+		if !reloadableConfigKeys[key] {
+			ignored = append(ignored, key)
+		}
+	}
+	if len(ignored) > 0 {
+		log.Printf("warning: config reload ignores %s; restart to apply", strings.Join(ignored, ", "))
 	}
+	merged.Limits = next.Limits
+	merged.RateLimit = next.RateLimit
+	merged.ErrorRate = next.ErrorRate
+	merged.ErrorStatus = next.ErrorStatus
+	s.setConfig(merged)
+	return nil
+}
+
+// RequestMetrics holds request-level performance metrics.
+// MemoryUsedBytes is the TotalAlloc delta: cumulative bytes allocated while handling the request.
+// It is monotonic, so it never goes negative when a GC frees memory mid-request, but it is not a
+// measure of live heap growth (memory that was allocated and already freed still counts).
+// ServerTimeUs and UptimeUs are taken when the metrics finish, just before the response is written,
+// so clients can compare the server's clock with their own.
+type RequestMetrics struct {
+	StartTime        time.Time               `json:"-"`
+	EndTime          time.Time               `json:"-"`
+	ServerStartTime  time.Time               `json:"-"`
+	StartCPUTime     int64                   `json:"-"`
+	StartTotalAlloc  uint64                  `json:"-"`
+	StartNumGC       uint32                  `json:"-"`
+	StartGCPauseNs   uint64                  `json:"-"`
+	DurationUs       int64                   `json:"duration_us"`
+	DurationMs       float64                 `json:"duration_ms"`
+	CPUUsagePercent  float64                 `json:"cpu_usage_percent"`
+	MemoryUsedBytes  int64                   `json:"memory_used_bytes"`
+	GCCycles         uint32                  `json:"gc_cycles"`
+	GCPauseUs        int64                   `json:"gc_pause_us"`
+	GoroutinesBefore int                     `json:"goroutines_before"`
+	GoroutinesAfter  int                     `json:"goroutines_after"`
+	ServerTimeUs     int64                   `json:"server_time_us"`
+	UptimeUs         int64                   `json:"uptime_us"`
+	Stages           map[string]StageMetrics `json:"stages,omitempty"`
+}
+
+// StageMetrics attributes part of a combined request's load to one sub-operation.
+// MemoryAllocatedBytes is the TotalAlloc delta, so it counts every byte the stage allocated
+// and never goes negative when a GC runs mid-stage.
+type StageMetrics struct {
+	DurationUs           int64   `json:"duration_us"`
+	DurationMs           float64 `json:"duration_ms"`
+	MemoryAllocatedBytes uint64  `json:"memory_allocated_bytes"`
+	GoroutineDelta       int     `json:"goroutine_delta"`
+}
 
+// stage runs one sub-operation of a combined request, recording its metrics under name and,
+// when the request is traced, a child span of the request span in ctx; an untraced ctx yields a
+// no-op span. With metrics disabled (nil receiver) it records only the span. fn's error is
+// returned unchanged.
+func (rm *RequestMetrics) stage(ctx context.Context, name string, fn func() error) (err error) {
+	_, span := trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName).Start(ctx, name,
+		trace.WithAttributes(attribute.String("apex.stage", name)))
 	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("memory allocation failed: %v", r)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
 		}
+		span.End()
 	}()
 
-	bytes := make([]byte, k*1024)
-	// Touch memory to ensure allocation
-	for i := 0; i < len(bytes); i += PageSize {
-		bytes[i] = 1
+	if rm == nil {
+		return fn()
 	}
-	// Memory will be freed naturally by GC
 
-	duration := time.Since(start)
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	allocBefore := memStats.TotalAlloc
+	goroutinesBefore := runtime.NumGoroutine()
+	start := time.Now()
 
-	memoryResult := MemoryResult{
-		SizeKB:     k,
-		DurationUs: duration.Nanoseconds() / 1000,
-		DurationMs: float64(duration.Nanoseconds()) / 1000000.0,
+	err = fn()
+
+	duration := time.Since(start)
+	runtime.ReadMemStats(&memStats)
+	if rm.Stages == nil {
+		rm.Stages = make(map[string]StageMetrics)
 	}
+	rm.Stages[name] = StageMetrics{
+		DurationUs:           duration.Nanoseconds() / 1000,
+		DurationMs:           float64(duration.Nanoseconds()) / 1000000.0,
+		MemoryAllocatedBytes: memStats.TotalAlloc - allocBefore,
+		GoroutineDelta:       runtime.NumGoroutine() - goroutinesBefore,
+	}
+	return err
+}
 
-	// Only include requested_range if it was a range
-	if wasRange {
-		memoryResult.RequestedRange = param
+// randSource hands out *rand.Rand instances for load generation. By default each caller borrows a
+// source from a sync.Pool of independently seeded instances, so concurrent handlers never contend
+// on a shared lock. After Seed it switches to one mutex-guarded source, trading that contention
+// for a reproducible sequence (concurrent requests can't be reproducible in any case).
+type randSource struct {
+	pool         sync.Pool
+	reproducible atomic.Bool
+	mu           sync.Mutex
+	seeded       *rand.Rand
+}
+
+// newRandSource creates a pooled source; pool instances are seeded from the auto-seeded global source
+func newRandSource() *randSource {
+	s := &randSource{}
+	s.pool.New = func() interface{} {
+		return rand.New(rand.NewSource(rand.Int63()))
 	}
+	return s
+}
 
-	return memoryResult, err
+// Seed switches to a single source that replays the sequence for seed
+func (s *randSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seeded = rand.New(rand.NewSource(seed))
+	s.reproducible.Store(true)
 }
 
-// getMemory handles GET requests to allocate memory of m kilobytes or a random size within a range.
-func getMemory(c *gin.Context) {
-	metrics := startRequestMetrics()
+// unseed switches back to pooled, independently seeded sources
+func (s *randSource) unseed() {
+	s.reproducible.Store(false)
+}
 
-	m := c.Param("m")
-	result, err := allocateMemory(m)
-	if err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("m: %v", err)})
+// with runs fn with exclusive use of a source, so bulk generation borrows (or locks) once
+func (s *randSource) with(fn func(r *rand.Rand)) {
+	if s.reproducible.Load() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		fn(s.seeded)
 		return
 	}
-	metrics.finish()
-	c.IndentedJSON(http.StatusOK, gin.H{
-		"data":            result,
-		"request_metrics": metrics,
+
+	r := s.pool.Get().(*rand.Rand)
+	defer s.pool.Put(r)
+	fn(r)
+}
+
+// Intn returns a random int in [0, n)
+func (s *randSource) Intn(n int) int {
+	var value int
+	s.with(func(r *rand.Rand) {
+		value = r.Intn(n)
 	})
+	return value
 }
 
-// FibonacciResult holds the result of Fibonacci calculation including timing
-type FibonacciResult struct {
-	N              int     `json:"n"`
-	RequestedRange string  `json:"requested_range,omitempty"`
-	Result         int     `json:"result"`
-	DurationUs     int64   `json:"duration_us"`
-	DurationMs     float64 `json:"duration_ms"`
+// Float64 returns a random float64 in [0.0, 1.0)
+func (s *randSource) Float64() float64 {
+	var value float64
+	s.with(func(r *rand.Rand) {
+		value = r.Float64()
+	})
+	return value
 }
 
-// fibonacci calculates the nth Fibonacci number.
-// Accepts either a single value (e.g., "30") or a range (e.g., "25..35")
-//
-// Deprecated: fibonacci is deprecated. Use generatePrimes for more predictable CPU load testing.
-func fibonacci(param string) (FibonacciResult, error) {
-	start := time.Now()
+// loadRand drives every random choice the load operations make (range selection, hex, query rows,
+// compressible text). main seeds it from -seed / APEX_RAND_SEED for reproducible runs.
+var loadRand = newRandSource()
 
-	n, wasRange, err := parseIntOrRange(param, MaxFibonacci, "fibonacci")
+// parseSeed parses a seed from the -seed flag or APEX_RAND_SEED. It reports false for an empty
+// value, and for an invalid one after logging a warning, meaning pooled random seeding is kept.
+func parseSeed(value string) (int64, bool) {
+	if value == "" {
+		return 0, false
+	}
+	seed, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
 	if err != nil {
-		return FibonacciResult{}, err
+		log.Printf("warning: ignoring invalid seed %q, using random seeding", value)
+		return 0, false
 	}
+	return seed, true
+}
 
-	var result int
-	if n <= 1 {
-		result = n
-	} else {
-		result = fibonacciRecursive(n)
-	}
+// sizeSuffixKB maps the size suffixes accepted by parseSizeKBOrRange to their size in KB (binary units)
+var sizeSuffixKB = []struct {
+	suffix string
+	kb     int
+}{
+	{"KB", 1},
+	{"MB", 1024},
+	{"GB", 1024 * 1024},
+}
 
-	duration := time.Since(start)
+// sizeToKB converts one size token such as "512KB", "10MB", or "2GB" (case-insensitive) to a
+// plain KB count. Tokens without a suffix are returned unchanged, so bare integers keep meaning KB.
+func sizeToKB(token string) (string, error) {
+	token = strings.TrimSpace(token)
+	upper := strings.ToUpper(token)
+	for _, unit := range sizeSuffixKB {
+		number, ok := strings.CutSuffix(upper, unit.suffix)
+		if !ok {
+			continue
+		}
+		value, err := strconv.Atoi(strings.TrimSpace(number))
+		if err != nil {
+			return "", errorWithCode(CodeInvalidNumber, "invalid size %q", token)
+		}
+		if value < 0 || value > math.MaxInt/unit.kb {
+			return "", errorWithCode(CodeOutOfRange, "size %q out of range", token)
+		}
+		return strconv.Itoa(value * unit.kb), nil
+	}
+	return token, nil
+}
 
-	fibResult := FibonacciResult{
-		N:          n,
-		Result:     result,
-		DurationUs: duration.Nanoseconds() / 1000,
-		DurationMs: float64(duration.Nanoseconds()) / 1000000.0,
+// parseSizeKBOrRange is parseIntOrRange for sizes in KB: every value in a single value, range, or
+// list may carry a KB, MB, or GB suffix (e.g. "10MB", "100MB..1GB"), and the converted KB count
+// must still be within maxKB.
+func parseSizeKBOrRange(ctx context.Context, param string, maxKB int, paramName string) (int, bool, error) {
+	separator := ".."
+	if strings.Contains(param, ",") {
+		separator = ","
+	}
+	parts := strings.Split(param, separator)
+	for i, part := range parts {
+		kb, err := sizeToKB(part)
+		if err != nil {
+			return 0, false, err
+		}
+		parts[i] = kb
 	}
+	return parseIntOrRange(ctx, strings.Join(parts, separator), maxKB, paramName)
+}
 
-	// Only include requested_range if it was a range
-	if wasRange {
-		fibResult.RequestedRange = param
+// rangeDist is how a value is picked from a min..max range, chosen per request with ?dist=
+type rangeDist string
+
+const (
+	DistUniform     rangeDist = "uniform" // every value equally likely (the default)
+	DistExponential rangeDist = "exp"     // biased toward min, as in traffic where small requests dominate
+	DistNormal      rangeDist = "normal"  // clustered around the midpoint
+)
+
+// ExpDistRate is the rate of the exponential distribution over a range scaled to [0, 1). At 4 the
+// mean lands about 23% of the way from min to max, and max is 55 times less likely than min.
+const ExpDistRate = 4.0
+
+// rangeDistKey is the request context key holding the ?dist= distribution
+type rangeDistKey struct{}
+
+// parseRangeDist parses a ?dist= value
+func parseRangeDist(raw string) (rangeDist, error) {
+	switch dist := rangeDist(raw); dist {
+	case DistUniform, DistExponential, DistNormal:
+		return dist, nil
 	}
+	return "", errorWithCode(CodeUnsupportedValue, "unsupported distribution %q, use uniform, exp, or normal", raw)
+}
 
-	return fibResult, nil
+// rangeDistFrom returns the distribution stored in ctx by rangeDistribution, or DistUniform
+func rangeDistFrom(ctx context.Context) rangeDist {
+	if dist, ok := ctx.Value(rangeDistKey{}).(rangeDist); ok {
+		return dist
+	}
+	return DistUniform
 }
 
-// fibonacciRecursive is the actual recursive implementation
-func fibonacciRecursive(n int) int {
+// pick draws an index in [0, n) from loadRand, shaped by d
+func (d rangeDist) pick(n int) int {
 	if n <= 1 {
-		return n
+		return 0
 	}
-	return fibonacciRecursive(n-1) + fibonacciRecursive(n-2)
+	var x float64
+	switch d {
+	case DistExponential:
+		// Inverse CDF of the exponential truncated to [0, 1)
+		x = -math.Log(1-loadRand.Float64()*(1-math.Exp(-ExpDistRate))) / ExpDistRate
+	case DistNormal:
+		// The range spans the midpoint ±3 standard deviations; the 0.3% of draws outside are redrawn
+		loadRand.with(func(r *rand.Rand) {
+			for x = -1; x < 0 || x >= 1; {
+				x = 0.5 + r.NormFloat64()/6
+			}
+		})
+	default:
+		return loadRand.Intn(n)
+	}
+	return min(int(x*float64(n)), n-1)
 }
 
-// PrimeResult holds the result of prime generation including timing
-type PrimeResult struct {
-	Count          int     `json:"count"`
-	RequestedRange string  `json:"requested_range,omitempty"`
-	LastPrime      int     `json:"last_prime"`
-	DurationUs     int64   `json:"duration_us"`
-	DurationMs     float64 `json:"duration_ms"`
+// rangeDistribution stores the ?dist= distribution in the request context for parseIntOrRange,
+// rejecting unknown names with a 400. Without ?dist=, ranges stay uniform.
+func (s *apiServer) rangeDistribution() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw, ok := c.GetQuery("dist")
+		if !ok || !isLoadRoute(c) {
+			c.Next()
+			return
+		}
+
+		dist, err := parseRangeDist(raw)
+		if err != nil {
+			respondParamError(c, "dist", "uniform, exp, normal", err)
+			c.Abort()
+			return
+		}
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), rangeDistKey{}, dist))
+		c.Next()
+	}
 }
 
-// generatePrimes generates the first n prime numbers and returns timing information.
-// Accepts either a single value (e.g., "100") or a range (e.g., "100..1000")
-func generatePrimes(param string) (PrimeResult, error) {
-	start := time.Now()
+// rangeClamp records whether parseIntOrRange had to cap a value for a request sent with ?clamp=1
+type rangeClamp struct {
+	clamped atomic.Bool
+}
 
-	n, wasRange, err := parseIntOrRange(param, MaxPrimes, "primes")
-	if err != nil {
-		return PrimeResult{}, err
+// rangeClampKey is the request context key holding the request's *rangeClamp
+type rangeClampKey struct{}
+
+// rangeClampFrom returns the rangeClamp stored in ctx by clampRanges, or nil when clamping is off
+func rangeClampFrom(ctx context.Context) *rangeClamp {
+	clamp, _ := ctx.Value(rangeClampKey{}).(*rangeClamp)
+	return clamp
+}
+
+// clamp caps value at maxValue and records that it did; with clamping off (nil rc) it returns
+// value unchanged for the usual out_of_range check
+func (rc *rangeClamp) clamp(value, maxValue int) int {
+	if rc == nil || value <= maxValue {
+		return value
 	}
+	rc.clamped.Store(true)
+	return maxValue
+}
 
-	if n <= 0 {
-		duration := time.Since(start)
-		result := PrimeResult{
-			Count:      0,
-			LastPrime:  0,
-			DurationUs: duration.Nanoseconds() / 1000,
-			DurationMs: float64(duration.Nanoseconds()) / 1000000.0,
+// pinnedKey is the gin context key set when pinnable locked the request to its OS thread
+const pinnedKey = "pinned"
+
+// pinnable wraps a CPU-bound handler so that with ?pin=1 (any strconv.ParseBool true value) it runs
+// locked to its OS thread via runtime.LockOSThread, so the scheduler can't move the computation
+// between threads mid-measurement. Only the handler's goroutine is pinned, so handlers that hand
+// work to other goroutines must check pinnedKey and refuse, as /primes does for ?parallel=.
+func pinnable(handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw, ok := c.GetQuery("pin")
+		if !ok {
+			handler(c)
+			return
 		}
-		if wasRange {
-			result.RequestedRange = param
+
+		pin, err := strconv.ParseBool(raw)
+		if err != nil {
+			respondParamError(c, "pin", "0,1", errorWithCode(CodeInvalidParameter, "invalid boolean %q", raw))
+			return
+		}
+		if pin {
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+			c.Set(pinnedKey, true)
 		}
-		return result, nil
+		handler(c)
 	}
+}
 
-	if n == 1 {
-		duration := time.Since(start)
-		result := PrimeResult{
-			Count:      1,
-			LastPrime:  2,
-			DurationUs: duration.Nanoseconds() / 1000,
-			DurationMs: float64(duration.Nanoseconds()) / 1000000.0,
+// clampRanges stores a rangeClamp in the request context when ?clamp=1 (any strconv.ParseBool true
+// value) is given on a load route, so values above a limit are capped instead of rejected. Negative
+// and malformed values are still errors.
+func (s *apiServer) clampRanges() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw, ok := c.GetQuery("clamp")
+		if !ok || !isLoadRoute(c) {
+			c.Next()
+			return
 		}
-		if wasRange {
-			result.RequestedRange = param
+
+		clamp, err := strconv.ParseBool(raw)
+		if err != nil {
+			respondParamError(c, "clamp", "0,1", errorWithCode(CodeInvalidParameter, "invalid boolean %q", raw))
+			c.Abort()
+			return
 		}
-		return result, nil
+		if clamp {
+			c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), rangeClampKey{}, &rangeClamp{}))
+		}
+		c.Next()
 	}
+}
 
-	// Keep track of primes found so far for trial division, but only store what we need
-	primes := []int{2}
-	lastPrime := 2
-	count := 1
-
-	for candidate := 3; count < n; candidate += 2 {
-		isPrime := true
-		for _, prime := range primes {
-			if prime*prime > candidate {
-				break
+// parseIntOrRange parses a parameter that can be either a single integer, a range (min..max),
+// a stepped range (min..max..step, picking a random value from min, min+step, ..., max),
+// or a list (a,b,c, picking one of the listed values at random).
+// Range values are drawn with the ?dist= distribution in ctx; list picks are always uniform.
+// With ?clamp=1 (a rangeClamp in ctx), values above maxValue are capped rather than rejected.
+// Returns the parsed value and whether it was a range or list.
+func parseIntOrRange(ctx context.Context, param string, maxValue int, paramName string) (int, bool, error) {
+	if strings.Contains(param, ",") {
+		items := strings.Split(param, ",")
+		values := make([]int, len(items))
+		for i, item := range items {
+			value, err := strconv.Atoi(strings.TrimSpace(item))
+			if err != nil {
+				return 0, false, errorWithCode(CodeInvalidNumber, "invalid list value %q: %v", item, err)
 			}
-			if candidate%prime == 0 {
-				isPrime = false
-				break
+			value = rangeClampFrom(ctx).clamp(value, maxValue)
+			if value < 0 || value > maxValue {
+				return 0, false, errorWithCode(CodeOutOfRange, "list value %d out of range (0-%d)", value, maxValue)
 			}
+			values[i] = value
 		}
-		if isPrime {
-			primes = append(primes, candidate)
-			lastPrime = candidate
-			count++
+		return values[loadRand.Intn(len(values))], true, nil
+	}
+
+	// Parse the parameter (single value or range)
+	if strings.Contains(param, "..") {
+		parts := strings.Split(param, "..")
+		if len(parts) != 2 && len(parts) != 3 {
+			return 0, false, errorWithCode(CodeInvalidRange, "invalid range format, use min..max or min..max..step")
+		}
+
+		min, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+		if err != nil {
+			return 0, false, errorWithCode(CodeInvalidNumber, "invalid minimum value: %v", err)
+		}
+
+		max, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return 0, false, errorWithCode(CodeInvalidNumber, "invalid maximum value: %v", err)
+		}
+
+		if min < 0 || max < 0 {
+			return 0, false, errorWithCode(CodeOutOfRange, "values must be non-negative")
+		}
+
+		if min > max {
+			return 0, false, errorWithCode(CodeInvalidRange, "minimum value cannot be greater than maximum")
+		}
+
+		step := 1
+		if len(parts) == 3 {
+			step, err = strconv.Atoi(strings.TrimSpace(parts[2]))
+			if err != nil {
+				return 0, false, errorWithCode(CodeInvalidNumber, "invalid step value: %v", err)
+			}
+			if step <= 0 {
+				return 0, false, errorWithCode(CodeInvalidRange, "step must be greater than zero")
+			}
+			span := max - min
+			if step > span {
+				return 0, false, errorWithCode(CodeInvalidRange, "step %d is larger than the range span %d", step, span)
+			}
+			if span%step != 0 {
+				return 0, false, errorWithCode(CodeInvalidRange, "step %d does not evenly divide the range span %d", step, span)
+			}
+		}
+
+		// With ?clamp=1 the range is cut back to the steps at or below maxValue, or to maxValue
+		// alone when it starts above it
+		if clamp := rangeClampFrom(ctx); clamp != nil && max > maxValue {
+			clamp.clamped.Store(true)
+			if min > maxValue {
+				min, max = maxValue, maxValue
+			} else {
+				max = min + (maxValue-min)/step*step
+			}
 		}
+
+		if min > maxValue || max > maxValue {
+			return 0, false, errorWithCode(CodeOutOfRange, "values must be within range (0-%d)", maxValue)
+		}
+
+		actualValue := min + step*rangeDistFrom(ctx).pick((max-min)/step+1)
+		return actualValue, true, nil
+	} else {
+		// Single value
+		value, err := strconv.Atoi(param)
+		if err != nil {
+			return 0, false, errorWithCode(CodeInvalidNumber, "invalid number: %v", err)
+		}
+		value = rangeClampFrom(ctx).clamp(value, maxValue)
+
+		if value < 0 || value > maxValue {
+			return 0, false, errorWithCode(CodeOutOfRange, "number out of range (0-%d)", maxValue)
+		}
+
+		return value, false, nil
 	}
+}
 
-	duration := time.Since(start)
-	result := PrimeResult{
-		Count:      count,
-		LastPrime:  lastPrime,
-		DurationUs: duration.Nanoseconds() / 1000,
-		DurationMs: float64(duration.Nanoseconds()) / 1000000.0,
+// Error codes reported in ErrorDetail.Code. They are part of the API: clients branch on them,
+// so existing values must not change meaning.
+const (
+	CodeInvalidNumber      = "invalid_number"    // not an integer where one was expected
+	CodeInvalidDuration    = "invalid_duration"  // not a Go duration where one was expected
+	CodeInvalidRange       = "invalid_range"     // malformed min..max[..step] range
+	CodeOutOfRange         = "out_of_range"      // a well-formed value outside the limit
+	CodeUnsupportedValue   = "unsupported_value" // not one of the accepted names (algo, mode, op, ...)
+	CodeInvalidParameter   = "invalid_parameter" // any other rejected input
+	CodeAllocationFailed   = "allocation_failed"
+	CodeTimeout            = "timeout"
+	CodeNotAllowed         = "not_allowed"
+	CodeUnauthorized       = "unauthorized"
+	CodeUpstreamError      = "upstream_error"
+	CodeDiskIO             = "disk_io"
+	CodeConcurrencyLimit   = "concurrency_limit"
+	CodeRateLimited        = "rate_limited"
+	CodeInternal           = "internal"
+	CodeInjectedFault      = "injected_fault"
+	CodeInsufficientMemory = "insufficient_memory" // an allocation larger than the system can spare (507)
+	CodeBodyTooLarge       = "body_too_large"      // a request body over its limit (413)
+)
+
+// codedError attaches an ErrorDetail code to an error
+type codedError struct {
+	code string
+	err  error
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+func (e *codedError) Unwrap() error { return e.err }
+
+// errorWithCode formats an error carrying the given ErrorDetail code. %w verbs wrap as in fmt.Errorf.
+func errorWithCode(code string, format string, args ...interface{}) error {
+	return &codedError{code: code, err: fmt.Errorf(format, args...)}
+}
+
+// errorCode returns the code for err: the innermost code attached with errorWithCode,
+// CodeTimeout for an expired context, and CodeInvalidParameter otherwise
+func errorCode(err error) string {
+	var coded *codedError
+	if errors.As(err, &coded) {
+		return coded.code
 	}
-	if wasRange {
-		result.RequestedRange = param
+	if errors.Is(err, context.DeadlineExceeded) {
+		return CodeTimeout
 	}
-	return result, nil
+	return CodeInvalidParameter
 }
 
-// getFibonacci handles GET requests to calculate the nth Fibonacci number or a random position within a range.
-//
-// Deprecated: getFibonacci is deprecated. Use getPrimes for more predictable CPU load testing.
-func getFibonacci(c *gin.Context) {
-	metrics := startRequestMetrics()
+// ErrorDetail describes a failed request. Param names the rejected parameter, if any; Limit is the
+// effective limit it was checked against; Timeout and Partial are set when ?timeout= expired.
+type ErrorDetail struct {
+	Param   string      `json:"param,omitempty"`
+	Message string      `json:"message"`
+	Code    string      `json:"code"`
+	Limit   string      `json:"limit,omitempty"`
+	Timeout string      `json:"timeout,omitempty"`
+	Partial interface{} `json:"partial,omitempty"`
+}
 
-	f := c.Param("f")
-	result, err := fibonacci(f)
-	if err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("f: %v", err)})
-		return
+// ErrorResponse is the envelope for every error response
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+// writeError writes detail in the ErrorResponse envelope and aborts the handler chain
+func writeError(c *gin.Context, status int, detail ErrorDetail) {
+	writeNegotiated(c, status, ErrorResponse{Error: detail})
+	c.Abort()
+}
+
+// abortWithError writes err as an ErrorResponse with the given status. param may be empty for
+// errors that aren't about one parameter.
+func abortWithError(c *gin.Context, status int, param string, err error) {
+	writeError(c, status, ErrorDetail{Param: param, Message: err.Error(), Code: errorCode(err)})
+}
+
+// respondParamError writes a 400 response for a parameter that failed validation,
+// including the parameter name and the effective limit it was checked against. A size the
+// system can't spare right now (CodeInsufficientMemory) is a 507 instead: the request was valid.
+// The limit is always reported as a string (see formatLimit) so clients see one type for every parameter.
+func respondParamError(c *gin.Context, param string, limit interface{}, err error) {
+	status := http.StatusBadRequest
+	switch errorCode(err) {
+	case CodeInsufficientMemory:
+		status = http.StatusInsufficientStorage
+	case CodeBodyTooLarge:
+		status = http.StatusRequestEntityTooLarge
 	}
-	metrics.finish()
-	c.IndentedJSON(http.StatusOK, gin.H{
-		"data":            result,
-		"request_metrics": metrics,
+	writeError(c, status, ErrorDetail{
+		Param:   param,
+		Message: err.Error(),
+		Code:    errorCode(err),
+		Limit:   formatLimit(limit),
 	})
 }
 
-// getPrimes handles GET requests to generate the first n prime numbers or a random count within a range.
-func getPrimes(c *gin.Context) {
-	metrics := startRequestMetrics()
+// StatusClientClosedRequest is the non-standard status (from nginx) recorded when the client
+// disconnected before the operation finished. Nobody reads the response; it exists so logs,
+// /stats, and /metrics can tell abandoned requests apart from timeouts.
+const StatusClientClosedRequest = 499
 
-	p := c.Param("p")
-	result, err := generatePrimes(p)
-	if err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("p: %v", err)})
+// respondOperationError writes the error for a failed load operation. When ?timeout= expired it is
+// a 503 carrying the partial result; when the client went away it is a 499; otherwise it is a 400
+// for the parameter, as from respondParamError.
+func respondOperationError(c *gin.Context, param string, limit interface{}, partial interface{}, err error) {
+	if errors.Is(err, context.Canceled) {
+		c.AbortWithStatus(StatusClientClosedRequest)
 		return
 	}
-	metrics.finish()
-	c.IndentedJSON(http.StatusOK, gin.H{
-		"data":            result,
-		"request_metrics": metrics,
-	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		respondParamError(c, param, limit, err)
+		return
+	}
+
+	detail := ErrorDetail{
+		Param:   param,
+		Message: fmt.Sprintf("operation stopped early: %v", err),
+		Code:    CodeTimeout,
+		Partial: partial,
+	}
+	if timeout, ok := c.Get(requestTimeoutKey); ok {
+		detail.Message = fmt.Sprintf("operation exceeded the %s timeout", timeout)
+		detail.Timeout = timeout.(time.Duration).String()
+	}
+	writeError(c, http.StatusServiceUnavailable, detail)
 }
 
-// HexResult holds the result of hex string generation including timing
-type HexResult struct {
-	SizeKB         int     `json:"size_kb"`
-	RequestedRange string  `json:"requested_range,omitempty"`
-	Length         int     `json:"length"`
-	HexString      string  `json:"hex_string"`
-	DurationUs     int64   `json:"duration_us"`
-	DurationMs     float64 `json:"duration_ms"`
+// formatLimit renders a limit as a string: integers in decimal ("10000"), durations in Go
+// duration syntax ("30s"), and sets of accepted values comma-separated ("sha256,sha512").
+func formatLimit(limit interface{}) string {
+	switch v := limit.(type) {
+	case time.Duration:
+		return v.String()
+	case []string:
+		return strings.Join(v, ",")
+	default:
+		return fmt.Sprint(v)
+	}
 }
 
-// createHexString generates a hex string of specified size in kilobytes.
-// Accepts either a single value (e.g., "100") or a range (e.g., "100..500")
-func createHexString(param string) (HexResult, error) {
-	start := time.Now()
+// requestMetricsKey is the gin context key under which respond exposes the finished RequestMetrics
+// to middleware, so server-wide stats use the same durations clients see.
+const requestMetricsKey = "request_metrics"
 
-	n, wasRange, err := parseIntOrRange(param, MaxHexKB, "hex")
-	if err != nil {
-		return HexResult{}, err
-	}
+// Response is the envelope for every successful response: the operation result under data and,
+// unless metrics collection was skipped, the request_metrics block
+type Response[T any] struct {
+	Data           T               `json:"data"`
+	Clamped        bool            `json:"clamped,omitempty"`
+	RequestMetrics *RequestMetrics `json:"request_metrics,omitempty"`
+}
 
-	hexChars := "0123456789abcdef"
-	result := make([]byte, n*1024)
-	for i := range result {
-		result[i] = hexChars[rand.Intn(16)]
-	}
+// CombinedResponse is the envelope of the combined endpoints: Response plus the summed durations of
+// the sub-operations, i.e. compute time without routing, serialization, and metrics overhead
+type CombinedResponse[T any] struct {
+	Data                     T               `json:"data"`
+	TotalOperationDurationUs int64           `json:"total_operation_duration_us"`
+	TotalOperationDurationMs float64         `json:"total_operation_duration_ms"`
+	Clamped                  bool            `json:"clamped,omitempty"`
+	RequestMetrics           *RequestMetrics `json:"request_metrics,omitempty"`
+}
 
-	hexString := string(result)
-	duration := time.Since(start)
+// StatusResponse is the body of the health probes and /stats/reset
+type StatusResponse struct {
+	Status string `json:"status"`
+}
 
-	hexResult := HexResult{
-		SizeKB:     n,
-		Length:     len(hexString),
-		HexString:  hexString,
-		DurationUs: duration.Nanoseconds() / 1000,
-		DurationMs: float64(duration.Nanoseconds()) / 1000000.0,
+// respond writes a successful response envelope with the operation data and, unless
+// metrics collection was skipped (nil metrics), the request_metrics block.
+func respond[T any](c *gin.Context, data T, metrics *RequestMetrics) {
+	if metrics != nil {
+		c.Set(requestMetricsKey, metrics)
 	}
+	writeNegotiated(c, http.StatusOK, Response[T]{Data: data, Clamped: wasClamped(c), RequestMetrics: metrics})
+}
 
-	// Only include requested_range if it was a range
-	if wasRange {
-		hexResult.RequestedRange = param
+// wasClamped reports whether ?clamp=1 capped any value of this request
+func wasClamped(c *gin.Context) bool {
+	clamp := rangeClampFrom(c.Request.Context())
+	return clamp != nil && clamp.clamped.Load()
+}
+
+// respondCombined is respond for the combined endpoints, adding the total of the sub-operations'
+// own duration_us and duration_ms, which are passed in that order
+func respondCombined[T any](c *gin.Context, data T, totalUs int64, totalMs float64, metrics *RequestMetrics) {
+	if metrics != nil {
+		c.Set(requestMetricsKey, metrics)
 	}
+	writeNegotiated(c, http.StatusOK, CombinedResponse[T]{
+		Data:                     data,
+		TotalOperationDurationUs: totalUs,
+		TotalOperationDurationMs: totalMs,
+		Clamped:                  wasClamped(c),
+		RequestMetrics:           metrics,
+	})
+}
+
+// prettyJSONKey is the gin context key holding whether this request gets indented JSON
+const prettyJSONKey = "pretty_json"
+
+// chunkedJSONKey is the gin context key holding whether this request's JSON is streamed
+const chunkedJSONKey = "chunked_json"
 
-	return hexResult, nil
+// jsonStyle decides per request whether JSON is indented: ?pretty=0/1 (any strconv.ParseBool
+// value) overrides the server default from APEX_PRETTY_JSON. ?chunked=1 streams it instead of
+// sending Content-Length.
+func (s *apiServer) jsonStyle() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		pretty := !s.compactJSON
+		if value, err := strconv.ParseBool(c.Query("pretty")); err == nil {
+			pretty = value
+		}
+		c.Set(prettyJSONKey, pretty)
+		if chunked, err := strconv.ParseBool(c.Query("chunked")); err == nil && chunked {
+			c.Set(chunkedJSONKey, true)
+		}
+		c.Next()
+	}
 }
 
-// getHexString handles GET requests to generate a hex string of n kilobytes or a random size within a range.
-func getHexString(c *gin.Context) {
-	metrics := startRequestMetrics()
+// requestTimeoutKey is the gin context key holding the request's ?timeout= budget
+const requestTimeoutKey = "request_timeout"
 
-	h := c.Param("h")
-	result, err := createHexString(h)
+// parseDurationRange parses a duration ("200ms") or a range of durations ("100ms..500ms"), picking
+// a value from the range uniformly with r. Both ends are checked against maxDuration.
+func parseDurationRange(param string, maxDuration time.Duration, r *randSource) (time.Duration, error) {
+	lowParam, highParam, isRange := strings.Cut(param, "..")
+	low, err := parseDurationParam(lowParam, maxDuration)
+	if err != nil || !isRange {
+		return low, err
+	}
+	high, err := parseDurationParam(highParam, maxDuration)
 	if err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("h: %v", err)})
-		return
+		return 0, err
 	}
-	metrics.finish()
-	c.IndentedJSON(http.StatusOK, gin.H{
-		"data":            result,
-		"request_metrics": metrics,
-	})
+	if low > high {
+		return 0, errorWithCode(CodeInvalidRange, "minimum duration cannot be greater than maximum")
+	}
+	return low + time.Duration(r.Intn(int(high-low)+1)), nil
 }
 
-func getFibonacciHex(c *gin.Context) {
-	metrics := startRequestMetrics()
+// injectLatency sleeps before load requests for ?delay= (default s.delay, from APEX_DELAY), a
+// duration or a min..max range for jitter, to simulate a slow downstream. It runs after
+// requestTimeout, so the sleep counts against ?timeout= and ends early when the request context
+// does; request_metrics only covers the handler's work after it.
+func (s *apiServer) injectLatency() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isLoadRoute(c) {
+			c.Next()
+			return
+		}
+		param := c.DefaultQuery("delay", s.delay)
+		if param == "" {
+			c.Next()
+			return
+		}
 
-	f := c.Param("f")
-	h := c.Param("h")
+		delay, err := parseDurationRange(param, s.limits().Delay, s.faultRand)
+		if err != nil {
+			respondParamError(c, "delay", s.limits().Delay, err)
+			return
+		}
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-c.Request.Context().Done():
+			respondOperationError(c, "delay", s.limits().Delay, nil, c.Request.Context().Err())
+			return
+		}
+		c.Next()
+	}
+}
 
-	fResult, err := fibonacci(f)
-	if err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("f: %v", err)})
+// requestTimeout bounds the request context by ?timeout= (a Go duration up to
+// loadLimits.RequestTimeout). Compute loops check the context and stop early, and
+// respondOperationError turns the expiry into a 503 with partial progress.
+func (s *apiServer) requestTimeout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw, ok := c.GetQuery("timeout")
+		if !ok {
+			c.Next()
+			return
+		}
+
+		timeout, err := parseDurationParam(raw, s.limits().RequestTimeout)
+		if err != nil {
+			respondParamError(c, "timeout", s.limits().RequestTimeout, err)
+			c.Abort()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Set(requestTimeoutKey, timeout)
+		c.Next()
+	}
+}
+
+// writeNegotiated writes body as JSON, or as key=value lines when the client's Accept header
+// prefers text/plain. JSON remains the default for missing or */* headers. JSON is indented
+// unless jsonStyle chose compact output for this request. The body is rendered up front so
+// Content-Length can be sent; without it, net/http falls back to chunked encoding for anything
+// over its 4 KB buffer, and clients can neither preallocate nor time a known-size download.
+// ?chunked=1 opts out of that for JSON, see writeChunkedJSON.
+func writeNegotiated(c *gin.Context, status int, body interface{}) {
+	if c.NegotiateFormat(gin.MIMEJSON, gin.MIMEPlain) != gin.MIMEPlain {
+		if c.GetBool(chunkedJSONKey) {
+			writeChunkedJSON(c, status, body)
+			return
+		}
+		var data []byte
+		var err error
+		if pretty, ok := c.Get(prettyJSONKey); ok && !pretty.(bool) {
+			data, err = json.Marshal(body)
+		} else {
+			data, err = json.MarshalIndent(body, "", "    ")
+		}
+		if err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		writeWithLength(c, status, "application/json; charset=utf-8", data)
 		return
 	}
 
-	hResult, err := createHexString(h)
+	text, err := formatKeyValues(body)
 	if err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("h: %v", err)})
+		c.IndentedJSON(http.StatusInternalServerError, ErrorResponse{Error: ErrorDetail{
+			Message: fmt.Sprintf("failed to format response: %v", err),
+			Code:    CodeInternal,
+		}})
 		return
 	}
-
-	metrics.finish()
-	c.IndentedJSON(http.StatusOK, gin.H{
-		"data":            map[string]interface{}{"fibonacci_result": fResult, "hex_result": hResult},
-		"request_metrics": metrics,
-	})
+	writeWithLength(c, status, "text/plain; charset=utf-8", []byte(text))
 }
 
-// getPrimesHex handles GET requests to generate primes and hex string.
-func getPrimesHex(c *gin.Context) {
-	metrics := startRequestMetrics()
+// writeChunkedJSON encodes body straight into the response with Transfer-Encoding: chunked. The
+// headers are flushed before encoding starts, so the client sees the response begin even while a
+// large payload is still being rendered, and the encoder writes its buffer to the connection
+// instead of handing back a copy the way json.Marshal does. Once headers are out an encoding
+// error can no longer change the status; it is only recorded on the context for the logger.
+func writeChunkedJSON(c *gin.Context, status int, body interface{}) {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Status(status)
+	c.Writer.WriteHeaderNow()
+	c.Writer.Flush()
 
-	p := c.Param("p")
-	h := c.Param("h")
+	encoder := json.NewEncoder(c.Writer)
+	if pretty, ok := c.Get(prettyJSONKey); !ok || pretty.(bool) {
+		encoder.SetIndent("", "    ")
+	}
+	if err := encoder.Encode(body); err != nil {
+		_ = c.Error(err)
+	}
+}
 
-	pResult, err := generatePrimes(p)
+// writeWithLength writes a fully rendered body with an explicit Content-Length (which
+// gzipResponses drops again when it compresses)
+func writeWithLength(c *gin.Context, status int, contentType string, data []byte) {
+	c.Header("Content-Length", strconv.Itoa(len(data)))
+	c.Data(status, contentType, data)
+}
+
+// formatKeyValues renders body as one key=value pair per line for shell-friendly parsing.
+// Keys follow the JSON field names; nested objects and arrays are joined with dots
+// (e.g. prime_result.count, request_metrics.duration_us). Fields under "data" are unprefixed.
+func formatKeyValues(body interface{}) (string, error) {
+	// Round-trip through JSON so struct tags (and omitempty) define the keys
+	raw, err := json.Marshal(body)
 	if err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("p: %v", err)})
-		return
+		return "", err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var generic map[string]interface{}
+	if err := decoder.Decode(&generic); err != nil {
+		return "", err
 	}
 
-	hResult, err := createHexString(h)
-	if err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("h: %v", err)})
-		return
+	var lines []string
+	if data, ok := generic["data"]; ok {
+		lines = appendKeyValues(lines, "", data)
+		delete(generic, "data")
 	}
+	lines = appendKeyValues(lines, "", generic)
+	return strings.Join(lines, "\n") + "\n", nil
+}
 
-	metrics.finish()
-	c.IndentedJSON(http.StatusOK, gin.H{
-		"data":            map[string]interface{}{"prime_result": pResult, "hex_result": hResult},
-		"request_metrics": metrics,
-	})
+// appendKeyValues flattens value into key=value lines, visiting object keys in sorted order
+func appendKeyValues(lines []string, prefix string, value interface{}) []string {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			lines = appendKeyValues(lines, join(key), v[key])
+		}
+	case []interface{}:
+		for i, item := range v {
+			lines = appendKeyValues(lines, join(strconv.Itoa(i)), item)
+		}
+	case nil:
+		lines = append(lines, prefix+"=")
+	default:
+		lines = append(lines, fmt.Sprintf("%s=%v", prefix, v))
+	}
+	return lines
 }
 
-// create function fibonacci, hex, memory
-func fibonacciHexMemory(c *gin.Context) {
+// beginRequestMetrics starts request metrics collection, or returns nil when metrics are
+// disabled server-wide (APEX_DISABLE_METRICS) or for this request (?metrics=false).
+func (s *apiServer) beginRequestMetrics(c *gin.Context) *RequestMetrics {
+	if s.metricsDisabled {
+		return nil
+	}
+	if enabled, err := strconv.ParseBool(c.Query("metrics")); err == nil && !enabled {
+		return nil
+	}
 	metrics := startRequestMetrics()
+	metrics.ServerStartTime = s.startTime
+	return metrics
+}
 
-	f := c.Param("f")
-	h := c.Param("h")
-	m := c.Param("m")
+// startRequestMetrics initializes request metrics collection
+func startRequestMetrics() *RequestMetrics {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
 
-	fResult, err := fibonacci(f)
-	if err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("f: %v", err)})
-		return
+	return &RequestMetrics{
+		StartTime:        time.Now(),
+		StartCPUTime:     getCPUTime(),
+		GoroutinesBefore: runtime.NumGoroutine(),
+		StartTotalAlloc:  memStats.TotalAlloc,
+		StartNumGC:       memStats.NumGC,
+		StartGCPauseNs:   memStats.PauseTotalNs,
 	}
+}
 
-	hResult, err := createHexString(h)
-	if err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("h: %v", err)})
-		return
+// cpuUsagePercent converts a process CPU time delta into a percentage of the wall time
+// available across all cores, clamped to [0, 100]. Returns -1 when CPU time could not be sampled.
+// Clamping absorbs getrusage tick granularity and GC worker time, which can push the raw
+// ratio slightly past 100% on a single core.
+func cpuUsagePercent(startCPUTime, endCPUTime int64, wall time.Duration) float64 {
+	if startCPUTime < 0 || endCPUTime < 0 || wall <= 0 {
+		return -1.0
 	}
+	percent := float64(endCPUTime-startCPUTime) / float64(wall.Nanoseconds()) / float64(runtime.NumCPU()) * 100.0
+	return math.Max(0, math.Min(100, percent))
+}
 
-	mResult, err := allocateMemory(m)
-	if err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("m: %v", err)})
+// finishRequestMetrics completes request metrics collection; it is a no-op when metrics are disabled
+func (rm *RequestMetrics) finish() {
+	if rm == nil {
 		return
 	}
 
-	metrics.finish()
-	c.IndentedJSON(http.StatusOK, gin.H{
-		"data":            map[string]interface{}{"fibonacci_result": fResult, "hex_result": hResult, "memory_result": mResult},
-		"request_metrics": metrics,
-	})
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+
+	rm.EndTime = time.Now()
+	duration := rm.EndTime.Sub(rm.StartTime)
+	rm.DurationUs = duration.Nanoseconds() / 1000
+	rm.DurationMs = float64(duration.Nanoseconds()) / 1000000.0
+	rm.GoroutinesAfter = runtime.NumGoroutine()
+
+	// Wall clock for comparing with the client's; uptime uses the monotonic clock, so it is immune to
+	// clock steps. Metrics started outside a server (tests) have no start time and report 0 uptime.
+	rm.ServerTimeUs = rm.EndTime.UnixMicro()
+	if !rm.ServerStartTime.IsZero() {
+		rm.UptimeUs = rm.EndTime.Sub(rm.ServerStartTime).Microseconds()
+	}
+
+	// TotalAlloc only grows, unlike Alloc, which drops if a GC runs during the request
+	rm.MemoryUsedBytes = int64(memStats.TotalAlloc - rm.StartTotalAlloc)
+
+	// Like CPU usage, GC is process-wide: a cycle triggered by a concurrent request counts here too
+	rm.GCCycles = memStats.NumGC - rm.StartNumGC
+	rm.GCPauseUs = int64(memStats.PauseTotalNs-rm.StartGCPauseNs) / 1000
+
+	// CPU usage is process-wide, so concurrent requests contribute to each other's figure
+	rm.CPUUsagePercent = cpuUsagePercent(rm.StartCPUTime, getCPUTime(), duration)
 }
 
-// primesHexMemory handles GET requests to generate primes, hex string, and allocate memory.
-func primesHexMemory(c *gin.Context) {
-	metrics := startRequestMetrics()
+// MemoryResult holds the result of memory allocation including timing. RSSBytes is the process
+// resident set size after the allocation and RSSDeltaBytes its change across the allocation; both
+// are 0 where RSS can't be read (see readRSS), and the delta can be negative if a GC ran meanwhile.
+type MemoryResult struct {
+	SizeKB         int     `json:"size_kb"`
+	RequestedRange string  `json:"requested_range,omitempty"`
+	Chunks         int     `json:"chunks,omitempty"`
+	Touch          string  `json:"touch,omitempty"`
+	Stride         int     `json:"stride,omitempty"`
+	Fill           string  `json:"fill,omitempty"`
+	HeldFor        string  `json:"held_for,omitempty"`
+	TotalHeldBytes int64   `json:"total_held_bytes,omitempty"`
+	RSSBytes       int64   `json:"rss_bytes"`
+	RSSDeltaBytes  int64   `json:"rss_delta_bytes"`
+	DurationUs     int64   `json:"duration_us"`
+	DurationMs     float64 `json:"duration_ms"`
+}
 
-	p := c.Param("p")
-	h := c.Param("h")
-	m := c.Param("m")
+// allocateMemory creates a byte slice of size mb and ensures allocation.
+// Accepts either a single value (e.g., "1024" or "1MB") or a range (e.g., "500..2000") up to maxKB
+func allocateMemory(ctx context.Context, param string, maxKB int) (MemoryResult, error) {
+	result, _, err := allocateMemoryBuffer(ctx, param, maxKB, 0, DefaultMemoryTouch, PageSize, "", nil)
+	return result, err
+}
 
-	pResult, err := generatePrimes(p)
-	if err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("p: %v", err)})
-		return
+// DefaultMemoryTouch is the ?touch= mode used when none is given: one write every stride bytes
+const DefaultMemoryTouch = "stride"
+
+// memoryTouchModes maps the ?touch= values accepted by /memory to functions that write to a fresh
+// allocation so the OS backs it with real pages. stride writes one byte every stride bytes, which
+// at the default PageSize faults in each page once; all writes every byte, adding cache and
+// memory-bandwidth load on top; none leaves the allocation untouched, so it is mostly reserved
+// address space until something writes to it.
+var memoryTouchModes = map[string]func(chunk []byte, stride int){
+	"all": func(chunk []byte, _ int) {
+		for i := range chunk {
+			chunk[i] = 1
+		}
+	},
+	"stride": func(chunk []byte, stride int) {
+		for i := 0; i < len(chunk); i += stride {
+			chunk[i] = 1
+		}
+	},
+	"none": func([]byte, int) {},
+}
+
+// memoryFillModes maps the ?fill= values accepted by /memory to functions that write every byte of
+// a fresh allocation, replacing the ?touch= pass. zero clears the buffer, faulting in every page
+// like touch=all; random fills it from loadRand, adding generator CPU time on top of the memory
+// bandwidth; none only reserves the memory. Random fills stop early when ctx ends.
+var memoryFillModes = map[string]func(ctx context.Context, chunk []byte) error{
+	"zero": func(_ context.Context, chunk []byte) error {
+		clear(chunk)
+		return nil
+	},
+	"random": func(ctx context.Context, chunk []byte) error {
+		_, err := fillRandom(ctx, chunk)
+		return err
+	},
+	"none": func(context.Context, []byte) error { return nil },
+}
+
+// memoryFillNames returns the accepted ?fill= values in sorted order
+func memoryFillNames() []string {
+	names := make([]string, 0, len(memoryFillModes))
+	for name := range memoryFillModes {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
+}
 
-	hResult, err := createHexString(h)
-	if err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("h: %v", err)})
-		return
+// memoryTouchNames returns the accepted ?touch= values in sorted order
+func memoryTouchNames() []string {
+	names := make([]string, 0, len(memoryTouchModes))
+	for name := range memoryTouchModes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// allocateMemoryBuffer allocates and touches memory like allocateMemory, and also returns the
+// buffers so callers can keep them alive (e.g. in the hold registry) instead of leaving them to
+// the GC. With chunkKB 0 the memory is one slice; otherwise it is split into chunkKB slices (the
+// last one holding the remainder) and the result reports the chunk count. Many moderate slices
+// succeed where one huge contiguous make can fail, and are easier on the allocator. Each slice is
+// touched with the named memoryTouchModes entry; stride must be positive. A non-empty fillMode
+// names a memoryFillModes entry that writes each slice instead of the touch. A non-nil admit is
+// given the chosen size in bytes before anything is allocated and can refuse it with an error.
+func allocateMemoryBuffer(ctx context.Context, param string, maxKB int, chunkKB int, touchMode string, stride int, fillMode string, admit func(size int64) error) (MemoryResult, [][]byte, error) {
+	touch, ok := memoryTouchModes[touchMode]
+	if !ok {
+		return MemoryResult{}, nil, errorWithCode(CodeUnsupportedValue, "unsupported touch mode %q", touchMode)
+	}
+	if stride < 1 {
+		return MemoryResult{}, nil, errorWithCode(CodeOutOfRange, "stride must be positive")
+	}
+	var fill func(ctx context.Context, chunk []byte) error
+	if fillMode != "" {
+		if fill, ok = memoryFillModes[fillMode]; !ok {
+			return MemoryResult{}, nil, errorWithCode(CodeUnsupportedValue, "unsupported fill mode %q", fillMode)
+		}
 	}
 
-	mResult, err := allocateMemory(m)
+	k, wasRange, err := parseSizeKBOrRange(ctx, param, maxKB, "memory")
 	if err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("m: %v", err)})
-		return
+		return MemoryResult{}, nil, err
+	}
+	result, buffers, err := allocateKB(ctx, k, chunkKB, touch, stride, fill, admit)
+	if err != nil {
+		return MemoryResult{}, nil, err
 	}
 
-	metrics.finish()
-	c.IndentedJSON(http.StatusOK, gin.H{
-		"data":            map[string]interface{}{"prime_result": pResult, "hex_result": hResult, "memory_result": mResult},
-		"request_metrics": metrics,
-	})
+	// Only include requested_range if it was a range
+	if wasRange {
+		result.RequestedRange = param
+	}
+
+	return result, buffers, nil
 }
 
-// getIndex serves the API documentation homepage
-func getIndex(c *gin.Context) {
-	html := `<!DOCTYPE html>
-<html>
-<head>
-    <title>Apex Load Generator API</title>
-    <style>
-        body { font-family: Arial, sans-serif; margin: 40px; background-color: #f5f5f5; }
-        .container { background: white; padding: 30px; border-radius: 8px; box-shadow: 0 2px 4px rgba(0,0,0,0.1); }
-        h1 { color: #333; border-bottom: 3px solid #4CAF50; padding-bottom: 10px; }
-        h2 { color: #555; margin-top: 30px; }
-        .endpoint { background: #f9f9f9; padding: 15px; margin: 10px 0; border-radius: 5px; border-left: 4px solid #4CAF50; }
-        .method { background: #4CAF50; color: white; padding: 3px 8px; border-radius: 3px; font-weight: bold; }
-        .deprecated { border-left-color: #ff9800; }
-        .deprecated .method { background: #ff9800; }
-        .example { background: #e8f5e8; padding: 10px; margin: 8px 0; border-radius: 3px; font-family: monospace; }
-        .limits { background: #fff3cd; padding: 10px; margin: 8px 0; border-radius: 3px; border: 1px solid #ffeaa7; }
-        a { color: #4CAF50; text-decoration: none; font-weight: bold; }
-        a:hover { text-decoration: underline; }
-        .note { background: #d1ecf1; padding: 10px; margin: 8px 0; border-radius: 3px; border: 1px solid #bee5eb; }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <h1>🚀 Apex Load Generator API</h1>
-        <p>A Go-based HTTP service for creating computational load through CPU calculations, memory allocation, and hex string generation. All endpoints return JSON with both operation results and request-level performance metrics.</p>
+// allocateKB is allocateMemoryBuffer for an already parsed size of k KB and resolved touch and
+// fill functions (fill nil to touch instead)
+func allocateKB(ctx context.Context, k int, chunkKB int, touch func(chunk []byte, stride int), stride int, fill func(ctx context.Context, chunk []byte) error, admit func(size int64) error) (result MemoryResult, buffers [][]byte, err error) {
+	start := time.Now()
 
-        <div class="note">
-            <strong>📖 API Documentation:</strong>
-            <ul>
-                <li><a href="/swagger">Interactive Swagger UI</a> - Try the API directly in your browser</li>
-                <li><a href="/docs">Alternative Swagger UI</a> - Same as above, alternative URL</li>
-                <li><a href="/swagger.yaml">Raw OpenAPI Specification</a> - Download the YAML spec</li>
-            </ul>
-        </div>
+	if err := memoryGuard.check(int64(k) * 1024); err != nil {
+		return MemoryResult{}, nil, err
+	}
+	if admit != nil {
+		if err := admit(int64(k) * 1024); err != nil {
+			return MemoryResult{}, nil, err
+		}
+	}
 
-        <h2>🔢 Single Operations</h2>
+	defer func() {
+		if r := recover(); r != nil {
+			result, buffers = MemoryResult{}, nil
+			err = errorWithCode(CodeAllocationFailed, "memory allocation failed: %v", r)
+		}
+	}()
 
-        <div class="endpoint">
-            <span class="method">GET</span> <strong>/primes/{p}</strong> - Generate Prime Numbers (Recommended)
-            <div class="example">
-                Example: <a href="/primes/100">/primes/100</a> - Generate first 100 prime numbers<br>
-                Range: <a href="/primes/50..200">/primes/50..200</a> - Generate random count between 50-200 primes
-            </div>
-            <div class="limits">Limits: p = 0-10,000 or range (e.g., 50..200) | Best for predictable CPU load testing</div>
-        </div>
+	rssBefore := readRSS()
+	remainingKB := k
+	for remainingKB > 0 {
+		size := remainingKB
+		if chunkKB > 0 {
+			size = min(chunkKB, remainingKB)
+		}
+		chunk := make([]byte, size*1024)
+		if fill == nil {
+			touch(chunk, stride)
+		} else if err := fill(ctx, chunk); err != nil {
+			return MemoryResult{}, nil, err
+		}
+		buffers = append(buffers, chunk)
+		remainingKB -= size
+	}
+	// Memory will be freed naturally by GC
+	rssAfter := readRSS()
 
-        <div class="endpoint">
-            <span class="method">GET</span> <strong>/memory/{m}</strong> - Allocate Memory
-            <div class="example">
-                Example: <a href="/memory/1024">/memory/1024</a> - Allocate 1MB (1024 KB) of memory<br>
-                Range: <a href="/memory/500..2000">/memory/500..2000</a> - Allocate random size between 500KB-2MB
-            </div>
-            <div class="limits">Limits: m = 0-1,000,000 KB or range (e.g., 500..2000) | Memory is allocated then freed naturally</div>
-        </div>
+	duration := time.Since(start)
 
-        <div class="endpoint">
-            <span class="method">GET</span> <strong>/hex/{h}</strong> - Generate Hex String
-            <div class="example">
-                Example: <a href="/hex/10">/hex/10</a> - Generate 10KB of hex data<br>
-                Range: <a href="/hex/100..500">/hex/100..500</a> - Generate random size between 100-500KB
-            </div>
-            <div class="limits">Limits: h = 0-10,000 KB or range (e.g., 100..500) | Returns full hex data for bandwidth testing</div>
-        </div>
+	result = MemoryResult{
+		SizeKB:        k,
+		RSSBytes:      rssAfter,
+		RSSDeltaBytes: rssAfter - rssBefore,
+		DurationUs:    duration.Nanoseconds() / 1000,
+		DurationMs:    float64(duration.Nanoseconds()) / 1000000.0,
+	}
+	if chunkKB > 0 {
+		result.Chunks = len(buffers)
+	}
+	return result, buffers, nil
+}
 
-        <div class="endpoint deprecated">
-            <span class="method">GET</span> <strong>/fibonacci/{f}</strong> - Fibonacci Calculation (Deprecated)
-            <div class="example">
-                Example: <a href="/fibonacci/30">/fibonacci/30</a> - Calculate 30th Fibonacci number<br>
-                Range: <a href="/fibonacci/25..35">/fibonacci/25..35</a> - Calculate random position between 25-35
-            </div>
-            <div class="limits">Limits: f = 0-45 or range (e.g., 25..35) | ⚠️ Deprecated: Use /primes for predictable CPU testing</div>
-        </div>
+// parseChunkKB parses the ?chunk= size for chunked allocation: a positive KB count, optionally
+// with a KB, MB, or GB suffix, of at most maxKB
+func parseChunkKB(param string, maxKB int) (int, error) {
+	converted, err := sizeToKB(param)
+	if err != nil {
+		return 0, err
+	}
+	kb, err := strconv.Atoi(converted)
+	if err != nil {
+		return 0, errorWithCode(CodeInvalidNumber, "invalid chunk size %q", param)
+	}
+	if kb < 1 || kb > maxKB {
+		return 0, errorWithCode(CodeOutOfRange, "chunk size out of range (1-%d KB)", maxKB)
+	}
+	return kb, nil
+}
 
-        <h2>🔄 Combined Operations</h2>
+// DefaultMemoryAvailableFraction is the share of available system memory a single allocation may use
+const DefaultMemoryAvailableFraction = 0.8
 
-        <div class="endpoint">
-            <span class="method">GET</span> <strong>/primes/hex/{p}/{h}</strong> - Prime + Hex Generation
-            <div class="example">
-                Example: <a href="/primes/hex/500/50">/primes/hex/500/50</a> - 500 primes + 50KB hex<br>
-                Range: <a href="/primes/hex/100..1000/25..100">/primes/hex/100..1000/25..100</a> - Variable primes + variable hex size
-            </div>
-            <div class="limits">Limits: p = 0-10,000, h = 0-10,000 KB | Both parameters support ranges (e.g., 100..1000)</div>
-        </div>
+// memoryHeadroom rejects allocations larger than a fraction of the memory the system reports as
+// available (see readAvailableMemory), so an oversized request fails with a 507 instead of getting
+// the process OOM-killed. APEX_MAX_MEMORY_KB still applies first; where availability can't be
+// read, it is the only limit.
+type memoryHeadroom struct {
+	fraction  float64
+	available func() (int64, bool)
+}
 
-        <div class="endpoint">
-            <span class="method">GET</span> <strong>/primes/hex/memory/{p}/{h}/{m}</strong> - Full Load Test
-            <div class="example">
-                Example: <a href="/primes/hex/memory/1000/100/2048">/primes/hex/memory/1000/100/2048</a> - Complete load test<br>
-                Range: <a href="/primes/hex/memory/500..2000/50..200/1000..5000">/primes/hex/memory/500..2000/50..200/1000..5000</a> - Variable everything
-            </div>
-            <div class="limits">Limits: p = 0-10,000, h = 0-10,000 KB, m = 0-1,000,000 KB | All parameters support ranges</div>
-        </div>
+// memoryGuard is the headroom check applied to every memory allocation. Its fraction is set once
+// from APEX_MEMORY_AVAILABLE_FRACTION at startup.
+var memoryGuard = &memoryHeadroom{fraction: DefaultMemoryAvailableFraction, available: readAvailableMemory}
 
-        <div class="endpoint deprecated">
-            <span class="method">GET</span> <strong>/fibonacci/hex/{f}/{h}</strong> - Fibonacci + Hex (Deprecated)
-            <div class="example">
-                Example: <a href="/fibonacci/hex/25/50">/fibonacci/hex/25/50</a> - Fibonacci + 50KB hex<br>
-                Range: <a href="/fibonacci/hex/20..30/25..100">/fibonacci/hex/20..30/25..100</a> - Variable Fibonacci + variable hex size
-            </div>
-            <div class="limits">Limits: f = 0-45, h = 0-10,000 KB | ⚠️ Use /primes/hex instead | Both parameters support ranges</div>
-        </div>
+// check returns a CodeInsufficientMemory error when size bytes exceed the allowed share of
+// available memory. Availability is read per call because it changes with load.
+func (h *memoryHeadroom) check(size int64) error {
+	available, ok := h.available()
+	if !ok {
+		return nil
+	}
+	allowed := int64(float64(available) * h.fraction)
+	if size > allowed {
+		return errorWithCode(CodeInsufficientMemory, "allocating %d KB would exceed %g of available memory (%d KB allowed of %d KB available)",
+			size/1024, h.fraction, allowed/1024, available/1024)
+	}
+	return nil
+}
 
-        <div class="endpoint deprecated">
-            <span class="method">GET</span> <strong>/fibonacci/hex/memory/{f}/{h}/{m}</strong> - Fibonacci + Hex + Memory (Deprecated)
-            <div class="example">
-                Example: <a href="/fibonacci/hex/memory/20/50/1024">/fibonacci/hex/memory/20/50/1024</a> - All operations<br>
-                Range: <a href="/fibonacci/hex/memory/15..25/25..100/500..2000">/fibonacci/hex/memory/15..25/25..100/500..2000</a> - Variable everything
-            </div>
-            <div class="limits">Limits: f = 0-45, h = 0-10,000 KB, m = 0-1,000,000 KB | ⚠️ Use /primes/hex/memory instead | All parameters support ranges</div>
-        </div>
+// memoryHold is an allocation, in one or more chunks, kept alive until it expires
+type memoryHold struct {
+	chunks  [][]byte
+	size    int64
+	expires time.Time
+}
 
-        <h2>📊 Response Format</h2>
-        <div class="note">
-            All endpoints return JSON with:
-            <ul>
-                <li><strong>data</strong>: Operation results (timing in both microseconds and milliseconds, counts, generated content)</li>
-                <li><strong>request_metrics</strong>: Performance data (duration_us, duration_ms, cpu_usage_percent, memory_used_bytes, goroutine counts)</li>
-            </ul>
-        </div>
+// memoryHoldRegistry keeps allocations alive for a TTL so memory pressure persists across requests.
+// Expired entries are dropped by a background janitor (see run), after which the GC can reclaim them.
+type memoryHoldRegistry struct {
+	mu            sync.Mutex
+	holds         []memoryHold
+	totalBytes    int64
+	reservedBytes int64
+}
 
-        <h2>🎯 Load Testing Examples</h2>
-        <div class="example">
-            Light CPU: <a href="/primes/100">/primes/100</a><br>
-            Heavy CPU: <a href="/primes/5000">/primes/5000</a><br>
-            Variable CPU: <a href="/primes/100..1000">/primes/100..1000</a><br>
-            Memory Test: <a href="/memory/100000">/memory/100000</a><br>
-            Variable Memory: <a href="/memory/50000..200000">/memory/50000..200000</a><br>
-            Bandwidth Test: <a href="/hex/1000">/hex/1000</a><br>
-            Variable Size Test: <a href="/hex/500..2000">/hex/500..2000</a><br>
-            Combined Load: <a href="/primes/hex/memory/2000/500/50000">/primes/hex/memory/2000/500/50000</a>
-        </div>
+// newMemoryHoldRegistry creates an empty hold registry
+func newMemoryHoldRegistry() *memoryHoldRegistry {
+	return &memoryHoldRegistry{}
+}
 
-        <div class="note">
-            <strong>💡 Performance Tips:</strong>
-            <ul>
-                <li>Prime generation: Linear complexity, predictable scaling</li>
-                <li>Fibonacci: Exponential complexity, deprecated for unpredictable performance</li>
-                <li>Hex generation: Optimized for low CPU usage, good for bandwidth testing</li>
-                <li>Memory allocation: Uses page-boundary touching for realistic patterns</li>
-                <li>All timing: Microsecond and millisecond precision for accurate performance analysis</li>
-            </ul>
-        </div>
-    </div>
-</body>
-</html>`
+// hold keeps data alive for ttl and returns the total bytes now held.
+// It refuses holds that would push the total past maxBytes.
+func (r *memoryHoldRegistry) hold(data []byte, ttl time.Duration, maxBytes int64) (int64, error) {
+	size := int64(len(data))
+	if err := r.reserve(size, maxBytes); err != nil {
+		return r.heldBytes(), err
+	}
+	return r.commit([][]byte{data}, size, ttl), nil
+}
 
-	c.Header("Content-Type", "text/html; charset=utf-8")
-	c.String(200, html)
+// reserve sets aside size bytes of the maxBytes cap for an allocation that is about to be held, so
+// a hold past the cap is refused before anything is allocated. The reservation must be followed by
+// commit once the allocation is made, or cancel if it fails.
+func (r *memoryHoldRegistry) reserve(size, maxBytes int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.totalBytes+r.reservedBytes+size > maxBytes {
+		return errorWithCode(CodeOutOfRange, "holding %d more bytes would exceed the held-memory cap (%d bytes already held)", size, r.totalBytes+r.reservedBytes)
+	}
+	r.reservedBytes += size
+	return nil
 }
 
-// getSwaggerYAML serves the raw Swagger YAML specification
-func getSwaggerYAML(c *gin.Context) {
-	data, err := ioutil.ReadFile("swagger.yaml")
-	if err != nil {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "swagger.yaml not found"})
-		return
+// cancel returns a reservation of size bytes whose allocation won't be held
+func (r *memoryHoldRegistry) cancel(size int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reservedBytes -= size
+}
+
+// commit holds chunks, allocated under a reservation of size bytes, for ttl and returns the total
+// bytes now held. The chunks are held and released together.
+func (r *memoryHoldRegistry) commit(chunks [][]byte, size int64, ttl time.Duration) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.holds = append(r.holds, memoryHold{chunks: chunks, size: size, expires: time.Now().Add(ttl)})
+	r.reservedBytes -= size
+	r.totalBytes += size
+	return r.totalBytes
+}
+
+// heldBytes returns the total bytes currently held
+func (r *memoryHoldRegistry) heldBytes() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.totalBytes
+}
+
+// releaseExpired drops every hold that has expired by now and returns how many were released
+func (r *memoryHoldRegistry) releaseExpired(now time.Time) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.holds[:0]
+	released := 0
+	for _, h := range r.holds {
+		if now.Before(h.expires) {
+			kept = append(kept, h)
+			continue
+		}
+		r.totalBytes -= h.size
+		released++
 	}
-	c.Header("Content-Type", "application/x-yaml")
-	c.String(200, string(data))
+	// Clear the tail so released buffers are not reachable through the backing array
+	for i := len(kept); i < len(r.holds); i++ {
+		r.holds[i] = memoryHold{}
+	}
+	r.holds = kept
+	return released
 }
 
-// getSwaggerUI serves the Swagger UI interface
-func getSwaggerUI(c *gin.Context) {
-	html := `<!DOCTYPE html>
-<html lang="en">
-<head>
-    <meta charset="UTF-8">
-    <title>Apex Load Generator API - Swagger UI</title>
-    <link rel="stylesheet" type="text/css" href="https://unpkg.com/swagger-ui-dist@4.15.5/swagger-ui.css" />
-    <style>
-        html {
-            box-sizing: border-box;
-            overflow: -moz-scrollbars-vertical;
-            overflow-y: scroll;
-        }
-        *, *:before, *:after {
-            box-sizing: inherit;
-        }
-        body {
-            margin:0;
-            background: #fafafa;
-        }
-    </style>
-</head>
-<body>
-    <div id="swagger-ui"></div>
-    <script src="https://unpkg.com/swagger-ui-dist@4.15.5/swagger-ui-bundle.js"></script>
-    <script src="https://unpkg.com/swagger-ui-dist@4.15.5/swagger-ui-standalone-preset.js"></script>
-    <script>
-        window.onload = function() {
-            const ui = SwaggerUIBundle({
-                url: '/swagger.yaml',
-                dom_id: '#swagger-ui',
-                deepLinking: true,
-                presets: [
-                    SwaggerUIBundle.presets.apis,
-                    SwaggerUIStandalonePreset
-                ],
-                plugins: [
-                    SwaggerUIBundle.plugins.DownloadUrl
-                ],
-                layout: "StandaloneLayout",
-                validatorUrl: null
-            });
-        };
-    </script>
-</body>
-</html>`
-	c.Header("Content-Type", "text/html; charset=utf-8")
-	c.String(200, html)
+// run releases expired holds every interval until ctx is cancelled
+func (r *memoryHoldRegistry) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			r.releaseExpired(now)
+		}
+	}
 }
 
-func main() {
-	rand.Seed(time.Now().UnixNano())
-	router := gin.Default()
-	router.GET("/", getIndex)
-	router.GET("/swagger.yaml", getSwaggerYAML)
-	router.GET("/swagger", getSwaggerUI)
-	router.GET("/docs", getSwaggerUI)
-	router.GET("/fibonacci/:f", getFibonacci)
-	router.GET("/primes/:p", getPrimes)
-	router.GET("/hex/:h", getHexString)
-	router.GET("/memory/:m", getMemory)
-	router.GET("/fibonacci/hex/:f/:h", getFibonacciHex)
-	router.GET("/primes/hex/:p/:h", getPrimesHex)
-	router.GET("/fibonacci/hex/memory/:f/:h/:m", fibonacciHexMemory)
-	router.GET("/primes/hex/memory/:p/:h/:m", primesHexMemory)
-
-	router.Run(":8080")
+// GCSnapshot holds the heap statistics captured around a forced garbage collection
+type GCSnapshot struct {
+	HeapAlloc uint64 `json:"heap_alloc"`
+	HeapInuse uint64 `json:"heap_inuse"`
+	NumGC     uint32 `json:"num_gc"`
+}
+
+// GCResult holds the result of a forced garbage collection including timing
+type GCResult struct {
+	Before         GCSnapshot `json:"before"`
+	After          GCSnapshot `json:"after"`
+	ReclaimedBytes int64      `json:"reclaimed_bytes"`
+	HeldBytes      int64      `json:"held_bytes"`
+	DurationUs     int64      `json:"duration_us"`
+	DurationMs     float64    `json:"duration_ms"`
+}
+
+// readGCSnapshot captures the current heap statistics
+func readGCSnapshot() GCSnapshot {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	return GCSnapshot{
+		HeapAlloc: memStats.HeapAlloc,
+		HeapInuse: memStats.HeapInuse,
+		NumGC:     memStats.NumGC,
+	}
+}
+
+// forceGC runs a garbage collection and reports heap statistics before and after.
+func forceGC() GCResult {
+	start := time.Now()
+
+	before := readGCSnapshot()
+	runtime.GC()
+	after := readGCSnapshot()
+
+	duration := time.Since(start)
+	return GCResult{
+		Before:         before,
+		After:          after,
+		ReclaimedBytes: int64(before.HeapAlloc) - int64(after.HeapAlloc),
+		DurationUs:     duration.Nanoseconds() / 1000,
+		DurationMs:     float64(duration.Nanoseconds()) / 1000000.0,
+	}
+}
+
+// MaxProcsResult holds the outcome of changing GOMAXPROCS at runtime
+type MaxProcsResult struct {
+	Previous   int `json:"previous"`
+	GOMAXPROCS int `json:"gomaxprocs"`
+	NumCPU     int `json:"num_cpu"`
+}
+
+// parseMaxProcs parses a GOMAXPROCS value for -maxprocs or POST /admin/maxprocs/:n.
+// Values above NumCPU are allowed, to study oversubscription.
+func parseMaxProcs(param string) (int, error) {
+	n, err := strconv.Atoi(param)
+	if err != nil {
+		return 0, errorWithCode(CodeInvalidNumber, "invalid number: %v", err)
+	}
+	if n < 1 || n > MaxGOMAXPROCS {
+		return 0, errorWithCode(CodeOutOfRange, "GOMAXPROCS out of range (1-%d)", MaxGOMAXPROCS)
+	}
+	return n, nil
+}
+
+// setMaxProcs applies n with runtime.GOMAXPROCS and reports the value now in effect.
+func setMaxProcs(n int) MaxProcsResult {
+	previous := runtime.GOMAXPROCS(n)
+	return MaxProcsResult{
+		Previous:   previous,
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		NumCPU:     runtime.NumCPU(),
+	}
+}
+
+// postMaxProcs handles POST requests to change GOMAXPROCS at runtime, for measuring how throughput
+// scales with OS threads without a restart. Only registered when APEX_ENABLE_ADMIN=true.
+func (s *apiServer) postMaxProcs(c *gin.Context) {
+	n, err := parseMaxProcs(c.Param("n"))
+	if err != nil {
+		respondParamError(c, "n", fmt.Sprintf("1-%d", MaxGOMAXPROCS), err)
+		return
+	}
+	result := setMaxProcs(n)
+	s.logger.Info("GOMAXPROCS changed", "previous", result.Previous, "gomaxprocs", result.GOMAXPROCS)
+	writeNegotiated(c, http.StatusOK, Response[MaxProcsResult]{Data: result})
+}
+
+// GCPercentResult holds the outcome of changing the GC target percentage at runtime
+type GCPercentResult struct {
+	Previous int `json:"previous"`
+	GOGC     int `json:"gogc"`
+}
+
+// parseGCPercent parses a GC target percentage for APEX_GOGC or POST /admin/gogc/:pct. Like the
+// GOGC environment variable, "off" (or -1) disables the collector.
+func parseGCPercent(param string) (int, error) {
+	if param == "off" {
+		return -1, nil
+	}
+	pct, err := strconv.Atoi(param)
+	if err != nil {
+		return 0, errorWithCode(CodeInvalidNumber, "invalid number: %v", err)
+	}
+	if pct < -1 || pct > MaxGCPercent {
+		return 0, errorWithCode(CodeOutOfRange, "GOGC out of range (0-%d, or off)", MaxGCPercent)
+	}
+	return pct, nil
+}
+
+// setGCPercent applies pct with debug.SetGCPercent and, like it, reports the previous value.
+func setGCPercent(pct int) GCPercentResult {
+	previous := debug.SetGCPercent(pct)
+	return GCPercentResult{Previous: previous, GOGC: pct}
+}
+
+// currentGCPercent reads the GC target percentage without changing it (-1 when GC is off).
+// debug.SetGCPercent can only report it by setting a new value, so it comes from runtime/metrics.
+func currentGCPercent() int {
+	sample := []metrics.Sample{{Name: "/gc/gogc:percent"}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 100
+	}
+	// The runtime stores -1 (off) as an int32 and reports it converted to uint64
+	return int(int64(sample[0].Value.Uint64()))
+}
+
+// postGCPercent handles POST requests to change the GC target percentage at runtime; lower values
+// collect more often, which makes /memory tests more GC-bound. Only registered when
+// APEX_ENABLE_ADMIN=true.
+func (s *apiServer) postGCPercent(c *gin.Context) {
+	pct, err := parseGCPercent(c.Param("pct"))
+	if err != nil {
+		respondParamError(c, "pct", fmt.Sprintf("0-%d or off", MaxGCPercent), err)
+		return
+	}
+	result := setGCPercent(pct)
+	s.logger.Info("GOGC changed", "previous", result.Previous, "gogc", result.GOGC)
+	writeNegotiated(c, http.StatusOK, Response[GCPercentResult]{Data: result})
+}
+
+// BallastReleaseResult reports how much ballast POST /admin/ballast/release dropped
+type BallastReleaseResult struct {
+	ReleasedBytes int64 `json:"released_bytes"`
+}
+
+// parseBallastMB parses APEX_BALLAST_MB, the size of the startup GC ballast in megabytes
+func parseBallastMB(param string) (int, error) {
+	mb, err := strconv.Atoi(param)
+	if err != nil {
+		return 0, errorWithCode(CodeInvalidNumber, "invalid number: %v", err)
+	}
+	if mb < 0 || mb > MaxBallastMB {
+		return 0, errorWithCode(CodeOutOfRange, "ballast out of range (0-%d MB)", MaxBallastMB)
+	}
+	return mb, nil
+}
+
+// setBallast allocates an mb-megabyte ballast and keeps it alive until releaseBallast. The slice is
+// never read or written: a large allocation comes straight from fresh, already-zeroed pages, so it
+// raises the live heap (and with it the next GC target) while the OS backs almost none of it with
+// physical memory.
+func (s *apiServer) setBallast(mb int) {
+	ballast := make([]byte, mb<<20)
+	s.ballast.Store(&ballast)
+}
+
+// ballastBytes returns the size of the ballast currently held, 0 if there is none
+func (s *apiServer) ballastBytes() int64 {
+	if ballast := s.ballast.Load(); ballast != nil {
+		return int64(len(*ballast))
+	}
+	return 0
+}
+
+// releaseBallast drops the ballast, if any, and returns its size. The GC reclaims it on its next
+// cycle; like the rest of the service, this doesn't force one.
+func (s *apiServer) releaseBallast() int64 {
+	if ballast := s.ballast.Swap(nil); ballast != nil {
+		return int64(len(*ballast))
+	}
+	return 0
+}
+
+// postReleaseBallast handles POST requests to drop the APEX_BALLAST_MB ballast mid-run, to compare GC
+// frequency with and without it. Only registered when APEX_ENABLE_ADMIN=true.
+func (s *apiServer) postReleaseBallast(c *gin.Context) {
+	released := s.releaseBallast()
+	s.logger.Info("ballast released", "released_bytes", released)
+	writeNegotiated(c, http.StatusOK, Response[BallastReleaseResult]{Data: BallastReleaseResult{ReleasedBytes: released}})
+}
+
+// postShutdown handles POST requests from test harnesses to stop the server at the end of a run. It
+// answers 202 and then asks main, through s.triggerShutdown, for the same graceful shutdown as a
+// SIGTERM, which waits for this and every other in-flight request. Only registered when
+// APEX_ENABLE_ADMIN=true.
+func (s *apiServer) postShutdown(c *gin.Context) {
+	s.logger.Info("shutdown requested", "client_ip", c.ClientIP(), "request_id", c.GetString(requestIDKey))
+	writeNegotiated(c, http.StatusAccepted, StatusResponse{Status: "shutting down"})
+	s.triggerShutdown("requested via POST /admin/shutdown")
+}
+
+// getPprof serves the net/http/pprof handlers under /debug/pprof/ for profiling the generator
+// itself. Named profiles (heap, goroutine, allocs, ...) and the index are served by pprof.Index,
+// which reads the profile name from the request path. Only registered when APEX_ENABLE_PPROF=true.
+func getPprof(c *gin.Context) {
+	switch c.Param("profile") {
+	case "/cmdline":
+		pprof.Cmdline(c.Writer, c.Request)
+	case "/profile":
+		pprof.Profile(c.Writer, c.Request)
+	case "/symbol":
+		pprof.Symbol(c.Writer, c.Request)
+	case "/trace":
+		pprof.Trace(c.Writer, c.Request)
+	default:
+		pprof.Index(c.Writer, c.Request)
+	}
+}
+
+// expvarMetrics holds the generator's expvar variables. They belong to the server rather than
+// the global expvar registry, which panics on duplicate names, so tests can build many servers.
+// A nil expvarMetrics is disabled.
+type expvarMetrics struct {
+	requests  expvar.Int
+	endpoints expvar.Map
+	heldBytes expvar.Func
+}
+
+// newExpvarMetrics creates the variables, reporting held memory from holds
+func newExpvarMetrics(holds *memoryHoldRegistry) *expvarMetrics {
+	ev := &expvarMetrics{
+		heldBytes: func() interface{} { return holds.heldBytes() },
+	}
+	ev.endpoints.Init()
+	return ev
+}
+
+// middleware counts every request handled by the router, per route template
+func (ev *expvarMetrics) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if ev == nil {
+			return
+		}
+
+		path := c.FullPath()
+		if path == "" {
+			path = "unmatched"
+		}
+		ev.requests.Add(1)
+		ev.endpoints.Add(path, 1)
+	}
+}
+
+// getVars serves /debug/vars in expvar.Handler's format: the globally published variables
+// (cmdline, memstats, and any others) followed by the server's own, all sorted by name.
+// Only registered when APEX_ENABLE_EXPVAR=true.
+func (ev *expvarMetrics) getVars(c *gin.Context) {
+	vars := []expvar.KeyValue{
+		{Key: "apex_held_memory_bytes", Value: ev.heldBytes},
+		{Key: "apex_requests_by_endpoint", Value: &ev.endpoints},
+		{Key: "apex_requests_total", Value: &ev.requests},
+	}
+	expvar.Do(func(kv expvar.KeyValue) { vars = append(vars, kv) })
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Key < vars[j].Key })
+
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Status(http.StatusOK)
+	c.Writer.WriteString("{\n")
+	for i, kv := range vars {
+		if i > 0 {
+			c.Writer.WriteString(",\n")
+		}
+		fmt.Fprintf(c.Writer, "%q: %s", kv.Key, kv.Value)
+	}
+	c.Writer.WriteString("\n}\n")
+}
+
+// postGC handles POST requests to force a garbage collection. It is a debugging tool and is
+// only registered when APEX_ENABLE_GC_ENDPOINT=true.
+func (s *apiServer) postGC(c *gin.Context) {
+	metrics := s.beginRequestMetrics(c)
+
+	result := forceGC()
+	result.HeldBytes = s.holds.heldBytes()
+
+	metrics.finish()
+	respond(c, result, metrics)
+}
+
+// getMemory handles GET requests to allocate memory of m kilobytes or a random size within a range.
+// With ?hold=<duration> the allocation is kept alive server-side for that long instead of being freed.
+func (s *apiServer) getMemory(c *gin.Context) {
+	metrics := s.beginRequestMetrics(c)
+
+	var hold time.Duration
+	if holdParam := c.Query("hold"); holdParam != "" {
+		var err error
+		hold, err = parseDurationParam(holdParam, s.limits().HoldDuration)
+		if err != nil {
+			respondParamError(c, "hold", s.limits().HoldDuration, err)
+			return
+		}
+	}
+
+	var chunkKB int
+	if chunkParam := c.Query("chunk"); chunkParam != "" {
+		var err error
+		chunkKB, err = parseChunkKB(chunkParam, s.limits().MemoryKB)
+		if err != nil {
+			respondParamError(c, "chunk", s.limits().MemoryKB, err)
+			return
+		}
+	}
+
+	touchMode, touchSet := c.GetQuery("touch")
+	if !touchSet {
+		touchMode = DefaultMemoryTouch
+	} else if _, ok := memoryTouchModes[touchMode]; !ok {
+		respondParamError(c, "touch", memoryTouchNames(), errorWithCode(CodeUnsupportedValue, "unsupported touch mode %q", touchMode))
+		return
+	}
+
+	stride := PageSize
+	strideParam, strideSet := c.GetQuery("stride")
+	if strideSet {
+		maxStride := s.limits().MemoryKB * 1024
+		var err error
+		stride, err = strconv.Atoi(strideParam)
+		if err != nil {
+			respondParamError(c, "stride", maxStride, errorWithCode(CodeInvalidNumber, "invalid stride %q", strideParam))
+			return
+		}
+		if stride < 1 || stride > maxStride {
+			respondParamError(c, "stride", maxStride, errorWithCode(CodeOutOfRange, "stride out of range (1-%d bytes)", maxStride))
+			return
+		}
+		if touchMode != DefaultMemoryTouch {
+			respondParamError(c, "stride", maxStride, errorWithCode(CodeInvalidParameter, "stride only applies to touch=stride"))
+			return
+		}
+	}
+
+	fillMode := c.Query("fill")
+	if fillMode != "" {
+		if _, ok := memoryFillModes[fillMode]; !ok {
+			respondParamError(c, "fill", memoryFillNames(), errorWithCode(CodeUnsupportedValue, "unsupported fill mode %q", fillMode))
+			return
+		}
+		if touchSet || strideSet {
+			respondParamError(c, "fill", memoryFillNames(), errorWithCode(CodeInvalidParameter, "fill can't be combined with touch or stride"))
+			return
+		}
+	}
+
+	// A hold reserves its share of APEX_MAX_HELD_KB before allocating, so one past the cap is
+	// refused without doing the allocation work
+	var admit func(size int64) error
+	var reserved int64
+	var holdErr error
+	if hold > 0 {
+		admit = func(size int64) error {
+			if holdErr = s.holds.reserve(size, int64(s.limits().HeldKB)*1024); holdErr != nil {
+				return holdErr
+			}
+			reserved = size
+			return nil
+		}
+	}
+
+	m := c.Param("m")
+	result, buffers, err := allocateMemoryBuffer(c.Request.Context(), m, s.limits().MemoryKB, chunkKB, touchMode, stride, fillMode, admit)
+	if err != nil {
+		s.holds.cancel(reserved)
+		if holdErr != nil {
+			respondParamError(c, "hold", s.limits().HeldKB, holdErr)
+			return
+		}
+		respondOperationError(c, "m", s.limits().MemoryKB, nil, err)
+		return
+	}
+	result.Fill = fillMode
+	if touchSet || strideSet {
+		result.Touch = touchMode
+		if touchMode == DefaultMemoryTouch {
+			result.Stride = stride
+		}
+	}
+
+	if hold > 0 {
+		result.HeldFor = hold.String()
+		result.TotalHeldBytes = s.holds.commit(buffers, reserved, hold)
+	}
+
+	metrics.finish()
+	respond(c, result, metrics)
+}
+
+// FibonacciResult holds the result of Fibonacci calculation including timing
+type FibonacciResult struct {
+	N              int     `json:"n"`
+	RequestedRange string  `json:"requested_range,omitempty"`
+	Result         int     `json:"result"`
+	Memo           string  `json:"memo,omitempty"`
+	DurationUs     int64   `json:"duration_us"`
+	DurationMs     float64 `json:"duration_ms"`
+}
+
+// fibonacciMemo caches Fibonacci results by position across requests. It holds at most maxSize
+// positions; once full, new positions are computed but not stored.
+type fibonacciMemo struct {
+	values  sync.Map
+	size    atomic.Int64
+	maxSize int64
+}
+
+// fibonacciCache is the cache shared by every ?memo=1 request
+var fibonacciCache = &fibonacciMemo{maxSize: FibonacciMemoSize}
+
+// lookup returns the cached result for position n, if any
+func (m *fibonacciMemo) lookup(n int) (int, bool) {
+	value, ok := m.values.Load(n)
+	if !ok {
+		return 0, false
+	}
+	return value.(int), true
+}
+
+// store caches the result for position n unless the cache is full
+func (m *fibonacciMemo) store(n, result int) {
+	if m.size.Add(1) > m.maxSize {
+		m.size.Add(-1)
+		return
+	}
+	if _, loaded := m.values.LoadOrStore(n, result); loaded {
+		m.size.Add(-1)
+	}
+}
+
+// reset empties the cache
+func (m *fibonacciMemo) reset() {
+	m.values.Clear()
+	m.size.Store(0)
+}
+
+// fibonacci calculates the nth Fibonacci number.
+// With memo, the result comes from fibonacciCache when present (Memo "hit"); otherwise it is
+// computed recursively as usual and then cached (Memo "miss"), so only the first request per
+// position pays the exponential cost.
+// Accepts either a single value (e.g., "30") or a range (e.g., "25..35")
+//
+// Deprecated: fibonacci is deprecated. Use generatePrimes for more predictable CPU load testing.
+func fibonacci(ctx context.Context, param string, maxN int, memo bool) (FibonacciResult, error) {
+	start := time.Now()
+
+	n, wasRange, err := parseIntOrRange(ctx, param, maxN, "fibonacci")
+	if err != nil {
+		return FibonacciResult{}, err
+	}
+
+	var result int
+	var memoStatus string
+	var cached int
+	var hit bool
+	if memo {
+		cached, hit = fibonacciCache.lookup(n)
+	}
+	switch {
+	case hit:
+		result, memoStatus = cached, "hit"
+	case n <= 1:
+		result = n
+	default:
+		result = fibonacciRecursive(n)
+	}
+	if memo && !hit {
+		fibonacciCache.store(n, result)
+		memoStatus = "miss"
+	}
+
+	duration := time.Since(start)
+
+	fibResult := FibonacciResult{
+		N:          n,
+		Result:     result,
+		Memo:       memoStatus,
+		DurationUs: duration.Nanoseconds() / 1000,
+		DurationMs: float64(duration.Nanoseconds()) / 1000000.0,
+	}
+
+	// Only include requested_range if it was a range
+	if wasRange {
+		fibResult.RequestedRange = param
+	}
+
+	return fibResult, nil
+}
+
+// fibonacciRecursive is the actual recursive implementation
+func fibonacciRecursive(n int) int {
+	if n <= 1 {
+		return n
+	}
+	return fibonacciRecursive(n-1) + fibonacciRecursive(n-2)
+}
+
+// PrimeResult holds the result of prime generation including timing
+type PrimeResult struct {
+	Count          int         `json:"count"`
+	RequestedRange string      `json:"requested_range,omitempty"`
+	LastPrime      int         `json:"last_prime"`
+	Algorithm      string      `json:"algorithm,omitempty"`
+	Workers        int         `json:"workers,omitempty"`
+	Cache          string      `json:"cache,omitempty"`
+	Stats          *PrimeStats `json:"stats,omitempty"`
+	DurationUs     int64       `json:"duration_us"`
+	DurationMs     float64     `json:"duration_ms"`
+}
+
+// PrimeStats describes how densely the primes of a PrimeResult are spread, for /primes?stats=1.
+// Density is primes per integer scanned (count / last_prime). PNTRatio compares last_prime with the
+// prime number theorem's estimate n·ln(n) of the nth prime; it is above 1 and falls slowly toward
+// 1 as n grows, and is 0 below n = 2, where the estimate is 0.
+type PrimeStats struct {
+	Density    float64 `json:"density"`
+	PNTRatio   float64 `json:"pnt_ratio"`
+	DurationUs int64   `json:"duration_us"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// primeStats computes PrimeStats from the count and the last of the first count primes. Both come
+// from the search itself, so this is O(1).
+func primeStats(count, lastPrime int) *PrimeStats {
+	start := time.Now()
+	stats := &PrimeStats{}
+	if lastPrime > 0 {
+		stats.Density = float64(count) / float64(lastPrime)
+	}
+	if count >= 2 {
+		n := float64(count)
+		stats.PNTRatio = float64(lastPrime) / (n * math.Log(n))
+	}
+	duration := time.Since(start)
+	stats.DurationUs = duration.Nanoseconds() / 1000
+	stats.DurationMs = float64(duration.Nanoseconds()) / 1000000.0
+	return stats
+}
+
+// primeMemo caches the first primes in order across requests. It grows on demand up to maxSize
+// primes; counts beyond that are computed without the cache.
+type primeMemo struct {
+	mu      sync.RWMutex
+	primes  []int
+	maxSize int
+}
+
+// primeCache is the cache shared by every ?cache=1 request
+var primeCache = &primeMemo{maxSize: MaxPrimes}
+
+// firstN returns the count of primes available (n, unless ctx ended) and the last of them, and
+// whether they were already cached. On a miss the cache is extended under the write lock by trial
+// division from its last prime; primes found before ctx ends are kept, since they are still in order.
+func (m *primeMemo) firstN(ctx context.Context, n int) (int, int, bool, error) {
+	m.mu.RLock()
+	if len(m.primes) >= n {
+		last := m.primes[n-1]
+		m.mu.RUnlock()
+		return n, last, true, nil
+	}
+	m.mu.RUnlock()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.primes) >= n {
+		return n, m.primes[n-1], true, nil
+	}
+	if len(m.primes) == 0 {
+		m.primes = append(m.primes, 2)
+	}
+	var err error
+	for candidate, checked := m.primes[len(m.primes)-1]+1, 0; len(m.primes) < n; candidate, checked = candidate+1, checked+1 {
+		if checked%cancelCheckInterval == 0 {
+			if err = ctx.Err(); err != nil {
+				break
+			}
+		}
+		if candidate%2 == 0 {
+			continue
+		}
+		isPrime := true
+		for _, prime := range m.primes[1:] {
+			if prime*prime > candidate {
+				break
+			}
+			if candidate%prime == 0 {
+				isPrime = false
+				break
+			}
+		}
+		if isPrime {
+			m.primes = append(m.primes, candidate)
+		}
+	}
+	count := min(len(m.primes), n)
+	return count, m.primes[count-1], false, err
+}
+
+// size returns the number of cached primes
+func (m *primeMemo) size() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.primes)
+}
+
+// reset empties the cache
+func (m *primeMemo) reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.primes = nil
+}
+
+// generatePrimesCached returns the same result as generatePrimes, served from primeCache: counts
+// already cached are sliced out instantly (Cache "hit"), larger ones extend the cache first (Cache
+// "miss"). Counts above the cache's maxSize fall through to generatePrimes (Cache "bypass").
+// Accepts either a single value (e.g., "100") or a range (e.g., "100..1000").
+func generatePrimesCached(ctx context.Context, param string, maxCount int) (PrimeResult, error) {
+	start := time.Now()
+
+	n, wasRange, err := parseIntOrRange(ctx, param, maxCount, "primes")
+	if err != nil {
+		return PrimeResult{}, err
+	}
+	if n > primeCache.maxSize {
+		result, err := generatePrimes(ctx, strconv.Itoa(n), maxCount)
+		result.Cache = "bypass"
+		if wasRange {
+			result.RequestedRange = param
+		}
+		return result, err
+	}
+
+	result := PrimeResult{Cache: "hit"}
+	if n > 0 {
+		var hit bool
+		result.Count, result.LastPrime, hit, err = primeCache.firstN(ctx, n)
+		if !hit {
+			result.Cache = "miss"
+		}
+	}
+
+	duration := time.Since(start)
+	result.DurationUs = duration.Nanoseconds() / 1000
+	result.DurationMs = float64(duration.Nanoseconds()) / 1000000.0
+	if wasRange {
+		result.RequestedRange = param
+	}
+	return result, err
+}
+
+// generatePrimes generates the first n prime numbers and returns timing information.
+// Accepts either a single value (e.g., "100") or a range (e.g., "100..1000").
+// If ctx ends first it returns the primes found so far together with ctx.Err().
+func generatePrimes(ctx context.Context, param string, maxCount int) (PrimeResult, error) {
+	return generatePrimesWith(ctx, param, maxCount, firstPrimesTrial)
+}
+
+// primeAlgorithms maps the ?algo= values accepted by /primes to functions returning how many of
+// the first n primes (n >= 1) they found before ctx ended, and the last of them. They agree on
+// every result but stress different arithmetic: "trial" divides by the primes found so far,
+// "sieve" sweeps a bit array sized by an upper bound on the nth prime, and "miller" runs a
+// Miller-Rabin test (modular exponentiation) on each odd candidate.
+var primeAlgorithms = map[string]func(ctx context.Context, n int) (int, int, error){
+	"trial":  firstPrimesTrial,
+	"sieve":  firstPrimesSieve,
+	"miller": firstPrimesMiller,
+}
+
+// primeAlgorithmNames returns the accepted ?algo= values in sorted order
+func primeAlgorithmNames() []string {
+	names := make([]string, 0, len(primeAlgorithms))
+	for name := range primeAlgorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// generatePrimesWith is generatePrimes using firstPrimes to find the primes
+func generatePrimesWith(ctx context.Context, param string, maxCount int, firstPrimes func(ctx context.Context, n int) (int, int, error)) (PrimeResult, error) {
+	n, wasRange, err := parseIntOrRange(ctx, param, maxCount, "primes")
+	if err != nil {
+		return PrimeResult{}, err
+	}
+
+	result, err := countPrimes(ctx, n, firstPrimes)
+	if wasRange {
+		result.RequestedRange = param
+	}
+	return result, err
+}
+
+// countPrimes times firstPrimes finding the first n primes (none for n <= 0), for an already parsed n
+func countPrimes(ctx context.Context, n int, firstPrimes func(ctx context.Context, n int) (int, int, error)) (PrimeResult, error) {
+	start := time.Now()
+
+	var err error
+	count, lastPrime := 0, 0
+	if n > 0 {
+		count, lastPrime, err = firstPrimes(ctx, n)
+	}
+
+	duration := time.Since(start)
+	result := PrimeResult{
+		Count:      count,
+		LastPrime:  lastPrime,
+		DurationUs: duration.Nanoseconds() / 1000,
+		DurationMs: float64(duration.Nanoseconds()) / 1000000.0,
+	}
+	return result, err
+}
+
+// firstPrimesTrial finds the first n primes by trial division by the primes found so far
+func firstPrimesTrial(ctx context.Context, n int) (int, int, error) {
+	primes, err := trialPrimes(ctx, n)
+	return len(primes), primes[len(primes)-1], err
+}
+
+// trialPrimes returns the first n primes (n >= 1) in order, found by trial division by the primes
+// found so far. If ctx ends first it returns the primes found up to then with ctx.Err().
+func trialPrimes(ctx context.Context, n int) ([]int, error) {
+	primes := make([]int, 1, n)
+	primes[0] = 2
+
+	for candidate, checked := 3, 0; len(primes) < n; candidate, checked = candidate+2, checked+1 {
+		if checked%cancelCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return primes, err
+			}
+		}
+
+		isPrime := true
+		for _, prime := range primes {
+			if prime*prime > candidate {
+				break
+			}
+			if candidate%prime == 0 {
+				isPrime = false
+				break
+			}
+		}
+		if isPrime {
+			primes = append(primes, candidate)
+		}
+	}
+	return primes, nil
+}
+
+// firstPrimesSieve finds the first n primes with a sieve of Eratosthenes over the odd numbers up
+// to nthPrimeUpperBound(n), then counts off the first n survivors
+func firstPrimesSieve(ctx context.Context, n int) (int, int, error) {
+	limit := nthPrimeUpperBound(n)
+	// Bit i marks the odd number 2i+3 as composite
+	size := (limit - 1) / 2
+	composite := make([]uint64, (size+63)/64)
+	for i := 0; ; i++ {
+		p := 2*i + 3
+		if p*p > limit {
+			break
+		}
+		if composite[i/64]&(1<<(uint(i)%64)) != 0 {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return 0, 0, err
+		}
+		for j := (p*p - 3) / 2; j < size; j += p {
+			composite[j/64] |= 1 << (uint(j) % 64)
+		}
+	}
+
+	count, lastPrime := 1, 2
+	for i := 0; i < size && count < n; i++ {
+		if composite[i/64]&(1<<(uint(i)%64)) == 0 {
+			count++
+			lastPrime = 2*i + 3
+		}
+	}
+	return count, lastPrime, nil
+}
+
+// firstPrimesMiller finds the first n primes by running isPrimeMillerRabin on each odd candidate
+func firstPrimesMiller(ctx context.Context, n int) (int, int, error) {
+	count, lastPrime := 1, 2
+	for candidate, checked := 3, 0; count < n; candidate, checked = candidate+2, checked+1 {
+		if checked%cancelCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return count, lastPrime, err
+			}
+		}
+		if isPrimeMillerRabin(uint64(candidate)) {
+			count++
+			lastPrime = candidate
+		}
+	}
+	return count, lastPrime, nil
+}
+
+// millerRabinBases are witnesses that make the Miller-Rabin test deterministic for every uint64
+var millerRabinBases = []uint64{2, 3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37}
+
+// isPrimeMillerRabin reports whether n is prime using Miller-Rabin with millerRabinBases
+func isPrimeMillerRabin(n uint64) bool {
+	if n < 2 {
+		return false
+	}
+	for _, p := range millerRabinBases {
+		if n%p == 0 {
+			return n == p
+		}
+	}
+
+	// n-1 = d * 2^r with d odd
+	d := n - 1
+	r := bits.TrailingZeros64(d)
+	d >>= uint(r)
+
+	for _, a := range millerRabinBases {
+		x := powMod(a, d, n)
+		if x == 1 || x == n-1 {
+			continue
+		}
+		composite := true
+		for i := 1; i < r; i++ {
+			x = mulMod(x, x, n)
+			if x == n-1 {
+				composite = false
+				break
+			}
+		}
+		if composite {
+			return false
+		}
+	}
+	return true
+}
+
+// mulMod returns a*b mod m without overflowing, via the 128-bit product
+func mulMod(a, b, m uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	return bits.Rem64(hi, lo, m)
+}
+
+// powMod returns base^exp mod m by square-and-multiply
+func powMod(base, exp, m uint64) uint64 {
+	result := uint64(1)
+	base %= m
+	for ; exp > 0; exp >>= 1 {
+		if exp&1 == 1 {
+			result = mulMod(result, base, m)
+		}
+		base = mulMod(base, base, m)
+	}
+	return result
+}
+
+// generatePrimesParallel generates the first n prime numbers like generatePrimes, but splits the
+// candidate search across workers goroutines so a single request can saturate several cores.
+// Accepts either a single value (e.g., "100") or a range (e.g., "100..1000") up to maxCount.
+// If ctx ends first it returns ctx.Err() with Count set to the primes found so far (not
+// necessarily the smallest ones) and no LastPrime.
+func generatePrimesParallel(ctx context.Context, param string, maxCount int, workers int) (PrimeResult, error) {
+	if workers <= 1 {
+		return generatePrimes(ctx, param, maxCount)
+	}
+
+	start := time.Now()
+
+	n, wasRange, err := parseIntOrRange(ctx, param, maxCount, "primes")
+	if err != nil {
+		return PrimeResult{}, err
+	}
+
+	count, lastPrime := 0, 0
+	if n > 0 {
+		count, lastPrime, err = nthPrimeParallel(ctx, n, workers)
+	}
+
+	duration := time.Since(start)
+	result := PrimeResult{
+		Count:      count,
+		LastPrime:  lastPrime,
+		Workers:    workers,
+		DurationUs: duration.Nanoseconds() / 1000,
+		DurationMs: float64(duration.Nanoseconds()) / 1000000.0,
+	}
+	if wasRange {
+		result.RequestedRange = param
+	}
+	return result, err
+}
+
+// nthPrimeParallel finds the nth prime (n >= 1) with segmented trial division. The odd candidates
+// up to an upper bound for the nth prime are split into one contiguous segment per worker; each
+// worker divides its candidates by the base primes up to the bound's square root, and the
+// segments are merged in order. It returns n and the nth prime, or, if ctx ends first, the number
+// of primes found so far, 0, and ctx.Err().
+func nthPrimeParallel(ctx context.Context, n int, workers int) (int, int, error) {
+	if n == 1 {
+		return 1, 2, nil
+	}
+
+	bound := nthPrimeUpperBound(n)
+	basePrimes := oddPrimesUpTo(int(math.Sqrt(float64(bound))) + 1)
+
+	span := (bound - 3 + workers) / workers
+	segments := make([][]int, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		lo := 3 + w*span
+		hi := lo + span - 1
+		if hi > bound {
+			hi = bound
+		}
+
+		wg.Add(1)
+		go func(w, lo, hi int) {
+			defer wg.Done()
+			segments[w] = trialDivideSegment(ctx, lo, hi, basePrimes)
+		}(w, lo, hi)
+	}
+	wg.Wait()
+
+	// 2 is the first prime; the segments hold the odd primes in ascending order
+	found := 1
+	if err := ctx.Err(); err != nil {
+		for _, segment := range segments {
+			found += len(segment)
+		}
+		return min(found, n), 0, err
+	}
+	for _, segment := range segments {
+		if found+len(segment) >= n {
+			return n, segment[n-found-1], nil
+		}
+		found += len(segment)
+	}
+	// Unreachable: the bound guarantees at least n primes
+	return n, 0, nil
+}
+
+// nthPrimeUpperBound returns a value no smaller than the nth prime (Rosser's bound for n >= 6)
+func nthPrimeUpperBound(n int) int {
+	if n < 6 {
+		return 13
+	}
+	f := float64(n)
+	return int(f*(math.Log(f)+math.Log(math.Log(f)))) + 1
+}
+
+// oddPrimesUpTo returns the odd primes <= limit by trial division
+func oddPrimesUpTo(limit int) []int {
+	var primes []int
+	for candidate := 3; candidate <= limit; candidate += 2 {
+		isPrime := true
+		for _, prime := range primes {
+			if prime*prime > candidate {
+				break
+			}
+			if candidate%prime == 0 {
+				isPrime = false
+				break
+			}
+		}
+		if isPrime {
+			primes = append(primes, candidate)
+		}
+	}
+	return primes
+}
+
+// trialDivideSegment returns the odd primes in [lo, hi], testing each candidate against basePrimes,
+// which must contain every odd prime up to sqrt(hi). It stops early, returning the primes found so
+// far, once ctx ends.
+func trialDivideSegment(ctx context.Context, lo, hi int, basePrimes []int) []int {
+	if lo%2 == 0 {
+		lo++
+	}
+
+	var primes []int
+	for candidate, checked := lo, 0; candidate <= hi; candidate, checked = candidate+2, checked+1 {
+		if checked%cancelCheckInterval == 0 && ctx.Err() != nil {
+			break
+		}
+
+		isPrime := true
+		for _, prime := range basePrimes {
+			if prime*prime > candidate {
+				break
+			}
+			if candidate%prime == 0 {
+				isPrime = false
+				break
+			}
+		}
+		if isPrime {
+			primes = append(primes, candidate)
+		}
+	}
+	return primes
+}
+
+// parseWorkers parses the ?parallel= worker count, capping it at GOMAXPROCS.
+// An empty value means a single (serial) worker.
+func parseWorkers(param string) (int, error) {
+	if param == "" {
+		return 1, nil
+	}
+
+	workers, err := strconv.Atoi(param)
+	if err != nil {
+		return 0, errorWithCode(CodeInvalidNumber, "invalid number: %v", err)
+	}
+	if workers < 1 {
+		return 0, errorWithCode(CodeOutOfRange, "worker count must be at least 1")
+	}
+
+	if maxWorkers := runtime.GOMAXPROCS(0); workers > maxWorkers {
+		workers = maxWorkers
+	}
+	return workers, nil
+}
+
+// getFibonacci handles GET requests to calculate the nth Fibonacci number or a random position within a range.
+// ?memo=1 serves repeated positions from the shared fibonacciCache.
+//
+// Deprecated: getFibonacci is deprecated. Use getPrimes for more predictable CPU load testing.
+func (s *apiServer) getFibonacci(c *gin.Context) {
+	metrics := s.beginRequestMetrics(c)
+
+	memo, err := strconv.ParseBool(c.DefaultQuery("memo", "0"))
+	if err != nil {
+		respondParamError(c, "memo", "0,1", errorWithCode(CodeInvalidParameter, "invalid boolean %q", c.Query("memo")))
+		return
+	}
+
+	f := c.Param("f")
+	result, err := fibonacci(c.Request.Context(), f, s.limits().Fibonacci, memo)
+	if err != nil {
+		respondParamError(c, "f", s.limits().Fibonacci, err)
+		return
+	}
+	metrics.finish()
+	respond(c, result, metrics)
+}
+
+// getPrimes handles GET requests to generate the first n prime numbers or a random count within a range.
+// With ?parallel=N the search is split across up to GOMAXPROCS goroutines. ?cache=1 serves the
+// answer from the shared primeCache instead and takes precedence over ?parallel. ?stats=1 adds
+// PrimeStats to the result. ?pin=1 can't be combined with more than one worker.
+func (s *apiServer) getPrimes(c *gin.Context) {
+	metrics := s.beginRequestMetrics(c)
+
+	workers, err := parseWorkers(c.Query("parallel"))
+	if err != nil {
+		respondParamError(c, "parallel", runtime.GOMAXPROCS(0), err)
+		return
+	}
+	cache, err := strconv.ParseBool(c.DefaultQuery("cache", "0"))
+	if err != nil {
+		respondParamError(c, "cache", "0,1", errorWithCode(CodeInvalidParameter, "invalid boolean %q", c.Query("cache")))
+		return
+	}
+	algo, algoSet := c.GetQuery("algo")
+	firstPrimes, ok := primeAlgorithms[algo]
+	if algoSet && !ok {
+		respondParamError(c, "algo", primeAlgorithmNames(), errorWithCode(CodeUnsupportedValue, "unsupported algorithm %q", algo))
+		return
+	}
+	if algoSet && (cache || workers > 1) {
+		respondParamError(c, "algo", primeAlgorithmNames(), errorWithCode(CodeInvalidParameter, "algo cannot be combined with parallel or cache"))
+		return
+	}
+	if workers > 1 && c.GetBool(pinnedKey) {
+		respondParamError(c, "pin", "0,1", errorWithCode(CodeInvalidParameter, "pin cannot be combined with parallel: the workers would run on other threads"))
+		return
+	}
+	stats, err := strconv.ParseBool(c.DefaultQuery("stats", "0"))
+	if err != nil {
+		respondParamError(c, "stats", "0,1", errorWithCode(CodeInvalidParameter, "invalid boolean %q", c.Query("stats")))
+		return
+	}
+
+	p := c.Param("p")
+	var result PrimeResult
+	switch {
+	case algoSet:
+		result, err = generatePrimesWith(c.Request.Context(), p, s.limits().Primes, firstPrimes)
+		result.Algorithm = algo
+	case cache:
+		result, err = generatePrimesCached(c.Request.Context(), p, s.limits().Primes)
+	default:
+		result, err = generatePrimesParallel(c.Request.Context(), p, s.limits().Primes, workers)
+	}
+	if err != nil {
+		respondOperationError(c, "p", s.limits().Primes, result, err)
+		return
+	}
+	if stats {
+		result.Stats = primeStats(result.Count, result.LastPrime)
+	}
+	metrics.finish()
+	respond(c, result, metrics)
+}
+
+// nextPrime returns the smallest prime greater than after. primes must hold every prime up to
+// after, in order; only those up to the candidate's square root are tried as divisors.
+func nextPrime(primes []int, after int) int {
+	for candidate := max(after+1, 2); ; candidate++ {
+		isPrime := true
+		for _, prime := range primes {
+			if prime*prime > candidate {
+				break
+			}
+			if candidate%prime == 0 {
+				isPrime = false
+				break
+			}
+		}
+		if isPrime {
+			return candidate
+		}
+	}
+}
+
+// getPrimesSSE handles GET requests to stream the first n primes (or a random count within a range)
+// as Server-Sent Events while they are found: one unnamed "data: <prime>" event per prime, flushed
+// immediately, then a "summary" event whose data is the PrimeResult as JSON. Generation stops without
+// a summary when the request context ends, e.g. when the client disconnects.
+func (s *apiServer) getPrimesSSE(c *gin.Context) {
+	start := time.Now()
+	param := c.Param("n")
+	n, wasRange, err := parseIntOrRange(c.Request.Context(), param, s.limits().Primes, "primes")
+	if err != nil {
+		respondParamError(c, "n", s.limits().Primes, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	primes := make([]int, 0, n)
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Status(http.StatusOK)
+	c.Stream(func(w io.Writer) bool {
+		if ctx.Err() != nil {
+			return false
+		}
+		if len(primes) < n {
+			last := 1
+			if len(primes) > 0 {
+				last = primes[len(primes)-1]
+			}
+			prime := nextPrime(primes, last)
+			primes = append(primes, prime)
+			_, err := fmt.Fprintf(w, "data: %d\n\n", prime)
+			return err == nil
+		}
+
+		duration := time.Since(start)
+		result := PrimeResult{
+			Count:      len(primes),
+			DurationUs: duration.Nanoseconds() / 1000,
+			DurationMs: float64(duration.Nanoseconds()) / 1000000.0,
+		}
+		if len(primes) > 0 {
+			result.LastPrime = primes[len(primes)-1]
+		}
+		if wasRange {
+			result.RequestedRange = param
+		}
+		summary, _ := json.Marshal(result)
+		fmt.Fprintf(w, "event: summary\ndata: %s\n\n", summary)
+		return false
+	})
+}
+
+// NthPrimeResult holds the nth prime including timing
+type NthPrimeResult struct {
+	N              int     `json:"n"`
+	RequestedRange string  `json:"requested_range,omitempty"`
+	Prime          int     `json:"prime"`
+	DurationUs     int64   `json:"duration_us"`
+	DurationMs     float64 `json:"duration_ms"`
+}
+
+// nthPrime returns the nth prime (1-indexed, so n=1 is 2) using generatePrimes, whose last prime
+// is the nth. Accepts either a single value (e.g., "1000") or a range (e.g., "100..1000"); the
+// chosen n must be at least 1. If ctx ends first it returns ctx.Err() with no prime.
+func nthPrime(ctx context.Context, param string, maxN int) (NthPrimeResult, error) {
+	primes, err := generatePrimes(ctx, param, maxN)
+	if err != nil {
+		return NthPrimeResult{}, err
+	}
+	if primes.Count < 1 {
+		return NthPrimeResult{}, errorWithCode(CodeOutOfRange, "n must be at least 1")
+	}
+	return NthPrimeResult{
+		N:              primes.Count,
+		RequestedRange: primes.RequestedRange,
+		Prime:          primes.LastPrime,
+		DurationUs:     primes.DurationUs,
+		DurationMs:     primes.DurationMs,
+	}, nil
+}
+
+// getNthPrime handles GET requests for the nth prime or the prime at a random position within a range
+func (s *apiServer) getNthPrime(c *gin.Context) {
+	metrics := s.beginRequestMetrics(c)
+
+	n := c.Param("n")
+	result, err := nthPrime(c.Request.Context(), n, s.limits().Primes)
+	if err != nil {
+		respondOperationError(c, "n", s.limits().Primes, result, err)
+		return
+	}
+	metrics.finish()
+	respond(c, result, metrics)
+}
+
+// PrimeGapResult holds the largest gap between consecutive primes among the first n, including timing.
+// GapStart and GapEnd are the primes on either side of the first occurrence of MaxGap.
+type PrimeGapResult struct {
+	N              int     `json:"n"`
+	RequestedRange string  `json:"requested_range,omitempty"`
+	LastPrime      int     `json:"last_prime"`
+	MaxGap         int     `json:"max_gap"`
+	GapStart       int     `json:"gap_start"`
+	GapEnd         int     `json:"gap_end"`
+	MeanGap        float64 `json:"mean_gap"`
+	PrimesBytes    int     `json:"primes_bytes"`
+	DurationUs     int64   `json:"duration_us"`
+	DurationMs     float64 `json:"duration_ms"`
+}
+
+// primeGaps generates the first n primes with trialPrimes, keeping all of them in a slice, then
+// scans it for the largest gap between neighbors. Accepts either a single value (e.g., "1000") or
+// a range (e.g., "100..1000"); n must be at least 2, so there is a gap. If ctx ends during
+// generation it returns ctx.Err() with no gap.
+func primeGaps(ctx context.Context, param string, maxN int) (PrimeGapResult, error) {
+	start := time.Now()
+
+	n, wasRange, err := parseIntOrRange(ctx, param, maxN, "primes")
+	if err != nil {
+		return PrimeGapResult{}, err
+	}
+	if n < 2 {
+		return PrimeGapResult{}, errorWithCode(CodeOutOfRange, "n must be at least 2")
+	}
+
+	primes, err := trialPrimes(ctx, n)
+	if err != nil {
+		return PrimeGapResult{}, err
+	}
+
+	result := PrimeGapResult{N: n, LastPrime: primes[n-1], PrimesBytes: cap(primes) * strconv.IntSize / 8}
+	for i := 1; i < n; i++ {
+		if gap := primes[i] - primes[i-1]; gap > result.MaxGap {
+			result.MaxGap, result.GapStart, result.GapEnd = gap, primes[i-1], primes[i]
+		}
+	}
+	result.MeanGap = float64(primes[n-1]-primes[0]) / float64(n-1)
+
+	duration := time.Since(start)
+	result.DurationUs = duration.Nanoseconds() / 1000
+	result.DurationMs = float64(duration.Nanoseconds()) / 1000000.0
+	if wasRange {
+		result.RequestedRange = param
+	}
+	return result, nil
+}
+
+// getPrimeGaps handles GET requests for the largest gap among the first n primes or a random count within a range
+func (s *apiServer) getPrimeGaps(c *gin.Context) {
+	metrics := s.beginRequestMetrics(c)
+
+	n := c.Param("n")
+	result, err := primeGaps(c.Request.Context(), n, s.limits().Primes)
+	if err != nil {
+		respondOperationError(c, "n", s.limits().Primes, result, err)
+		return
+	}
+	metrics.finish()
+	respond(c, result, metrics)
+}
+
+// SieveResult holds the result of sieving all primes up to a limit including timing
+type SieveResult struct {
+	Limit          int     `json:"limit"`
+	RequestedRange string  `json:"requested_range,omitempty"`
+	Count          int     `json:"count"`
+	LargestPrime   int     `json:"largest_prime"`
+	SieveBytes     int     `json:"sieve_bytes"`
+	DurationUs     int64   `json:"duration_us"`
+	DurationMs     float64 `json:"duration_ms"`
+}
+
+// sievePrimes counts the primes <= n with a bit-packed Sieve of Eratosthenes and returns timing information.
+// Only odd numbers are stored, one bit each, so the sieve needs about n/16 bytes.
+// Accepts either a single value (e.g., "100000") or a range (e.g., "100000..1000000").
+// If ctx ends first it returns ctx.Err() with no count.
+func sievePrimes(ctx context.Context, param string, maxN int) (SieveResult, error) {
+	start := time.Now()
+
+	n, wasRange, err := parseIntOrRange(ctx, param, maxN, "sieve limit")
+	if err != nil {
+		return SieveResult{}, err
+	}
+
+	result := SieveResult{Limit: n}
+	if n >= 2 {
+		// Bit i marks the odd number 2i+3 as composite
+		size := (n - 1) / 2
+		composite := make([]uint64, (size+63)/64)
+		result.SieveBytes = len(composite) * 8
+
+		for i := 0; ; i++ {
+			p := 2*i + 3
+			if p*p > n {
+				break
+			}
+			if composite[i/64]&(1<<(uint(i)%64)) != 0 {
+				continue
+			}
+			// Each base prime sweeps the whole array, so checking once per prime is enough
+			if err := ctx.Err(); err != nil {
+				return result, err
+			}
+			for j := (p*p - 3) / 2; j < size; j += p {
+				composite[j/64] |= 1 << (uint(j) % 64)
+			}
+		}
+
+		// 2 is the only even prime
+		result.Count = 1
+		result.LargestPrime = 2
+		for i := 0; i < size; i++ {
+			if composite[i/64]&(1<<(uint(i)%64)) == 0 {
+				result.Count++
+				result.LargestPrime = 2*i + 3
+			}
+		}
+	}
+
+	duration := time.Since(start)
+	result.DurationUs = duration.Nanoseconds() / 1000
+	result.DurationMs = float64(duration.Nanoseconds()) / 1000000.0
+	if wasRange {
+		result.RequestedRange = param
+	}
+	return result, nil
+}
+
+// getPrimesUpTo handles GET requests to sieve all primes up to n or a random limit within a range.
+func (s *apiServer) getPrimesUpTo(c *gin.Context) {
+	metrics := s.beginRequestMetrics(c)
+
+	n := c.Param("n")
+	result, err := sievePrimes(c.Request.Context(), n, s.limits().SieveN)
+	if err != nil {
+		respondOperationError(c, "n", s.limits().SieveN, result, err)
+		return
+	}
+	metrics.finish()
+	respond(c, result, metrics)
+}
+
+// HashBlockSize is the size in bytes of the fixed block hashed on each iteration
+const HashBlockSize = 1024
+
+// hashAlgorithms maps the ?algo= values accepted by /hash to their constructors
+var hashAlgorithms = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// hashAlgorithmNames returns the accepted ?algo= values in sorted order
+func hashAlgorithmNames() []string {
+	names := make([]string, 0, len(hashAlgorithms))
+	for name := range hashAlgorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HashResult holds the result of repeated block hashing including timing
+type HashResult struct {
+	Algorithm      string  `json:"algorithm"`
+	Iterations     int     `json:"iterations"`
+	RequestedRange string  `json:"requested_range,omitempty"`
+	BlockBytes     int     `json:"block_bytes"`
+	Digest         string  `json:"digest"`
+	NsPerIteration float64 `json:"ns_per_iteration"`
+	DurationUs     int64   `json:"duration_us"`
+	DurationMs     float64 `json:"duration_ms"`
+}
+
+// hashBlock hashes a fixed block n times with the named algorithm and returns the final digest.
+// Each iteration hashes the block followed by the previous digest, so the work cannot be skipped.
+// Accepts either a single value (e.g., "10000") or a range (e.g., "1000..10000").
+// If ctx ends first it returns ctx.Err() with Iterations set to the hashes completed.
+func hashBlock(ctx context.Context, param string, algo string, maxIterations int) (HashResult, error) {
+	newHash, ok := hashAlgorithms[algo]
+	if !ok {
+		return HashResult{}, errorWithCode(CodeUnsupportedValue, "unsupported algorithm %q", algo)
+	}
+
+	start := time.Now()
+
+	n, wasRange, err := parseIntOrRange(ctx, param, maxIterations, "iterations")
+	if err != nil {
+		return HashResult{}, err
+	}
+
+	block := make([]byte, HashBlockSize)
+	for i := range block {
+		block[i] = byte(i)
+	}
+
+	h := newHash()
+	var digest []byte
+	for i := 0; i < n; i++ {
+		if i%cancelCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return HashResult{Algorithm: algo, Iterations: i, BlockBytes: HashBlockSize}, err
+			}
+		}
+		h.Reset()
+		h.Write(block)
+		h.Write(digest)
+		digest = h.Sum(digest[:0])
+	}
+
+	duration := time.Since(start)
+	result := HashResult{
+		Algorithm:  algo,
+		Iterations: n,
+		BlockBytes: HashBlockSize,
+		Digest:     hex.EncodeToString(digest),
+		DurationUs: duration.Nanoseconds() / 1000,
+		DurationMs: float64(duration.Nanoseconds()) / 1000000.0,
+	}
+	if n > 0 {
+		result.NsPerIteration = float64(duration.Nanoseconds()) / float64(n)
+	}
+	if wasRange {
+		result.RequestedRange = param
+	}
+	return result, nil
+}
+
+// getHash handles GET requests to hash a fixed block n times or a random count within a range.
+// ?algo= selects sha256 (default) or sha512.
+func (s *apiServer) getHash(c *gin.Context) {
+	metrics := s.beginRequestMetrics(c)
+
+	algo := c.DefaultQuery("algo", "sha256")
+	if _, ok := hashAlgorithms[algo]; !ok {
+		respondParamError(c, "algo", hashAlgorithmNames(), errorWithCode(CodeUnsupportedValue, "unsupported algorithm %q", algo))
+		return
+	}
+
+	n := c.Param("n")
+	result, err := hashBlock(c.Request.Context(), n, algo, s.limits().HashIterations)
+	if err != nil {
+		respondOperationError(c, "n", s.limits().HashIterations, result, err)
+		return
+	}
+	metrics.finish()
+	respond(c, result, metrics)
+}
+
+// defaultRegexPattern is what /regex runs when ?pattern= is omitted: it picks out failed API
+// requests (4xx/5xx) from access-log lines, the kind of pattern a log parser or WAF rule runs per request
+const defaultRegexPattern = `^(\d{1,3}\.){3}\d{1,3} - (\w+) \[[^\]]+\] "(GET|POST|PUT|DELETE) (/api/v\d+/[a-z]+/\d+) HTTP/1\.[01]" [45]\d\d \d+$`
+
+// defaultRegexp is defaultRegexPattern compiled once at startup
+var defaultRegexp = regexp.MustCompile(defaultRegexPattern)
+
+// RegexResult holds the result of matching a regex against generated log lines including timing
+type RegexResult struct {
+	Pattern        string  `json:"pattern"`
+	Lines          int     `json:"lines"`
+	RequestedRange string  `json:"requested_range,omitempty"`
+	Matches        int     `json:"matches"`
+	BytesScanned   int64   `json:"bytes_scanned"`
+	NsPerLine      float64 `json:"ns_per_line"`
+	DurationUs     int64   `json:"duration_us"`
+	DurationMs     float64 `json:"duration_ms"`
+}
+
+// compileRegexPattern compiles a ?pattern= regex. Go's regexp runs in linear time, so there is no
+// catastrophic backtracking to guard against; the length cap bounds the compiled program size.
+func compileRegexPattern(pattern string) (*regexp.Regexp, error) {
+	if len(pattern) > MaxRegexPatternLen {
+		return nil, errorWithCode(CodeOutOfRange, "pattern longer than %d bytes", MaxRegexPatternLen)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errorWithCode(CodeInvalidParameter, "invalid pattern: %v", err)
+	}
+	return re, nil
+}
+
+// generateLogLines creates n random access-log lines in Common Log Format. Paths, methods, and
+// statuses vary so the default pattern matches about half of them.
+func generateLogLines(n int) []string {
+	methods := []string{"GET", "POST", "PUT", "DELETE"}
+	resources := []string{"users", "orders", "items", "sessions"}
+	statuses := []int{200, 200, 201, 204, 301, 304, 400, 401, 403, 404, 500, 503}
+	lines := make([]string, n)
+	loadRand.with(func(r *rand.Rand) {
+		for i := range lines {
+			lines[i] = fmt.Sprintf(`%d.%d.%d.%d - user%d [16/Oct/2026:%02d:%02d:%02d +0000] "%s /api/v%d/%s/%d HTTP/1.1" %d %d`,
+				r.Intn(256), r.Intn(256), r.Intn(256), r.Intn(256), r.Intn(10000),
+				r.Intn(24), r.Intn(60), r.Intn(60),
+				methods[r.Intn(len(methods))], 1+r.Intn(3), resources[r.Intn(len(resources))], r.Intn(1000000),
+				statuses[r.Intn(len(statuses))], r.Intn(65536))
+		}
+	})
+	return lines
+}
+
+// matchRegex generates n log lines and counts how many re matches.
+// Accepts either a single value (e.g., "10000") or a range (e.g., "1000..10000").
+// If ctx ends first it returns ctx.Err() with Matches counted over the lines checked so far.
+func matchRegex(ctx context.Context, param string, re *regexp.Regexp, maxLines int) (RegexResult, error) {
+	start := time.Now()
+
+	n, wasRange, err := parseIntOrRange(ctx, param, maxLines, "lines")
+	if err != nil {
+		return RegexResult{}, err
+	}
+
+	result := RegexResult{Pattern: re.String(), Lines: n}
+	for i, line := range generateLogLines(n) {
+		if i%cancelCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return result, err
+			}
+		}
+		if re.MatchString(line) {
+			result.Matches++
+		}
+		result.BytesScanned += int64(len(line))
+	}
+
+	duration := time.Since(start)
+	result.DurationUs = duration.Nanoseconds() / 1000
+	result.DurationMs = float64(duration.Nanoseconds()) / 1000000.0
+	if n > 0 {
+		result.NsPerLine = float64(duration.Nanoseconds()) / float64(n)
+	}
+	if wasRange {
+		result.RequestedRange = param
+	}
+	return result, nil
+}
+
+// getRegex handles GET requests to match a regex (the default log-line pattern, or ?pattern=)
+// against n generated lines or a random count within a range.
+func (s *apiServer) getRegex(c *gin.Context) {
+	metrics := s.beginRequestMetrics(c)
+
+	re := defaultRegexp
+	if pattern, ok := c.GetQuery("pattern"); ok {
+		var err error
+		if re, err = compileRegexPattern(pattern); err != nil {
+			respondParamError(c, "pattern", MaxRegexPatternLen, err)
+			return
+		}
+	}
+
+	n := c.Param("n")
+	result, err := matchRegex(c.Request.Context(), n, re, s.limits().RegexLines)
+	if err != nil {
+		respondOperationError(c, "n", s.limits().RegexLines, result, err)
+		return
+	}
+	metrics.finish()
+	respond(c, result, metrics)
+}
+
+// encryptionModes maps the ?mode= values accepted by /encrypt to functions that encrypt
+// plaintext with the given AES-256 block cipher in that mode and return the ciphertext
+var encryptionModes = map[string]func(block cipher.Block, plaintext []byte) ([]byte, error){
+	"gcm": encryptGCM,
+	"cbc": encryptCBC,
+}
+
+// encryptionModeNames returns the accepted ?mode= values in sorted order
+func encryptionModeNames() []string {
+	names := make([]string, 0, len(encryptionModes))
+	for name := range encryptionModes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// encryptGCM seals plaintext with AES-GCM under a random nonce; the ciphertext includes the auth tag
+func encryptGCM(block cipher.Block, plaintext []byte) ([]byte, error) {
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := crand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nil, nonce, plaintext, nil), nil
+}
+
+// encryptCBC encrypts plaintext with AES-CBC under a random IV after PKCS#7 padding
+func encryptCBC(block cipher.Block, plaintext []byte) ([]byte, error) {
+	padding := aes.BlockSize - len(plaintext)%aes.BlockSize
+	ciphertext := make([]byte, len(plaintext)+padding)
+	copy(ciphertext, plaintext)
+	for i := len(plaintext); i < len(ciphertext); i++ {
+		ciphertext[i] = byte(padding)
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	if _, err := crand.Read(iv); err != nil {
+		return nil, err
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, ciphertext)
+	return ciphertext, nil
+}
+
+// EncryptResult holds the result of AES encryption including timing and throughput
+type EncryptResult struct {
+	Mode            string  `json:"mode"`
+	SizeKB          int     `json:"size_kb"`
+	RequestedRange  string  `json:"requested_range,omitempty"`
+	PlaintextBytes  int     `json:"plaintext_bytes"`
+	CiphertextBytes int     `json:"ciphertext_bytes"`
+	ThroughputMBps  float64 `json:"throughput_mb_per_sec"`
+	DurationUs      int64   `json:"duration_us"`
+	DurationMs      float64 `json:"duration_ms"`
+}
+
+// encryptData generates kb kilobytes of random plaintext and encrypts it with AES-256 in the named mode
+// under a fresh random key. Throughput covers the encryption step only, not plaintext generation.
+// The ciphertext itself is discarded; only its length is reported.
+// Accepts either a single value (e.g., "1024") or a range (e.g., "100..1000")
+func encryptData(ctx context.Context, param string, mode string, maxKB int) (EncryptResult, error) {
+	encrypt, ok := encryptionModes[mode]
+	if !ok {
+		return EncryptResult{}, errorWithCode(CodeUnsupportedValue, "unsupported mode %q", mode)
+	}
+
+	start := time.Now()
+
+	n, wasRange, err := parseIntOrRange(ctx, param, maxKB, "encrypt")
+	if err != nil {
+		return EncryptResult{}, err
+	}
+
+	key := make([]byte, 32)
+	plaintext := make([]byte, n*1024)
+	if _, err := crand.Read(key); err != nil {
+		return EncryptResult{}, err
+	}
+	if _, err := crand.Read(plaintext); err != nil {
+		return EncryptResult{}, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return EncryptResult{}, err
+	}
+
+	encryptStart := time.Now()
+	ciphertext, err := encrypt(block, plaintext)
+	if err != nil {
+		return EncryptResult{}, err
+	}
+	encryptDuration := time.Since(encryptStart)
+
+	duration := time.Since(start)
+	result := EncryptResult{
+		Mode:            mode,
+		SizeKB:          n,
+		PlaintextBytes:  len(plaintext),
+		CiphertextBytes: len(ciphertext),
+		DurationUs:      duration.Nanoseconds() / 1000,
+		DurationMs:      float64(duration.Nanoseconds()) / 1000000.0,
+	}
+	if len(plaintext) > 0 && encryptDuration > 0 {
+		result.ThroughputMBps = float64(len(plaintext)) / (1024 * 1024) / encryptDuration.Seconds()
+	}
+	if wasRange {
+		result.RequestedRange = param
+	}
+	return result, nil
+}
+
+// getEncrypt handles GET requests to AES-256 encrypt kb kilobytes of random data or a random size within a range.
+// ?mode= selects gcm (default) or cbc.
+func (s *apiServer) getEncrypt(c *gin.Context) {
+	metrics := s.beginRequestMetrics(c)
+
+	mode := c.DefaultQuery("mode", "gcm")
+	if _, ok := encryptionModes[mode]; !ok {
+		respondParamError(c, "mode", encryptionModeNames(), errorWithCode(CodeUnsupportedValue, "unsupported mode %q", mode))
+		return
+	}
+
+	kb := c.Param("kb")
+	result, err := encryptData(c.Request.Context(), kb, mode, s.limits().EncryptKB)
+	if err != nil {
+		respondParamError(c, "kb", s.limits().EncryptKB, err)
+		return
+	}
+	metrics.finish()
+	respond(c, result, metrics)
+}
+
+// compressibleWords is the vocabulary used to build semi-compressible input for /compress
+var compressibleWords = []string{
+	"load", "generator", "request", "latency", "memory", "prime", "query", "cache",
+	"server", "client", "timeout", "retry", "header", "payload", "metric", "trace",
+}
+
+// CompressResult holds the result of gzip compression including timing
+type CompressResult struct {
+	Level            int     `json:"level"`
+	SizeKB           int     `json:"size_kb"`
+	RequestedRange   string  `json:"requested_range,omitempty"`
+	OriginalBytes    int     `json:"original_bytes"`
+	CompressedBytes  int     `json:"compressed_bytes"`
+	CompressionRatio float64 `json:"compression_ratio"`
+	DurationUs       int64   `json:"duration_us"`
+	DurationMs       float64 `json:"duration_ms"`
+}
+
+// parseGzipLevel parses the ?level= value, accepting gzip.HuffmanOnly (-2) through gzip.BestCompression (9)
+func parseGzipLevel(param string) (int, error) {
+	level, err := strconv.Atoi(param)
+	if err != nil {
+		return 0, errorWithCode(CodeInvalidNumber, "invalid number: %v", err)
+	}
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		return 0, errorWithCode(CodeOutOfRange, "level out of range (%d-%d)", gzip.HuffmanOnly, gzip.BestCompression)
+	}
+	return level, nil
+}
+
+// generateCompressibleData returns size bytes of text built from random words and random digits,
+// which gzip typically shrinks by a factor of 3-4 rather than all-or-nothing
+func generateCompressibleData(size int) []byte {
+	var buf bytes.Buffer
+	buf.Grow(size + 32)
+	loadRand.with(func(r *rand.Rand) {
+		for buf.Len() < size {
+			buf.WriteString(compressibleWords[r.Intn(len(compressibleWords))])
+			buf.WriteString(strconv.Itoa(r.Intn(1000)))
+			buf.WriteByte(' ')
+		}
+	})
+	return buf.Bytes()[:size]
+}
+
+// compressData generates kb kilobytes of semi-compressible data and gzips it at the given level.
+// Accepts either a single value (e.g., "1024") or a range (e.g., "100..1000")
+func compressData(ctx context.Context, param string, level int, maxKB int) (CompressResult, error) {
+	start := time.Now()
+
+	n, wasRange, err := parseIntOrRange(ctx, param, maxKB, "compress")
+	if err != nil {
+		return CompressResult{}, err
+	}
+
+	data := generateCompressibleData(n * 1024)
+
+	var compressed bytes.Buffer
+	writer, err := gzip.NewWriterLevel(&compressed, level)
+	if err != nil {
+		return CompressResult{}, err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return CompressResult{}, err
+	}
+	if err := writer.Close(); err != nil {
+		return CompressResult{}, err
+	}
+
+	duration := time.Since(start)
+	result := CompressResult{
+		Level:            level,
+		SizeKB:           n,
+		OriginalBytes:    len(data),
+		CompressedBytes:  compressed.Len(),
+		CompressionRatio: float64(len(data)) / float64(compressed.Len()),
+		DurationUs:       duration.Nanoseconds() / 1000,
+		DurationMs:       float64(duration.Nanoseconds()) / 1000000.0,
+	}
+	if wasRange {
+		result.RequestedRange = param
+	}
+	return result, nil
+}
+
+// getCompress handles GET requests to gzip kb kilobytes of generated data or a random size within a range.
+// ?level= selects the gzip level (default -1, gzip.DefaultCompression).
+func (s *apiServer) getCompress(c *gin.Context) {
+	metrics := s.beginRequestMetrics(c)
+
+	level, err := parseGzipLevel(c.DefaultQuery("level", strconv.Itoa(gzip.DefaultCompression)))
+	if err != nil {
+		respondParamError(c, "level", fmt.Sprintf("%d..%d", gzip.HuffmanOnly, gzip.BestCompression), err)
+		return
+	}
+
+	kb := c.Param("kb")
+	result, err := compressData(c.Request.Context(), kb, level, s.limits().CompressKB)
+	if err != nil {
+		respondParamError(c, "kb", s.limits().CompressKB, err)
+		return
+	}
+	metrics.finish()
+	respond(c, result, metrics)
+}
+
+// jsonDocument is the nested payload /json serializes: a catalog-style document whose items carry
+// maps and child slices, so encoding/json exercises reflection over several levels
+type jsonDocument struct {
+	ID        string     `json:"id"`
+	Generated time.Time  `json:"generated"`
+	Tags      []string   `json:"tags"`
+	Items     []jsonItem `json:"items"`
+}
+
+type jsonItem struct {
+	ID         int               `json:"id"`
+	Name       string            `json:"name"`
+	Price      float64           `json:"price"`
+	InStock    bool              `json:"in_stock"`
+	Attributes map[string]string `json:"attributes"`
+	Variants   []jsonVariant     `json:"variants"`
+}
+
+type jsonVariant struct {
+	SKU      string `json:"sku"`
+	Quantity int    `json:"quantity"`
+}
+
+// JSONResult holds the result of a JSON marshal/unmarshal roundtrip including throughput
+type JSONResult struct {
+	SizeKB         int     `json:"size_kb"`
+	RequestedRange string  `json:"requested_range,omitempty"`
+	Iterations     int     `json:"iterations"`
+	Items          int     `json:"items"`
+	DocumentBytes  int     `json:"document_bytes"`
+	BytesProcessed int64   `json:"bytes_processed"`
+	ThroughputMBps float64 `json:"throughput_mb_per_sec"`
+	DurationUs     int64   `json:"duration_us"`
+	DurationMs     float64 `json:"duration_ms"`
+}
+
+// parseJSONIterations parses the /json ?iterations= value, which must be 1 through maxIterations
+func parseJSONIterations(param string, maxIterations int) (int, error) {
+	iterations, err := strconv.Atoi(param)
+	if err != nil {
+		return 0, errorWithCode(CodeInvalidNumber, "invalid number: %v", err)
+	}
+	if iterations < 1 || iterations > maxIterations {
+		return 0, errorWithCode(CodeOutOfRange, "iterations out of range (1-%d)", maxIterations)
+	}
+	return iterations, nil
+}
+
+// generateJSONDocument builds a jsonDocument whose encoding is at least size bytes. Items are
+// encoded as they're added to track the size, so the document overshoots by at most one item.
+func generateJSONDocument(size int) jsonDocument {
+	doc := jsonDocument{ID: "catalog", Generated: time.Now().UTC(), Tags: []string{"load", "json", "roundtrip"}, Items: []jsonItem{}}
+	encoded := 0
+	loadRand.with(func(r *rand.Rand) {
+		for encoded < size {
+			item := jsonItem{
+				ID:      len(doc.Items),
+				Name:    compressibleWords[r.Intn(len(compressibleWords))] + " " + compressibleWords[r.Intn(len(compressibleWords))],
+				Price:   float64(r.Intn(100000)) / 100,
+				InStock: r.Intn(2) == 0,
+				Attributes: map[string]string{
+					"color":    compressibleWords[r.Intn(len(compressibleWords))],
+					"material": compressibleWords[r.Intn(len(compressibleWords))],
+				},
+			}
+			for v := 0; v < 1+r.Intn(4); v++ {
+				item.Variants = append(item.Variants, jsonVariant{SKU: fmt.Sprintf("SKU-%06d", r.Intn(1000000)), Quantity: r.Intn(500)})
+			}
+			data, _ := json.Marshal(item)
+			encoded += len(data) + 1
+			doc.Items = append(doc.Items, item)
+		}
+	})
+	return doc
+}
+
+// roundtripJSON builds a nested document of about kb kilobytes, then marshals and unmarshals it
+// iterations times. Throughput counts bytes encoded plus bytes decoded over the roundtrips only.
+// Accepts either a single value (e.g., "100") or a range (e.g., "10..100").
+// If ctx ends first it returns ctx.Err() with Iterations set to the roundtrips completed.
+func roundtripJSON(ctx context.Context, param string, iterations int, maxKB int) (JSONResult, error) {
+	start := time.Now()
+
+	n, wasRange, err := parseIntOrRange(ctx, param, maxKB, "json")
+	if err != nil {
+		return JSONResult{}, err
+	}
+
+	doc := generateJSONDocument(n * 1024)
+	result := JSONResult{SizeKB: n, Items: len(doc.Items)}
+
+	roundtripStart := time.Now()
+	for i := 0; i < iterations; i++ {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return result, errorWithCode(CodeInternal, "marshal failed: %v", err)
+		}
+		var decoded jsonDocument
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			return result, errorWithCode(CodeInternal, "unmarshal failed: %v", err)
+		}
+		result.Iterations++
+		result.DocumentBytes = len(data)
+		result.BytesProcessed += 2 * int64(len(data))
+	}
+	roundtripDuration := time.Since(roundtripStart)
+
+	duration := time.Since(start)
+	result.DurationUs = duration.Nanoseconds() / 1000
+	result.DurationMs = float64(duration.Nanoseconds()) / 1000000.0
+	if roundtripDuration > 0 {
+		result.ThroughputMBps = float64(result.BytesProcessed) / (1024 * 1024) / roundtripDuration.Seconds()
+	}
+	if wasRange {
+		result.RequestedRange = param
+	}
+	return result, nil
+}
+
+// getJSON handles GET requests to roundtrip a document of kb kilobytes (or a random size within a range)
+// through encoding/json. ?iterations= sets the number of roundtrips (default 1).
+func (s *apiServer) getJSON(c *gin.Context) {
+	metrics := s.beginRequestMetrics(c)
+
+	iterations, err := parseJSONIterations(c.DefaultQuery("iterations", "1"), s.limits().JSONIterations)
+	if err != nil {
+		respondParamError(c, "iterations", s.limits().JSONIterations, err)
+		return
+	}
+
+	kb := c.Param("kb")
+	result, err := roundtripJSON(c.Request.Context(), kb, iterations, s.limits().JSONKB)
+	if err != nil {
+		respondOperationError(c, "kb", s.limits().JSONKB, result, err)
+		return
+	}
+	metrics.finish()
+	respond(c, result, metrics)
+}
+
+// sortAlgorithms maps the ?algo= values accepted by /sort to in-place int sorts. "std" is the
+// standard library's pattern-defeating quicksort; the others are straightforward implementations
+// for comparing branch and cache behavior.
+var sortAlgorithms = map[string]func(data []int){
+	"std":   sort.Ints,
+	"quick": quickSort,
+	"merge": mergeSort,
+	"heap":  heapSort,
+}
+
+// sortAlgorithmNames returns the accepted ?algo= values in sorted order
+func sortAlgorithmNames() []string {
+	names := make([]string, 0, len(sortAlgorithms))
+	for name := range sortAlgorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SortResult holds the result of sorting generated data including timing
+type SortResult struct {
+	Algorithm      string  `json:"algorithm"`
+	Count          int     `json:"count"`
+	RequestedRange string  `json:"requested_range,omitempty"`
+	Reversed       bool    `json:"reversed"`
+	Sorted         bool    `json:"sorted"`
+	SortDurationUs int64   `json:"sort_duration_us"`
+	DurationUs     int64   `json:"duration_us"`
+	DurationMs     float64 `json:"duration_ms"`
+}
+
+// quickSort sorts data in place with Hoare partitioning around the middle element, recursing
+// into the smaller side so the stack stays O(log n)
+func quickSort(data []int) {
+	for len(data) > 1 {
+		pivot := data[len(data)/2]
+		i, j := 0, len(data)-1
+		for i <= j {
+			for data[i] < pivot {
+				i++
+			}
+			for data[j] > pivot {
+				j--
+			}
+			if i <= j {
+				data[i], data[j] = data[j], data[i]
+				i++
+				j--
+			}
+		}
+		if j+1 < len(data)-i {
+			quickSort(data[:j+1])
+			data = data[i:]
+		} else {
+			quickSort(data[i:])
+			data = data[:j+1]
+		}
+	}
+}
+
+// mergeSort sorts data with a bottom-up merge sort using one scratch buffer of the same size
+func mergeSort(data []int) {
+	if len(data) < 2 {
+		return
+	}
+	src, dst := data, make([]int, len(data))
+	for width := 1; width < len(data); width *= 2 {
+		for lo := 0; lo < len(data); lo += 2 * width {
+			mid := min(lo+width, len(data))
+			hi := min(lo+2*width, len(data))
+			i, j, k := lo, mid, lo
+			for i < mid && j < hi {
+				if src[j] < src[i] {
+					dst[k] = src[j]
+					j++
+				} else {
+					dst[k] = src[i]
+					i++
+				}
+				k++
+			}
+			k += copy(dst[k:], src[i:mid])
+			copy(dst[k:], src[j:hi])
+		}
+		src, dst = dst, src
+	}
+	// After an odd number of passes the sorted data is in the scratch buffer
+	if &src[0] != &data[0] {
+		copy(data, src)
+	}
+}
+
+// heapSort sorts data in place by building a max-heap and repeatedly moving its root to the end
+func heapSort(data []int) {
+	siftDown := func(root, end int) {
+		for {
+			child := 2*root + 1
+			if child >= end {
+				return
+			}
+			if child+1 < end && data[child+1] > data[child] {
+				child++
+			}
+			if data[root] >= data[child] {
+				return
+			}
+			data[root], data[child] = data[child], data[root]
+			root = child
+		}
+	}
+
+	for i := len(data)/2 - 1; i >= 0; i-- {
+		siftDown(i, len(data))
+	}
+	for end := len(data) - 1; end > 0; end-- {
+		data[0], data[end] = data[end], data[0]
+		siftDown(0, end)
+	}
+}
+
+// sortData generates n random ints and sorts them with the named algorithm, verifying the output.
+// With reverse the data is first put in descending order, the worst case for naive pivots.
+// Accepts either a single value (e.g., "100000") or a range (e.g., "10000..100000")
+func sortData(ctx context.Context, param string, algo string, reverse bool, maxN int) (SortResult, error) {
+	sortFunc, ok := sortAlgorithms[algo]
+	if !ok {
+		return SortResult{}, errorWithCode(CodeUnsupportedValue, "unsupported algorithm %q", algo)
+	}
+
+	start := time.Now()
+
+	n, wasRange, err := parseIntOrRange(ctx, param, maxN, "sort")
+	if err != nil {
+		return SortResult{}, err
+	}
+
+	data := make([]int, n)
+	loadRand.with(func(r *rand.Rand) {
+		for i := range data {
+			data[i] = r.Int()
+		}
+	})
+	if reverse {
+		sort.Sort(sort.Reverse(sort.IntSlice(data)))
+	}
+
+	sortStart := time.Now()
+	sortFunc(data)
+	sortDuration := time.Since(sortStart)
+
+	duration := time.Since(start)
+	result := SortResult{
+		Algorithm:      algo,
+		Count:          n,
+		Reversed:       reverse,
+		Sorted:         sort.IntsAreSorted(data),
+		SortDurationUs: sortDuration.Nanoseconds() / 1000,
+		DurationUs:     duration.Nanoseconds() / 1000,
+		DurationMs:     float64(duration.Nanoseconds()) / 1000000.0,
+	}
+	if wasRange {
+		result.RequestedRange = param
+	}
+	return result, nil
+}
+
+// getSort handles GET requests to sort n random ints or a random count within a range.
+// ?algo= picks std (default), quick, merge, or heap; ?reverse=1 pre-sorts the data descending.
+func (s *apiServer) getSort(c *gin.Context) {
+	metrics := s.beginRequestMetrics(c)
+
+	algo := c.DefaultQuery("algo", "std")
+	if _, ok := sortAlgorithms[algo]; !ok {
+		respondParamError(c, "algo", sortAlgorithmNames(), errorWithCode(CodeUnsupportedValue, "unsupported algorithm %q", algo))
+		return
+	}
+	reverse, err := strconv.ParseBool(c.DefaultQuery("reverse", "0"))
+	if err != nil {
+		respondParamError(c, "reverse", "0,1", errorWithCode(CodeInvalidParameter, "invalid boolean %q", c.Query("reverse")))
+		return
+	}
+
+	n := c.Param("n")
+	result, err := sortData(c.Request.Context(), n, algo, reverse, s.limits().SortN)
+	if err != nil {
+		respondParamError(c, "n", s.limits().SortN, err)
+		return
+	}
+	metrics.finish()
+	respond(c, result, metrics)
+}
+
+// MatmulResult holds the result of a matrix multiplication including throughput
+type MatmulResult struct {
+	Dim                int     `json:"dim"`
+	RequestedRange     string  `json:"requested_range,omitempty"`
+	RowsComputed       int     `json:"rows_computed"`
+	FLOPs              int64   `json:"flops"`
+	GFLOPS             float64 `json:"gflops"`
+	Checksum           float64 `json:"checksum"`
+	MultiplyDurationUs int64   `json:"multiply_duration_us"`
+	DurationUs         int64   `json:"duration_us"`
+	DurationMs         float64 `json:"duration_ms"`
+}
+
+// multiplyMatrices multiplies two random dim x dim float64 matrices with the naive i-j-k triple loop.
+// The inner loop walks b by column, so large matrices are bound by memory bandwidth rather than
+// arithmetic. FLOPs counts one multiply and one add per inner iteration (2*dim^3), and GFLOPS
+// covers the multiply step alone. Accepts either a single value (e.g., "256") or a range
+// (e.g., "128..512"). If ctx ends first it returns ctx.Err() with RowsComputed and FLOPs set
+// to the rows of the product completed.
+func multiplyMatrices(ctx context.Context, param string, maxDim int) (MatmulResult, error) {
+	start := time.Now()
+
+	dim, wasRange, err := parseIntOrRange(ctx, param, maxDim, "dimension")
+	if err != nil {
+		return MatmulResult{}, err
+	}
+
+	a := make([]float64, dim*dim)
+	b := make([]float64, dim*dim)
+	product := make([]float64, dim*dim)
+	loadRand.with(func(r *rand.Rand) {
+		for i := range a {
+			a[i] = r.Float64()
+			b[i] = r.Float64()
+		}
+	})
+
+	multiplyStart := time.Now()
+	for i := 0; i < dim; i++ {
+		if err := ctx.Err(); err != nil {
+			return MatmulResult{Dim: dim, RowsComputed: i, FLOPs: 2 * int64(i) * int64(dim) * int64(dim)}, err
+		}
+		row := a[i*dim : (i+1)*dim]
+		for j := 0; j < dim; j++ {
+			var sum float64
+			for k := 0; k < dim; k++ {
+				sum += row[k] * b[k*dim+j]
+			}
+			product[i*dim+j] = sum
+		}
+	}
+	multiplyDuration := time.Since(multiplyStart)
+
+	var checksum float64
+	for _, v := range product {
+		checksum += v
+	}
+
+	duration := time.Since(start)
+	flops := 2 * int64(dim) * int64(dim) * int64(dim)
+	result := MatmulResult{
+		Dim:                dim,
+		RowsComputed:       dim,
+		FLOPs:              flops,
+		Checksum:           checksum,
+		MultiplyDurationUs: multiplyDuration.Nanoseconds() / 1000,
+		DurationUs:         duration.Nanoseconds() / 1000,
+		DurationMs:         float64(duration.Nanoseconds()) / 1000000.0,
+	}
+	if multiplyDuration > 0 {
+		result.GFLOPS = float64(flops) / float64(multiplyDuration.Nanoseconds())
+	}
+	if wasRange {
+		result.RequestedRange = param
+	}
+	return result, nil
+}
+
+// getMatmul handles GET requests to multiply two random dim x dim matrices or a random dimension
+// within a range
+func (s *apiServer) getMatmul(c *gin.Context) {
+	metrics := s.beginRequestMetrics(c)
+
+	dim := c.Param("dim")
+	result, err := multiplyMatrices(c.Request.Context(), dim, s.limits().MatmulDim)
+	if err != nil {
+		respondOperationError(c, "dim", s.limits().MatmulDim, result, err)
+		return
+	}
+	metrics.finish()
+	respond(c, result, metrics)
+}
+
+// DiskWriteResult holds the result of a disk write including timing and throughput
+type DiskWriteResult struct {
+	SizeKB          int     `json:"size_kb"`
+	RequestedRange  string  `json:"requested_range,omitempty"`
+	BytesWritten    int64   `json:"bytes_written"`
+	WriteDurationUs int64   `json:"write_duration_us"`
+	SyncDurationUs  int64   `json:"sync_duration_us"`
+	ThroughputMBps  float64 `json:"throughput_mb_per_sec"`
+	DurationUs      int64   `json:"duration_us"`
+	DurationMs      float64 `json:"duration_ms"`
+}
+
+// writeDiskFile writes kb kilobytes of random data to a new temp file in dir (the system temp
+// directory when dir is empty) in DiskChunkSize writes, fsyncs it, and deletes it. Throughput
+// covers the writes and the fsync, so it reflects the storage device rather than the page cache.
+// Accepts either a single value (e.g., "1024") or a range (e.g., "100..1000").
+// If ctx ends first it returns ctx.Err() with BytesWritten set to the bytes written so far.
+func writeDiskFile(ctx context.Context, dir string, param string, maxKB int) (DiskWriteResult, error) {
+	start := time.Now()
+
+	n, wasRange, err := parseIntOrRange(ctx, param, maxKB, "disk write")
+	if err != nil {
+		return DiskWriteResult{}, err
+	}
+
+	chunk := make([]byte, DiskChunkSize)
+	loadRand.with(func(r *rand.Rand) {
+		r.Read(chunk)
+	})
+
+	f, err := os.CreateTemp(dir, "apex-disk-*")
+	if err != nil {
+		return DiskWriteResult{}, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	result := DiskWriteResult{SizeKB: n}
+	writeStart := time.Now()
+	for remaining := int64(n) * 1024; remaining > 0; {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		size := min(remaining, int64(len(chunk)))
+		written, err := f.Write(chunk[:size])
+		result.BytesWritten += int64(written)
+		if err != nil {
+			return result, err
+		}
+		remaining -= int64(written)
+	}
+	writeDuration := time.Since(writeStart)
+
+	syncStart := time.Now()
+	if err := f.Sync(); err != nil {
+		return result, err
+	}
+	syncDuration := time.Since(syncStart)
+
+	duration := time.Since(start)
+	result.WriteDurationUs = writeDuration.Nanoseconds() / 1000
+	result.SyncDurationUs = syncDuration.Nanoseconds() / 1000
+	result.DurationUs = duration.Nanoseconds() / 1000
+	result.DurationMs = float64(duration.Nanoseconds()) / 1000000.0
+	if ioDuration := writeDuration + syncDuration; result.BytesWritten > 0 && ioDuration > 0 {
+		result.ThroughputMBps = float64(result.BytesWritten) / (1024 * 1024) / ioDuration.Seconds()
+	}
+	if wasRange {
+		result.RequestedRange = param
+	}
+	return result, nil
+}
+
+// getDiskWrite handles GET requests to write kb kilobytes (or a random size within a range) to a
+// temp file in APEX_TMP_DIR. It is only registered when APEX_ENABLE_DISK=true, since not every
+// deployment has a writable disk. Filesystem failures are a 500, not a parameter error.
+func (s *apiServer) getDiskWrite(c *gin.Context) {
+	metrics := s.beginRequestMetrics(c)
+
+	kb := c.Param("kb")
+	result, err := writeDiskFile(c.Request.Context(), s.tmpDir, kb, s.limits().DiskWriteKB)
+	if respondDiskError(c, "write", err) {
+		return
+	}
+	if err != nil {
+		respondOperationError(c, "kb", s.limits().DiskWriteKB, result, err)
+		return
+	}
+	metrics.finish()
+	respond(c, result, metrics)
+}
+
+// respondDiskError writes a 500 when err is a filesystem failure (*fs.PathError) and reports
+// whether it did. Other errors are left to respondOperationError.
+func respondDiskError(c *gin.Context, op string, err error) bool {
+	var pathErr *fs.PathError
+	if !errors.As(err, &pathErr) {
+		return false
+	}
+	abortWithError(c, http.StatusInternalServerError, "", errorWithCode(CodeDiskIO, "disk %s failed: %w", op, err))
+	return true
+}
+
+// diskReadFile is the backing file for /disk/read: filled with random data once at startup so
+// reads measure I/O without any write or generation cost. Concurrent reads are safe since each
+// uses ReadAt with its own offset.
+type diskReadFile struct {
+	file *os.File
+	size int64
+}
+
+// newDiskReadFile creates a kb-kilobyte backing file of random data in dir (the system temp
+// directory when dir is empty) and syncs it to disk. Callers must call close to remove it.
+func newDiskReadFile(dir string, kb int) (*diskReadFile, error) {
+	if kb <= 0 {
+		return nil, fmt.Errorf("backing file size must be positive, got %d KB", kb)
+	}
+	f, err := os.CreateTemp(dir, "apex-disk-read-*")
+	if err != nil {
+		return nil, err
+	}
+
+	chunk := make([]byte, DiskChunkSize)
+	for remaining := int64(kb) * 1024; remaining > 0; remaining -= int64(len(chunk)) {
+		loadRand.with(func(r *rand.Rand) {
+			r.Read(chunk)
+		})
+		if _, err := f.Write(chunk[:min(remaining, int64(len(chunk)))]); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return nil, err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return &diskReadFile{file: f, size: int64(kb) * 1024}, nil
+}
+
+// close closes and removes the backing file
+func (d *diskReadFile) close() error {
+	if err := d.file.Close(); err != nil {
+		return err
+	}
+	return os.Remove(d.file.Name())
+}
+
+// DiskReadResult holds the result of a disk read including timing and throughput
+type DiskReadResult struct {
+	SizeKB         int     `json:"size_kb"`
+	RequestedRange string  `json:"requested_range,omitempty"`
+	BytesRead      int64   `json:"bytes_read"`
+	FileBytes      int64   `json:"file_bytes"`
+	Wraps          int     `json:"wraps"`
+	ThroughputMBps float64 `json:"throughput_mb_per_sec"`
+	DurationUs     int64   `json:"duration_us"`
+	DurationMs     float64 `json:"duration_ms"`
+}
+
+// read reads kb kilobytes from the backing file sequentially from the start in DiskChunkSize
+// reads, wrapping back to the start when it reaches the end; Wraps counts how often it did.
+// Reads go through the OS page cache, so a backing file smaller than free memory is mostly
+// served from RAM after the first pass.
+// Accepts either a single value (e.g., "1024") or a range (e.g., "100..1000").
+// If ctx ends first it returns ctx.Err() with BytesRead set to the bytes read so far.
+func (d *diskReadFile) read(ctx context.Context, param string, maxKB int) (DiskReadResult, error) {
+	start := time.Now()
+
+	n, wasRange, err := parseIntOrRange(ctx, param, maxKB, "disk read")
+	if err != nil {
+		return DiskReadResult{}, err
+	}
+
+	result := DiskReadResult{SizeKB: n, FileBytes: d.size}
+	buf := make([]byte, DiskChunkSize)
+	var offset int64
+	for remaining := int64(n) * 1024; remaining > 0; {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		if offset == d.size {
+			offset = 0
+			result.Wraps++
+		}
+		size := min(remaining, int64(len(buf)), d.size-offset)
+		read, err := d.file.ReadAt(buf[:size], offset)
+		result.BytesRead += int64(read)
+		if err != nil {
+			return result, err
+		}
+		offset += int64(read)
+		remaining -= int64(read)
+	}
+
+	duration := time.Since(start)
+	result.DurationUs = duration.Nanoseconds() / 1000
+	result.DurationMs = float64(duration.Nanoseconds()) / 1000000.0
+	if result.BytesRead > 0 && duration > 0 {
+		result.ThroughputMBps = float64(result.BytesRead) / (1024 * 1024) / duration.Seconds()
+	}
+	if wasRange {
+		result.RequestedRange = param
+	}
+	return result, nil
+}
+
+// getDiskRead handles GET requests to read kb kilobytes (or a random size within a range) from
+// the backing file created at startup. Registered alongside /disk/write when APEX_ENABLE_DISK=true.
+func (s *apiServer) getDiskRead(c *gin.Context) {
+	metrics := s.beginRequestMetrics(c)
+
+	kb := c.Param("kb")
+	result, err := s.diskReadFile.read(c.Request.Context(), kb, s.limits().DiskReadKB)
+	if respondDiskError(c, "read", err) {
+		return
+	}
+	if err != nil {
+		respondOperationError(c, "kb", s.limits().DiskReadKB, result, err)
+		return
+	}
+	metrics.finish()
+	respond(c, result, metrics)
+}
+
+// errFetchNotAllowed is returned for /fetch URLs whose host is not in APEX_FETCH_ALLOWLIST
+var errFetchNotAllowed error = &codedError{code: CodeNotAllowed, err: errors.New("host not in APEX_FETCH_ALLOWLIST")}
+
+// parseFetchAllowlist splits a comma-separated APEX_FETCH_ALLOWLIST into lowercase host entries.
+// An entry is either a hostname, which allows any port, or host:port.
+func parseFetchAllowlist(raw string) []string {
+	var hosts []string
+	for _, entry := range strings.Split(raw, ",") {
+		if entry = strings.ToLower(strings.TrimSpace(entry)); entry != "" {
+			hosts = append(hosts, entry)
+		}
+	}
+	return hosts
+}
+
+// checkFetchURL rejects URLs that are not plain http(s) or whose host is not allowlisted
+func (s *apiServer) checkFetchURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errorWithCode(CodeUnsupportedValue, "unsupported scheme %q", u.Scheme)
+	}
+	host, hostname := strings.ToLower(u.Host), strings.ToLower(u.Hostname())
+	for _, allowed := range s.fetchAllowlist {
+		if allowed == hostname || allowed == host {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q", errFetchNotAllowed, hostname)
+}
+
+// FetchResult holds the result of downloading from a URL including timing and throughput
+type FetchResult struct {
+	URL                string  `json:"url"`
+	StatusCode         int     `json:"status_code"`
+	MaxBytes           int     `json:"max_bytes"`
+	RequestedRange     string  `json:"requested_range,omitempty"`
+	BytesRead          int64   `json:"bytes_read"`
+	TimeToFirstByteUs  int64   `json:"time_to_first_byte_us"`
+	DownloadDurationUs int64   `json:"download_duration_us"`
+	ThroughputMBps     float64 `json:"throughput_mb_per_sec"`
+	DurationUs         int64   `json:"duration_us"`
+	DurationMs         float64 `json:"duration_ms"`
+}
+
+// fetchURL GETs rawURL and reads up to param bytes of the body, discarding them. The upstream
+// status is reported rather than treated as an error, since any response exercises the path.
+// Throughput covers reading the body, after the response headers arrived.
+// Accepts either a single value (e.g., "1048576") or a range (e.g., "1024..1048576").
+// If ctx ends first it returns ctx.Err() with BytesRead set to the bytes read so far.
+func (s *apiServer) fetchURL(ctx context.Context, rawURL string, param string, maxBytes int) (FetchResult, error) {
+	start := time.Now()
+
+	n, wasRange, err := parseIntOrRange(ctx, param, maxBytes, "bytes")
+	if err != nil {
+		return FetchResult{}, err
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return FetchResult{}, err
+	}
+	if err := s.checkFetchURL(u); err != nil {
+		return FetchResult{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return FetchResult{}, err
+	}
+	resp, err := s.fetchClient.Do(req)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return FetchResult{URL: u.String(), MaxBytes: n}, ctxErr
+		}
+		return FetchResult{}, err
+	}
+	defer resp.Body.Close()
+	firstByte := time.Since(start)
+
+	result := FetchResult{URL: u.String(), StatusCode: resp.StatusCode, MaxBytes: n}
+	downloadStart := time.Now()
+	result.BytesRead, err = io.Copy(io.Discard, io.LimitReader(resp.Body, int64(n)))
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return result, ctxErr
+		}
+		return FetchResult{}, err
+	}
+	downloadDuration := time.Since(downloadStart)
+
+	duration := time.Since(start)
+	result.TimeToFirstByteUs = firstByte.Nanoseconds() / 1000
+	result.DownloadDurationUs = downloadDuration.Nanoseconds() / 1000
+	result.DurationUs = duration.Nanoseconds() / 1000
+	result.DurationMs = float64(duration.Nanoseconds()) / 1000000.0
+	if result.BytesRead > 0 && downloadDuration > 0 {
+		result.ThroughputMBps = float64(result.BytesRead) / (1024 * 1024) / downloadDuration.Seconds()
+	}
+	if wasRange {
+		result.RequestedRange = param
+	}
+	return result, nil
+}
+
+// respondFetchError writes the error for a rejected or failed /fetch: a 403 when the host (or a
+// redirect's host) is not allowlisted, a 400 for a malformed or non-http(s) URL before any request
+// was made, and a 502 when the upstream request itself failed
+func respondFetchError(c *gin.Context, allowlist []string, err error) {
+	var upstreamErr *url.Error
+	switch {
+	case errors.Is(err, errFetchNotAllowed):
+		writeError(c, http.StatusForbidden, ErrorDetail{
+			Param:   "url",
+			Message: err.Error(),
+			Code:    CodeNotAllowed,
+			Limit:   formatLimit(allowlist),
+		})
+	case errors.As(err, &upstreamErr) && upstreamErr.Op != "parse":
+		abortWithError(c, http.StatusBadGateway, "url", errorWithCode(CodeUpstreamError, "fetch failed: %w", err))
+	default:
+		respondParamError(c, "url", []string{"http", "https"}, err)
+	}
+}
+
+// getFetch handles GET requests to download up to ?bytes= (default: the limit) from ?url=, for
+// load on outbound network paths. Only hosts in APEX_FETCH_ALLOWLIST may be fetched, so with
+// the default empty allowlist every request is a 403. Upstream connection failures are a 502.
+func (s *apiServer) getFetch(c *gin.Context) {
+	metrics := s.beginRequestMetrics(c)
+
+	bytesParam := c.DefaultQuery("bytes", strconv.Itoa(s.limits().FetchBytes))
+	if _, _, err := parseIntOrRange(c.Request.Context(), bytesParam, s.limits().FetchBytes, "bytes"); err != nil {
+		respondParamError(c, "bytes", s.limits().FetchBytes, err)
+		return
+	}
+	u, err := url.Parse(c.Query("url"))
+	if err == nil {
+		err = s.checkFetchURL(u)
+	}
+	if err != nil {
+		respondFetchError(c, s.fetchAllowlist, err)
+		return
+	}
+
+	result, err := s.fetchURL(c.Request.Context(), u.String(), bytesParam, s.limits().FetchBytes)
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		respondOperationError(c, "bytes", s.limits().FetchBytes, result, err)
+		return
+	}
+	if err != nil {
+		respondFetchError(c, s.fetchAllowlist, err)
+		return
+	}
+	metrics.finish()
+	respond(c, result, metrics)
+}
+
+// EchoResult holds the size and SHA-256 digest of a POST /echo request body including timing
+type EchoResult struct {
+	BytesRead      int64   `json:"bytes_read"`
+	MaxBytes       int     `json:"max_bytes"`
+	SHA256         string  `json:"sha256"`
+	ThroughputMBps float64 `json:"throughput_mb_per_sec"`
+	DurationUs     int64   `json:"duration_us"`
+	DurationMs     float64 `json:"duration_ms"`
+}
+
+// readEcho reads body in DiskChunkSize chunks through a SHA-256 digest, also copying it into echo
+// when that is non-nil, and checks ctx between chunks. The caller bounds body with
+// http.MaxBytesReader, whose error comes back unwrapped.
+func readEcho(ctx context.Context, body io.Reader, maxBytes int, echo *bytes.Buffer) (EchoResult, error) {
+	start := time.Now()
+	result := EchoResult{MaxBytes: maxBytes}
+	digest := sha256.New()
+	chunk := make([]byte, DiskChunkSize)
+
+	var err error
+	for {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		var n int
+		n, err = body.Read(chunk)
+		digest.Write(chunk[:n])
+		if echo != nil {
+			echo.Write(chunk[:n])
+		}
+		result.BytesRead += int64(n)
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			break
+		}
+	}
+
+	duration := time.Since(start)
+	result.SHA256 = hex.EncodeToString(digest.Sum(nil))
+	if duration > 0 {
+		result.ThroughputMBps = float64(result.BytesRead) / (1024 * 1024) / duration.Seconds()
+	}
+	result.DurationUs = duration.Nanoseconds() / 1000
+	result.DurationMs = float64(duration.Nanoseconds()) / 1000000.0
+	return result, err
+}
+
+// postEcho handles POST /echo: it reads the request body (up to loadLimits.EchoBytes, enforced
+// with http.MaxBytesReader) to exercise inbound bandwidth and reports its size and SHA-256. With
+// ?echo=1 the body is sent back verbatim with the request's Content-Type instead.
+func (s *apiServer) postEcho(c *gin.Context) {
+	metrics := s.beginRequestMetrics(c)
+
+	echo, err := strconv.ParseBool(c.DefaultQuery("echo", "0"))
+	if err != nil {
+		respondParamError(c, "echo", "0,1", errorWithCode(CodeInvalidParameter, "invalid boolean %q", c.Query("echo")))
+		return
+	}
+
+	maxBytes := s.limits().EchoBytes
+	var echoed *bytes.Buffer
+	if echo {
+		echoed = &bytes.Buffer{}
+	}
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, int64(maxBytes))
+	result, err := readEcho(c.Request.Context(), body, maxBytes, echoed)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			err = errorWithCode(CodeBodyTooLarge, "request body exceeds %d bytes", maxBytes)
+		}
+		respondOperationError(c, "body", maxBytes, result, err)
+		return
+	}
+
+	if echo {
+		contentType := c.GetHeader("Content-Type")
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		writeWithLength(c, http.StatusOK, contentType, echoed.Bytes())
+		return
+	}
+	metrics.finish()
+	respond(c, result, metrics)
+}
+
+// HexResult holds the result of hex string generation including timing
+type HexResult struct {
+	SizeKB         int     `json:"size_kb"`
+	RequestedRange string  `json:"requested_range,omitempty"`
+	Length         int     `json:"length"`
+	HexString      string  `json:"hex_string"`
+	Encoding       string  `json:"encoding,omitempty"`
+	DurationUs     int64   `json:"duration_us"`
+	DurationMs     float64 `json:"duration_ms"`
+}
+
+// HexStreamChunkSize is the number of hex bytes written per chunk by /hex/stream
+const HexStreamChunkSize = 32 * 1024
+
+// Hex scratch buffers are pooled in power-of-two size classes from 1 KB to 16 MB
+const (
+	hexPoolMinBits = 10
+	hexPoolMaxBits = 24
+)
+
+// hexBufferPools recycles hex scratch buffers, one pool per size class, so repeated hex requests
+// reuse memory instead of allocating n*1024 bytes each time. Pointers to slices are pooled so Put
+// doesn't allocate. Buffers above the largest class (only with a raised APEX_MAX_HEX_KB) bypass it.
+var hexBufferPools [hexPoolMaxBits - hexPoolMinBits + 1]sync.Pool
+
+// hexBufferClass returns the pool index whose buffers hold size bytes, or -1 if size is too large to pool
+func hexBufferClass(size int) int {
+	if size <= 1<<hexPoolMinBits {
+		return 0
+	}
+	class := bits.Len(uint(size-1)) - hexPoolMinBits
+	if class >= len(hexBufferPools) {
+		return -1
+	}
+	return class
+}
+
+// getHexBuffer returns a buffer of length size, taken from the pool for its size class when one is
+// free. Callers hand it back with putHexBuffer once nothing references its contents.
+func getHexBuffer(size int) *[]byte {
+	class := hexBufferClass(size)
+	if class < 0 {
+		buf := make([]byte, size)
+		return &buf
+	}
+	if buf, ok := hexBufferPools[class].Get().(*[]byte); ok {
+		*buf = (*buf)[:size]
+		return buf
+	}
+	buf := make([]byte, size, 1<<(class+hexPoolMinBits))
+	return &buf
+}
+
+// putHexBuffer returns a buffer obtained from getHexBuffer to its pool
+func putHexBuffer(buf *[]byte) {
+	if class := hexBufferClass(cap(*buf)); class >= 0 && cap(*buf) == 1<<(class+hexPoolMinBits) {
+		hexBufferPools[class].Put(buf)
+	}
+}
+
+// hexRandBlock is how many random bytes fillHex reads at a time; each becomes two hex characters
+const hexRandBlock = 2048
+
+// fillHex fills buf with random lowercase hex characters. Random bytes are read in hexRandBlock
+// blocks into a stack array and hex.Encode'd into buf, so each RNG call yields 16 characters rather
+// than one. An odd-length buf gets its last character from the low nibble of one extra byte.
+// If ctx ends first it stops and returns the number of bytes filled along with ctx.Err().
+func fillHex(ctx context.Context, buf []byte) (int, error) {
+	const hexChars = "0123456789abcdef"
+	var raw [hexRandBlock]byte
+	filled := 0
+	var err error
+	loadRand.with(func(r *rand.Rand) {
+		for filled < len(buf) {
+			// One check per 64 KB keeps the overhead negligible
+			if filled%(64*cancelCheckInterval) == 0 {
+				if err = ctx.Err(); err != nil {
+					return
+				}
+			}
+			n := min((len(buf)-filled+1)/2, len(raw))
+			r.Read(raw[:n])
+			if filled+2*n > len(buf) {
+				hex.Encode(buf[filled:], raw[:n-1])
+				buf[len(buf)-1] = hexChars[raw[n-1]&0x0f]
+				filled = len(buf)
+			} else {
+				filled += hex.Encode(buf[filled:], raw[:n])
+			}
+		}
+	})
+	return filled, err
+}
+
+// fillRandom fills buf with random bytes from loadRand. If ctx ends first it stops and returns
+// the number of bytes filled along with ctx.Err().
+func fillRandom(ctx context.Context, buf []byte) (int, error) {
+	filled := 0
+	var err error
+	loadRand.with(func(r *rand.Rand) {
+		for filled < len(buf) {
+			// One check per 64 KB, as in fillHex
+			if err = ctx.Err(); err != nil {
+				return
+			}
+			n, _ := r.Read(buf[filled:min(len(buf), filled+64*cancelCheckInterval)])
+			filled += n
+		}
+	})
+	return filled, err
+}
+
+// hexEncodings maps the ?encoding= values accepted by /hex and /hex/stream to the payload length
+// for size KB. hex (the default) is size KB of hex characters; base64 encodes size KB of random
+// bytes, so its payload is about 4/3 as long and carries 6 bits per character instead of 4.
+var hexEncodings = map[string]func(sizeKB int) int{
+	"hex":    func(sizeKB int) int { return sizeKB * 1024 },
+	"base64": func(sizeKB int) int { return base64.StdEncoding.EncodedLen(sizeKB * 1024) },
+}
+
+// hexEncodingNames returns the accepted ?encoding= values in sorted order
+func hexEncodingNames() []string {
+	names := make([]string, 0, len(hexEncodings))
+	for name := range hexEncodings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// createHexString generates a hex string of specified size in kilobytes.
+// Accepts either a single value (e.g., "100" or "1MB") or a range (e.g., "100..500").
+// The hex is generated into a pooled scratch buffer, so the string copy is the only allocation of its size.
+// If ctx ends first it returns ctx.Err() with Length set to the bytes generated and no HexString.
+func createHexString(ctx context.Context, param string, maxKB int) (HexResult, error) {
+	return createEncodedString(ctx, param, "hex", maxKB)
+}
+
+// createEncodedString is createHexString with a choice of hexEncodings. With "base64" it generates
+// size KB of random bytes and base64-encodes them (Encoding "base64"), so Length is the encoded length.
+func createEncodedString(ctx context.Context, param, encoding string, maxKB int) (HexResult, error) {
+	n, wasRange, err := parseSizeKBOrRange(ctx, param, maxKB, "hex")
+	if err != nil {
+		return HexResult{}, err
+	}
+	result, err := encodeRandomKB(ctx, n, encoding)
+	if err != nil {
+		return result, err
+	}
+
+	// Only include requested_range if it was a range
+	if wasRange {
+		result.RequestedRange = param
+	}
+
+	return result, nil
+}
+
+// encodeRandomKB is createEncodedString for an already parsed size of n KB
+func encodeRandomKB(ctx context.Context, n int, encoding string) (HexResult, error) {
+	start := time.Now()
+
+	// The default encoding is left out of the result so hex responses are unchanged
+	reported := encoding
+	if encoding == "hex" {
+		reported = ""
+	}
+
+	buf := getHexBuffer(n * 1024)
+	defer putHexBuffer(buf)
+	var payload []byte
+	var filled int
+	var err error
+	if encoding == "base64" {
+		filled, err = fillRandom(ctx, *buf)
+		out := getHexBuffer(hexEncodings[encoding](n))
+		defer putHexBuffer(out)
+		payload = (*out)[:base64.StdEncoding.EncodedLen(filled)]
+		base64.StdEncoding.Encode(payload, (*buf)[:filled])
+	} else {
+		filled, err = fillHex(ctx, *buf)
+		payload = (*buf)[:filled]
+	}
+	if err != nil {
+		duration := time.Since(start)
+		return HexResult{
+			SizeKB:     n,
+			Length:     len(payload),
+			Encoding:   reported,
+			DurationUs: duration.Nanoseconds() / 1000,
+			DurationMs: float64(duration.Nanoseconds()) / 1000000.0,
+		}, err
+	}
+
+	hexString := string(payload)
+	duration := time.Since(start)
+
+	return HexResult{
+		SizeKB:     n,
+		Length:     len(hexString),
+		HexString:  hexString,
+		Encoding:   reported,
+		DurationUs: duration.Nanoseconds() / 1000,
+		DurationMs: float64(duration.Nanoseconds()) / 1000000.0,
+	}, nil
+}
+
+// getHexString handles GET requests to generate a hex string of n kilobytes or a random size within a range.
+// ?encoding=base64 returns n KB of random bytes base64-encoded instead.
+func (s *apiServer) getHexString(c *gin.Context) {
+	metrics := s.beginRequestMetrics(c)
+
+	encoding := c.DefaultQuery("encoding", "hex")
+	if _, ok := hexEncodings[encoding]; !ok {
+		respondParamError(c, "encoding", hexEncodingNames(), errorWithCode(CodeUnsupportedValue, "unsupported encoding %q", encoding))
+		return
+	}
+
+	h := c.Param("h")
+	result, err := createEncodedString(c.Request.Context(), h, encoding, s.limits().HexKB)
+	if err != nil {
+		respondOperationError(c, "h", s.limits().HexKB, result, err)
+		return
+	}
+	metrics.finish()
+	respond(c, result, metrics)
+}
+
+// getHexStream handles GET requests to stream h kilobytes of random hex (or a random size within a range)
+// as text/plain. The payload is generated and written in HexStreamChunkSize chunks, so memory use stays
+// constant regardless of h. There is no JSON envelope or request_metrics block.
+// With ?encoding=base64 it streams h KB of random bytes base64-encoded; each chunk encodes a multiple
+// of 3 bytes, so padding only ever appears at the very end.
+func (s *apiServer) getHexStream(c *gin.Context) {
+	encoding := c.DefaultQuery("encoding", "hex")
+	encodedLen, ok := hexEncodings[encoding]
+	if !ok {
+		respondParamError(c, "encoding", hexEncodingNames(), errorWithCode(CodeUnsupportedValue, "unsupported encoding %q", encoding))
+		return
+	}
+
+	h := c.Param("h")
+	n, _, err := parseSizeKBOrRange(c.Request.Context(), h, s.limits().HexKB, "hex")
+	if err != nil {
+		respondParamError(c, "h", s.limits().HexKB, err)
+		return
+	}
+
+	// remaining counts hex characters, or random bytes still to encode for base64
+	remaining := n * 1024
+	buf := getHexBuffer(HexStreamChunkSize)
+	defer putHexBuffer(buf)
+	chunk := *buf
+	var raw []byte
+	if encoding == "base64" {
+		rawBuf := getHexBuffer(base64.StdEncoding.DecodedLen(HexStreamChunkSize))
+		defer putHexBuffer(rawBuf)
+		raw = *rawBuf
+	}
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Header("Content-Length", strconv.Itoa(encodedLen(n)))
+	c.Status(http.StatusOK)
+	c.Stream(func(w io.Writer) bool {
+		if remaining == 0 {
+			return false
+		}
+		var out []byte
+		if raw != nil {
+			size := min(remaining, len(raw))
+			if _, err := fillRandom(c.Request.Context(), raw[:size]); err != nil {
+				return false
+			}
+			out = chunk[:base64.StdEncoding.EncodedLen(size)]
+			base64.StdEncoding.Encode(out, raw[:size])
+			remaining -= size
+		} else {
+			size := min(remaining, len(chunk))
+			if _, err := fillHex(c.Request.Context(), chunk[:size]); err != nil {
+				return false
+			}
+			out = chunk[:size]
+			remaining -= size
+		}
+		if _, err := w.Write(out); err != nil {
+			return false
+		}
+		return remaining > 0
+	})
+}
+
+const (
+	// DefaultDripBytes is the /drip size when ?bytes= is omitted
+	DefaultDripBytes = 1024
+	// DefaultDripDuration is the /drip duration when ?duration= is omitted (capped at the configured maximum)
+	DefaultDripDuration = 2 * time.Second
+	// DripInterval is the target gap between /drip writes; short drips use fewer, larger writes
+	DripInterval = 100 * time.Millisecond
+)
+
+// getDrip handles GET requests that trickle ?bytes= of random hex over ?duration= as text/plain, to
+// exercise client read timeouts and streaming. The body is written in evenly spaced, flushed steps
+// about DripInterval apart, the last one landing at the full duration. Like /hex/stream there is no
+// JSON envelope; Content-Length is set up front, so a drip cut short by the client or ?timeout=
+// leaves the body shorter than advertised.
+func (s *apiServer) getDrip(c *gin.Context) {
+	n, _, err := parseIntOrRange(c.Request.Context(), c.DefaultQuery("bytes", strconv.Itoa(DefaultDripBytes)), s.limits().DripBytes, "bytes")
+	if err != nil {
+		respondParamError(c, "bytes", s.limits().DripBytes, err)
+		return
+	}
+	d, err := parseDurationParam(c.DefaultQuery("duration", min(DefaultDripDuration, s.limits().DripDuration).String()), s.limits().DripDuration)
+	if err != nil {
+		respondParamError(c, "duration", s.limits().DripDuration, err)
+		return
+	}
+
+	// At least one step, and at most one per byte
+	steps := max(1, min(int(d/DripInterval), n))
+	ctx := c.Request.Context()
+	start := time.Now()
+	buf := getHexBuffer(min(n, HexStreamChunkSize))
+	defer putHexBuffer(buf)
+	chunk := *buf
+	step, written := 0, 0
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Header("Content-Length", strconv.Itoa(n))
+	c.Status(http.StatusOK)
+	// Send the headers right away; only the body trickles
+	c.Writer.Flush()
+	if n == 0 {
+		return
+	}
+	c.Stream(func(w io.Writer) bool {
+		step++
+		timer := time.NewTimer(time.Until(start.Add(d * time.Duration(step) / time.Duration(steps))))
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return false
+		case <-timer.C:
+		}
+
+		for target := n * step / steps; written < target; {
+			size := min(target-written, len(chunk))
+			if _, err := fillHex(ctx, chunk[:size]); err != nil {
+				return false
+			}
+			if _, err := w.Write(chunk[:size]); err != nil {
+				return false
+			}
+			written += size
+		}
+		return step < steps
+	})
+}
+
+// QueryPhase holds the timing of a single phase of a simulated query
+type QueryPhase struct {
+	Name       string  `json:"name"`
+	Rows       int     `json:"rows"`
+	DurationUs int64   `json:"duration_us"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// QueryResult holds the result of a simulated database query including per-phase timing
+type QueryResult struct {
+	Rows           int          `json:"rows"`
+	RequestedRange string       `json:"requested_range,omitempty"`
+	Joins          int          `json:"joins"`
+	RowsProcessed  int          `json:"rows_processed"`
+	ResultRows     int          `json:"result_rows"`
+	Phases         []QueryPhase `json:"phases"`
+	DurationUs     int64        `json:"duration_us"`
+	DurationMs     float64      `json:"duration_ms"`
+}
+
+// queryRow is a generated table row; ForeignKey references the ID of a row in the next table
+type queryRow struct {
+	ID         int
+	ForeignKey int
+	Value      int
+}
+
+// generateQueryTable creates n rows with sequential IDs and random foreign keys and values
+func generateQueryTable(n int) []queryRow {
+	rows := make([]queryRow, n)
+	loadRand.with(func(r *rand.Rand) {
+		for i := range rows {
+			rows[i] = queryRow{
+				ID:         i,
+				ForeignKey: r.Intn(n),
+				Value:      r.Intn(1000000),
+			}
+		}
+	})
+	return rows
+}
+
+// simulateQuery models a data-service request: it generates n rows, nested-loop joins them
+// against `joins` further generated tables, filters the result, and sorts it.
+// Accepts either a single value (e.g., "1000") or a range (e.g., "500..2000") up to maxRows.
+// If ctx ends during a join it returns ctx.Err() with the phases completed so far.
+func simulateQuery(ctx context.Context, param string, joins int, maxRows int) (QueryResult, error) {
+	start := time.Now()
+
+	n, wasRange, err := parseIntOrRange(ctx, param, maxRows, "query")
+	if err != nil {
+		return QueryResult{}, err
+	}
+
+	var phases []QueryPhase
+	rowsProcessed := 0
+	recordPhase := func(name string, rows int, phaseStart time.Time) {
+		duration := time.Since(phaseStart)
+		phases = append(phases, QueryPhase{
+			Name:       name,
+			Rows:       rows,
+			DurationUs: duration.Nanoseconds() / 1000,
+			DurationMs: float64(duration.Nanoseconds()) / 1000000.0,
+		})
+		rowsProcessed += rows
+	}
+
+	phaseStart := time.Now()
+	current := generateQueryTable(n)
+	recordPhase("scan", len(current), phaseStart)
+
+	for j := 0; j < joins; j++ {
+		phaseStart = time.Now()
+		table := generateQueryTable(n)
+		joined := make([]queryRow, 0, len(current))
+		// Nested-loop join: compare every left row against every right row
+		for i, left := range current {
+			// Each left row scans the whole right table, so check every few rows
+			if i%64 == 0 {
+				if err := ctx.Err(); err != nil {
+					return QueryResult{Rows: n, Joins: joins, RowsProcessed: rowsProcessed, Phases: phases}, err
+				}
+			}
+			for _, right := range table {
+				if left.ForeignKey == right.ID {
+					joined = append(joined, queryRow{
+						ID:         left.ID,
+						ForeignKey: right.ForeignKey,
+						Value:      (left.Value + right.Value) % 1000000,
+					})
+				}
+			}
+		}
+		current = joined
+		recordPhase(fmt.Sprintf("join_%d", j+1), len(current)*len(table), phaseStart)
+	}
+
+	phaseStart = time.Now()
+	filtered := current[:0]
+	for _, row := range current {
+		if row.Value%2 == 0 {
+			filtered = append(filtered, row)
+		}
+	}
+	recordPhase("filter", len(current), phaseStart)
+
+	phaseStart = time.Now()
+	sort.Slice(filtered, func(i, j int) bool {
+		if filtered[i].Value != filtered[j].Value {
+			return filtered[i].Value > filtered[j].Value
+		}
+		return filtered[i].ID < filtered[j].ID
+	})
+	recordPhase("sort", len(filtered), phaseStart)
+
+	duration := time.Since(start)
+
+	queryResult := QueryResult{
+		Rows:          n,
+		Joins:         joins,
+		RowsProcessed: rowsProcessed,
+		ResultRows:    len(filtered),
+		Phases:        phases,
+		DurationUs:    duration.Nanoseconds() / 1000,
+		DurationMs:    float64(duration.Nanoseconds()) / 1000000.0,
+	}
+
+	// Only include requested_range if it was a range
+	if wasRange {
+		queryResult.RequestedRange = param
+	}
+
+	return queryResult, nil
+}
+
+// getQuery handles GET requests to simulate a database query over n rows with an optional joins count.
+func (s *apiServer) getQuery(c *gin.Context) {
+	metrics := s.beginRequestMetrics(c)
+
+	joins, _, err := parseIntOrRange(c.Request.Context(), c.DefaultQuery("joins", "1"), s.limits().QueryJoins, "joins")
+	if err != nil {
+		respondParamError(c, "joins", s.limits().QueryJoins, err)
+		return
+	}
+
+	n := c.Param("n")
+	result, err := simulateQuery(c.Request.Context(), n, joins, s.limits().QueryRows)
+	if err != nil {
+		respondOperationError(c, "n", s.limits().QueryRows, result, err)
+		return
+	}
+	metrics.finish()
+	respond(c, result, metrics)
+}
+
+// CollatzResult holds the longest Collatz stopping time found for 1..n including timing
+type CollatzResult struct {
+	N               int     `json:"n"`
+	RequestedRange  string  `json:"requested_range,omitempty"`
+	MaxStoppingTime int     `json:"max_stopping_time"`
+	MaxStartingN    int     `json:"max_starting_n"`
+	TotalSteps      int64   `json:"total_steps"`
+	DurationUs      int64   `json:"duration_us"`
+	DurationMs      float64 `json:"duration_ms"`
+}
+
+// collatzStoppingTime counts the steps the Collatz map (n/2 if even, 3n+1 if odd) takes to reach 1
+func collatzStoppingTime(n uint64) int {
+	steps := 0
+	for n != 1 {
+		if n%2 == 0 {
+			n /= 2
+		} else {
+			n = 3*n + 1
+		}
+		steps++
+	}
+	return steps
+}
+
+// findCollatzMax computes the stopping time of every integer from 1 to n and reports the longest.
+// Each sequence is walked in full with no memoization, keeping the load branch-heavy and cache-light.
+// Accepts either a single value (e.g., "100000") or a range (e.g., "1000..100000").
+// If ctx ends first it returns ctx.Err() with the maximum found so far.
+func findCollatzMax(ctx context.Context, param string, maxN int) (CollatzResult, error) {
+	start := time.Now()
+
+	n, wasRange, err := parseIntOrRange(ctx, param, maxN, "collatz")
+	if err != nil {
+		return CollatzResult{}, err
+	}
+
+	result := CollatzResult{N: n}
+	for i := 1; i <= n; i++ {
+		if i%cancelCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return result, err
+			}
+		}
+		steps := collatzStoppingTime(uint64(i))
+		result.TotalSteps += int64(steps)
+		if steps > result.MaxStoppingTime || result.MaxStartingN == 0 {
+			result.MaxStoppingTime = steps
+			result.MaxStartingN = i
+		}
+	}
+
+	duration := time.Since(start)
+	result.DurationUs = duration.Nanoseconds() / 1000
+	result.DurationMs = float64(duration.Nanoseconds()) / 1000000.0
+	if wasRange {
+		result.RequestedRange = param
+	}
+	return result, nil
+}
+
+// getCollatz handles GET requests to find the longest Collatz stopping time up to n or a random bound within a range.
+func (s *apiServer) getCollatz(c *gin.Context) {
+	metrics := s.beginRequestMetrics(c)
+
+	n := c.Param("n")
+	result, err := findCollatzMax(c.Request.Context(), n, s.limits().CollatzN)
+	if err != nil {
+		respondOperationError(c, "n", s.limits().CollatzN, result, err)
+		return
+	}
+	metrics.finish()
+	respond(c, result, metrics)
+}
+
+// GoroutinesResult holds the outcome of a goroutine fan-out including scheduling latency
+type GoroutinesResult struct {
+	N                   int     `json:"n"`
+	RequestedRange      string  `json:"requested_range,omitempty"`
+	Spawned             int     `json:"spawned"`
+	PeakConcurrent      int64   `json:"peak_concurrent"`
+	SpawnUs             int64   `json:"spawn_us"`
+	SchedLatencyTotalUs int64   `json:"sched_latency_total_us"`
+	SchedLatencyMaxUs   int64   `json:"sched_latency_max_us"`
+	DurationUs          int64   `json:"duration_us"`
+	DurationMs          float64 `json:"duration_ms"`
+}
+
+// storeMax raises v to x if x is larger, retrying when another goroutine updates v concurrently
+func storeMax(v *atomic.Int64, x int64) {
+	for cur := v.Load(); x > cur; cur = v.Load() {
+		if v.CompareAndSwap(cur, x) {
+			return
+		}
+	}
+}
+
+// spawnGoroutines starts n goroutines that each sleep for GoroutineSleep, then waits for all of them.
+// Each goroutine records how long it waited between go and its first instruction (scheduling latency)
+// and bumps a shared live counter, whose high-water mark is reported as peak_concurrent.
+// Accepts either a single value (e.g., "10000") or a range (e.g., "1000..10000").
+// If ctx ends first it stops spawning, waits for the goroutines already started, and returns
+// ctx.Err() with the partial result, so no goroutines outlive the request.
+func spawnGoroutines(ctx context.Context, param string, maxN int) (GoroutinesResult, error) {
+	start := time.Now()
+
+	n, wasRange, err := parseIntOrRange(ctx, param, maxN, "goroutines")
+	if err != nil {
+		return GoroutinesResult{}, err
+	}
+
+	var (
+		wg           sync.WaitGroup
+		live, peak   atomic.Int64
+		latencyTotal atomic.Int64
+		latencyMax   atomic.Int64
+	)
+	result := GoroutinesResult{N: n}
+	for i := 0; i < n; i++ {
+		if i%cancelCheckInterval == 0 {
+			if err = ctx.Err(); err != nil {
+				break
+			}
+		}
+		wg.Add(1)
+		spawnedAt := time.Now()
+		go func() {
+			defer wg.Done()
+			latency := time.Since(spawnedAt).Nanoseconds()
+			latencyTotal.Add(latency)
+			storeMax(&latencyMax, latency)
+			storeMax(&peak, live.Add(1))
+			time.Sleep(GoroutineSleep)
+			live.Add(-1)
+		}()
+		result.Spawned++
+	}
+	result.SpawnUs = time.Since(start).Microseconds()
+	wg.Wait()
+
+	result.PeakConcurrent = peak.Load()
+	result.SchedLatencyTotalUs = latencyTotal.Load() / 1000
+	result.SchedLatencyMaxUs = latencyMax.Load() / 1000
+	duration := time.Since(start)
+	result.DurationUs = duration.Nanoseconds() / 1000
+	result.DurationMs = float64(duration.Nanoseconds()) / 1000000.0
+	if err != nil {
+		return result, err
+	}
+	if wasRange {
+		result.RequestedRange = param
+	}
+	return result, nil
+}
+
+// getGoroutines handles GET requests to fan out n goroutines (or a random count within a range)
+// and wait for them, stressing the scheduler and goroutine stack allocation.
+func (s *apiServer) getGoroutines(c *gin.Context) {
+	metrics := s.beginRequestMetrics(c)
+
+	n := c.Param("n")
+	result, err := spawnGoroutines(c.Request.Context(), n, s.limits().Goroutines)
+	if err != nil {
+		respondOperationError(c, "n", s.limits().Goroutines, result, err)
+		return
+	}
+	metrics.finish()
+	respond(c, result, metrics)
+}
+
+// CPUBurnResult holds the result of a time-bounded CPU burn including timing
+type CPUBurnResult struct {
+	RequestedDuration string  `json:"requested_duration"`
+	Iterations        int64   `json:"iterations"`
+	PrimesFound       int64   `json:"primes_found"`
+	DurationUs        int64   `json:"duration_us"`
+	DurationMs        float64 `json:"duration_ms"`
+}
+
+// cpuBurnCandidateLimit bounds the trial-division candidates so each iteration costs roughly the same
+const cpuBurnCandidateLimit = 1 << 20
+
+// parseDurationParam parses a duration such as "500ms" or "2s" and checks it against maxDuration.
+func parseDurationParam(param string, maxDuration time.Duration) (time.Duration, error) {
+	d, err := time.ParseDuration(param)
+	if err != nil {
+		return 0, errorWithCode(CodeInvalidDuration, "invalid duration: %v", err)
+	}
+
+	if d < 0 || d > maxDuration {
+		return 0, errorWithCode(CodeOutOfRange, "duration out of range (0s-%s)", maxDuration)
+	}
+
+	return d, nil
+}
+
+// burnCPU spins doing prime trial division until d has elapsed and reports how many candidates it tested.
+// If ctx ends first it stops early and returns the partial result with ctx.Err().
+func burnCPU(ctx context.Context, d time.Duration) (CPUBurnResult, error) {
+	start := time.Now()
+	deadline := start.Add(d)
+
+	var iterations, primesFound int64
+	var ctxErr error
+	candidate := 3
+	for {
+		// Checking the clock every candidate would dominate the work, so batch the checks
+		if iterations%cancelCheckInterval == 0 {
+			if !time.Now().Before(deadline) {
+				break
+			}
+			if ctxErr = ctx.Err(); ctxErr != nil {
+				break
+			}
+		}
+
+		isPrime := true
+		for divisor := 3; divisor*divisor <= candidate; divisor += 2 {
+			if candidate%divisor == 0 {
+				isPrime = false
+				break
+			}
+		}
+		if isPrime {
+			primesFound++
+		}
+
+		iterations++
+		candidate += 2
+		if candidate > cpuBurnCandidateLimit {
+			candidate = 3
+		}
+	}
+
+	duration := time.Since(start)
+	return CPUBurnResult{
+		RequestedDuration: d.String(),
+		Iterations:        iterations,
+		PrimesFound:       primesFound,
+		DurationUs:        duration.Nanoseconds() / 1000,
+		DurationMs:        float64(duration.Nanoseconds()) / 1000000.0,
+	}, ctxErr
+}
+
+// SpinResult holds the result of an allocation-free busy spin including timing
+type SpinResult struct {
+	RequestedDuration string  `json:"requested_duration"`
+	Iterations        int64   `json:"iterations"`
+	Checksum          uint64  `json:"checksum"`
+	DurationUs        int64   `json:"duration_us"`
+	DurationMs        float64 `json:"duration_ms"`
+}
+
+// spinUntil advances a xorshift state until deadline and returns the iteration count and final state
+// (reported so the compiler can't drop the loop). It allocates nothing, so it never triggers a GC;
+// BenchmarkSpinUntil and TestSpinUntilAllocs keep it that way. If ctx ends first it stops early
+// with ctx.Err().
+func spinUntil(ctx context.Context, deadline time.Time) (int64, uint64, error) {
+	var iterations int64
+	state := uint64(0x9e3779b97f4a7c15)
+	for {
+		if iterations%cancelCheckInterval == 0 {
+			if !time.Now().Before(deadline) {
+				return iterations, state, nil
+			}
+			if err := ctx.Err(); err != nil {
+				return iterations, state, err
+			}
+		}
+		state ^= state << 13
+		state ^= state >> 7
+		state ^= state << 17
+		iterations++
+	}
+}
+
+// spin busy-loops on integer arithmetic for d and reports how many iterations ran.
+// Unlike burnCPU it touches no memory beyond registers, isolating scheduler behavior from GC.
+func spin(ctx context.Context, d time.Duration) (SpinResult, error) {
+	start := time.Now()
+	iterations, checksum, err := spinUntil(ctx, start.Add(d))
+	duration := time.Since(start)
+	return SpinResult{
+		RequestedDuration: d.String(),
+		Iterations:        iterations,
+		Checksum:          checksum,
+		DurationUs:        duration.Nanoseconds() / 1000,
+		DurationMs:        float64(duration.Nanoseconds()) / 1000000.0,
+	}, err
+}
+
+// getSpin handles GET requests to busy-spin one core without allocating for a fixed duration.
+func (s *apiServer) getSpin(c *gin.Context) {
+	metrics := s.beginRequestMetrics(c)
+
+	d, err := parseDurationParam(c.Param("d"), s.limits().CPUDuration)
+	if err != nil {
+		respondParamError(c, "d", s.limits().CPUDuration, err)
+		return
+	}
+
+	result, err := spin(c.Request.Context(), d)
+	if err != nil {
+		respondOperationError(c, "d", s.limits().CPUDuration, result, err)
+		return
+	}
+	metrics.finish()
+	respond(c, result, metrics)
+}
+
+// getCPUBurn handles GET requests to pin a core with trial division for a fixed duration.
+func (s *apiServer) getCPUBurn(c *gin.Context) {
+	metrics := s.beginRequestMetrics(c)
+
+	d, err := parseDurationParam(c.Param("d"), s.limits().CPUDuration)
+	if err != nil {
+		respondParamError(c, "d", s.limits().CPUDuration, err)
+		return
+	}
+
+	result, err := burnCPU(c.Request.Context(), d)
+	if err != nil {
+		respondOperationError(c, "d", s.limits().CPUDuration, result, err)
+		return
+	}
+	metrics.finish()
+	respond(c, result, metrics)
+}
+
+// bcryptPassword is the fixed password /bcrypt hashes, so only the cost varies between requests
+const bcryptPassword = "correct horse battery staple"
+
+// BcryptResult holds the result of a bcrypt password hash including timing
+type BcryptResult struct {
+	Cost       int     `json:"cost"`
+	Hash       string  `json:"hash"`
+	DurationUs int64   `json:"duration_us"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// bcryptCostRange is the accepted cost range, reported as the limit on validation errors
+var bcryptCostRange = fmt.Sprintf("%d-%d", MinBcryptCost, MaxBcryptCost)
+
+// hashBcrypt hashes bcryptPassword at the given cost, which must be a plain integer within
+// MinBcryptCost-MaxBcryptCost. bcrypt can't be interrupted, so ctx is not checked mid-hash.
+func hashBcrypt(param string) (BcryptResult, error) {
+	cost, err := strconv.Atoi(param)
+	if err != nil {
+		return BcryptResult{}, errorWithCode(CodeInvalidNumber, "invalid number: %v", err)
+	}
+	if cost < MinBcryptCost || cost > MaxBcryptCost {
+		return BcryptResult{}, errorWithCode(CodeOutOfRange, "cost out of range (%s)", bcryptCostRange)
+	}
+
+	start := time.Now()
+	hashed, err := bcrypt.GenerateFromPassword([]byte(bcryptPassword), cost)
+	if err != nil {
+		return BcryptResult{}, errorWithCode(CodeInternal, "bcrypt failed: %v", err)
+	}
+	duration := time.Since(start)
+
+	return BcryptResult{
+		Cost:       cost,
+		Hash:       string(hashed),
+		DurationUs: duration.Nanoseconds() / 1000,
+		DurationMs: float64(duration.Nanoseconds()) / 1000000.0,
+	}, nil
+}
+
+// getBcrypt handles GET requests to hash a fixed password with bcrypt at the given cost,
+// modeling the CPU load of a login storm.
+func (s *apiServer) getBcrypt(c *gin.Context) {
+	metrics := s.beginRequestMetrics(c)
+
+	result, err := hashBcrypt(c.Param("cost"))
+	if err != nil {
+		respondParamError(c, "cost", bcryptCostRange, err)
+		return
+	}
+	metrics.finish()
+	respond(c, result, metrics)
+}
+
+// StatusCodeResult is the body of /status/:code
+type StatusCodeResult struct {
+	StatusCode int    `json:"status_code"`
+	StatusText string `json:"status_text"`
+}
+
+// parseStatusCode parses a /status/:code value, which must be a valid HTTP status (100-599)
+func parseStatusCode(param string) (int, error) {
+	code, err := strconv.Atoi(param)
+	if err != nil {
+		return 0, errorWithCode(CodeInvalidNumber, "invalid number: %v", err)
+	}
+	if code < 100 || code > 599 {
+		return 0, errorWithCode(CodeOutOfRange, "status code out of range (100-599)")
+	}
+	return code, nil
+}
+
+// getStatusCode handles GET requests that answer with an arbitrary status code and no work, for
+// testing client error handling (like httpbin's /status). Codes that forbid a body (1xx, 204,
+// 304) are sent without one; HTTP has no final 1xx response, so net/http sends those (except
+// 101) as an informational response followed by its default 200.
+func (s *apiServer) getStatusCode(c *gin.Context) {
+	code, err := parseStatusCode(c.Param("code"))
+	if err != nil {
+		respondParamError(c, "code", "100-599", err)
+		return
+	}
+	if code < 200 || code == http.StatusNoContent || code == http.StatusNotModified {
+		c.Status(code)
+		return
+	}
+	writeNegotiated(c, code, Response[StatusCodeResult]{Data: StatusCodeResult{StatusCode: code, StatusText: http.StatusText(code)}})
+}
+
+// FibonacciHexResult is the data of /fibonacci/hex
+type FibonacciHexResult struct {
+	FibonacciResult FibonacciResult `json:"fibonacci_result"`
+	HexResult       HexResult       `json:"hex_result"`
+}
+
+// PrimeHexResult is the data of /primes/hex. Fields are in key order, as the map this replaced
+// was marshalled.
+type PrimeHexResult struct {
+	HexResult   HexResult   `json:"hex_result"`
+	PrimeResult PrimeResult `json:"prime_result"`
+}
+
+// FibonacciHexMemoryResult is the data of /fibonacci/hex/memory
+type FibonacciHexMemoryResult struct {
+	FibonacciResult FibonacciResult `json:"fibonacci_result"`
+	HexResult       HexResult       `json:"hex_result"`
+	MemoryResult    MemoryResult    `json:"memory_result"`
+}
+
+// PrimeHexMemoryResult is the data of /primes/hex/memory, in key order like PrimeHexResult. Budget
+// and Skipped are set with ?budget=: the results of skipped stages are left empty.
+type PrimeHexMemoryResult struct {
+	Budget       string       `json:"budget,omitempty"`
+	HexResult    HexResult    `json:"hex_result"`
+	MemoryResult MemoryResult `json:"memory_result"`
+	PrimeResult  PrimeResult  `json:"prime_result"`
+	Skipped      []string     `json:"skipped,omitempty"`
+}
+
+// budgetExhausted reports whether budgetCtx, derived from the request context ctx, has ended
+// because its own deadline passed rather than because the request ended (?timeout= or a
+// disconnect), which still fails the request as usual
+func budgetExhausted(ctx, budgetCtx context.Context) bool {
+	return budgetCtx.Err() != nil && ctx.Err() == nil
+}
+
+func (s *apiServer) getFibonacciHex(c *gin.Context) {
+	metrics := s.beginRequestMetrics(c)
+
+	f := c.Param("f")
+	h := c.Param("h")
+
+	var fResult FibonacciResult
+	if err := metrics.stage(c.Request.Context(), "fibonacci", func() (err error) {
+		fResult, err = fibonacci(c.Request.Context(), f, s.limits().Fibonacci, false)
+		return err
+	}); err != nil {
+		respondParamError(c, "f", s.limits().Fibonacci, err)
+		return
+	}
+
+	var hResult HexResult
+	if err := metrics.stage(c.Request.Context(), "hex", func() (err error) {
+		hResult, err = createHexString(c.Request.Context(), h, s.limits().HexKB)
+		return err
+	}); err != nil {
+		respondOperationError(c, "h", s.limits().HexKB, hResult, err)
+		return
+	}
+
+	metrics.finish()
+	respondCombined(c, FibonacciHexResult{FibonacciResult: fResult, HexResult: hResult},
+		fResult.DurationUs+hResult.DurationUs, fResult.DurationMs+hResult.DurationMs, metrics)
+}
+
+// getPrimesHex handles GET requests to generate primes and hex string.
+func (s *apiServer) getPrimesHex(c *gin.Context) {
+	metrics := s.beginRequestMetrics(c)
+
+	p := c.Param("p")
+	h := c.Param("h")
+
+	var pResult PrimeResult
+	if err := metrics.stage(c.Request.Context(), "primes", func() (err error) {
+		pResult, err = generatePrimes(c.Request.Context(), p, s.limits().Primes)
+		return err
+	}); err != nil {
+		respondOperationError(c, "p", s.limits().Primes, pResult, err)
+		return
+	}
+
+	var hResult HexResult
+	if err := metrics.stage(c.Request.Context(), "hex", func() (err error) {
+		hResult, err = createHexString(c.Request.Context(), h, s.limits().HexKB)
+		return err
+	}); err != nil {
+		respondOperationError(c, "h", s.limits().HexKB, hResult, err)
+		return
+	}
+
+	metrics.finish()
+	respondCombined(c, PrimeHexResult{HexResult: hResult, PrimeResult: pResult},
+		pResult.DurationUs+hResult.DurationUs, pResult.DurationMs+hResult.DurationMs, metrics)
+}
+
+// create function fibonacci, hex, memory
+func (s *apiServer) fibonacciHexMemory(c *gin.Context) {
+	metrics := s.beginRequestMetrics(c)
+
+	f := c.Param("f")
+	h := c.Param("h")
+	m := c.Param("m")
+
+	var fResult FibonacciResult
+	if err := metrics.stage(c.Request.Context(), "fibonacci", func() (err error) {
+		fResult, err = fibonacci(c.Request.Context(), f, s.limits().Fibonacci, false)
+		return err
+	}); err != nil {
+		respondParamError(c, "f", s.limits().Fibonacci, err)
+		return
+	}
+
+	var hResult HexResult
+	if err := metrics.stage(c.Request.Context(), "hex", func() (err error) {
+		hResult, err = createHexString(c.Request.Context(), h, s.limits().HexKB)
+		return err
+	}); err != nil {
+		respondOperationError(c, "h", s.limits().HexKB, hResult, err)
+		return
+	}
+
+	var mResult MemoryResult
+	if err := metrics.stage(c.Request.Context(), "memory", func() (err error) {
+		mResult, err = allocateMemory(c.Request.Context(), m, s.limits().MemoryKB)
+		return err
+	}); err != nil {
+		respondParamError(c, "m", s.limits().MemoryKB, err)
+		return
+	}
+
+	metrics.finish()
+	respondCombined(c, FibonacciHexMemoryResult{FibonacciResult: fResult, HexResult: hResult, MemoryResult: mResult},
+		fResult.DurationUs+hResult.DurationUs+mResult.DurationUs, fResult.DurationMs+hResult.DurationMs+mResult.DurationMs, metrics)
+}
+
+// primesHexMemory handles GET requests to generate primes, hex string, and allocate memory.
+// p, h, and m are all validated before any stage runs, so a bad param is a 400 however little
+// budget there is. ?budget=<duration> does as much as fits in that time: the stages share one
+// deadline, the primes stage always runs to completion so there is at least one result, and the
+// hex and memory stages start only while budget remains. A stage the deadline cuts short is
+// dropped like one that never started, and both are listed in skipped.
+func (s *apiServer) primesHexMemory(c *gin.Context) {
+	metrics := s.beginRequestMetrics(c)
+
+	p := c.Param("p")
+	h := c.Param("h")
+	m := c.Param("m")
+
+	ctx := c.Request.Context()
+	pCount, pRange, err := parseIntOrRange(ctx, p, s.limits().Primes, "primes")
+	if err != nil {
+		respondParamError(c, "p", s.limits().Primes, err)
+		return
+	}
+	hKB, hRange, err := parseSizeKBOrRange(ctx, h, s.limits().HexKB, "hex")
+	if err != nil {
+		respondParamError(c, "h", s.limits().HexKB, err)
+		return
+	}
+	mKB, mRange, err := parseSizeKBOrRange(ctx, m, s.limits().MemoryKB, "memory")
+	if err != nil {
+		respondParamError(c, "m", s.limits().MemoryKB, err)
+		return
+	}
+
+	budgetCtx := ctx
+	var budget string
+	if raw, ok := c.GetQuery("budget"); ok {
+		d, err := parseDurationParam(raw, s.limits().RequestTimeout)
+		if err != nil {
+			respondParamError(c, "budget", s.limits().RequestTimeout, err)
+			return
+		}
+		var cancel context.CancelFunc
+		budgetCtx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+		budget = d.String()
+	}
+	var skipped []string
+
+	var pResult PrimeResult
+	if err := metrics.stage(ctx, "primes", func() (err error) {
+		pResult, err = countPrimes(ctx, pCount, firstPrimesTrial)
+		return err
+	}); err != nil {
+		respondOperationError(c, "p", s.limits().Primes, pResult, err)
+		return
+	}
+	if pRange {
+		pResult.RequestedRange = p
+	}
+
+	var hResult HexResult
+	if budgetExhausted(ctx, budgetCtx) {
+		skipped = append(skipped, "hex")
+	} else if err := metrics.stage(budgetCtx, "hex", func() (err error) {
+		hResult, err = encodeRandomKB(budgetCtx, hKB, "hex")
+		return err
+	}); err != nil {
+		if !errors.Is(err, context.DeadlineExceeded) || !budgetExhausted(ctx, budgetCtx) {
+			respondOperationError(c, "h", s.limits().HexKB, hResult, err)
+			return
+		}
+		hResult = HexResult{}
+		skipped = append(skipped, "hex")
+	} else if hRange {
+		hResult.RequestedRange = h
+	}
+
+	var mResult MemoryResult
+	if budgetExhausted(ctx, budgetCtx) {
+		skipped = append(skipped, "memory")
+	} else if err := metrics.stage(budgetCtx, "memory", func() (err error) {
+		mResult, _, err = allocateKB(budgetCtx, mKB, 0, memoryTouchModes[DefaultMemoryTouch], PageSize, nil, nil)
+		return err
+	}); err != nil {
+		respondOperationError(c, "m", s.limits().MemoryKB, mResult, err)
+		return
+	} else if mRange {
+		mResult.RequestedRange = m
+	}
+
+	metrics.finish()
+	respondCombined(c, PrimeHexMemoryResult{Budget: budget, HexResult: hResult, MemoryResult: mResult, PrimeResult: pResult, Skipped: skipped},
+		pResult.DurationUs+hResult.DurationUs+mResult.DurationUs, pResult.DurationMs+hResult.DurationMs+mResult.DurationMs, metrics)
+}
+
+// loadOperation is a single load generator addressable by name, e.g. ?primes=1000 on /load.
+// warmup is the small value POST /warmup runs it with.
+type loadOperation struct {
+	name      string
+	resultKey string
+	warmup    string
+	limit     func(limits loadLimits) interface{}
+	run       func(ctx context.Context, value string, limits loadLimits) (interface{}, error)
+}
+
+// loadOperations lists the operations /load can run, in execution order. Per-endpoint options
+// (?algo=, ?mode=, ?level=, ?iterations=, ?joins=) keep their defaults; use the dedicated endpoint to vary them.
+var loadOperations = []loadOperation{
+	{
+		name:      "primes",
+		resultKey: "prime_result",
+		warmup:    "100",
+		limit:     func(limits loadLimits) interface{} { return limits.Primes },
+		run: func(ctx context.Context, value string, limits loadLimits) (interface{}, error) {
+			return generatePrimes(ctx, value, limits.Primes)
+		},
+	},
+	{
+		name:      "sieve",
+		resultKey: "sieve_result",
+		warmup:    "10000",
+		limit:     func(limits loadLimits) interface{} { return limits.SieveN },
+		run: func(ctx context.Context, value string, limits loadLimits) (interface{}, error) {
+			return sievePrimes(ctx, value, limits.SieveN)
+		},
+	},
+	{
+		name:      "collatz",
+		resultKey: "collatz_result",
+		warmup:    "1000",
+		limit:     func(limits loadLimits) interface{} { return limits.CollatzN },
+		run: func(ctx context.Context, value string, limits loadLimits) (interface{}, error) {
+			return findCollatzMax(ctx, value, limits.CollatzN)
+		},
+	},
+	{
+		name:      "goroutines",
+		resultKey: "goroutines_result",
+		warmup:    "10",
+		limit:     func(limits loadLimits) interface{} { return limits.Goroutines },
+		run: func(ctx context.Context, value string, limits loadLimits) (interface{}, error) {
+			return spawnGoroutines(ctx, value, limits.Goroutines)
+		},
+	},
+	{
+		name:      "hash",
+		resultKey: "hash_result",
+		warmup:    "100",
+		limit:     func(limits loadLimits) interface{} { return limits.HashIterations },
+		run: func(ctx context.Context, value string, limits loadLimits) (interface{}, error) {
+			return hashBlock(ctx, value, "sha256", limits.HashIterations)
+		},
+	},
+	{
+		name:      "regex",
+		resultKey: "regex_result",
+		warmup:    "100",
+		limit:     func(limits loadLimits) interface{} { return limits.RegexLines },
+		run: func(ctx context.Context, value string, limits loadLimits) (interface{}, error) {
+			return matchRegex(ctx, value, defaultRegexp, limits.RegexLines)
+		},
+	},
+	{
+		name:      "encrypt",
+		resultKey: "encrypt_result",
+		warmup:    "64",
+		limit:     func(limits loadLimits) interface{} { return limits.EncryptKB },
+		run: func(ctx context.Context, value string, limits loadLimits) (interface{}, error) {
+			return encryptData(ctx, value, "gcm", limits.EncryptKB)
+		},
+	},
+	{
+		name:      "compress",
+		resultKey: "compress_result",
+		warmup:    "64",
+		limit:     func(limits loadLimits) interface{} { return limits.CompressKB },
+		run: func(ctx context.Context, value string, limits loadLimits) (interface{}, error) {
+			return compressData(ctx, value, gzip.DefaultCompression, limits.CompressKB)
+		},
+	},
+	{
+		name:      "json",
+		resultKey: "json_result",
+		warmup:    "16",
+		limit:     func(limits loadLimits) interface{} { return limits.JSONKB },
+		run: func(ctx context.Context, value string, limits loadLimits) (interface{}, error) {
+			return roundtripJSON(ctx, value, 1, limits.JSONKB)
+		},
+	},
+	{
+		name:      "sort",
+		resultKey: "sort_result",
+		warmup:    "1000",
+		limit:     func(limits loadLimits) interface{} { return limits.SortN },
+		run: func(ctx context.Context, value string, limits loadLimits) (interface{}, error) {
+			return sortData(ctx, value, "std", false, limits.SortN)
+		},
+	},
+	{
+		name:      "matmul",
+		resultKey: "matmul_result",
+		warmup:    "16",
+		limit:     func(limits loadLimits) interface{} { return limits.MatmulDim },
+		run: func(ctx context.Context, value string, limits loadLimits) (interface{}, error) {
+			return multiplyMatrices(ctx, value, limits.MatmulDim)
+		},
+	},
+	{
+		name:      "hex",
+		resultKey: "hex_result",
+		warmup:    "64",
+		limit:     func(limits loadLimits) interface{} { return limits.HexKB },
+		run: func(ctx context.Context, value string, limits loadLimits) (interface{}, error) {
+			return createHexString(ctx, value, limits.HexKB)
+		},
+	},
+	{
+		name:      "memory",
+		resultKey: "memory_result",
+		warmup:    "1024",
+		limit:     func(limits loadLimits) interface{} { return limits.MemoryKB },
+		run: func(ctx context.Context, value string, limits loadLimits) (interface{}, error) {
+			return allocateMemory(ctx, value, limits.MemoryKB)
+		},
+	},
+	{
+		name:      "query",
+		resultKey: "query_result",
+		warmup:    "100",
+		limit:     func(limits loadLimits) interface{} { return limits.QueryRows },
+		run: func(ctx context.Context, value string, limits loadLimits) (interface{}, error) {
+			return simulateQuery(ctx, value, 1, limits.QueryRows)
+		},
+	},
+	{
+		name:      "bcrypt",
+		resultKey: "bcrypt_result",
+		warmup:    "4",
+		limit:     func(limits loadLimits) interface{} { return bcryptCostRange },
+		run: func(ctx context.Context, value string, limits loadLimits) (interface{}, error) {
+			return hashBcrypt(value)
+		},
+	},
+	{
+		name:      "cpu",
+		resultKey: "cpu_result",
+		warmup:    "10ms",
+		limit:     func(limits loadLimits) interface{} { return limits.CPUDuration },
+		run: func(ctx context.Context, value string, limits loadLimits) (interface{}, error) {
+			d, err := parseDurationParam(value, limits.CPUDuration)
+			if err != nil {
+				return nil, err
+			}
+			return burnCPU(ctx, d)
+		},
+	},
+	{
+		name:      "spin",
+		resultKey: "spin_result",
+		warmup:    "10ms",
+		limit:     func(limits loadLimits) interface{} { return limits.CPUDuration },
+		run: func(ctx context.Context, value string, limits loadLimits) (interface{}, error) {
+			d, err := parseDurationParam(value, limits.CPUDuration)
+			if err != nil {
+				return nil, err
+			}
+			return spin(ctx, d)
+		},
+	},
+}
+
+// findLoadOperation looks up a loadOperation by name
+func findLoadOperation(name string) (loadOperation, bool) {
+	for _, op := range loadOperations {
+		if op.name == name {
+			return op, true
+		}
+	}
+	return loadOperation{}, false
+}
+
+// loadOperationNames returns the operation names in execution order
+func loadOperationNames() []string {
+	names := make([]string, len(loadOperations))
+	for i, op := range loadOperations {
+		names[i] = op.name
+	}
+	return names
+}
+
+// LoadResult is the data of /load: each operation's result under its loadOperation.resultKey.
+// The keys depend on the query, so it stays a map.
+type LoadResult map[string]interface{}
+
+// getLoad handles GET requests that compose any mix of operations from query parameters,
+// e.g. /load?primes=1000&hex=100&memory=2048&cpu=500ms. Absent parameters are skipped, present
+// ones run in loadOperations order with a request_metrics stage each.
+func (s *apiServer) getLoad(c *gin.Context) {
+	metrics := s.beginRequestMetrics(c)
+
+	results := make(LoadResult)
+	for _, op := range loadOperations {
+		value, ok := c.GetQuery(op.name)
+		if !ok {
+			continue
+		}
+
+		var result interface{}
+		if err := metrics.stage(c.Request.Context(), op.name, func() (err error) {
+			// Operations that don't check the context themselves still shouldn't start late
+			if err := c.Request.Context().Err(); err != nil {
+				return err
+			}
+			result, err = op.run(c.Request.Context(), value, s.limits())
+			return err
+		}); err != nil {
+			if result != nil {
+				results[op.resultKey] = result
+			}
+			respondOperationError(c, op.name, op.limit(s.limits()), results, err)
+			return
+		}
+		results[op.resultKey] = result
+	}
+
+	metrics.finish()
+	respond(c, results, metrics)
+}
+
+// BatchOperation is one entry of a POST /batch request body
+type BatchOperation struct {
+	Op    string `json:"op"`
+	Value string `json:"value"`
+}
+
+// BatchResult holds the outcome of one batch operation
+type BatchResult struct {
+	Op         string      `json:"op"`
+	Value      string      `json:"value"`
+	DurationMs float64     `json:"duration_ms"`
+	Result     interface{} `json:"result"`
+}
+
+// BatchResponse holds the results of a batch in request order
+type BatchResponse struct {
+	Results         []BatchResult `json:"results"`
+	TotalDurationMs float64       `json:"total_duration_ms"`
+}
+
+// postBatch handles POST requests with a JSON array of operations, e.g.
+// [{"op":"primes","value":"100"},{"op":"memory","value":"500..1000"}], run in order.
+// Every op name is validated before anything runs; a value error stops the batch with a 400.
+func (s *apiServer) postBatch(c *gin.Context) {
+	metrics := s.beginRequestMetrics(c)
+
+	var ops []BatchOperation
+	if err := c.ShouldBindJSON(&ops); err != nil {
+		respondParamError(c, "body", "JSON array of {op, value}", err)
+		return
+	}
+	if len(ops) > s.limits().BatchOps {
+		respondParamError(c, "body", s.limits().BatchOps, errorWithCode(CodeOutOfRange, "batch has %d operations, exceeding the limit", len(ops)))
+		return
+	}
+
+	resolved := make([]loadOperation, len(ops))
+	for i, entry := range ops {
+		op, ok := findLoadOperation(entry.Op)
+		if !ok {
+			respondParamError(c, "op", loadOperationNames(), errorWithCode(CodeUnsupportedValue, "unknown operation %q at index %d", entry.Op, i))
+			return
+		}
+		resolved[i] = op
+	}
+
+	response := BatchResponse{Results: make([]BatchResult, 0, len(ops))}
+	start := time.Now()
+	for i, op := range resolved {
+		opStart := time.Now()
+		result, err := op.run(c.Request.Context(), ops[i].Value, s.limits())
+		if err == nil {
+			err = c.Request.Context().Err()
+		}
+		if err != nil {
+			respondOperationError(c, op.name, op.limit(s.limits()), response, fmt.Errorf("operation %d: %w", i, err))
+			return
+		}
+		response.Results = append(response.Results, BatchResult{
+			Op:         op.name,
+			Value:      ops[i].Value,
+			DurationMs: float64(time.Since(opStart).Nanoseconds()) / 1000000.0,
+			Result:     result,
+		})
+	}
+	response.TotalDurationMs = float64(time.Since(start).Nanoseconds()) / 1000000.0
+
+	metrics.finish()
+	respond(c, response, metrics)
+}
+
+// WarmupOperation reports one operation run by POST /warmup
+type WarmupOperation struct {
+	Op         string  `json:"op"`
+	Value      string  `json:"value"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// WarmupResult lists the operations POST /warmup ran, in loadOperations order
+type WarmupResult struct {
+	Operations      []WarmupOperation `json:"operations"`
+	TotalDurationMs float64           `json:"total_duration_ms"`
+}
+
+// postWarmup handles POST requests that run every load operation once at its small warmup value,
+// so the first measured requests don't pay for cold caches, empty buffer pools, an unsized heap,
+// or lazily initialized state. It changes nothing a second call could undo or repeat differently,
+// so it is safe to call before every test run. Each operation is a request_metrics stage.
+func (s *apiServer) postWarmup(c *gin.Context) {
+	metrics := s.beginRequestMetrics(c)
+
+	result := WarmupResult{Operations: make([]WarmupOperation, 0, len(loadOperations))}
+	start := time.Now()
+	for _, op := range loadOperations {
+		opStart := time.Now()
+		if err := metrics.stage(c.Request.Context(), op.name, func() error {
+			if err := c.Request.Context().Err(); err != nil {
+				return err
+			}
+			_, err := op.run(c.Request.Context(), op.warmup, s.limits())
+			return err
+		}); err != nil {
+			respondOperationError(c, op.name, op.limit(s.limits()), result, err)
+			return
+		}
+		result.Operations = append(result.Operations, WarmupOperation{
+			Op:         op.name,
+			Value:      op.warmup,
+			DurationMs: float64(time.Since(opStart).Nanoseconds()) / 1000000.0,
+		})
+	}
+	result.TotalDurationMs = float64(time.Since(start).Nanoseconds()) / 1000000.0
+
+	metrics.finish()
+	respond(c, result, metrics)
+}
+
+// WSResult answers one /ws command. Result is set on success and Error otherwise.
+type WSResult struct {
+	Op         string       `json:"op"`
+	Value      string       `json:"value"`
+	DurationMs float64      `json:"duration_ms"`
+	Result     interface{}  `json:"result,omitempty"`
+	Error      *ErrorDetail `json:"error,omitempty"`
+}
+
+// runWSCommand runs one /ws command through the loadOperations table, like a single /batch entry.
+// Errors are reported in the result rather than ending the session.
+func (s *apiServer) runWSCommand(ctx context.Context, cmd BatchOperation) WSResult {
+	reply := WSResult{Op: cmd.Op, Value: cmd.Value}
+	op, ok := findLoadOperation(cmd.Op)
+	if !ok {
+		reply.Error = &ErrorDetail{
+			Param:   "op",
+			Message: fmt.Sprintf("unknown operation %q", cmd.Op),
+			Code:    CodeUnsupportedValue,
+			Limit:   formatLimit(loadOperationNames()),
+		}
+		return reply
+	}
+
+	start := time.Now()
+	result, err := op.run(ctx, cmd.Value, s.limits())
+	reply.DurationMs = float64(time.Since(start).Nanoseconds()) / 1000000.0
+	if err != nil {
+		reply.Error = &ErrorDetail{
+			Param:   op.name,
+			Message: err.Error(),
+			Code:    errorCode(err),
+			Limit:   formatLimit(op.limit(s.limits())),
+		}
+		return reply
+	}
+	reply.Result = result
+	return reply
+}
+
+// getWebSocket handles GET requests that upgrade to a WebSocket for sustained interactive load
+// without per-request HTTP overhead. Each text frame is a JSON command such as
+// {"op":"primes","value":"1000"} and is answered with one WSResult frame, in order. The session
+// counts as a single request for admission control and ?timeout=.
+func (s *apiServer) getWebSocket(c *gin.Context) {
+	ctx := c.Request.Context()
+	server := websocket.Server{
+		Handler: func(ws *websocket.Conn) { s.serveWebSocket(ctx, ws) },
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// serveWebSocket reads commands until the client closes the connection or ctx ends. Pings from the
+// client are answered with pongs by the websocket package; the server pings every WSPingInterval.
+// A malformed command gets an error reply and the session continues.
+func (s *apiServer) serveWebSocket(ctx context.Context, ws *websocket.Conn) {
+	// Close sends the close frame that completes the closing handshake
+	defer ws.Close()
+	ws.MaxPayloadBytes = MaxWSMessageBytes
+
+	// Only the pinger uses ws.Write; replies go through websocket.JSON, which sets its own frame type
+	ws.PayloadType = websocket.PingFrame
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(WSPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if _, err := ws.Write(nil); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	for ctx.Err() == nil {
+		var cmd BatchOperation
+		err := websocket.JSON.Receive(ws, &cmd)
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+			reply := WSResult{Error: &ErrorDetail{
+				Param:   "body",
+				Message: err.Error(),
+				Code:    CodeInvalidParameter,
+				Limit:   "JSON object {op, value}",
+			}}
+			if err := websocket.JSON.Send(ws, reply); err != nil {
+				return
+			}
+			continue
+		case err != nil:
+			// io.EOF after a close frame, or a broken or oversized read
+			return
+		}
+
+		if err := websocket.JSON.Send(ws, s.runWSCommand(ctx, cmd)); err != nil {
+			return
+		}
+	}
+}
+
+// getIndex serves the API documentation homepage
+func getIndex(c *gin.Context) {
+	html := `<!DOCTYPE html>
+<html>
+<head>
+    <title>Apex Load Generator API</title>
+    <style>
+        body { font-family: Arial, sans-serif; margin: 40px; background-color: #f5f5f5; }
+        .container { background: white; padding: 30px; border-radius: 8px; box-shadow: 0 2px 4px rgba(0,0,0,0.1); }
+        h1 { color: #333; border-bottom: 3px solid #4CAF50; padding-bottom: 10px; }
+        h2 { color: #555; margin-top: 30px; }
+        .endpoint { background: #f9f9f9; padding: 15px; margin: 10px 0; border-radius: 5px; border-left: 4px solid #4CAF50; }
+        .method { background: #4CAF50; color: white; padding: 3px 8px; border-radius: 3px; font-weight: bold; }
+        .deprecated { border-left-color: #ff9800; }
+        .deprecated .method { background: #ff9800; }
+        .example { background: #e8f5e8; padding: 10px; margin: 8px 0; border-radius: 3px; font-family: monospace; }
+        .limits { background: #fff3cd; padding: 10px; margin: 8px 0; border-radius: 3px; border: 1px solid #ffeaa7; }
+        a { color: #4CAF50; text-decoration: none; font-weight: bold; }
+        a:hover { text-decoration: underline; }
+        .note { background: #d1ecf1; padding: 10px; margin: 8px 0; border-radius: 3px; border: 1px solid #bee5eb; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <h1>🚀 Apex Load Generator API</h1>
+        <p>A Go-based HTTP service for creating computational load through CPU calculations, memory allocation, and hex string generation. All endpoints return JSON with both operation results and request-level performance metrics.</p>
+
+        <div class="note">
+            <strong>📖 API Documentation:</strong>
+            <ul>
+                <li><a href="/swagger">Interactive Swagger UI</a> - Try the API directly in your browser</li>
+                <li><a href="/docs">Alternative Swagger UI</a> - Same as above, alternative URL</li>
+                <li><a href="/swagger.yaml">Raw OpenAPI Specification</a> - Download the YAML spec</li>
+                <li><a href="/openapi.json">Generated OpenAPI Document</a> - JSON spec built from the registered routes</li>
+            </ul>
+        </div>
+
+        <h2>🔢 Single Operations</h2>
+
+        <div class="endpoint">
+            <span class="method">GET</span> <strong>/primes/{p}</strong> - Generate Prime Numbers (Recommended)
+            <div class="example">
+                Example: <a href="/primes/100">/primes/100</a> - Generate first 100 prime numbers<br>
+                Range: <a href="/primes/50..200">/primes/50..200</a> - Generate random count between 50-200 primes
+            </div>
+            <div class="limits">Limits: p = 0-10,000 or range (e.g., 50..200) | Best for predictable CPU load testing</div>
+        </div>
+
+        <div class="endpoint">
+            <span class="method">GET</span> <strong>/memory/{m}</strong> - Allocate Memory
+            <div class="example">
+                Example: <a href="/memory/1024">/memory/1024</a> - Allocate 1MB (1024 KB) of memory<br>
+                Range: <a href="/memory/500..2000">/memory/500..2000</a> - Allocate random size between 500KB-2MB
+            </div>
+            <div class="limits">Limits: m = 0-1,000,000 KB or range (e.g., 500..2000) | Memory is allocated then freed naturally</div>
+        </div>
+
+        <div class="endpoint">
+            <span class="method">GET</span> <strong>/hex/{h}</strong> - Generate Hex String
+            <div class="example">
+                Example: <a href="/hex/10">/hex/10</a> - Generate 10KB of hex data<br>
+                Range: <a href="/hex/100..500">/hex/100..500</a> - Generate random size between 100-500KB
+            </div>
+            <div class="limits">Limits: h = 0-10,000 KB or range (e.g., 100..500) | Returns full hex data for bandwidth testing</div>
+        </div>
+
+        <div class="endpoint deprecated">
+            <span class="method">GET</span> <strong>/fibonacci/{f}</strong> - Fibonacci Calculation (Deprecated)
+            <div class="example">
+                Example: <a href="/fibonacci/30">/fibonacci/30</a> - Calculate 30th Fibonacci number<br>
+                Range: <a href="/fibonacci/25..35">/fibonacci/25..35</a> - Calculate random position between 25-35
+            </div>
+            <div class="limits">Limits: f = 0-45 or range (e.g., 25..35) | ⚠️ Deprecated: Use /primes for predictable CPU testing</div>
+        </div>
+
+        <h2>🔄 Combined Operations</h2>
+
+        <div class="endpoint">
+            <span class="method">GET</span> <strong>/primes/hex/{p}/{h}</strong> - Prime + Hex Generation
+            <div class="example">
+                Example: <a href="/primes/hex/500/50">/primes/hex/500/50</a> - 500 primes + 50KB hex<br>
+                Range: <a href="/primes/hex/100..1000/25..100">/primes/hex/100..1000/25..100</a> - Variable primes + variable hex size
+            </div>
+            <div class="limits">Limits: p = 0-10,000, h = 0-10,000 KB | Both parameters support ranges (e.g., 100..1000)</div>
+        </div>
+
+        <div class="endpoint">
+            <span class="method">GET</span> <strong>/primes/hex/memory/{p}/{h}/{m}</strong> - Full Load Test
+            <div class="example">
+                Example: <a href="/primes/hex/memory/1000/100/2048">/primes/hex/memory/1000/100/2048</a> - Complete load test<br>
+                Range: <a href="/primes/hex/memory/500..2000/50..200/1000..5000">/primes/hex/memory/500..2000/50..200/1000..5000</a> - Variable everything
+            </div>
+            <div class="limits">Limits: p = 0-10,000, h = 0-10,000 KB, m = 0-1,000,000 KB | All parameters support ranges</div>
+        </div>
+
+        <div class="endpoint deprecated">
+            <span class="method">GET</span> <strong>/fibonacci/hex/{f}/{h}</strong> - Fibonacci + Hex (Deprecated)
+            <div class="example">
+                Example: <a href="/fibonacci/hex/25/50">/fibonacci/hex/25/50</a> - Fibonacci + 50KB hex<br>
+                Range: <a href="/fibonacci/hex/20..30/25..100">/fibonacci/hex/20..30/25..100</a> - Variable Fibonacci + variable hex size
+            </div>
+            <div class="limits">Limits: f = 0-45, h = 0-10,000 KB | ⚠️ Use /primes/hex instead | Both parameters support ranges</div>
+        </div>
+
+        <div class="endpoint deprecated">
+            <span class="method">GET</span> <strong>/fibonacci/hex/memory/{f}/{h}/{m}</strong> - Fibonacci + Hex + Memory (Deprecated)
+            <div class="example">
+                Example: <a href="/fibonacci/hex/memory/20/50/1024">/fibonacci/hex/memory/20/50/1024</a> - All operations<br>
+                Range: <a href="/fibonacci/hex/memory/15..25/25..100/500..2000">/fibonacci/hex/memory/15..25/25..100/500..2000</a> - Variable everything
+            </div>
+            <div class="limits">Limits: f = 0-45, h = 0-10,000 KB, m = 0-1,000,000 KB | ⚠️ Use /primes/hex/memory instead | All parameters support ranges</div>
+        </div>
+
+        <h2>📊 Response Format</h2>
+        <div class="note">
+            All endpoints return JSON with:
+            <ul>
+                <li><strong>data</strong>: Operation results (timing in both microseconds and milliseconds, counts, generated content)</li>
+                <li><strong>request_metrics</strong>: Performance data (duration_us, duration_ms, cpu_usage_percent, memory_used_bytes, goroutine counts)</li>
+            </ul>
+        </div>
+
+        <h2>🎯 Load Testing Examples</h2>
+        <div class="example">
+            Light CPU: <a href="/primes/100">/primes/100</a><br>
+            Heavy CPU: <a href="/primes/5000">/primes/5000</a><br>
+            Variable CPU: <a href="/primes/100..1000">/primes/100..1000</a><br>
+            Memory Test: <a href="/memory/100000">/memory/100000</a><br>
+            Variable Memory: <a href="/memory/50000..200000">/memory/50000..200000</a><br>
+            Bandwidth Test: <a href="/hex/1000">/hex/1000</a><br>
+            Variable Size Test: <a href="/hex/500..2000">/hex/500..2000</a><br>
+            Combined Load: <a href="/primes/hex/memory/2000/500/50000">/primes/hex/memory/2000/500/50000</a>
+        </div>
+
+        <div class="note">
+            <strong>💡 Performance Tips:</strong>
+            <ul>
+                <li>Prime generation: Linear complexity, predictable scaling</li>
+                <li>Fibonacci: Exponential complexity, deprecated for unpredictable performance</li>
+                <li>Hex generation: Optimized for low CPU usage, good for bandwidth testing</li>
+                <li>Memory allocation: Uses page-boundary touching for realistic patterns</li>
+                <li>All timing: Microsecond and millisecond precision for accurate performance analysis</li>
+            </ul>
+        </div>
+    </div>
+</body>
+</html>`
+
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.String(200, html)
+}
+
+// getHealthz is a liveness probe: it answers immediately without generating load or collecting request metrics.
+func getHealthz(c *gin.Context) {
+	writeNegotiated(c, http.StatusOK, StatusResponse{Status: "ok"})
+}
+
+// getReadyz is a readiness probe: it returns 503 until startup work has finished and the server
+// is marked ready, then 200. It also reports not ready once shutdown has begun.
+func (s *apiServer) getReadyz(c *gin.Context) {
+	if !s.ready.Load() {
+		writeNegotiated(c, http.StatusServiceUnavailable, StatusResponse{Status: "not ready"})
+		return
+	}
+	writeNegotiated(c, http.StatusOK, StatusResponse{Status: "ready"})
+}
+
+// getSwaggerYAML serves the raw Swagger YAML specification
+func getSwaggerYAML(c *gin.Context) {
+	data, err := ioutil.ReadFile("swagger.yaml")
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, "", errorWithCode(CodeInternal, "swagger.yaml not found"))
+		return
+	}
+	c.Header("Content-Type", "application/x-yaml")
+	c.String(200, string(data))
+}
+
+// getSwaggerUI serves the Swagger UI interface
+func getSwaggerUI(c *gin.Context) {
+	html := `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <title>Apex Load Generator API - Swagger UI</title>
+    <link rel="stylesheet" type="text/css" href="https://unpkg.com/swagger-ui-dist@4.15.5/swagger-ui.css" />
+    <style>
+        html {
+            box-sizing: border-box;
+            overflow: -moz-scrollbars-vertical;
+            overflow-y: scroll;
+        }
+        *, *:before, *:after {
+            box-sizing: inherit;
+        }
+        body {
+            margin:0;
+            background: #fafafa;
+        }
+    </style>
+</head>
+<body>
+    <div id="swagger-ui"></div>
+    <script src="https://unpkg.com/swagger-ui-dist@4.15.5/swagger-ui-bundle.js"></script>
+    <script src="https://unpkg.com/swagger-ui-dist@4.15.5/swagger-ui-standalone-preset.js"></script>
+    <script>
+        window.onload = function() {
+            const ui = SwaggerUIBundle({
+                url: '/swagger.yaml',
+                dom_id: '#swagger-ui',
+                deepLinking: true,
+                presets: [
+                    SwaggerUIBundle.presets.apis,
+                    SwaggerUIStandalonePreset
+                ],
+                plugins: [
+                    SwaggerUIBundle.plugins.DownloadUrl
+                ],
+                layout: "StandaloneLayout",
+                validatorUrl: null
+            });
+        };
+    </script>
+</body>
+</html>`
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.String(200, html)
+}
+
+// rangeSyntax describes the value syntax parseIntOrRange accepts, for the OpenAPI document
+const rangeSyntax = "A single value (`100`), a range picked from at random (`100..200`), a stepped range " +
+	"(`100..200..50`), or a list picked from at random (`100,150,200`)"
+
+// rangePattern matches the value syntax parseIntOrRange accepts
+const rangePattern = `^\d+((\.\.\d+){1,2}|(,\d+)*)$`
+
+// sizeSyntax and sizePattern extend rangeSyntax and rangePattern with parseSizeKBOrRange's suffixes
+const sizeSyntax = "Values are in KB unless suffixed with `KB`, `MB`, or `GB` (e.g. `10MB`, `100MB..1GB`)"
+const sizePattern = `^\d+([KkMmGg][Bb])?((\.\.\d+([KkMmGg][Bb])?){1,2}|(,\d+([KkMmGg][Bb])?)*)$`
+
+// openAPIDocument is the subset of an OpenAPI 3.0 document served at /openapi.json
+type openAPIDocument struct {
+	OpenAPI    string                                 `json:"openapi"`
+	Info       openAPIInfo                            `json:"info"`
+	Paths      map[string]map[string]openAPIOperation `json:"paths"`
+	Components openAPIComponents                      `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Version     string `json:"version"`
+}
+
+type openAPIComponents struct {
+	Schemas map[string]*openAPISchema `json:"schemas"`
+}
+
+type openAPIOperation struct {
+	Summary    string                     `json:"summary"`
+	Tags       []string                   `json:"tags,omitempty"`
+	Parameters []openAPIParameter         `json:"parameters,omitempty"`
+	Responses  map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Required    bool           `json:"required,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Schema      *openAPISchema `json:"schema"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Pattern              string                    `json:"pattern,omitempty"`
+	Enum                 []string                  `json:"enum,omitempty"`
+	Properties           map[string]*openAPISchema `json:"properties,omitempty"`
+	Items                *openAPISchema            `json:"items,omitempty"`
+	AdditionalProperties *openAPISchema            `json:"additionalProperties,omitempty"`
+}
+
+// openAPIParam documents one path or query parameter of a route. limit, if set, reports the
+// effective limit the value is checked against; enum lists the accepted names.
+type openAPIParam struct {
+	name        string
+	in          string
+	description string
+	ranged      bool
+	sized       bool
+	limit       func(limits loadLimits) interface{}
+	enum        func() []string
+}
+
+// openAPIRoute documents one route. result is a zero value of the data type inside the Response
+// envelope; nil means the route doesn't answer with the envelope (HTML, YAML, streams, ...).
+type openAPIRoute struct {
+	summary  string
+	tag      string
+	params   []openAPIParam
+	result   interface{}
+	combined bool // responds with CombinedResponse
+}
+
+// rangeParam documents a path parameter parsed with parseIntOrRange
+func rangeParam(name, description string, limit func(limits loadLimits) interface{}) openAPIParam {
+	return openAPIParam{name: name, in: "path", description: description, ranged: true, limit: limit}
+}
+
+// pinParam documents the ?pin= query parameter of routes registered through pinnable
+var pinParam = openAPIParam{name: "pin", in: "query", description: "Run the computation locked to one OS thread (`0` or `1`)"}
+
+// sizeParam documents a KB path parameter parsed with parseSizeKBOrRange
+func sizeParam(name, description string, limit func(limits loadLimits) interface{}) openAPIParam {
+	return openAPIParam{name: name, in: "path", description: description, ranged: true, sized: true, limit: limit}
+}
+
+// openAPIRoutes documents every route by "METHOD /gin/path". TestOpenAPICoversRoutes fails when
+// a registered route is missing here, so add the entry together with the route.
+var openAPIRoutes = map[string]openAPIRoute{
+	"GET /":                      {summary: "HTML API documentation", tag: "Documentation"},
+	"GET /swagger.yaml":          {summary: "Hand-written Swagger YAML specification", tag: "Documentation"},
+	"GET /swagger":               {summary: "Swagger UI", tag: "Documentation"},
+	"GET /docs":                  {summary: "Swagger UI (alias of /swagger)", tag: "Documentation"},
+	"GET /openapi.json":          {summary: "This OpenAPI document, generated from the registered routes", tag: "Documentation"},
+	"GET /metrics":               {summary: "Prometheus metrics", tag: "Monitoring"},
+	"GET /stats":                 {summary: "Request totals and latency per route", tag: "Monitoring", result: StatsResult{}},
+	"POST /stats/reset":          {summary: "Reset /stats", tag: "Monitoring"},
+	"GET /sysinfo":               {summary: "Host and Go runtime snapshot", tag: "Monitoring", result: SysInfoResult{}},
+	"GET /healthz":               {summary: "Liveness probe", tag: "Monitoring"},
+	"GET /readyz":                {summary: "Readiness probe", tag: "Monitoring"},
+	"POST /gc":                   {summary: "Force a garbage collection", tag: "Debug", result: GCResult{}},
+	"GET /debug/pprof/*profile":  {summary: "net/http/pprof profiles", tag: "Debug"},
+	"POST /debug/pprof/*profile": {summary: "net/http/pprof symbol lookup", tag: "Debug"},
+	"GET /debug/vars":            {summary: "expvar variables", tag: "Debug"},
+	"POST /admin/maxprocs/:n": {
+		summary: "Change GOMAXPROCS at runtime", tag: "Debug", result: MaxProcsResult{},
+		params: []openAPIParam{{name: "n", in: "path", description: "New GOMAXPROCS value (1-1024)"}},
+	},
+	"POST /admin/gogc/:pct": {
+		summary: "Change the GC target percentage at runtime", tag: "Debug", result: GCPercentResult{},
+		params: []openAPIParam{{name: "pct", in: "path", description: "New GOGC value (0-10000, or off)"}},
+	},
+	"POST /admin/shutdown": {summary: "Shut down gracefully, as on SIGTERM", tag: "Debug"},
+	"GET /config": {
+		summary: "Effective configuration, secrets redacted", tag: "Monitoring", result: ConfigResult{},
+	},
+	"POST /admin/ballast/release": {
+		summary: "Release the APEX_BALLAST_MB GC ballast", tag: "Debug", result: BallastReleaseResult{},
+	},
+	"GET /stats/histogram": {
+		summary: "Latency histogram per route", tag: "Monitoring", result: HistogramResult{},
+		params: []openAPIParam{{name: "path", in: "query", description: "Route template (/primes/:p) or request path (/primes/100); all routes when omitted"}},
+	},
+	"GET /fibonacci/:f": {
+		summary: "Calculate a Fibonacci number", tag: "CPU Load Testing", result: FibonacciResult{},
+		params: []openAPIParam{
+			rangeParam("f", "Fibonacci index", func(limits loadLimits) interface{} { return limits.Fibonacci }),
+			{name: "memo", in: "query", description: "Use the shared Fibonacci cache (`0` or `1`)"},
+		},
+	},
+	"GET /primes/:p": {
+		summary: "Generate the first p primes", tag: "CPU Load Testing", result: PrimeResult{},
+		params: []openAPIParam{
+			rangeParam("p", "Number of primes", func(limits loadLimits) interface{} { return limits.Primes }),
+			{name: "parallel", in: "query", description: "Worker goroutines, capped at GOMAXPROCS"},
+			{name: "cache", in: "query", description: "Serve from the shared prime cache (`0` or `1`); overrides parallel"},
+			{name: "algo", in: "query", description: "Primality algorithm (default trial); can't be combined with parallel or cache", enum: primeAlgorithmNames},
+			{name: "stats", in: "query", description: "Add prime density statistics (`0` or `1`)"},
+			pinParam,
+		},
+	},
+	"GET /primes/sse/:n": {
+		summary: "Stream the first n primes as Server-Sent Events", tag: "CPU Load Testing",
+		params: []openAPIParam{rangeParam("n", "Number of primes", func(limits loadLimits) interface{} { return limits.Primes })},
+	},
+	"GET /primes/upto/:n": {
+		summary: "Sieve all primes up to n", tag: "CPU Load Testing", result: SieveResult{},
+		params: []openAPIParam{rangeParam("n", "Upper bound", func(limits loadLimits) interface{} { return limits.SieveN }), pinParam},
+	},
+	"GET /collatz/:n": {
+		summary: "Longest Collatz stopping time for 1..n", tag: "CPU Load Testing", result: CollatzResult{},
+		params: []openAPIParam{rangeParam("n", "Upper bound", func(limits loadLimits) interface{} { return limits.CollatzN })},
+	},
+	"GET /goroutines/:n": {
+		summary: "Spawn n sleeping goroutines and wait for them", tag: "CPU Load Testing", result: GoroutinesResult{},
+		params: []openAPIParam{rangeParam("n", "Goroutines to spawn", func(limits loadLimits) interface{} { return limits.Goroutines })},
+	},
+	"GET /primes/nth/:n": {
+		summary: "Find the nth prime", tag: "CPU Load Testing", result: NthPrimeResult{},
+		params: []openAPIParam{rangeParam("n", "Prime index, from 1", func(limits loadLimits) interface{} { return limits.Primes }), pinParam},
+	},
+	"GET /primes/gaps/:n": {
+		summary: "Find the largest gap among the first n primes", tag: "CPU Load Testing", result: PrimeGapResult{},
+		params: []openAPIParam{rangeParam("n", "Number of primes, from 2", func(limits loadLimits) interface{} { return limits.Primes }), pinParam},
+	},
+	"GET /hash/:n": {
+		summary: "Hash a block n times", tag: "CPU Load Testing", result: HashResult{},
+		params: []openAPIParam{
+			rangeParam("n", "Iterations", func(limits loadLimits) interface{} { return limits.HashIterations }),
+			{name: "algo", in: "query", description: "Hash algorithm (default sha256)", enum: hashAlgorithmNames},
+		},
+	},
+	"GET /hex/:h": {
+		summary: "Generate h KB of random hex", tag: "Bandwidth Testing", result: HexResult{},
+		params: []openAPIParam{
+			sizeParam("h", "Size in KB", func(limits loadLimits) interface{} { return limits.HexKB }),
+			{name: "encoding", in: "query", description: "Payload encoding (default hex); base64 encodes h KB of random bytes", enum: hexEncodingNames},
+		},
+	},
+	"GET /hex/stream/:h": {
+		summary: "Stream h KB of random hex as text/plain", tag: "Bandwidth Testing",
+		params: []openAPIParam{
+			sizeParam("h", "Size in KB", func(limits loadLimits) interface{} { return limits.HexKB }),
+			{name: "encoding", in: "query", description: "Payload encoding (default hex); base64 encodes h KB of random bytes", enum: hexEncodingNames},
+		},
+	},
+	"GET /drip": {
+		summary: "Trickle random hex as text/plain over a duration", tag: "Bandwidth Testing",
+		params: []openAPIParam{
+			{name: "bytes", in: "query", description: "Bytes to send (default 1024). " + rangeSyntax, ranged: true, limit: func(limits loadLimits) interface{} { return limits.DripBytes }},
+			{name: "duration", in: "query", description: "Go duration to spread the body over (default `2s`)", limit: func(limits loadLimits) interface{} { return limits.DripDuration }},
+		},
+	},
+	"GET /regex/:n": {
+		summary: "Match a regex against n generated log lines", tag: "CPU Load Testing", result: RegexResult{},
+		params: []openAPIParam{
+			rangeParam("n", "Lines", func(limits loadLimits) interface{} { return limits.RegexLines }),
+			{name: "pattern", in: "query", description: "Go RE2 regex to use instead of the default 4xx/5xx access-log pattern", limit: func(limits loadLimits) interface{} { return MaxRegexPatternLen }},
+		},
+	},
+	"GET /encrypt/:kb": {
+		summary: "Encrypt kb KB of random data", tag: "CPU Load Testing", result: EncryptResult{},
+		params: []openAPIParam{
+			rangeParam("kb", "Size in KB", func(limits loadLimits) interface{} { return limits.EncryptKB }),
+			{name: "mode", in: "query", description: "AES mode (default gcm)", enum: encryptionModeNames},
+		},
+	},
+	"GET /compress/:kb": {
+		summary: "Gzip kb KB of generated data", tag: "CPU Load Testing", result: CompressResult{},
+		params: []openAPIParam{
+			rangeParam("kb", "Size in KB", func(limits loadLimits) interface{} { return limits.CompressKB }),
+			{name: "level", in: "query", description: "Gzip level, -2 (Huffman only) to 9"},
+		},
+	},
+	"GET /json/:kb": {
+		summary: "Marshal and unmarshal a nested document of kb KB", tag: "CPU Load Testing", result: JSONResult{},
+		params: []openAPIParam{
+			rangeParam("kb", "Document size in KB", func(limits loadLimits) interface{} { return limits.JSONKB }),
+			{name: "iterations", in: "query", description: "Roundtrips (default 1)", limit: func(limits loadLimits) interface{} { return limits.JSONIterations }},
+		},
+	},
+	"GET /sort/:n": {
+		summary: "Sort n random integers", tag: "CPU Load Testing", result: SortResult{},
+		params: []openAPIParam{
+			rangeParam("n", "Element count", func(limits loadLimits) interface{} { return limits.SortN }),
+			{name: "algo", in: "query", description: "Sort algorithm (default std)", enum: sortAlgorithmNames},
+			{name: "reverse", in: "query", description: "Start from descending data (`0` or `1`)"},
+		},
+	},
+	"GET /matmul/:dim": {
+		summary: "Multiply two dim x dim matrices", tag: "CPU Load Testing", result: MatmulResult{},
+		params: []openAPIParam{rangeParam("dim", "Matrix dimension", func(limits loadLimits) interface{} { return limits.MatmulDim })},
+	},
+	"GET /memory/:m": {
+		summary: "Allocate m KB of memory", tag: "Memory Testing", result: MemoryResult{},
+		params: []openAPIParam{
+			sizeParam("m", "Size in KB", func(limits loadLimits) interface{} { return limits.MemoryKB }),
+			{name: "hold", in: "query", description: "Keep the allocation alive for this Go duration", limit: func(limits loadLimits) interface{} { return limits.HoldDuration }},
+			{name: "chunk", in: "query", description: "Allocate in slices of this size in KB (KB, MB, or GB suffix allowed) instead of one slice", limit: func(limits loadLimits) interface{} { return limits.MemoryKB }},
+			{name: "touch", in: "query", description: "How to write the allocation (default stride): every byte, every stride bytes, or not at all", enum: memoryTouchNames},
+			{name: "stride", in: "query", description: "Bytes between writes for touch=stride (default 4096)", limit: func(limits loadLimits) interface{} { return limits.MemoryKB * 1024 }},
+			{name: "fill", in: "query", description: "Write every byte instead of touching: zeros, random bytes, or nothing; can't be combined with touch or stride", enum: memoryFillNames},
+		},
+	},
+	"GET /query/:n": {
+		summary: "Simulate a database query over n rows", tag: "CPU Load Testing", result: QueryResult{},
+		params: []openAPIParam{
+			rangeParam("n", "Row count", func(limits loadLimits) interface{} { return limits.QueryRows }),
+			{name: "joins", in: "query", description: "Join count (default 1)", limit: func(limits loadLimits) interface{} { return limits.QueryJoins }},
+		},
+	},
+	"GET /spin/:d": {
+		summary: "Spin on integer arithmetic for a Go duration without allocating", tag: "CPU Load Testing", result: SpinResult{},
+		params: []openAPIParam{{name: "d", in: "path", description: "Go duration, e.g. `500ms`", limit: func(limits loadLimits) interface{} { return limits.CPUDuration }}, pinParam},
+	},
+	"GET /bcrypt/:cost": {
+		summary: "Hash a fixed password with bcrypt", tag: "CPU Load Testing", result: BcryptResult{},
+		params: []openAPIParam{{name: "cost", in: "path", description: "bcrypt cost factor (4-15); each step doubles the work"}},
+	},
+	"GET /cpu/:d": {
+		summary: "Burn CPU for a Go duration", tag: "CPU Load Testing", result: CPUBurnResult{},
+		params: []openAPIParam{{name: "d", in: "path", description: "Go duration, e.g. `500ms`", limit: func(limits loadLimits) interface{} { return limits.CPUDuration }}, pinParam},
+	},
+	"GET /status/:code": {
+		summary: "Respond with an arbitrary status code", tag: "Fault Testing", result: StatusCodeResult{},
+		params: []openAPIParam{{name: "code", in: "path", description: "HTTP status code (100-599)"}},
+	},
+	"GET /fibonacci/hex/:f/:h": {
+		summary: "Fibonacci and hex generation", tag: "Combined Operations", result: FibonacciHexResult{}, combined: true,
+		params: []openAPIParam{
+			rangeParam("f", "Fibonacci index", func(limits loadLimits) interface{} { return limits.Fibonacci }),
+			sizeParam("h", "Hex size in KB", func(limits loadLimits) interface{} { return limits.HexKB }),
+		},
+	},
+	"GET /primes/hex/:p/:h": {
+		summary: "Prime and hex generation", tag: "Combined Operations", result: PrimeHexResult{}, combined: true,
+		params: []openAPIParam{
+			rangeParam("p", "Number of primes", func(limits loadLimits) interface{} { return limits.Primes }),
+			sizeParam("h", "Hex size in KB", func(limits loadLimits) interface{} { return limits.HexKB }),
+		},
+	},
+	"GET /fibonacci/hex/memory/:f/:h/:m": {
+		summary: "Fibonacci, hex generation, and memory allocation", tag: "Combined Operations", result: FibonacciHexMemoryResult{}, combined: true,
+		params: []openAPIParam{
+			rangeParam("f", "Fibonacci index", func(limits loadLimits) interface{} { return limits.Fibonacci }),
+			sizeParam("h", "Hex size in KB", func(limits loadLimits) interface{} { return limits.HexKB }),
+			sizeParam("m", "Memory size in KB", func(limits loadLimits) interface{} { return limits.MemoryKB }),
+		},
+	},
+	"GET /primes/hex/memory/:p/:h/:m": {
+		summary: "Prime and hex generation, and memory allocation", tag: "Combined Operations", result: PrimeHexMemoryResult{}, combined: true,
+		params: []openAPIParam{
+			rangeParam("p", "Number of primes", func(limits loadLimits) interface{} { return limits.Primes }),
+			sizeParam("h", "Hex size in KB", func(limits loadLimits) interface{} { return limits.HexKB }),
+			sizeParam("m", "Memory size in KB", func(limits loadLimits) interface{} { return limits.MemoryKB }),
+			{name: "budget", in: "query", description: "Run stages only while this Go duration lasts and list the rest as skipped", limit: func(limits loadLimits) interface{} { return limits.RequestTimeout }},
+		},
+	},
+	"GET /load": {
+		summary: "Compose operations from query parameters, e.g. ?primes=1000&hex=100", tag: "Combined Operations", result: LoadResult{},
+	},
+	"POST /batch": {
+		summary: "Run a JSON array of {op, value} operations in order", tag: "Combined Operations", result: BatchResponse{},
+	},
+	"POST /warmup": {
+		summary: "Run every load operation once at a small size to prime caches and pools", tag: "Combined Operations", result: WarmupResult{},
+	},
+	"GET /ws": {
+		summary: "Upgrade to a WebSocket that answers {op, value} commands", tag: "Combined Operations",
+	},
+	"GET /fetch": {
+		summary: "Download from an allowlisted URL", tag: "Bandwidth Testing", result: FetchResult{},
+		params: []openAPIParam{
+			{name: "url", in: "query", description: "http(s) URL whose host is in APEX_FETCH_ALLOWLIST"},
+			{name: "bytes", in: "query", description: "Maximum bytes to read. " + rangeSyntax, ranged: true, limit: func(limits loadLimits) interface{} { return limits.FetchBytes }},
+		},
+	},
+	"POST /echo": {
+		summary: "Read the request body and report its size and SHA-256", tag: "Bandwidth Testing", result: EchoResult{},
+		params: []openAPIParam{
+			{name: "echo", in: "query", description: "Send the body back verbatim instead (`0` or `1`)"},
+		},
+	},
+	"GET /disk/write/:kb": {
+		summary: "Write, fsync, and delete a temp file", tag: "Disk I/O Testing", result: DiskWriteResult{},
+		params: []openAPIParam{rangeParam("kb", "Size in KB", func(limits loadLimits) interface{} { return limits.DiskWriteKB })},
+	},
+	"GET /disk/read/:kb": {
+		summary: "Read from the startup backing file", tag: "Disk I/O Testing", result: DiskReadResult{},
+		params: []openAPIParam{rangeParam("kb", "Size in KB", func(limits loadLimits) interface{} { return limits.DiskReadKB })},
+	},
+}
+
+// openAPIPath converts a gin route path to OpenAPI syntax: /primes/:p becomes /primes/{p}
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// openAPISchemas derives schemas from Go types through their JSON tags. Named structs are added
+// to components once and referenced from then on.
+type openAPISchemas map[string]*openAPISchema
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaFor returns the schema for values of type t
+func (schemas openAPISchemas) schemaFor(t reflect.Type) *openAPISchema {
+	switch {
+	case t == timeType:
+		return &openAPISchema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Pointer:
+		return schemas.schemaFor(t.Elem())
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &openAPISchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &openAPISchema{Type: "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return &openAPISchema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &openAPISchema{Type: "number"}
+	case reflect.String:
+		return &openAPISchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &openAPISchema{Type: "array", Items: schemas.schemaFor(t.Elem())}
+	case reflect.Map:
+		return &openAPISchema{Type: "object", AdditionalProperties: schemas.schemaFor(t.Elem())}
+	case reflect.Struct:
+		if _, ok := schemas[t.Name()]; !ok {
+			schema := &openAPISchema{Type: "object", Properties: make(map[string]*openAPISchema)}
+			// Reserve the name first so recursive types terminate
+			schemas[t.Name()] = schema
+			for i := 0; i < t.NumField(); i++ {
+				field := t.Field(i)
+				name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+				if !field.IsExported() || name == "-" {
+					continue
+				}
+				if name == "" {
+					name = field.Name
+				}
+				schema.Properties[name] = schemas.schemaFor(field.Type)
+			}
+		}
+		return &openAPISchema{Ref: "#/components/schemas/" + t.Name()}
+	default:
+		// interface{}: any JSON value
+		return &openAPISchema{}
+	}
+}
+
+// openAPIDocument builds the OpenAPI document for the routes registered on this server, with
+// the limits it enforces
+func (s *apiServer) openAPIDocument() openAPIDocument {
+	schemas := make(openAPISchemas)
+	errorResponse := openAPIResponse{
+		Description: "Error; see the code field",
+		Content: map[string]openAPIMediaType{
+			gin.MIMEJSON: {Schema: schemas.schemaFor(reflect.TypeOf(ErrorResponse{}))},
+		},
+	}
+	codes := schemas["ErrorDetail"].Properties["code"]
+	codes.Enum = []string{
+		CodeInvalidNumber, CodeInvalidDuration, CodeInvalidRange, CodeOutOfRange, CodeUnsupportedValue,
+		CodeInvalidParameter, CodeAllocationFailed, CodeTimeout, CodeNotAllowed, CodeUpstreamError,
+		CodeDiskIO, CodeConcurrencyLimit, CodeRateLimited, CodeInternal, CodeUnauthorized, CodeInjectedFault,
+		CodeInsufficientMemory,
+	}
+
+	doc := openAPIDocument{
+		OpenAPI: "3.0.3",
+		Info: openAPIInfo{
+			Title: "Apex Load Generator API",
+			Description: "Generates CPU, memory, bandwidth, and I/O load for testing. " +
+				"Parameter limits reflect this server's APEX_MAX_* settings.",
+			Version: "1.0.0",
+		},
+		Paths:      make(map[string]map[string]openAPIOperation),
+		Components: openAPIComponents{Schemas: schemas},
+	}
+
+	for _, info := range s.routes {
+		route, ok := openAPIRoutes[info.Method+" "+info.Path]
+		if !ok {
+			route = openAPIRoute{summary: info.Path}
+		}
+		op := openAPIOperation{
+			Summary:   route.summary,
+			Responses: map[string]openAPIResponse{"200": {Description: "Success"}},
+		}
+		if route.tag != "" {
+			op.Tags = []string{route.tag}
+		}
+		for _, param := range route.params {
+			schema := &openAPISchema{Type: "string"}
+			description := param.description
+			if param.ranged {
+				schema.Pattern = rangePattern
+				if param.in == "path" {
+					description += ". " + rangeSyntax
+				}
+			}
+			if param.sized {
+				schema.Pattern = sizePattern
+				description += ". " + sizeSyntax
+			}
+			if param.enum != nil {
+				schema.Enum = param.enum()
+			}
+			if param.limit != nil {
+				description += fmt.Sprintf(" (max %s)", formatLimit(param.limit(s.limits())))
+			}
+			op.Parameters = append(op.Parameters, openAPIParameter{
+				Name:        param.name,
+				In:          param.in,
+				Required:    param.in == "path",
+				Description: description,
+				Schema:      schema,
+			})
+		}
+		if route.result != nil {
+			op.Responses["200"] = openAPIResponse{
+				Description: "Success",
+				Content: map[string]openAPIMediaType{gin.MIMEJSON: {Schema: &openAPISchema{
+					Type: "object",
+					Properties: map[string]*openAPISchema{
+						"data":            schemas.schemaFor(reflect.TypeOf(route.result)),
+						"request_metrics": schemas.schemaFor(reflect.TypeOf(RequestMetrics{})),
+					},
+				}}},
+			}
+			if route.combined {
+				properties := op.Responses["200"].Content[gin.MIMEJSON].Schema.Properties
+				properties["total_operation_duration_us"] = &openAPISchema{Type: "integer"}
+				properties["total_operation_duration_ms"] = &openAPISchema{Type: "number"}
+			}
+			op.Parameters = append(op.Parameters,
+				openAPIParameter{Name: "timeout", In: "query", Description: fmt.Sprintf("Time budget as a Go duration (max %s)", s.limits().RequestTimeout), Schema: &openAPISchema{Type: "string"}},
+				openAPIParameter{Name: "metrics", In: "query", Description: "Set to false to omit request_metrics", Schema: &openAPISchema{Type: "boolean"}},
+				openAPIParameter{Name: "dist", In: "query", Description: "Distribution for picking values from min..max ranges", Schema: &openAPISchema{Type: "string", Enum: []string{"uniform", "exp", "normal"}}},
+				openAPIParameter{Name: "error_rate", In: "query", Description: "Probability (0-1) of failing with an injected fault before doing any work", Schema: &openAPISchema{Type: "number"}},
+				openAPIParameter{Name: "delay", In: "query", Description: fmt.Sprintf("Latency to inject before the work, a Go duration or min..max range (max %s)", s.limits().Delay), Schema: &openAPISchema{Type: "string"}},
+				openAPIParameter{Name: "error_status", In: "query", Description: "Status code of injected faults (400-599, default 500)", Schema: &openAPISchema{Type: "integer"}},
+			)
+			op.Responses["400"] = errorResponse
+			op.Responses["503"] = errorResponse
+		}
+
+		path := openAPIPath(info.Path)
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]openAPIOperation)
+		}
+		doc.Paths[path][strings.ToLower(info.Method)] = op
+	}
+	return doc
+}
+
+// getOpenAPI serves the OpenAPI 3.0 document for this server's routes. It is always JSON:
+// the key=value rendering of writeNegotiated makes no sense for a spec.
+func (s *apiServer) getOpenAPI(c *gin.Context) {
+	c.JSON(http.StatusOK, s.openAPIDocument())
+}
+
+// prometheusMetrics holds the per-route request, error, and latency collectors together with the
+// standard Go runtime and process collectors. Each server gets its own registry so tests can
+// build several servers without duplicate-registration panics.
+type prometheusMetrics struct {
+	registry  *prometheus.Registry
+	handler   http.Handler
+	requests  *prometheus.CounterVec
+	errors    *prometheus.CounterVec
+	latencies *prometheus.HistogramVec
+}
+
+// newPrometheusMetrics creates the collectors and registers them on a fresh registry
+func newPrometheusMetrics() *prometheusMetrics {
+	pm := &prometheusMetrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Total number of HTTP requests by route and status.",
+		}, []string{"path", "status"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_request_errors_total",
+			Help: "Total number of HTTP requests answered with a 4xx or 5xx status by route.",
+		}, []string{"path"}),
+		latencies: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request latency by route.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"path"}),
+	}
+	pm.registry.MustRegister(
+		pm.requests,
+		pm.errors,
+		pm.latencies,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	pm.handler = promhttp.HandlerFor(pm.registry, promhttp.HandlerOpts{})
+	return pm
+}
+
+// observe records a completed request for the given route template
+func (pm *prometheusMetrics) observe(path string, status int, duration time.Duration) {
+	pm.requests.WithLabelValues(path, strconv.Itoa(status)).Inc()
+	if status >= http.StatusBadRequest {
+		pm.errors.WithLabelValues(path).Inc()
+	}
+	pm.latencies.WithLabelValues(path).Observe(duration.Seconds())
+}
+
+// middleware records every request handled by the router.
+// Routes are labelled by their template (e.g. /primes/:p) to keep label cardinality bounded.
+func (pm *prometheusMetrics) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		path := c.FullPath()
+		if path == "" {
+			path = "unmatched"
+		}
+		pm.observe(path, c.Writer.Status(), time.Since(start))
+	}
+}
+
+// getMetrics serves the registry through promhttp, which handles exposition format negotiation
+func (pm *prometheusMetrics) getMetrics(c *gin.Context) {
+	pm.handler.ServeHTTP(c.Writer, c.Request)
+}
+
+// StatsReservoirSize is the number of latency samples kept per endpoint for percentile estimates
+const StatsReservoirSize = 1024
+
+// LatencySummary summarizes request latencies in milliseconds. Min, max, and mean cover every
+// request; percentiles are estimated from a uniform reservoir sample of StatsReservoirSize latencies.
+type LatencySummary struct {
+	Count  int64   `json:"count"`
+	MinMs  float64 `json:"min_ms"`
+	MaxMs  float64 `json:"max_ms"`
+	MeanMs float64 `json:"mean_ms"`
+	P50Ms  float64 `json:"p50_ms"`
+	P95Ms  float64 `json:"p95_ms"`
+	P99Ms  float64 `json:"p99_ms"`
+}
+
+// EndpointStats holds the totals for one route template
+type EndpointStats struct {
+	Requests int64          `json:"requests"`
+	Errors   int64          `json:"errors"`
+	Latency  LatencySummary `json:"latency"`
+}
+
+// StatsResult is the server-wide summary returned by GET /stats
+type StatsResult struct {
+	Since         time.Time                `json:"since"`
+	TotalRequests int64                    `json:"total_requests"`
+	TotalErrors   int64                    `json:"total_errors"`
+	Endpoints     map[string]EndpointStats `json:"endpoints"`
+}
+
+// DefaultHistogramBucketsMs are the upper bounds, in milliseconds, of the latency histogram buckets
+// served by GET /stats/histogram unless APEX_STATS_HISTOGRAM_BUCKETS overrides them
+var DefaultHistogramBucketsMs = []float64{1, 2, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// HistogramBucket counts the requests whose latency fell in (previous bucket's LeMs, LeMs]
+type HistogramBucket struct {
+	LeMs  float64 `json:"le_ms"`
+	Count int64   `json:"count"`
+}
+
+// LatencyHistogram is the latency distribution of one route. Buckets are not cumulative; Overflow
+// counts the requests slower than the last bound.
+type LatencyHistogram struct {
+	Count    int64             `json:"count"`
+	Buckets  []HistogramBucket `json:"buckets"`
+	Overflow int64             `json:"overflow"`
+}
+
+// HistogramResult is returned by GET /stats/histogram, keyed by route template like /stats
+type HistogramResult struct {
+	Since     time.Time                   `json:"since"`
+	Endpoints map[string]LatencyHistogram `json:"endpoints"`
+}
+
+// endpointAccumulator collects the running totals, latency reservoir, and histogram counts for
+// one route. buckets has one count per statsAggregator.bucketsMs bound plus the overflow.
+type endpointAccumulator struct {
+	requests  int64
+	errors    int64
+	sumMs     float64
+	minMs     float64
+	maxMs     float64
+	reservoir []float64
+	buckets   []int64
+}
+
+// statsAggregator keeps in-memory request totals and latency summaries per route template.
+// bucketsMs must be set before the first request is recorded.
+type statsAggregator struct {
+	mu        sync.Mutex
+	since     time.Time
+	endpoints map[string]*endpointAccumulator
+	bucketsMs []float64
+	rng       *rand.Rand
+}
+
+// newStatsAggregator creates an empty aggregator with the default histogram buckets
+func newStatsAggregator() *statsAggregator {
+	return &statsAggregator{
+		since:     time.Now(),
+		endpoints: make(map[string]*endpointAccumulator),
+		bucketsMs: DefaultHistogramBucketsMs,
+		// Reservoir sampling has its own source so it never perturbs a seeded loadRand sequence
+		rng: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// parseHistogramBuckets parses a comma-separated list of strictly increasing, positive bucket
+// bounds in milliseconds, as in APEX_STATS_HISTOGRAM_BUCKETS=1,5,10,50,100
+func parseHistogramBuckets(raw string) ([]float64, error) {
+	var bounds []float64
+	for _, entry := range strings.Split(raw, ",") {
+		bound, err := strconv.ParseFloat(strings.TrimSpace(entry), 64)
+		if err != nil || bound <= 0 || math.IsInf(bound, 0) || math.IsNaN(bound) {
+			return nil, fmt.Errorf("invalid bucket bound %q", entry)
+		}
+		if len(bounds) > 0 && bound <= bounds[len(bounds)-1] {
+			return nil, fmt.Errorf("bucket bounds must increase, got %g after %g", bound, bounds[len(bounds)-1])
+		}
+		bounds = append(bounds, bound)
+	}
+	return bounds, nil
+}
+
+// record adds one completed request to the totals for path
+func (sa *statsAggregator) record(path string, status int, duration time.Duration) {
+	ms := float64(duration.Nanoseconds()) / 1000000.0
+
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+
+	acc, ok := sa.endpoints[path]
+	if !ok {
+		acc = &endpointAccumulator{minMs: ms, maxMs: ms, buckets: make([]int64, len(sa.bucketsMs)+1)}
+		sa.endpoints[path] = acc
+	}
+	acc.requests++
+	if status >= http.StatusBadRequest {
+		acc.errors++
+	}
+	acc.sumMs += ms
+	acc.minMs = math.Min(acc.minMs, ms)
+	acc.maxMs = math.Max(acc.maxMs, ms)
+
+	// Algorithm R: once full, replace a random slot with probability size/requests
+	if len(acc.reservoir) < StatsReservoirSize {
+		acc.reservoir = append(acc.reservoir, ms)
+	} else if i := sa.rng.Int63n(acc.requests); i < StatsReservoirSize {
+		acc.reservoir[i] = ms
+	}
+
+	// The first bound at or above ms; past the last bound, the overflow slot
+	acc.buckets[sort.SearchFloat64s(sa.bucketsMs, ms)]++
+}
+
+// reset discards all totals and restarts the collection window
+func (sa *statsAggregator) reset() {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	sa.since = time.Now()
+	sa.endpoints = make(map[string]*endpointAccumulator)
+}
+
+// snapshot computes the current summary
+func (sa *statsAggregator) snapshot() StatsResult {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+
+	result := StatsResult{
+		Since:     sa.since,
+		Endpoints: make(map[string]EndpointStats, len(sa.endpoints)),
+	}
+	for path, acc := range sa.endpoints {
+		sorted := append([]float64(nil), acc.reservoir...)
+		sort.Float64s(sorted)
+
+		result.TotalRequests += acc.requests
+		result.TotalErrors += acc.errors
+		result.Endpoints[path] = EndpointStats{
+			Requests: acc.requests,
+			Errors:   acc.errors,
+			Latency: LatencySummary{
+				Count:  acc.requests,
+				MinMs:  acc.minMs,
+				MaxMs:  acc.maxMs,
+				MeanMs: acc.sumMs / float64(acc.requests),
+				P50Ms:  percentile(sorted, 50),
+				P95Ms:  percentile(sorted, 95),
+				P99Ms:  percentile(sorted, 99),
+			},
+		}
+	}
+	return result
+}
+
+// histogram returns the latency distribution of the routes in paths, or of every route recorded so
+// far when paths is empty. A route with no requests yet gets empty buckets.
+func (sa *statsAggregator) histogram(paths ...string) HistogramResult {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+
+	if len(paths) == 0 {
+		for path := range sa.endpoints {
+			paths = append(paths, path)
+		}
+	}
+	result := HistogramResult{Since: sa.since, Endpoints: make(map[string]LatencyHistogram, len(paths))}
+	for _, path := range paths {
+		histogram := LatencyHistogram{Buckets: make([]HistogramBucket, len(sa.bucketsMs))}
+		acc := sa.endpoints[path]
+		for i, bound := range sa.bucketsMs {
+			histogram.Buckets[i].LeMs = bound
+			if acc != nil {
+				histogram.Buckets[i].Count = acc.buckets[i]
+			}
+		}
+		if acc != nil {
+			histogram.Count = acc.requests
+			histogram.Overflow = acc.buckets[len(sa.bucketsMs)]
+		}
+		result.Endpoints[path] = histogram
+	}
+	return result
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted, or 0 when it is empty
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// requestDuration returns the RequestMetrics duration when the handler produced one, falling
+// back to the time since start for errors and requests with metrics disabled.
+func requestDuration(c *gin.Context, start time.Time) time.Duration {
+	if value, ok := c.Get(requestMetricsKey); ok {
+		if rm, ok := value.(*RequestMetrics); ok && !rm.EndTime.IsZero() {
+			return rm.EndTime.Sub(rm.StartTime)
+		}
+	}
+	return time.Since(start)
+}
+
+// middleware records every request handled by the router, timed by requestDuration
+func (sa *statsAggregator) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		path := c.FullPath()
+		if path == "" {
+			path = "unmatched"
+		}
+		sa.record(path, c.Writer.Status(), requestDuration(c, start))
+	}
+}
+
+// statsdClient sends per-request metrics to a StatsD server over UDP. Tags use the DogStatsD
+// "|#key:value" extension, which the Datadog agent, Telegraf, and statsd_exporter understand.
+// A nil client is disabled.
+type statsdClient struct {
+	conn net.Conn
+}
+
+// newStatsdClient resolves addr (host:port) and returns a client that sends to it
+func newStatsdClient(addr string) (*statsdClient, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &statsdClient{conn: conn}, nil
+}
+
+// send writes the timing and counter for one request as a single datagram. StatsD is
+// fire-and-forget: write errors (e.g. nothing listening) are dropped rather than failing the request.
+func (sc *statsdClient) send(path string, status int, duration time.Duration) {
+	tags := fmt.Sprintf("|#endpoint:%s,status:%d", path, status)
+	ms := strconv.FormatFloat(float64(duration.Nanoseconds())/1000000.0, 'f', 3, 64)
+	sc.conn.Write([]byte("apex.request.duration:" + ms + "|ms" + tags + "\napex.request.count:1|c" + tags))
+}
+
+// close releases the client's socket
+func (sc *statsdClient) close() error {
+	return sc.conn.Close()
+}
+
+// middleware sends every request handled by the router, timed by requestDuration.
+// It passes requests straight through when the client is nil.
+func (sc *statsdClient) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if sc == nil {
+			c.Next()
+			return
+		}
+		start := time.Now()
+		c.Next()
+
+		path := c.FullPath()
+		if path == "" {
+			path = "unmatched"
+		}
+		sc.send(path, c.Writer.Status(), requestDuration(c, start))
+	}
+}
+
+// tracerName is the instrumentation scope of the generator's spans
+const tracerName = "apex-load-generator"
+
+// traceContext reads the W3C traceparent header that joins a request to its caller's trace
+var traceContext = propagation.TraceContext{}
+
+// newTracerProvider builds an OpenTelemetry tracer provider that batches spans to an OTLP exporter
+// configured by the standard OTEL_* variables, or returns nil when tracing is off: no
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT, or OTEL_TRACES_EXPORTER=none.
+// The exporter reads the endpoint, headers, and timeout itself; OTEL_EXPORTER_OTLP_PROTOCOL picks
+// http/protobuf (the default) or grpc.
+func newTracerProvider(ctx context.Context) (*sdktrace.TracerProvider, error) {
+	if os.Getenv("OTEL_TRACES_EXPORTER") == "none" {
+		return nil, nil
+	}
+	if os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" {
+		return nil, nil
+	}
+
+	protocol := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL")
+	if protocol == "" {
+		protocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch protocol {
+	case "", "http/protobuf":
+		exporter, err = otlptracehttp.New(ctx)
+	case "grpc":
+		exporter, err = otlptracegrpc.New(ctx)
+	default:
+		return nil, fmt.Errorf("unsupported OTLP protocol %q (supported: http/protobuf, grpc)", protocol)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Detectors apply in order, so OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the default name
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", "apex-load-generator")),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res)), nil
+}
+
+// traceRequests starts a server span per request and stores it in the request context, where
+// metrics.stage() starts a child span per sub-operation. An incoming traceparent makes the span
+// part of the caller's trace; the SDK's default parent-based sampler doesn't record one whose
+// sampled flag is off. It passes requests straight through when tracing is off (nil tracer).
+func (s *apiServer) traceRequests() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.tracer == nil {
+			c.Next()
+			return
+		}
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		ctx := traceContext.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		ctx, span := s.tracer.Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", c.Request.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", c.Request.URL.Path),
+			),
+		)
+		defer span.End()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
+
+// SysInfoResult is a snapshot of the host and Go runtime the generator is running on
+type SysInfoResult struct {
+	Hostname       string    `json:"hostname"`
+	GoVersion      string    `json:"go_version"`
+	OS             string    `json:"os"`
+	Arch           string    `json:"arch"`
+	NumCPU         int       `json:"num_cpu"`
+	GOMAXPROCS     int       `json:"gomaxprocs"`
+	GOGC           int       `json:"gogc"`
+	Goroutines     int       `json:"goroutines"`
+	HeapAllocBytes uint64    `json:"heap_alloc_bytes"`
+	HeapSysBytes   uint64    `json:"heap_sys_bytes"`
+	NumGC          uint32    `json:"num_gc"`
+	BallastBytes   int64     `json:"ballast_bytes"`
+	StartedAt      time.Time `json:"started_at"`
+	UptimeSeconds  float64   `json:"uptime_seconds"`
+}
+
+// sysInfo collects the current SysInfoResult. Heap figures come from runtime.MemStats: HeapAlloc is
+// the live heap and HeapSys what the heap has obtained from the OS.
+func (s *apiServer) sysInfo() SysInfoResult {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return SysInfoResult{
+		Hostname:       hostname,
+		GoVersion:      runtime.Version(),
+		OS:             runtime.GOOS,
+		Arch:           runtime.GOARCH,
+		NumCPU:         runtime.NumCPU(),
+		GOMAXPROCS:     runtime.GOMAXPROCS(0),
+		GOGC:           currentGCPercent(),
+		Goroutines:     runtime.NumGoroutine(),
+		HeapAllocBytes: memStats.HeapAlloc,
+		HeapSysBytes:   memStats.HeapSys,
+		NumGC:          memStats.NumGC,
+		BallastBytes:   s.ballastBytes(),
+		StartedAt:      s.startTime,
+		UptimeSeconds:  time.Since(s.startTime).Seconds(),
+	}
+}
+
+// getSysInfo handles GET requests for a snapshot of the host and runtime, for comparing request
+// metrics across nodes. It generates no load.
+func (s *apiServer) getSysInfo(c *gin.Context) {
+	writeNegotiated(c, http.StatusOK, Response[SysInfoResult]{Data: s.sysInfo()})
+}
+
+// redactedValue replaces secrets in GET /config
+const redactedValue = "REDACTED"
+
+// ConfigResult is the configuration the server is running with. Config holds the resolved Config
+// keyed as in the -config file, after environment and flag overrides (and any SIGHUP reload); the
+// other fields are settings that only come from the environment.
+type ConfigResult struct {
+	Config           map[string]interface{} `json:"config"`
+	EnabledEndpoints []string               `json:"enabled_endpoints"`
+	PrettyJSON       bool                   `json:"pretty_json"`
+	Delay            string                 `json:"delay,omitempty"`
+	CORSOrigins      []string               `json:"cors_origins"`
+	FetchAllowlist   []string               `json:"fetch_allowlist"`
+	StatsD           bool                   `json:"statsd"`
+	Tracing          bool                   `json:"tracing"`
+}
+
+// effectiveConfig collects the ConfigResult, with the auth token redacted
+func (s *apiServer) effectiveConfig() (ConfigResult, error) {
+	config := *s.config.Load()
+	if config.AuthToken != "" {
+		config.AuthToken = redactedValue
+	}
+	// Round-trip through YAML so the keys match the config file and durations read as "30s"
+	raw, err := yaml.Marshal(config)
+	if err != nil {
+		return ConfigResult{}, err
+	}
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(raw, &values); err != nil {
+		return ConfigResult{}, err
+	}
+
+	var enabled []string
+	for name := range s.enabledRoutes {
+		enabled = append(enabled, name)
+	}
+	sort.Strings(enabled)
+	if s.enabledRoutes == nil {
+		enabled = loadEndpointNames()
+	}
+	return ConfigResult{
+		Config:           values,
+		EnabledEndpoints: enabled,
+		PrettyJSON:       !s.compactJSON,
+		Delay:            s.delay,
+		CORSOrigins:      s.corsOrigins,
+		FetchAllowlist:   s.fetchAllowlist,
+		StatsD:           s.statsd != nil,
+		Tracing:          s.tracer != nil,
+	}, nil
+}
+
+// getConfig handles GET requests for the effective configuration, to check that file, environment,
+// and flag precedence resolved as intended. Only registered when APEX_ENABLE_ADMIN=true.
+func (s *apiServer) getConfig(c *gin.Context) {
+	result, err := s.effectiveConfig()
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, "", errorWithCode(CodeInternal, "%v", err))
+		return
+	}
+	writeNegotiated(c, http.StatusOK, Response[ConfigResult]{Data: result})
+}
+
+// getStats handles GET requests for the server-wide request summary
+func (s *apiServer) getStats(c *gin.Context) {
+	writeNegotiated(c, http.StatusOK, Response[StatsResult]{Data: s.stats.snapshot()})
+}
+
+// getStatsHistogram handles GET requests for per-route latency histograms. ?path= selects one
+// route, given either as its template (/primes/:p) or as a request path (/primes/100); without it
+// every route recorded so far is returned.
+func (s *apiServer) getStatsHistogram(c *gin.Context) {
+	path, ok := c.GetQuery("path")
+	if !ok || path == "" {
+		writeNegotiated(c, http.StatusOK, Response[HistogramResult]{Data: s.stats.histogram()})
+		return
+	}
+
+	route, ok := s.matchRoute(path)
+	if !ok {
+		respondParamError(c, "path", "a route path such as /primes/100", errorWithCode(CodeInvalidParameter, "no route matches %q", path))
+		return
+	}
+	writeNegotiated(c, http.StatusOK, Response[HistogramResult]{Data: s.stats.histogram(route)})
+}
+
+// matchRoute returns the registered route template that path is, or that gin would route path to.
+// Like gin, a static segment wins over a :param, and a *wildcard takes the rest of the path.
+func (s *apiServer) matchRoute(path string) (string, bool) {
+	segments := strings.Split(path, "/")
+	best, bestParams := "", -1
+	for _, route := range s.routes {
+		if route.Path == path {
+			return route.Path, true
+		}
+		params, ok := matchRouteSegments(strings.Split(route.Path, "/"), segments)
+		if ok && (bestParams < 0 || params < bestParams) {
+			best, bestParams = route.Path, params
+		}
+	}
+	return best, bestParams >= 0
+}
+
+// matchRouteSegments reports whether the path segments match the template segments, and how many
+// template segments were parameters
+func matchRouteSegments(template, segments []string) (params int, ok bool) {
+	for i, segment := range template {
+		if strings.HasPrefix(segment, "*") {
+			return params + 1, i < len(segments)
+		}
+		if i >= len(segments) {
+			return 0, false
+		}
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			if segments[i] == "" {
+				return 0, false
+			}
+			params++
+		case segment != segments[i]:
+			return 0, false
+		}
+	}
+	return params, len(template) == len(segments)
+}
+
+// postStatsReset handles POST requests to clear the server-wide request summary
+func (s *apiServer) postStatsReset(c *gin.Context) {
+	s.stats.reset()
+	writeNegotiated(c, http.StatusOK, StatusResponse{Status: "reset"})
+}
+
+// gzipResponseWriter compresses JSON and plain text bodies on the fly. The decision is made on the
+// first write, once the handler has set Content-Type, so other responses pass through untouched.
+type gzipResponseWriter struct {
+	gin.ResponseWriter
+	gz       *gzip.Writer
+	decided  bool
+	compress bool
+}
+
+// decide checks the response headers and, for compressible bodies, switches to gzip encoding.
+// Content-Length is dropped because the compressed size isn't known until the body is complete.
+func (w *gzipResponseWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+
+	header := w.Header()
+	contentType := header.Get("Content-Type")
+	if header.Get("Content-Encoding") != "" {
+		return
+	}
+	if !strings.HasPrefix(contentType, gin.MIMEJSON) && !strings.HasPrefix(contentType, gin.MIMEPlain) {
+		return
+	}
+
+	w.compress = true
+	header.Set("Content-Encoding", "gzip")
+	header.Add("Vary", "Accept-Encoding")
+	header.Del("Content-Length")
+	w.gz = gzip.NewWriter(w.ResponseWriter)
+}
+
+// Write compresses data when the response was found to be compressible
+func (w *gzipResponseWriter) Write(data []byte) (int, error) {
+	w.decide()
+	if !w.compress {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.gz.Write(data)
+}
+
+// WriteString routes through Write so string renders are compressed too
+func (w *gzipResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush pushes buffered compressed data to the client, keeping streamed responses incremental.
+// A flush before the first write still has to decide, since it sends the headers.
+func (w *gzipResponseWriter) Flush() {
+	w.decide()
+	if w.compress {
+		w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// close writes the gzip footer if compression was used
+func (w *gzipResponseWriter) close() {
+	if w.compress {
+		w.gz.Close()
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header lists gzip with a non-zero quality
+func acceptsGzip(acceptEncoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), "gzip") {
+			continue
+		}
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if key == "q" {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					quality = parsed
+				}
+			}
+		}
+		return quality > 0
+	}
+	return false
+}
+
+// gzipResponses compresses JSON and text responses for clients sending Accept-Encoding: gzip.
+// Requests with ?raw=1 are left uncompressed so bandwidth tests can still move raw bytes.
+func gzipResponses() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Query("raw") == "1" || !acceptsGzip(c.GetHeader("Accept-Encoding")) {
+			c.Next()
+			return
+		}
+
+		writer := &gzipResponseWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		defer writer.close()
+		c.Next()
+	}
+}
+
+// recoverPanics turns a panic in a later middleware or handler into a JSON 500
+// {"error": "internal", "detail": ...} and logs it with the request ID and stack trace. It sits
+// inside the logging, metrics, and stats middleware so the 500 is recorded like any other response.
+// http.ErrAbortHandler is re-panicked, since it deliberately aborts the response.
+func (s *apiServer) recoverPanics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			if r == http.ErrAbortHandler {
+				panic(r)
+			}
+
+			s.logger.LogAttrs(c.Request.Context(), slog.LevelError, "panic recovered",
+				slog.String("method", c.Request.Method),
+				slog.String("path", c.Request.URL.Path),
+				slog.String("request_id", c.GetString(requestIDKey)),
+				slog.Any("panic", r),
+				slog.String("stack", string(debug.Stack())),
+			)
+			if c.Writer.Written() {
+				// Part of the response is already on the wire; all we can do is stop
+				c.Abort()
+				return
+			}
+			abortWithError(c, http.StatusInternalServerError, "", errorWithCode(CodeInternal, "%v", r))
+		}()
+		c.Next()
+	}
+}
+
+// trackInFlight counts requests currently being handled so shutdown can report how many it drained
+func (s *apiServer) trackInFlight() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s.inFlight.Add(1)
+		defer s.inFlight.Add(-1)
+		c.Next()
+	}
+}
+
+// parseCORSOrigins splits a comma-separated APEX_CORS_ORIGINS into origins such as
+// "https://dashboard.example.com". Origins are compared exactly, so no trailing slash; "*" allows any.
+func parseCORSOrigins(raw string) []string {
+	var origins []string
+	for _, entry := range strings.Split(raw, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			origins = append(origins, entry)
+		}
+	}
+	return origins
+}
+
+// cors adds CORS headers for requests whose Origin is in s.corsOrigins and answers preflight
+// OPTIONS requests with a 204 before auth or admission control see them, since browsers send
+// preflights without credentials. With no origins configured it does nothing.
+func (s *apiServer) cors() gin.HandlerFunc {
+	allowed := make(map[string]bool, len(s.corsOrigins))
+	for _, origin := range s.corsOrigins {
+		allowed[origin] = true
+	}
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" || !(allowed[origin] || allowed["*"]) {
+			c.Next()
+			return
+		}
+
+		header := c.Writer.Header()
+		if allowed["*"] {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+			header.Add("Vary", "Origin")
+		}
+		header.Set("Access-Control-Expose-Headers", "X-Request-ID, Retry-After")
+
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			header.Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			header.Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-Request-ID")
+			header.Set("Access-Control-Max-Age", "600")
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
+
+// parseErrorRate parses an ?error_rate= or APEX_ERROR_RATE probability between 0 and 1
+func parseErrorRate(raw string) (float64, error) {
+	rate, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+	if err != nil {
+		return 0, errorWithCode(CodeInvalidNumber, "invalid number: %v", err)
+	}
+	if !(rate >= 0 && rate <= 1) {
+		return 0, errorWithCode(CodeOutOfRange, "rate out of range (0-1)")
+	}
+	return rate, nil
+}
+
+// parseErrorStatus parses an ?error_status= or APEX_ERROR_STATUS code, which must be a 4xx or 5xx
+func parseErrorStatus(raw string) (int, error) {
+	status, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil {
+		return 0, errorWithCode(CodeInvalidNumber, "invalid number: %v", err)
+	}
+	if status < 400 || status > 599 {
+		return 0, errorWithCode(CodeOutOfRange, "status out of range (400-599)")
+	}
+	return status, nil
+}
+
+// injectErrors fails load requests with probability ?error_rate= (default Config.ErrorRate, from
+// APEX_ERROR_RATE) before any work is done, answering with ?error_status= (default Config.ErrorStatus,
+// APEX_ERROR_STATUS, 500). The dice come from s.faultRand, a pooled per-request source separate
+// from loadRand. Operational routes are never failed.
+func (s *apiServer) injectErrors() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isLoadRoute(c) {
+			c.Next()
+			return
+		}
+
+		config := s.config.Load()
+		rate, status := config.ErrorRate, config.ErrorStatus
+		if raw, ok := c.GetQuery("error_rate"); ok {
+			var err error
+			if rate, err = parseErrorRate(raw); err != nil {
+				respondParamError(c, "error_rate", "0-1", err)
+				return
+			}
+		}
+		if raw, ok := c.GetQuery("error_status"); ok {
+			var err error
+			if status, err = parseErrorStatus(raw); err != nil {
+				respondParamError(c, "error_status", "400-599", err)
+				return
+			}
+		}
+
+		if rate > 0 && s.faultRand.Float64() < rate {
+			writeError(c, status, ErrorDetail{
+				Message: fmt.Sprintf("injected fault (error_rate %g)", rate),
+				Code:    CodeInjectedFault,
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// authExemptRoutes stay open when APEX_AUTH_TOKEN is set, so orchestrator probes (which send
+// no credentials) keep working
+var authExemptRoutes = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+// requireAuth rejects requests without "Authorization: Bearer <s.authToken>" with a 401; an
+// empty authToken disables the check. Both tokens are hashed before the constant-time compare so
+// neither the content nor the length of the expected token leaks through timing.
+func (s *apiServer) requireAuth() gin.HandlerFunc {
+	expected := sha256.Sum256([]byte(s.authToken))
+	return func(c *gin.Context) {
+		if s.authToken == "" || authExemptRoutes[c.FullPath()] {
+			c.Next()
+			return
+		}
+
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		provided := sha256.Sum256([]byte(token))
+		if !ok || subtle.ConstantTimeCompare(provided[:], expected[:]) != 1 {
+			c.Header("WWW-Authenticate", `Bearer realm="apex-load-generator"`)
+			writeError(c, http.StatusUnauthorized, ErrorDetail{
+				Message: "missing or invalid bearer token",
+				Code:    CodeUnauthorized,
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// operationalRoutes are the routes that do no load generation. They bypass admission control so
+// probes, scrapes, and debugging keep working while the generator is saturated.
+var operationalRoutes = map[string]bool{
+	"/":                      true,
+	"/metrics":               true,
+	"/stats":                 true,
+	"/stats/reset":           true,
+	"/stats/histogram":       true,
+	"/sysinfo":               true,
+	"/config":                true,
+	"/healthz":               true,
+	"/readyz":                true,
+	"/swagger.yaml":          true,
+	"/swagger":               true,
+	"/docs":                  true,
+	"/openapi.json":          true,
+	"/gc":                    true,
+	"/admin/maxprocs/:n":     true,
+	"/admin/gogc/:pct":       true,
+	"/admin/ballast/release": true,
+	"/admin/shutdown":        true,
+	"/debug/pprof/*profile":  true,
+	"/debug/vars":            true,
+}
+
+// isLoadRoute reports whether the request matched a route that generates load. Unmatched
+// requests (404s) and HEAD probes do no work, so they are not load routes either.
+func isLoadRoute(c *gin.Context) bool {
+	path := c.FullPath()
+	return path != "" && !operationalRoutes[path] && c.Request.Method != http.MethodHead
+}
+
+// limitConcurrency caps the number of load requests in flight at cap(s.loadSlots)
+// (APEX_MAX_CONCURRENCY); a nil loadSlots means no cap. A request that finds every slot taken
+// waits up to s.queueTimeout (APEX_CONCURRENCY_QUEUE_TIMEOUT, default 0 = don't wait) for one to
+// free up, then gets a 503 with Retry-After. Operational routes always bypass the limiter.
+func (s *apiServer) limitConcurrency() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.loadSlots == nil || !isLoadRoute(c) {
+			c.Next()
+			return
+		}
+
+		select {
+		case s.loadSlots <- struct{}{}:
+		default:
+			if !s.waitForSlot(c.Request.Context()) {
+				c.Header("Retry-After", "1")
+				writeError(c, http.StatusServiceUnavailable, ErrorDetail{
+					Message: fmt.Sprintf("concurrency limit of %d load requests reached", cap(s.loadSlots)),
+					Code:    CodeConcurrencyLimit,
+					Limit:   formatLimit(cap(s.loadSlots)),
+				})
+				return
+			}
+		}
+		defer func() { <-s.loadSlots }()
+		c.Next()
+	}
+}
+
+// waitForSlot waits up to s.queueTimeout for a load slot and reports whether it got one
+func (s *apiServer) waitForSlot(ctx context.Context) bool {
+	if s.queueTimeout <= 0 {
+		return false
+	}
+	timer := time.NewTimer(s.queueTimeout)
+	defer timer.Stop()
+	select {
+	case s.loadSlots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// rateLimiter throttles request arrival with one rate.Limiter per route (APEX_RATE_LIMIT_RPS,
+// APEX_RATE_LIMIT_BURST), so a flood of one endpoint doesn't starve the others.
+type rateLimiter struct {
+	rps      float64
+	burst    int
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+// newRateLimiter creates a rateLimiter allowing rps requests per second per route with the given burst
+func newRateLimiter(rps float64, burst int) *rateLimiter {
+	return &rateLimiter{rps: rps, burst: burst, limiters: make(map[string]*rate.Limiter)}
+}
+
+// allow admits one request for route at time now. Each route's limiter starts full, so a burst of
+// requests is admitted before the rate applies. When it is empty, allow returns false and how long
+// until the next token is available.
+func (rl *rateLimiter) allow(route string, now time.Time) (bool, time.Duration) {
+	rl.mu.Lock()
+	limiter, ok := rl.limiters[route]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(rl.rps), rl.burst)
+		rl.limiters[route] = limiter
+	}
+	rl.mu.Unlock()
+
+	if limiter.AllowN(now, 1) {
+		return true, 0
+	}
+	// Reserving then cancelling reads the wait without consuming the token for the rejected request
+	reservation := limiter.ReserveN(now, 1)
+	wait := reservation.DelayFrom(now)
+	reservation.CancelAt(now)
+	return false, wait
+}
+
+// limitRate rejects load requests that arrive faster than s.rateLimiter allows with a 429 and a
+// Retry-After header (whole seconds, rounded up); a nil rateLimiter means no limit. A reload may
+// swap the limiter, so it's loaded once per request. Unlike
+// limitConcurrency, this caps arrival rate rather than in-flight count. Operational routes are exempt.
+func (s *apiServer) limitRate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limiter := s.rateLimiter.Load()
+		if limiter == nil || !isLoadRoute(c) {
+			c.Next()
+			return
+		}
+
+		ok, wait := limiter.allow(c.FullPath(), time.Now())
+		if !ok {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeError(c, http.StatusTooManyRequests, ErrorDetail{
+				Message: fmt.Sprintf("rate limit of %g requests per second (burst %d) exceeded for %s", limiter.rps, limiter.burst, c.FullPath()),
+				Code:    CodeRateLimited,
+				Limit:   formatLimit(limiter.rps),
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// requestIDHeader carries the request correlation ID in both directions
+const requestIDHeader = "X-Request-ID"
+
+// requestIDKey is the gin context key holding the request correlation ID
+const requestIDKey = "request_id"
+
+// newLogger creates a logger writing to w in the given format: "text" for logfmt-style
+// key=value lines, anything else for one JSON object per line.
+func newLogger(w io.Writer, format string, level slog.Level) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level}
+	if format == "text" {
+		return slog.New(slog.NewTextHandler(w, opts))
+	}
+	return slog.New(slog.NewJSONHandler(w, opts))
+}
+
+// loggerFromEnv creates a logger from APEX_LOG_FORMAT (json or text, default json) and
+// APEX_LOG_LEVEL (debug, info, warn, or error, default info). Invalid values log a warning
+// and use the default.
+func loggerFromEnv(w io.Writer) *slog.Logger {
+	format := strings.ToLower(strings.TrimSpace(os.Getenv("APEX_LOG_FORMAT")))
+	if format != "" && format != "json" && format != "text" {
+		log.Printf("warning: ignoring invalid APEX_LOG_FORMAT=%q, using default json", format)
+		format = "json"
+	}
+
+	level := slog.LevelInfo
+	if raw := strings.TrimSpace(os.Getenv("APEX_LOG_LEVEL")); raw != "" {
+		if err := level.UnmarshalText([]byte(raw)); err != nil {
+			log.Printf("warning: ignoring invalid APEX_LOG_LEVEL=%q, using default info", raw)
+			level = slog.LevelInfo
+		}
+	}
+	return newLogger(w, format, level)
+}
+
+// newRequestID generates a random (version 4) UUID
+func newRequestID() string {
+	var b [16]byte
+	crand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// validRequestID reports whether a client-supplied ID is safe to reuse: 1 to 128 printable
+// ASCII characters, so it can't bloat or break log lines and response headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// requestLogger replaces gin's default logger with one structured line per request. It reuses a
+// valid incoming X-Request-ID or generates one, and echoes it in the response. 5xx responses are
+// logged at error level and 4xx at warn.
+func (s *apiServer) requestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		id := c.GetHeader(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Set(requestIDKey, id)
+		c.Header(requestIDHeader, id)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		s.logger.LogAttrs(c.Request.Context(), level, "request",
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Float64("duration_ms", float64(time.Since(start).Nanoseconds())/1000000.0),
+			slog.Int("bytes", max(c.Writer.Size(), 0)),
+			slog.String("client_ip", c.ClientIP()),
+			slog.String("request_id", id),
+		)
+	}
+}
+
+// HTTPPort is the default port plain HTTP (or HTTPS, when TLS is on without -tls-port) is served on
+const HTTPPort = 8080
+
+// tlsConfig is where HTTPS is served from. A zero port means HTTPS replaces plain HTTP on
+// the HTTP port; otherwise HTTPS runs on port alongside it.
+type tlsConfig struct {
+	certFile string
+	keyFile  string
+	port     int
+}
+
+// resolveTLSConfig checks APEX_TLS_CERT, APEX_TLS_KEY, and -tls-port against the plain HTTP port,
+// returning nil when TLS is off. Setting only one of the files, or a TLS port without them, is an
+// error so a half-configured instance fails at startup instead of silently serving plain HTTP.
+func resolveTLSConfig(certFile, keyFile string, port, httpPort int) (*tlsConfig, error) {
+	switch {
+	case certFile == "" && keyFile == "":
+		if port != 0 {
+			return nil, fmt.Errorf("-tls-port %d requires APEX_TLS_CERT and APEX_TLS_KEY", port)
+		}
+		return nil, nil
+	case certFile == "":
+		return nil, errors.New("APEX_TLS_KEY is set but APEX_TLS_CERT is not; set both to enable TLS")
+	case keyFile == "":
+		return nil, errors.New("APEX_TLS_CERT is set but APEX_TLS_KEY is not; set both to enable TLS")
+	case port < 0 || port > 65535:
+		return nil, fmt.Errorf("-tls-port %d is out of range (1-65535)", port)
+	case port == httpPort:
+		return nil, fmt.Errorf("-tls-port %d is the plain HTTP port; omit it to serve only HTTPS there", port)
+	}
+	return &tlsConfig{certFile: certFile, keyFile: keyFile, port: port}, nil
+}
+
+// serve runs srv on listener until it is shut down, over TLS when srv.TLSConfig is set
+func serve(srv *http.Server, listener net.Listener) error {
+	if srv.TLSConfig != nil {
+		return srv.ServeTLS(listener, "", "")
+	}
+	return srv.Serve(listener)
+}
+
+// shutdown gracefully stops servers, giving in-flight requests up to grace to complete.
+// The grace period is shared, not per server.
+func (s *apiServer) shutdown(grace time.Duration, reason string, servers ...*http.Server) error {
+	s.ready.Store(false)
+	draining := s.inFlight.Load()
+	log.Printf("shutting down (%s): draining %d in-flight requests with %s grace period", reason, draining, grace)
+
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+
+	var errs []error
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		log.Printf("shutdown incomplete: %d requests still in flight: %v", s.inFlight.Load(), err)
+		return err
+	}
+	log.Printf("shutdown complete: drained %d requests", draining)
+	return nil
+}
+
+// registerRoutes registers all documentation and load testing routes on the router
+func (s *apiServer) registerRoutes(router *gin.Engine) {
+	router.Use(s.requestLogger(), s.metrics.middleware(), s.stats.middleware(), s.statsd.middleware(), s.traceRequests(), s.expvars.middleware(), s.trackInFlight(), s.recoverPanics(), s.cors(), s.jsonStyle(), s.requireAuth(), s.injectErrors(), s.limitRate(), s.limitConcurrency(), gzipResponses(), s.requestTimeout(), s.rangeDistribution(), s.clampRanges(), s.injectLatency())
+
+	router.GET("/", getIndex)
+	router.GET("/metrics", s.metrics.getMetrics)
+	router.GET("/stats", s.getStats)
+	router.GET("/sysinfo", s.getSysInfo)
+	router.POST("/stats/reset", s.postStatsReset)
+	router.GET("/stats/histogram", s.getStatsHistogram)
+	router.GET("/healthz", getHealthz)
+	router.GET("/readyz", s.getReadyz)
+	router.GET("/swagger.yaml", getSwaggerYAML)
+	router.GET("/swagger", getSwaggerUI)
+	router.GET("/docs", getSwaggerUI)
+	router.GET("/openapi.json", s.getOpenAPI)
+	load := loadRoutes{router: router, enabled: s.enabledRoutes}
+	load.GET("/fibonacci/:f", s.getFibonacci)
+	load.GET("/primes/:p", pinnable(s.getPrimes))
+	load.GET("/primes/upto/:n", pinnable(s.getPrimesUpTo))
+	load.GET("/collatz/:n", s.getCollatz)
+	load.GET("/goroutines/:n", s.getGoroutines)
+	load.GET("/primes/sse/:n", s.getPrimesSSE)
+	load.GET("/primes/nth/:n", pinnable(s.getNthPrime))
+	load.GET("/primes/gaps/:n", pinnable(s.getPrimeGaps))
+	load.GET("/hash/:n", s.getHash)
+	load.GET("/regex/:n", s.getRegex)
+	load.GET("/hex/:h", s.getHexString)
+	load.GET("/hex/stream/:h", s.getHexStream)
+	load.GET("/drip", s.getDrip)
+	load.GET("/encrypt/:kb", s.getEncrypt)
+	load.GET("/compress/:kb", s.getCompress)
+	load.GET("/json/:kb", s.getJSON)
+	load.GET("/sort/:n", s.getSort)
+	load.GET("/matmul/:dim", s.getMatmul)
+	load.GET("/memory/:m", s.getMemory)
+	load.GET("/query/:n", s.getQuery)
+	load.GET("/cpu/:d", pinnable(s.getCPUBurn))
+	load.GET("/spin/:d", pinnable(s.getSpin))
+	load.GET("/bcrypt/:cost", s.getBcrypt)
+	load.GET("/status/:code", s.getStatusCode)
+	load.GET("/fibonacci/hex/:f/:h", s.getFibonacciHex)
+	load.GET("/primes/hex/:p/:h", s.getPrimesHex)
+	load.GET("/fibonacci/hex/memory/:f/:h/:m", s.fibonacciHexMemory)
+	load.GET("/primes/hex/memory/:p/:h/:m", s.primesHexMemory)
+	load.GET("/load", s.getLoad)
+	load.POST("/batch", s.postBatch)
+	load.POST("/warmup", s.postWarmup)
+	load.GET("/ws", s.getWebSocket)
+	load.GET("/fetch", s.getFetch)
+	load.POST("/echo", s.postEcho)
+
+	if s.gcEndpoint {
+		router.POST("/gc", s.postGC)
+	}
+	if s.pprofEndpoints {
+		router.GET("/debug/pprof/*profile", getPprof)
+		router.POST("/debug/pprof/*profile", getPprof)
+	}
+	if s.expvars != nil {
+		router.GET("/debug/vars", s.expvars.getVars)
+	}
+	if s.adminEndpoints {
+		router.GET("/config", s.getConfig)
+		router.POST("/admin/maxprocs/:n", s.postMaxProcs)
+		router.POST("/admin/gogc/:pct", s.postGCPercent)
+		router.POST("/admin/ballast/release", s.postReleaseBallast)
+		if s.triggerShutdown != nil {
+			router.POST("/admin/shutdown", s.postShutdown)
+		}
+	}
+	if s.diskEndpoints {
+		load.GET("/disk/write/:kb", s.getDiskWrite)
+		if s.diskReadFile != nil {
+			load.GET("/disk/read/:kb", s.getDiskRead)
+		}
+	}
+	s.routes = router.Routes()
+
+	// HEAD is added after s.routes is captured, so the OpenAPI document lists only the GETs
+	for _, route := range s.routes {
+		if route.Method != http.MethodGet || operationalRoutes[route.Path] || route.Path == "/ws" {
+			continue
+		}
+		if route.Path == "/status/:code" {
+			// Already free to compute, and its status is the point of the probe
+			router.HEAD(route.Path, s.getStatusCode)
+			continue
+		}
+		router.HEAD(route.Path, headLoadRoute(headContentTypes[route.Path]))
+	}
+}
+
+// loadRoutes registers load routes on router, skipping those whose endpointName is not in
+// enabled (APEX_ENABLED_ENDPOINTS). A nil enabled set registers everything. Skipped routes are
+// never added, so they 404 like any unknown path and are left out of /openapi.json.
+type loadRoutes struct {
+	router  *gin.Engine
+	enabled map[string]bool
+}
+
+// GET registers a GET load route unless its endpoint is disabled
+func (r loadRoutes) GET(path string, handler gin.HandlerFunc) {
+	if r.enabled == nil || r.enabled[endpointName(path)] {
+		r.router.GET(path, handler)
+	}
+}
+
+// POST registers a POST load route unless its endpoint is disabled
+func (r loadRoutes) POST(path string, handler gin.HandlerFunc) {
+	if r.enabled == nil || r.enabled[endpointName(path)] {
+		r.router.POST(path, handler)
+	}
+}
+
+// endpointName is the name APEX_ENABLED_ENDPOINTS uses for a route: its first path segment, so
+// "primes" covers /primes/:p, /primes/nth/:n, /primes/hex/:p/:h, and every other /primes route
+func endpointName(path string) string {
+	name, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	return name
+}
+
+// loadEndpointNames returns the endpoint names of every documented load route in sorted order
+func loadEndpointNames() []string {
+	seen := make(map[string]bool)
+	for key := range openAPIRoutes {
+		_, path, _ := strings.Cut(key, " ")
+		if !operationalRoutes[path] {
+			seen[endpointName(path)] = true
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseEnabledEndpoints splits a comma-separated APEX_ENABLED_ENDPOINTS into a set of endpoint
+// names. An empty list returns nil, which enables every endpoint. Unknown names are an error, so a
+// typo can't quietly leave the wrong endpoints exposed.
+func parseEnabledEndpoints(raw string) (map[string]bool, error) {
+	known := loadEndpointNames()
+	var enabled map[string]bool
+	for _, entry := range strings.Split(raw, ",") {
+		name := strings.ToLower(strings.TrimSpace(entry))
+		if name == "" {
+			continue
+		}
+		if _, found := slices.BinarySearch(known, name); !found {
+			return nil, fmt.Errorf("unknown endpoint %q (known: %s)", name, strings.Join(known, ", "))
+		}
+		if enabled == nil {
+			enabled = make(map[string]bool)
+		}
+		enabled[name] = true
+	}
+	return enabled, nil
+}
+
+// headContentTypes are the Content-Types of load routes whose GET doesn't answer with the
+// negotiated JSON or plain text envelope
+var headContentTypes = map[string]string{
+	"/hex/stream/:h": "text/plain; charset=utf-8",
+	"/drip":          "text/plain; charset=utf-8",
+	"/primes/sse/:n": "text/event-stream",
+}
+
+// headLoadRoute answers HEAD on a load route with the status and Content-Type its GET would send
+// (contentType, or the negotiated JSON or plain text type when empty) without doing any work, so
+// uptime checks can probe it for free. Parameters aren't validated and there's no Content-Length,
+// since both would take running the GET.
+func headLoadRoute(contentType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := contentType
+		if header == "" {
+			header = "application/json; charset=utf-8"
+			if c.NegotiateFormat(gin.MIMEJSON, gin.MIMEPlain) == gin.MIMEPlain {
+				header = "text/plain; charset=utf-8"
+			}
+		}
+		c.Header("Content-Type", header)
+		c.Status(http.StatusOK)
+	}
+}
+
+func main() {
+	// Route the standard logger (startup, warnings, shutdown) through the structured handler too
+	logger := loggerFromEnv(os.Stdout)
+	slog.SetDefault(logger)
+
+	configFlag := flag.String("config", "", "YAML config file with defaults for port, limits, auth, rate limits, and features; env vars and flags override it (a missing file is ignored)")
+	flag.Int("port", HTTPPort, "port to serve plain HTTP on (env APEX_PORT)")
+	flag.String("seed", "", "seed for reproducible range selection and data generation (default: time-based; env APEX_RAND_SEED)")
+	flag.Int("tls-port", 0, "serve HTTPS on this port alongside plain HTTP (default: with APEX_TLS_CERT and APEX_TLS_KEY set, HTTPS replaces plain HTTP)")
+	maxprocsFlag := flag.String("maxprocs", "", "OS threads executing Go code simultaneously, 1-1024 (default: the runtime's choice, which honors the GOMAXPROCS env var)")
+	flag.Parse()
+
+	config, err := loadConfig(*configFlag)
+	if err != nil {
+		log.Fatalf("invalid config file: %v", err)
+	}
+	if *configFlag != "" {
+		if _, statErr := os.Stat(*configFlag); statErr != nil {
+			log.Printf("config file %s not found, using defaults", *configFlag)
+		} else {
+			log.Printf("loaded config file %s", *configFlag)
+		}
+	}
+	config.applyEnv()
+	config.applyFlags(flag.CommandLine)
+	if *maxprocsFlag != "" {
+		n, err := parseMaxProcs(*maxprocsFlag)
+		if err != nil {
+			log.Fatalf("invalid -maxprocs %q: %v", *maxprocsFlag, err)
+		}
+		runtime.GOMAXPROCS(n)
+	}
+	log.Printf("GOMAXPROCS: %d (NumCPU: %d)", runtime.GOMAXPROCS(0), runtime.NumCPU())
+	if raw := os.Getenv("APEX_GOGC"); raw != "" {
+		pct, err := parseGCPercent(raw)
+		if err != nil {
+			log.Fatalf("invalid APEX_GOGC %q: %v", raw, err)
+		}
+		debug.SetGCPercent(pct)
+		log.Printf("GOGC: %d", pct)
+	}
+	if seed, ok := parseSeed(config.Seed); ok {
+		loadRand.Seed(seed)
+		log.Printf("random seed: %d (reproducible)", seed)
+	}
+
+	tlsSettings, err := resolveTLSConfig(os.Getenv("APEX_TLS_CERT"), os.Getenv("APEX_TLS_KEY"), config.TLSPort, config.Port)
+	if err != nil {
+		log.Fatalf("invalid TLS configuration: %v", err)
+	}
+
+	server := newAPIServer(config.Limits)
+	server.setConfig(config)
+	server.metricsDisabled = config.Features.DisableMetrics
+	server.gcEndpoint = config.Features.GCEndpoint
+	server.pprofEndpoints = config.Features.Pprof
+	if fraction := envPositiveFloat("APEX_MEMORY_AVAILABLE_FRACTION", DefaultMemoryAvailableFraction); fraction > 1 {
+		log.Printf("warning: ignoring APEX_MEMORY_AVAILABLE_FRACTION=%g above 1, using default %g", fraction, DefaultMemoryAvailableFraction)
+	} else {
+		memoryGuard.fraction = fraction
+	}
+	if config.Features.Expvar {
+		server.expvars = newExpvarMetrics(server.holds)
+	}
+	server.diskEndpoints = config.Features.Disk
+	server.adminEndpoints = config.Features.Admin
+	server.tmpDir = os.Getenv("APEX_TMP_DIR")
+	server.fetchAllowlist = parseFetchAllowlist(os.Getenv("APEX_FETCH_ALLOWLIST"))
+	server.authToken = config.AuthToken
+	server.corsOrigins = parseCORSOrigins(os.Getenv("APEX_CORS_ORIGINS"))
+	if server.enabledRoutes, err = parseEnabledEndpoints(os.Getenv("APEX_ENABLED_ENDPOINTS")); err != nil {
+		log.Fatalf("invalid APEX_ENABLED_ENDPOINTS: %v", err)
+	} else if server.enabledRoutes != nil {
+		log.Printf("enabled endpoints: %s", os.Getenv("APEX_ENABLED_ENDPOINTS"))
+	}
+	if raw := os.Getenv("APEX_STATS_HISTOGRAM_BUCKETS"); raw != "" {
+		if buckets, err := parseHistogramBuckets(raw); err != nil {
+			log.Printf("warning: ignoring invalid APEX_STATS_HISTOGRAM_BUCKETS=%q: %v", raw, err)
+		} else {
+			server.stats.bucketsMs = buckets
+		}
+	}
+	if raw := os.Getenv("APEX_DELAY"); raw != "" {
+		if _, err := parseDurationRange(raw, server.limits().Delay, server.faultRand); err != nil {
+			log.Printf("warning: ignoring invalid APEX_DELAY=%q: %v", raw, err)
+		} else {
+			server.delay = raw
+			log.Printf("latency injection: delaying load requests by %s", raw)
+		}
+	}
+	if raw := os.Getenv("APEX_BALLAST_MB"); raw != "" {
+		mb, err := parseBallastMB(raw)
+		if err != nil {
+			log.Fatalf("invalid APEX_BALLAST_MB %q: %v", raw, err)
+		}
+		if mb > 0 {
+			server.setBallast(mb)
+			log.Printf("GC ballast: holding %d MB", mb)
+		}
+	}
+	if addr := os.Getenv("APEX_STATSD_ADDR"); addr != "" {
+		if client, err := newStatsdClient(addr); err != nil {
+			log.Printf("warning: ignoring invalid APEX_STATSD_ADDR=%q: %v", addr, err)
+		} else {
+			server.statsd = client
+			defer client.close()
+			log.Printf("statsd: sending request metrics to %s", addr)
+		}
+	}
+	tracerProvider, err := newTracerProvider(context.Background())
+	if err != nil {
+		log.Printf("warning: tracing disabled: %v", err)
+	} else if tracerProvider != nil {
+		otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+			logger.Warn("otlp export failed", "error", err)
+		}))
+		server.tracer = tracerProvider.Tracer(tracerName)
+		log.Printf("tracing: exporting spans over OTLP")
+	}
+	if config.ErrorRate > 0 {
+		log.Printf("fault injection: failing %g of load requests with status %d", config.ErrorRate, config.ErrorStatus)
+	}
+	if server.authToken != "" {
+		log.Printf("bearer-token auth enabled for all routes except /healthz and /readyz")
+	}
+	if limiter := server.rateLimiter.Load(); limiter != nil {
+		log.Printf("rate limit: %g requests per second per endpoint (burst %d)", limiter.rps, limiter.burst)
+	}
+	if maxConcurrency := config.MaxConcurrency; maxConcurrency > 0 {
+		server.loadSlots = make(chan struct{}, maxConcurrency)
+		server.queueTimeout = config.ConcurrencyQueueTimeout
+		log.Printf("concurrency limit: %d load requests (queue timeout %s)", maxConcurrency, server.queueTimeout)
+	}
+	if server.diskEndpoints {
+		fileKB := envPositiveInt("APEX_DISK_READ_FILE_KB", DefaultDiskReadFileKB)
+		readFile, err := newDiskReadFile(server.tmpDir, fileKB)
+		if err != nil {
+			log.Fatalf("failed to create disk read file: %v", err)
+		}
+		server.diskReadFile = readFile
+		log.Printf("disk endpoints enabled: %d KB read file %s", fileKB, readFile.file.Name())
+	}
+	server.compactJSON = !envBool("APEX_PRETTY_JSON", true)
+	server.logger = logger
+	// POST /admin/shutdown hands its reason to the same shutdown path as the signals below
+	shutdownRequests := make(chan string, 1)
+	server.triggerShutdown = func(reason string) {
+		select {
+		case shutdownRequests <- reason:
+		default:
+		}
+	}
+	router := gin.New()
+	router.Use(gin.Recovery())
+	server.registerRoutes(router)
+
+	srv := &http.Server{
+		Addr:    fmt.Sprintf(":%d", config.Port),
+		Handler: router,
+	}
+	servers := []*http.Server{srv}
+	if tlsSettings != nil {
+		// Load the pair now so a bad certificate fails startup rather than every handshake
+		certificate, err := tls.LoadX509KeyPair(tlsSettings.certFile, tlsSettings.keyFile)
+		if err != nil {
+			log.Fatalf("failed to load TLS certificate: %v", err)
+		}
+		tlsServer := srv
+		if tlsSettings.port != 0 {
+			tlsServer = &http.Server{Addr: fmt.Sprintf(":%d", tlsSettings.port), Handler: router}
+			servers = append(servers, tlsServer)
+		}
+		tlsServer.TLSConfig = &tls.Config{Certificates: []tls.Certificate{certificate}}
+	}
+
+	// Bind before serving so a failed bind exits before readiness is ever reported
+	listeners := make([]net.Listener, len(servers))
+	for i, httpServer := range servers {
+		listener, err := net.Listen("tcp", httpServer.Addr)
+		if err != nil {
+			log.Fatalf("failed to listen on %s: %v", httpServer.Addr, err)
+		}
+		listeners[i] = listener
+	}
+
+	for i, httpServer := range servers {
+		scheme := "http"
+		if httpServer.TLSConfig != nil {
+			scheme = "https"
+		}
+		log.Printf("serving %s on %s", scheme, httpServer.Addr)
+		go func(httpServer *http.Server, listener net.Listener) {
+			if err := serve(httpServer, listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("server failed: %v", err)
+			}
+		}(httpServer, listeners[i])
+	}
+
+	janitorCtx, stopJanitor := context.WithCancel(context.Background())
+	defer stopJanitor()
+	go server.holds.run(janitorCtx, time.Second)
+
+	// All startup work is done; let readiness probes route traffic here
+	server.ready.Store(true)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := server.reloadConfig(*configFlag, flag.CommandLine); err != nil {
+				log.Printf("config reload failed, keeping the running config: %v", err)
+				continue
+			}
+			log.Printf("config reloaded: limits, rate limit, and error injection updated")
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	var reason string
+	select {
+	case sig := <-quit:
+		reason = "received " + sig.String()
+	case reason = <-shutdownRequests:
+	}
+
+	err = server.shutdown(envDuration("APEX_SHUTDOWN_GRACE", 10*time.Second), reason, servers...)
+	if tracerProvider != nil {
+		// Flush the spans of the drained requests before exiting
+		flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+		if flushErr := tracerProvider.Shutdown(flushCtx); flushErr != nil {
+			log.Printf("failed to flush traces: %v", flushErr)
+		}
+		cancelFlush()
+	}
+	if server.diskReadFile != nil {
+		if closeErr := server.diskReadFile.close(); closeErr != nil {
+			log.Printf("failed to remove disk read file: %v", closeErr)
+		}
+	}
+	if err != nil {
+		os.Exit(1)
+	}
 }
@@ -1,15 +1,48 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"math"
+	"math/rand"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/net/websocket"
+	"google.golang.org/protobuf/proto"
 )
 
 // TestParseIntOrRange tests the abstracted range parsing function
@@ -74,11 +107,56 @@ func TestParseIntOrRange(t *testing.T) {
 		},
 		{
 			name:        "Range with too many parts",
+			param:       "50..100..150..200",
+			maxValue:    1000,
+			paramName:   "test",
+			expectError: true,
+		},
+		{
+			name:        "Stepped range with step larger than span",
 			param:       "50..100..150",
 			maxValue:    1000,
 			paramName:   "test",
 			expectError: true,
 		},
+		{
+			name:        "Stepped range with zero step",
+			param:       "50..500..0",
+			maxValue:    1000,
+			paramName:   "test",
+			expectError: true,
+		},
+		{
+			name:        "Stepped range with negative step",
+			param:       "50..500..-50",
+			maxValue:    1000,
+			paramName:   "test",
+			expectError: true,
+		},
+		{
+			name:        "Stepped range with step not dividing span",
+			param:       "50..500..40",
+			maxValue:    1000,
+			paramName:   "test",
+			expectError: true,
+		},
+		{
+			name:        "Stepped range with invalid step",
+			param:       "50..500..x",
+			maxValue:    1000,
+			paramName:   "test",
+			expectError: true,
+		},
+		{
+			name:        "Valid stepped range",
+			param:       "50..500..50",
+			maxValue:    1000,
+			paramName:   "test",
+			expectError: false,
+			minExpected: 50,
+			maxExpected: 500,
+			expectRange: true,
+		},
 		{
 			name:        "Range with invalid min",
 			param:       "invalid..150",
@@ -138,7 +216,7 @@ func TestParseIntOrRange(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			val, isRange, err := parseIntOrRange(tt.param, tt.maxValue, tt.paramName)
+			val, isRange, err := parseIntOrRange(context.Background(), tt.param, tt.maxValue, tt.paramName)
 
 			if tt.expectError {
 				if err == nil {
@@ -169,6 +247,511 @@ func TestParseIntOrRange(t *testing.T) {
 	}
 }
 
+// TestParseSizeKBOrRange tests KB/MB/GB suffixes on single values, ranges, and lists
+func TestParseSizeKBOrRange(t *testing.T) {
+	tests := []struct {
+		param       string
+		expectError bool
+		minExpected int
+		maxExpected int
+		expectRange bool
+	}{
+		{"512", false, 512, 512, false},
+		{"512KB", false, 512, 512, false},
+		{"10MB", false, 10240, 10240, false},
+		{"2GB", false, 2097152, 2097152, false},
+		{"1gb", false, 1048576, 1048576, false},
+		{"3 MB", false, 3072, 3072, false},
+		{"100MB..1GB", false, 102400, 1048576, true},
+		{"512KB..1024", false, 512, 1024, true},
+		{"1MB,2MB", false, 1024, 2048, true},
+		{"3GB", true, 0, 0, false},
+		{"1.5GB", true, 0, 0, false},
+		{"MB", true, 0, 0, false},
+		{"-1MB", true, 0, 0, false},
+		{"10TB", true, 0, 0, false},
+		{"99999999999999999GB", true, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.param, func(t *testing.T) {
+			val, isRange, err := parseSizeKBOrRange(context.Background(), tt.param, 2*1024*1024, "test")
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error but got %d", val)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			// The documented pattern should accept every valid value written without spaces
+			if !strings.Contains(tt.param, " ") && !regexp.MustCompile(sizePattern).MatchString(tt.param) {
+				t.Errorf("sizePattern does not match %q", tt.param)
+			}
+			if isRange != tt.expectRange {
+				t.Errorf("Expected isRange=%v, got %v", tt.expectRange, isRange)
+			}
+			if val < tt.minExpected || val > tt.maxExpected {
+				t.Errorf("Expected value between %d-%d, got %d", tt.minExpected, tt.maxExpected, val)
+			}
+		})
+	}
+}
+
+// TestSizeSuffixEndpoints tests that /memory and /hex accept size suffixes and still enforce their caps
+func TestSizeSuffixEndpoints(t *testing.T) {
+	router := setupRouter()
+
+	tests := []struct {
+		url            string
+		expectedStatus int
+		expectedKB     int
+	}{
+		{"/memory/2MB", http.StatusOK, 2048},
+		{"/hex/1MB", http.StatusOK, 1024},
+		{"/memory/2GB", http.StatusBadRequest, 0},
+		{"/hex/10MB", http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			var response map[string]map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if response["data"]["size_kb"] != float64(tt.expectedKB) {
+				t.Errorf("Expected size_kb %d, got %v", tt.expectedKB, response["data"]["size_kb"])
+			}
+		})
+	}
+}
+
+// TestParseSteppedRange tests that stepped ranges only pick values on the step grid
+func TestParseSteppedRange(t *testing.T) {
+	seen := make(map[int]bool)
+	for i := 0; i < 1000; i++ {
+		val, isRange, err := parseIntOrRange(context.Background(), "50..500..50", 1000, "test")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !isRange {
+			t.Fatal("Expected stepped range to be reported as a range")
+		}
+		if val < 50 || val > 500 || val%50 != 0 {
+			t.Fatalf("Expected a multiple of 50 within 50-500, got %d", val)
+		}
+		seen[val] = true
+	}
+	if len(seen) != 10 {
+		t.Errorf("Expected all 10 step values to be chosen over 1000 draws, got %d", len(seen))
+	}
+
+	// Step equal to the span leaves just the two endpoints
+	for i := 0; i < 100; i++ {
+		val, _, err := parseIntOrRange(context.Background(), "0..10..10", 1000, "test")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if val != 0 && val != 10 {
+			t.Fatalf("Expected 0 or 10, got %d", val)
+		}
+	}
+}
+
+// TestParseValueList tests that comma-separated lists pick one of the listed values
+func TestParseValueList(t *testing.T) {
+	tests := []struct {
+		name   string
+		param  string
+		values []int
+	}{
+		{"Two items", "100,500", []int{100, 500}},
+		{"Three items", "100, 500, 1000", []int{100, 500, 1000}},
+		{"Duplicates", "7,7", []int{7}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen := make(map[int]bool)
+			for i := 0; i < 200; i++ {
+				val, isRange, err := parseIntOrRange(context.Background(), tt.param, 1000, "test")
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if !isRange {
+					t.Fatal("Expected a list to be reported as a range")
+				}
+				seen[val] = true
+			}
+			for val := range seen {
+				found := false
+				for _, allowed := range tt.values {
+					found = found || val == allowed
+				}
+				if !found {
+					t.Errorf("Got %d, which is not in the list %v", val, tt.values)
+				}
+			}
+			if len(seen) != len(tt.values) {
+				t.Errorf("Expected all %d values to be chosen over 200 draws, got %v", len(tt.values), seen)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"100,abc", "100,2000", "100,-5", "100,", ",100", "100..200,300"} {
+		if _, _, err := parseIntOrRange(context.Background(), invalid, 1000, "test"); err == nil {
+			t.Errorf("Expected error for list %q", invalid)
+		}
+	}
+}
+
+// TestGetPrimesValueList tests that list specs are echoed in requested_range
+func TestGetPrimesValueList(t *testing.T) {
+	router := setupRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/primes/10,20,30", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+	data := response["data"].(map[string]interface{})
+	if data["requested_range"] != "10,20,30" {
+		t.Errorf("Expected requested_range '10,20,30', got %v", data["requested_range"])
+	}
+	if count := data["count"].(float64); count != 10 && count != 20 && count != 30 {
+		t.Errorf("Expected count from the list, got %v", count)
+	}
+}
+
+// TestRangeDistributions tests that over many draws the mean and spread match each ?dist= shape
+func TestRangeDistributions(t *testing.T) {
+	const samples = 20000
+	expMean := 1000 * (1/ExpDistRate - 1/(math.Exp(ExpDistRate)-1))
+	tests := []struct {
+		dist           rangeDist
+		mean           float64
+		minStd, maxStd float64
+	}{
+		{DistUniform, 500, 270, 310},
+		{DistExponential, expMean, 150, 250},
+		{DistNormal, 500, 150, 185},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.dist), func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), rangeDistKey{}, tt.dist)
+			var sum, sumSquares float64
+			for i := 0; i < samples; i++ {
+				val, _, err := parseIntOrRange(ctx, "0..1000", 1000, "test")
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if val < 0 || val > 1000 {
+					t.Fatalf("Value %d outside the range", val)
+				}
+				sum += float64(val)
+				sumSquares += float64(val) * float64(val)
+			}
+			mean := sum / samples
+			std := math.Sqrt(sumSquares/samples - mean*mean)
+			if math.Abs(mean-tt.mean) > 15 {
+				t.Errorf("Expected mean near %.0f, got %.1f", tt.mean, mean)
+			}
+			if std < tt.minStd || std > tt.maxStd {
+				t.Errorf("Expected standard deviation in %.0f-%.0f, got %.1f", tt.minStd, tt.maxStd, std)
+			}
+		})
+	}
+
+	t.Run("Stepped range stays on the steps", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), rangeDistKey{}, DistExponential)
+		for i := 0; i < 1000; i++ {
+			val, _, err := parseIntOrRange(ctx, "100..1000..100", 1000, "test")
+			if err != nil || val%100 != 0 || val < 100 || val > 1000 {
+				t.Fatalf("Expected a multiple of 100 in 100-1000, got %d (%v)", val, err)
+			}
+		}
+	})
+
+	for _, raw := range []string{"Uniform", "poisson", ""} {
+		if _, err := parseRangeDist(raw); err == nil {
+			t.Errorf("Expected an error for dist %q", raw)
+		}
+	}
+}
+
+// TestDistParam tests that ?dist= is accepted on load routes and rejected when unknown
+func TestDistParam(t *testing.T) {
+	router := setupRouter()
+
+	for _, path := range []string{"/primes/10..20?dist=exp", "/hex/1..4?dist=normal", "/primes/10?dist=uniform"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status 200 for %s, got %d", path, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/primes/10..20?dist=zipf", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 for an unknown dist, got %d", w.Code)
+	}
+	var response ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse error response: %v", err)
+	}
+	if response.Error.Param != "dist" || response.Error.Code != CodeUnsupportedValue {
+		t.Errorf("Expected an unsupported_value error for dist, got %+v", response.Error)
+	}
+}
+
+// TestParseIntOrRangeClamp tests that ?clamp=1 caps values and ranges above the limit
+func TestParseIntOrRangeClamp(t *testing.T) {
+	tests := []struct {
+		param    string
+		min, max int
+		clamped  bool
+	}{
+		{"50", 50, 50, false},
+		{"150", 100, 100, true},
+		{"90..150", 90, 100, true},
+		{"200..300", 100, 100, true},
+		{"0..150..25", 0, 100, true},
+		{"10..160..50", 10, 60, true},
+		{"120,5", 5, 100, true},
+		{"10..20", 10, 20, false},
+	}
+	for _, tt := range tests {
+		clamp := &rangeClamp{}
+		ctx := context.WithValue(context.Background(), rangeClampKey{}, clamp)
+		for range 50 {
+			value, _, err := parseIntOrRange(ctx, tt.param, 100, "test")
+			if err != nil {
+				t.Fatalf("%q: unexpected error: %v", tt.param, err)
+			}
+			if value < tt.min || value > tt.max {
+				t.Fatalf("%q: expected a value in %d..%d, got %d", tt.param, tt.min, tt.max, value)
+			}
+		}
+		if clamp.clamped.Load() != tt.clamped {
+			t.Errorf("%q: expected clamped %t", tt.param, tt.clamped)
+		}
+		if _, _, err := parseIntOrRange(context.Background(), tt.param, 100, "test"); (err != nil) != tt.clamped {
+			t.Errorf("%q: expected an error without clamping only when clamped, got %v", tt.param, err)
+		}
+	}
+
+	// Stepped ranges clamp to the last step within the limit
+	ctx := context.WithValue(context.Background(), rangeClampKey{}, &rangeClamp{})
+	for range 50 {
+		if value, _, _ := parseIntOrRange(ctx, "10..160..50", 100, "test"); value != 10 && value != 60 {
+			t.Fatalf("Expected 10 or 60 from a clamped 10..160..50, got %d", value)
+		}
+	}
+
+	for _, param := range []string{"-5", "abc", "20..10", "0..150..7"} {
+		if _, _, err := parseIntOrRange(ctx, param, 100, "test"); err == nil {
+			t.Errorf("%q: expected an error even with clamping", param)
+		}
+	}
+}
+
+// TestClampParam tests ?clamp=1 end to end, including the clamped note in the response
+func TestClampParam(t *testing.T) {
+	router := setupRouter()
+
+	tests := []struct {
+		path    string
+		clamped bool
+	}{
+		{"/primes/20000?clamp=1", true},
+		{"/primes/9000..10001?clamp=1", true},
+		{"/primes/100?clamp=1", false},
+		{"/primes/hex/20000/5?clamp=true", true},
+		{"/load?hash=10&collatz=99999999&clamp=1", true},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", tt.path, w.Code, w.Body.String())
+		}
+		var response struct {
+			Data    map[string]interface{} `json:"data"`
+			Clamped bool                   `json:"clamped"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s: failed to parse response: %v", tt.path, err)
+		}
+		if response.Clamped != tt.clamped {
+			t.Errorf("%s: expected clamped %t, got %s", tt.path, tt.clamped, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/primes/20000?clamp=1", nil))
+	if result := decodeStrict[Response[PrimeResult]](t, w.Body.Bytes()).Data; result.Count != MaxPrimes {
+		t.Errorf("Expected /primes/20000 to be clamped to %d primes, got %d", MaxPrimes, result.Count)
+	}
+
+	for _, path := range []string{"/primes/20000", "/primes/20000?clamp=0", "/primes/10?clamp=maybe"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", path, w.Code)
+		}
+	}
+}
+
+// TestPinParam tests that ?pin=1 requests on the CPU and prime endpoints complete normally and that
+// invalid values, and pinning /primes with parallel workers, are rejected. Whether the thread was actually locked is not observable here.
+func TestPinParam(t *testing.T) {
+	router := setupRouter()
+
+	for _, path := range []string{"/primes/100?pin=1", "/primes/upto/1000?pin=true", "/primes/nth/100?pin=1",
+		"/primes/gaps/100?pin=1", "/cpu/5ms?pin=1", "/spin/5ms?pin=1", "/primes/100?pin=0", "/primes/100?pin=1&parallel=1",
+		"/primes/100?pin=0&parallel=2"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: expected status 200, got %d: %s", path, w.Code, w.Body.String())
+		}
+	}
+
+	rejected := []string{"/cpu/5ms?pin=maybe"}
+	if runtime.GOMAXPROCS(0) > 1 {
+		// parallel is capped at GOMAXPROCS, so with one P it stays on the pinned goroutine and is allowed
+		rejected = append(rejected, "/primes/100?pin=1&parallel=2")
+	}
+	for _, path := range rejected {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusBadRequest || decodeStrict[ErrorResponse](t, w.Body.Bytes()).Error.Code != CodeInvalidParameter {
+			t.Errorf("%s: expected status 400 with %s, got %d: %s", path, CodeInvalidParameter, w.Code, w.Body.String())
+		}
+	}
+}
+
+// TestLoadRandSeed tests that seeding the load source makes range selection and hex output reproducible
+func TestLoadRandSeed(t *testing.T) {
+	defer loadRand.unseed()
+
+	run := func() ([]int, string) {
+		loadRand.Seed(42)
+		values := make([]int, 20)
+		for i := range values {
+			values[i], _, _ = parseIntOrRange(context.Background(), "0..1000000", 1000000, "test")
+		}
+		hex, _ := createHexString(context.Background(), "1", MaxHexKB)
+		return values, hex.HexString
+	}
+
+	firstValues, firstHex := run()
+	secondValues, secondHex := run()
+
+	for i := range firstValues {
+		if firstValues[i] != secondValues[i] {
+			t.Fatalf("Expected identical range selections with the same seed, got %v and %v", firstValues, secondValues)
+		}
+	}
+	if firstHex != secondHex {
+		t.Error("Expected identical hex output with the same seed")
+	}
+}
+
+// TestParseSeed tests parsing of the -seed flag / APEX_RAND_SEED value
+func TestParseSeed(t *testing.T) {
+	if seed, ok := parseSeed("12345"); !ok || seed != 12345 {
+		t.Errorf("Expected seed 12345, got %d (%v)", seed, ok)
+	}
+	if seed, ok := parseSeed(" -7 "); !ok || seed != -7 {
+		t.Errorf("Expected seed -7, got %d (%v)", seed, ok)
+	}
+	for _, value := range []string{"", "not-a-seed"} {
+		if _, ok := parseSeed(value); ok {
+			t.Errorf("Expected %q to keep random seeding", value)
+		}
+	}
+}
+
+// TestConcurrentLoadRand hammers hex generation and range parsing from many goroutines in both
+// pooled and seeded modes; run with -race to check the sources are never shared unsafely
+func TestConcurrentLoadRand(t *testing.T) {
+	defer loadRand.unseed()
+
+	for _, seeded := range []bool{false, true} {
+		t.Run(fmt.Sprintf("seeded=%v", seeded), func(t *testing.T) {
+			if seeded {
+				loadRand.Seed(7)
+			} else {
+				loadRand.unseed()
+			}
+
+			var wg sync.WaitGroup
+			for g := 0; g < 50; g++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < 20; i++ {
+						result, err := createHexString(context.Background(), "1..4", MaxHexKB)
+						if err != nil || result.Length != result.SizeKB*1024 {
+							t.Errorf("Unexpected hex result %d bytes for %d KB (%v)", result.Length, result.SizeKB, err)
+							return
+						}
+						if _, _, err := parseIntOrRange(context.Background(), "0..1000..10", 1000, "test"); err != nil {
+							t.Errorf("Unexpected range error: %v", err)
+							return
+						}
+					}
+				}()
+			}
+			wg.Wait()
+		})
+	}
+}
+
+// TestAllocateMemoryRSS tests that memory results report RSS on Linux and zero elsewhere
+func TestAllocateMemoryRSS(t *testing.T) {
+	result, err := allocateMemory(context.Background(), "10240", MaxMemoryKB)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if runtime.GOOS != "linux" {
+		if result.RSSBytes != 0 || result.RSSDeltaBytes != 0 {
+			t.Errorf("Expected zero RSS fields off Linux, got %d and %d", result.RSSBytes, result.RSSDeltaBytes)
+		}
+		return
+	}
+	if result.RSSBytes <= 0 {
+		t.Errorf("Expected a positive RSS on Linux, got %d", result.RSSBytes)
+	}
+	// Touching 10 MB of fresh pages should move RSS by most of that, GC permitting
+	if result.RSSDeltaBytes <= 0 {
+		t.Logf("RSS did not grow across the allocation (delta %d); a GC may have run", result.RSSDeltaBytes)
+	}
+}
+
 // TestAllocateMemory tests memory allocation function
 func TestAllocateMemory(t *testing.T) {
 	tests := []struct {
@@ -208,7 +791,7 @@ func TestAllocateMemory(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := allocateMemory(tt.param)
+			result, err := allocateMemory(context.Background(), tt.param, MaxMemoryKB)
 
 			if tt.expectError {
 				if err == nil {
@@ -299,7 +882,7 @@ func TestFibonacci(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := fibonacci(tt.param)
+			result, err := fibonacci(context.Background(), tt.param, MaxFibonacci, false)
 
 			if tt.expectError {
 				if err == nil {
@@ -395,7 +978,7 @@ func TestGeneratePrimes(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := generatePrimes(tt.param)
+			result, err := generatePrimes(context.Background(), tt.param, MaxPrimes)
 
 			if tt.expectError {
 				if err == nil {
@@ -438,24 +1021,479 @@ func TestGeneratePrimes(t *testing.T) {
 	}
 }
 
-// TestCreateHexString tests hex string generation function
-func TestCreateHexString(t *testing.T) {
-	tests := []struct {
-		name         string
-		param        string
-		expectError  bool
-		expectedSize int
-	}{
-		{
-			name:         "Generate 1KB hex",
-			param:        "1",
-			expectError:  false,
-			expectedSize: 1,
-		},
-		{
-			name:         "Generate 0KB hex",
-			param:        "0",
-			expectError:  false,
+// TestGeneratePrimesParallel tests that parallel generation matches serial generation
+func TestGeneratePrimesParallel(t *testing.T) {
+	counts := []string{"0", "1", "2", "5", "6", "100", "1000", "10000"}
+	workerCounts := []int{2, 3, 4, 8}
+
+	for _, count := range counts {
+		serial, err := generatePrimes(context.Background(), count, MaxPrimes)
+		if err != nil {
+			t.Fatalf("Unexpected serial error for %s: %v", count, err)
+		}
+
+		for _, workers := range workerCounts {
+			t.Run(fmt.Sprintf("n=%s/workers=%d", count, workers), func(t *testing.T) {
+				parallel, err := generatePrimesParallel(context.Background(), count, MaxPrimes, workers)
+				if err != nil {
+					t.Fatalf("Unexpected parallel error: %v", err)
+				}
+				if parallel.Count != serial.Count {
+					t.Errorf("Expected count %d, got %d", serial.Count, parallel.Count)
+				}
+				if parallel.LastPrime != serial.LastPrime {
+					t.Errorf("Expected last prime %d, got %d", serial.LastPrime, parallel.LastPrime)
+				}
+				if parallel.Workers != workers {
+					t.Errorf("Expected %d workers, got %d", workers, parallel.Workers)
+				}
+			})
+		}
+	}
+
+	if _, err := generatePrimesParallel(context.Background(), "20000", MaxPrimes, 4); err == nil {
+		t.Error("Expected error for count over the limit")
+	}
+}
+
+// TestPrimeAlgorithms tests that every ?algo= finds the same count and last prime
+func TestPrimeAlgorithms(t *testing.T) {
+	expectedLast := map[int]int{1: 2, 2: 3, 5: 11, 6: 13, 100: 541, 1000: 7919, 10000: 104729}
+	for n, last := range expectedLast {
+		for _, algo := range primeAlgorithmNames() {
+			count, lastPrime, err := primeAlgorithms[algo](context.Background(), n)
+			if err != nil {
+				t.Fatalf("%s(%d) failed: %v", algo, n, err)
+			}
+			if count != n || lastPrime != last {
+				t.Errorf("%s(%d): expected count %d and last prime %d, got %d and %d", algo, n, n, last, count, lastPrime)
+			}
+		}
+	}
+}
+
+// TestIsPrimeMillerRabin tests primes, composites, and strong pseudoprimes to small bases
+func TestIsPrimeMillerRabin(t *testing.T) {
+	tests := []struct {
+		n     uint64
+		prime bool
+	}{
+		{0, false}, {1, false}, {2, true}, {3, true}, {4, false}, {37, true}, {41, true},
+		{561, false},                 // Carmichael number
+		{3215031751, false},          // strong pseudoprime to bases 2, 3, 5, and 7
+		{2147483647, true},           // 2^31 - 1
+		{2305843009213693951, true},  // 2^61 - 1
+		{18446744073709551557, true}, // largest uint64 prime
+		{18446744073709551615, false},
+	}
+	for _, tt := range tests {
+		if got := isPrimeMillerRabin(tt.n); got != tt.prime {
+			t.Errorf("isPrimeMillerRabin(%d) = %v, expected %v", tt.n, got, tt.prime)
+		}
+	}
+}
+
+// TestGetPrimesAlgo tests ?algo= on /primes and its conflicts with parallel and cache
+func TestGetPrimesAlgo(t *testing.T) {
+	router := setupRouter()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, algo := range primeAlgorithmNames() {
+		w := get("/primes/100?algo=" + algo)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 for algo %s, got %d", algo, w.Code)
+		}
+		var response Response[PrimeResult]
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to parse JSON response: %v", err)
+		}
+		if response.Data.Algorithm != algo || response.Data.Count != 100 || response.Data.LastPrime != 541 {
+			t.Errorf("Expected 100 primes ending at 541 via %s, got %+v", algo, response.Data)
+		}
+	}
+
+	conflicts := []string{"/primes/100?algo=wheel", "/primes/100?algo=sieve&cache=1"}
+	if runtime.GOMAXPROCS(0) > 1 {
+		// parallel is capped at GOMAXPROCS, so with one P it stays serial and is allowed
+		conflicts = append(conflicts, "/primes/100?algo=miller&parallel=2")
+	}
+	for _, path := range conflicts {
+		if w := get(path); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", path, w.Code)
+		}
+	}
+}
+
+// TestNthPrime tests nth prime lookup against known values
+func TestNthPrime(t *testing.T) {
+	tests := []struct {
+		param       string
+		expectError bool
+		prime       int
+	}{
+		{"1", false, 2},
+		{"2", false, 3},
+		{"5", false, 11},
+		{"100", false, 541},
+		{"10000", false, 104729},
+		{"0", true, 0},
+		{"10001", true, 0},
+		{"first", true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.param, func(t *testing.T) {
+			result, err := nthPrime(context.Background(), tt.param, MaxPrimes)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error for %q, got %+v", tt.param, result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result.Prime != tt.prime || strconv.Itoa(result.N) != tt.param {
+				t.Errorf("Expected prime %d for n=%s, got %+v", tt.prime, tt.param, result)
+			}
+		})
+	}
+
+	result, err := nthPrime(context.Background(), "5..6", MaxPrimes)
+	if err != nil || result.RequestedRange != "5..6" || (result.Prime != 11 && result.Prime != 13) {
+		t.Errorf("Expected the 5th or 6th prime for a range, got %+v, %v", result, err)
+	}
+}
+
+// TestPrimeGaps tests the largest prime gap for known counts
+func TestPrimeGaps(t *testing.T) {
+	tests := []struct {
+		param                               string
+		lastPrime, maxGap, gapStart, gapEnd int
+	}{
+		{"2", 3, 1, 2, 3},
+		{"10", 29, 6, 23, 29},
+		{"100", 541, 18, 523, 541},
+		{"1000", 7919, 34, 1327, 1361},
+		{"10000", 104729, 72, 31397, 31469},
+	}
+	for _, tt := range tests {
+		t.Run(tt.param, func(t *testing.T) {
+			result, err := primeGaps(context.Background(), tt.param, MaxPrimes)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result.LastPrime != tt.lastPrime || result.MaxGap != tt.maxGap || result.GapStart != tt.gapStart || result.GapEnd != tt.gapEnd {
+				t.Errorf("Expected last prime %d and gap %d (%d..%d), got %+v", tt.lastPrime, tt.maxGap, tt.gapStart, tt.gapEnd, result)
+			}
+			n, _ := strconv.Atoi(tt.param)
+			if expected := float64(tt.lastPrime-2) / float64(n-1); result.MeanGap != expected {
+				t.Errorf("Expected mean gap %g, got %g", expected, result.MeanGap)
+			}
+			if result.PrimesBytes < n*4 {
+				t.Errorf("Expected at least %d bytes of primes, got %d", n*4, result.PrimesBytes)
+			}
+		})
+	}
+
+	for _, param := range []string{"0", "1", "10001", "abc"} {
+		if _, err := primeGaps(context.Background(), param, MaxPrimes); err == nil {
+			t.Errorf("Expected an error for %q", param)
+		}
+	}
+}
+
+// TestGetPrimeGaps tests the /primes/gaps/:n route, including ranges
+func TestGetPrimeGaps(t *testing.T) {
+	router := setupRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/primes/gaps/100..200", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var response Response[PrimeGapResult]
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+	if response.Data.RequestedRange != "100..200" || response.Data.N < 100 || response.Data.N > 200 || response.Data.MaxGap < 18 {
+		t.Errorf("Unexpected result for 100..200: %+v", response.Data)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/primes/gaps/1", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a single prime, got %d", w.Code)
+	}
+}
+
+// TestSievePrimes tests the bit-packed sieve against known prime counts and trial division
+func TestSievePrimes(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedCount int
+		expectedLast  int
+	}{
+		{"0", 0, 0},
+		{"1", 0, 0},
+		{"2", 1, 2},
+		{"3", 2, 3},
+		{"10", 4, 7},
+		{"100", 25, 97},
+		{"1000000", 78498, 999983},
+	}
+
+	for _, tt := range tests {
+		t.Run("n="+tt.input, func(t *testing.T) {
+			result, err := sievePrimes(context.Background(), tt.input, MaxSieveN)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result.Count != tt.expectedCount {
+				t.Errorf("Expected count %d, got %d", tt.expectedCount, result.Count)
+			}
+			if result.LargestPrime != tt.expectedLast {
+				t.Errorf("Expected largest prime %d, got %d", tt.expectedLast, result.LargestPrime)
+			}
+		})
+	}
+
+	// The sieve up to the nth prime must find exactly n primes, and one less just below it
+	for _, count := range []int{1, 2, 10, 168, 1000, 5000} {
+		serial, err := generatePrimes(context.Background(), strconv.Itoa(count), MaxPrimes)
+		if err != nil {
+			t.Fatalf("Unexpected error generating %d primes: %v", count, err)
+		}
+
+		sieved, _ := sievePrimes(context.Background(), strconv.Itoa(serial.LastPrime), MaxSieveN)
+		if sieved.Count != count || sieved.LargestPrime != serial.LastPrime {
+			t.Errorf("Sieve up to %d: expected %d primes ending at %d, got %d ending at %d",
+				serial.LastPrime, count, serial.LastPrime, sieved.Count, sieved.LargestPrime)
+		}
+
+		below, _ := sievePrimes(context.Background(), strconv.Itoa(serial.LastPrime-1), MaxSieveN)
+		if below.Count != count-1 {
+			t.Errorf("Sieve up to %d: expected %d primes, got %d", serial.LastPrime-1, count-1, below.Count)
+		}
+	}
+
+	if _, err := sievePrimes(context.Background(), "20000000", MaxSieveN); err == nil {
+		t.Error("Expected error for limit over the maximum")
+	}
+}
+
+// TestHashBlock tests repeated block hashing for each algorithm and the range form
+func TestHashBlock(t *testing.T) {
+	t.Run("Default sha256 digest", func(t *testing.T) {
+		result, err := hashBlock(context.Background(), "3", "sha256", MaxHashIterations)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		// Chained sha256 over the 1 KB block, computed independently
+		expected := "8c31c7b9664bcf9a578d7fce41047c72fcac3d168b30ce29c910998145a5b14b"
+		if result.Digest != expected {
+			t.Errorf("Expected digest %s, got %s", expected, result.Digest)
+		}
+		if result.Iterations != 3 || result.BlockBytes != HashBlockSize || result.Algorithm != "sha256" {
+			t.Errorf("Unexpected result fields: %+v", result)
+		}
+		if result.NsPerIteration <= 0 {
+			t.Errorf("Expected positive ns_per_iteration, got %f", result.NsPerIteration)
+		}
+	})
+
+	t.Run("sha512 digest length", func(t *testing.T) {
+		result, err := hashBlock(context.Background(), "10", "sha512", MaxHashIterations)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(result.Digest) != 128 {
+			t.Errorf("Expected 128 hex characters for sha512, got %d", len(result.Digest))
+		}
+	})
+
+	t.Run("Range sets requested_range", func(t *testing.T) {
+		result, err := hashBlock(context.Background(), "10..20", "sha256", MaxHashIterations)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result.RequestedRange != "10..20" {
+			t.Errorf("Expected requested_range 10..20, got %q", result.RequestedRange)
+		}
+		if result.Iterations < 10 || result.Iterations > 20 {
+			t.Errorf("Expected iterations within 10..20, got %d", result.Iterations)
+		}
+	})
+
+	t.Run("Zero iterations", func(t *testing.T) {
+		result, err := hashBlock(context.Background(), "0", "sha256", MaxHashIterations)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result.Digest != "" || result.NsPerIteration != 0 {
+			t.Errorf("Expected empty digest for zero iterations, got %+v", result)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		if _, err := hashBlock(context.Background(), "10", "md5", MaxHashIterations); err == nil {
+			t.Error("Expected error for unsupported algorithm")
+		}
+		if _, err := hashBlock(context.Background(), "200000", "sha256", MaxHashIterations); err == nil {
+			t.Error("Expected error for iterations over the limit")
+		}
+	})
+}
+
+// TestEncryptData tests AES encryption sizes and throughput for each mode
+func TestEncryptData(t *testing.T) {
+	tests := []struct {
+		name               string
+		input              string
+		mode               string
+		expectedPlaintext  int
+		expectedCiphertext int
+	}{
+		// GCM appends a 16-byte authentication tag
+		{"GCM", "64", "gcm", 64 * 1024, 64*1024 + 16},
+		// CBC pads block-aligned input with one full block
+		{"CBC", "64", "cbc", 64 * 1024, 64*1024 + 16},
+		{"Zero size GCM", "0", "gcm", 0, 16},
+		{"Zero size CBC", "0", "cbc", 0, 16},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := encryptData(context.Background(), tt.input, tt.mode, MaxEncryptKB)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result.PlaintextBytes != tt.expectedPlaintext {
+				t.Errorf("Expected %d plaintext bytes, got %d", tt.expectedPlaintext, result.PlaintextBytes)
+			}
+			if result.CiphertextBytes != tt.expectedCiphertext {
+				t.Errorf("Expected %d ciphertext bytes, got %d", tt.expectedCiphertext, result.CiphertextBytes)
+			}
+			if result.Mode != tt.mode {
+				t.Errorf("Expected mode %s, got %s", tt.mode, result.Mode)
+			}
+			if tt.expectedPlaintext > 0 && result.ThroughputMBps <= 0 {
+				t.Errorf("Expected positive throughput, got %f", result.ThroughputMBps)
+			}
+		})
+	}
+
+	t.Run("Range", func(t *testing.T) {
+		result, err := encryptData(context.Background(), "1..4", "gcm", MaxEncryptKB)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result.RequestedRange != "1..4" || result.SizeKB < 1 || result.SizeKB > 4 {
+			t.Errorf("Expected size within 1..4 with requested_range set, got %+v", result)
+		}
+		if result.PlaintextBytes != result.SizeKB*1024 {
+			t.Errorf("Expected %d plaintext bytes, got %d", result.SizeKB*1024, result.PlaintextBytes)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		if _, err := encryptData(context.Background(), "1", "ecb", MaxEncryptKB); err == nil {
+			t.Error("Expected error for unsupported mode")
+		}
+		if _, err := encryptData(context.Background(), "20000", "gcm", MaxEncryptKB); err == nil {
+			t.Error("Expected error for size over the limit")
+		}
+	})
+}
+
+// TestCompressData tests gzip compression at the default and explicit levels
+func TestCompressData(t *testing.T) {
+	levels := []int{gzip.DefaultCompression, gzip.HuffmanOnly, gzip.NoCompression, gzip.BestSpeed, gzip.BestCompression}
+
+	for _, level := range levels {
+		t.Run("level="+strconv.Itoa(level), func(t *testing.T) {
+			result, err := compressData(context.Background(), "64", level, MaxCompressKB)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result.Level != level {
+				t.Errorf("Expected level %d, got %d", level, result.Level)
+			}
+			if result.OriginalBytes != 64*1024 {
+				t.Errorf("Expected %d original bytes, got %d", 64*1024, result.OriginalBytes)
+			}
+			if result.CompressedBytes <= 0 || result.CompressionRatio <= 0 {
+				t.Errorf("Expected populated compressed size and ratio, got %+v", result)
+			}
+			if level != gzip.NoCompression && result.CompressionRatio <= 1 {
+				t.Errorf("Expected semi-compressible data to shrink, got ratio %f", result.CompressionRatio)
+			}
+		})
+	}
+
+	if _, err := compressData(context.Background(), "20000", gzip.DefaultCompression, MaxCompressKB); err == nil {
+		t.Error("Expected error for size over the limit")
+	}
+}
+
+// TestParseGzipLevel tests validation of the gzip level parameter
+func TestParseGzipLevel(t *testing.T) {
+	for _, valid := range []string{"-2", "-1", "0", "1", "9"} {
+		if _, err := parseGzipLevel(valid); err != nil {
+			t.Errorf("Expected level %s to be valid, got %v", valid, err)
+		}
+	}
+	for _, invalid := range []string{"-3", "10", "fast", ""} {
+		if _, err := parseGzipLevel(invalid); err == nil {
+			t.Errorf("Expected level %q to be rejected", invalid)
+		}
+	}
+}
+
+// TestParseWorkers tests parsing and capping of the parallel worker count
+func TestParseWorkers(t *testing.T) {
+	if workers, err := parseWorkers(""); err != nil || workers != 1 {
+		t.Errorf("Expected 1 worker for empty value, got %d (%v)", workers, err)
+	}
+	if workers, err := parseWorkers("1"); err != nil || workers != 1 {
+		t.Errorf("Expected 1 worker, got %d (%v)", workers, err)
+	}
+	if workers, err := parseWorkers("100000"); err != nil || workers != runtime.GOMAXPROCS(0) {
+		t.Errorf("Expected workers capped at GOMAXPROCS=%d, got %d (%v)", runtime.GOMAXPROCS(0), workers, err)
+	}
+	for _, invalid := range []string{"0", "-2", "many"} {
+		if _, err := parseWorkers(invalid); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+}
+
+// TestCreateHexString tests hex string generation function
+func TestCreateHexString(t *testing.T) {
+	tests := []struct {
+		name         string
+		param        string
+		expectError  bool
+		expectedSize int
+	}{
+		{
+			name:         "Generate 1KB hex",
+			param:        "1",
+			expectError:  false,
+			expectedSize: 1,
+		},
+		{
+			name:         "Generate 0KB hex",
+			param:        "0",
+			expectError:  false,
 			expectedSize: 0,
 		},
 		{
@@ -477,7 +1515,7 @@ func TestCreateHexString(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := createHexString(tt.param)
+			result, err := createHexString(context.Background(), tt.param, MaxHexKB)
 
 			if tt.expectError {
 				if err == nil {
@@ -534,6 +1572,49 @@ func TestCreateHexString(t *testing.T) {
 	}
 }
 
+// TestFibonacciMemo tests that ?memo=1 results match the recursive output, that a repeated position
+// is a cache hit, and that the cache stays bounded
+func TestFibonacciMemo(t *testing.T) {
+	fibonacciCache.reset()
+	defer fibonacciCache.reset()
+
+	for n := 0; n <= 25; n++ {
+		param := strconv.Itoa(n)
+		first, err := fibonacci(context.Background(), param, MaxFibonacci, true)
+		if err != nil {
+			t.Fatalf("Unexpected error for %d: %v", n, err)
+		}
+		second, err := fibonacci(context.Background(), param, MaxFibonacci, true)
+		if err != nil {
+			t.Fatalf("Unexpected error for %d: %v", n, err)
+		}
+		expected := fibonacciRecursive(n)
+		if first.Result != expected || second.Result != expected {
+			t.Errorf("Expected fib(%d) = %d, got %d then %d", n, expected, first.Result, second.Result)
+		}
+		if first.Memo != "miss" || second.Memo != "hit" {
+			t.Errorf("Expected a miss then a hit for %d, got %q then %q", n, first.Memo, second.Memo)
+		}
+	}
+
+	uncached, err := fibonacci(context.Background(), "25", MaxFibonacci, false)
+	if err != nil || uncached.Memo != "" || uncached.Result != 75025 {
+		t.Errorf("Expected an uncached result without memo status, got %+v, %v", uncached, err)
+	}
+
+	bounded := &fibonacciMemo{maxSize: 2}
+	for n := 0; n < 5; n++ {
+		bounded.store(n, n)
+	}
+	bounded.store(0, 0)
+	if bounded.size.Load() != 2 {
+		t.Errorf("Expected the cache to hold 2 entries, got %d", bounded.size.Load())
+	}
+	if _, ok := bounded.lookup(4); ok {
+		t.Error("Expected positions past the bound not to be cached")
+	}
+}
+
 // TestFibonacciRecursive tests the recursive Fibonacci implementation
 func TestFibonacciRecursive(t *testing.T) {
 	tests := []struct {
@@ -604,69 +1685,387 @@ func TestStartRequestMetrics(t *testing.T) {
 	}
 }
 
-// BenchmarkParseIntOrRange benchmarks the abstracted parsing function
-func BenchmarkParseIntOrRange(b *testing.B) {
-	for i := 0; i < b.N; i++ {
-		parseIntOrRange("100..500", 1000, "test")
-	}
-}
+// TestRequestMetricsMemoryAcrossGC tests that a GC mid-request, which drops the live heap below
+// its starting size, doesn't make memory_used_bytes negative
+func TestRequestMetricsMemoryAcrossGC(t *testing.T) {
+	garbage := make([]byte, 16*1024*1024)
+	garbage[len(garbage)-1] = 1
 
-// BenchmarkAllocateMemory benchmarks memory allocation
-func BenchmarkAllocateMemory(b *testing.B) {
-	for i := 0; i < b.N; i++ {
-		allocateMemory("1")
-	}
-}
+	metrics := startRequestMetrics()
 
-// BenchmarkFibonacci benchmarks Fibonacci calculation
-func BenchmarkFibonacci(b *testing.B) {
-	for i := 0; i < b.N; i++ {
-		fibonacci("10")
-	}
-}
+	// Drop the only reference and collect: Alloc now ends well below its value at start
+	runtime.KeepAlive(garbage)
+	garbage = nil
+	runtime.GC()
+	allocated := make([]byte, 1024*1024)
+	allocated[0] = 1
 
-// BenchmarkGeneratePrimes benchmarks prime generation
-func BenchmarkGeneratePrimes(b *testing.B) {
-	for i := 0; i < b.N; i++ {
-		generatePrimes("10")
+	metrics.finish()
+	runtime.KeepAlive(allocated)
+
+	if metrics.MemoryUsedBytes < 1024*1024 {
+		t.Errorf("Expected MemoryUsedBytes to count the 1 MB allocated mid-request, got %d", metrics.MemoryUsedBytes)
 	}
 }
 
-// BenchmarkCreateHexString benchmarks hex string generation
-func BenchmarkCreateHexString(b *testing.B) {
-	for i := 0; i < b.N; i++ {
-		createHexString("1")
+// TestRequestMetricsGC tests that GC cycles during a request are counted, and that a large
+// allocation reports gc_cycles and gc_pause_us
+func TestRequestMetricsGC(t *testing.T) {
+	metrics := startRequestMetrics()
+	runtime.GC()
+	metrics.finish()
+	if metrics.GCCycles < 1 || metrics.GCPauseUs < 0 {
+		t.Errorf("Expected at least one GC cycle and a non-negative pause, got %d cycles, %d us", metrics.GCCycles, metrics.GCPauseUs)
 	}
-}
 
-// setupRouter creates a test router with all routes
-func setupRouter() *gin.Engine {
 	gin.SetMode(gin.TestMode)
+	server := newAPIServer(defaultLoadLimits())
 	router := gin.New()
-	router.GET("/", getIndex)
-	router.GET("/fibonacci/:f", getFibonacci)
-	router.GET("/primes/:p", getPrimes)
-	router.GET("/hex/:h", getHexString)
-	router.GET("/memory/:m", getMemory)
-	router.GET("/fibonacci/hex/:f/:h", getFibonacciHex)
-	router.GET("/primes/hex/:p/:h", getPrimesHex)
-	router.GET("/fibonacci/hex/memory/:f/:h/:m", fibonacciHexMemory)
-	router.GET("/primes/hex/memory/:p/:h/:m", primesHexMemory)
-	return router
-}
+	server.registerRoutes(router)
 
-// TestGetIndex tests the HTML homepage endpoint
-func TestGetIndex(t *testing.T) {
-	router := setupRouter()
 	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("GET", "/", nil)
-	router.ServeHTTP(w, req)
-
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/memory/100MB?touch=all", nil))
 	if w.Code != http.StatusOK {
-		t.Errorf("Expected status 200, got %d", w.Code)
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
 	}
-
-	body := w.Body.String()
+	var response struct {
+		RequestMetrics map[string]interface{} `json:"request_metrics"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	for _, field := range []string{"gc_cycles", "gc_pause_us"} {
+		value, ok := response.RequestMetrics[field].(float64)
+		if !ok || value < 0 {
+			t.Errorf("Expected a non-negative %s, got %v", field, response.RequestMetrics[field])
+		}
+	}
+}
+
+func TestRequestMetricsServerTime(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := newAPIServer(defaultLoadLimits())
+	router := gin.New()
+	server.registerRoutes(router)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/fibonacci/10", nil))
+	now := time.Now().UnixMicro()
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		RequestMetrics struct {
+			ServerTimeUs *int64 `json:"server_time_us"`
+			UptimeUs     *int64 `json:"uptime_us"`
+		} `json:"request_metrics"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	metrics := response.RequestMetrics
+	if metrics.ServerTimeUs == nil || metrics.UptimeUs == nil {
+		t.Fatalf("Expected server_time_us and uptime_us, got %s", w.Body.String())
+	}
+	if diff := now - *metrics.ServerTimeUs; diff < 0 || diff > int64(time.Second/time.Microsecond) {
+		t.Errorf("Expected server_time_us within a second of %d, got %d", now, *metrics.ServerTimeUs)
+	}
+	if *metrics.UptimeUs < 0 || *metrics.UptimeUs > time.Since(server.startTime).Microseconds() {
+		t.Errorf("Expected uptime_us between 0 and the server's age, got %d", *metrics.UptimeUs)
+	}
+}
+
+// TestRequestMetricsCPUUsage tests that a busy loop reports a plausible CPU usage percentage
+func TestRequestMetricsCPUUsage(t *testing.T) {
+	if getCPUTime() < 0 {
+		t.Skip("process CPU time is unavailable on this platform")
+	}
+
+	metrics := startRequestMetrics()
+	deadline := time.Now().Add(50 * time.Millisecond)
+	x := 0
+	for time.Now().Before(deadline) {
+		x++
+	}
+	metrics.finish()
+
+	if metrics.CPUUsagePercent <= 0 {
+		t.Errorf("Expected positive CPU usage after busy loop, got %f (iterations %d)", metrics.CPUUsagePercent, x)
+	}
+	if metrics.CPUUsagePercent > 100 {
+		t.Errorf("Expected CPU usage normalized across cores to be at most 100, got %f", metrics.CPUUsagePercent)
+	}
+}
+
+// TestCPUUsagePercent tests the CPU time to percentage conversion
+func TestCPUUsagePercent(t *testing.T) {
+	if got := cpuUsagePercent(-1, 100, time.Second); got != -1.0 {
+		t.Errorf("Expected -1 when start CPU time is unavailable, got %f", got)
+	}
+	if got := cpuUsagePercent(0, 100, 0); got != -1.0 {
+		t.Errorf("Expected -1 for zero wall time, got %f", got)
+	}
+
+	// One core fully busy for the whole wall time
+	got := cpuUsagePercent(0, int64(time.Second), time.Second)
+	expected := 100.0 / float64(runtime.NumCPU())
+	if got < expected-0.001 || got > expected+0.001 {
+		t.Errorf("Expected %f, got %f", expected, got)
+	}
+
+	// CPU time exceeding wall time across all cores is clamped to 100
+	overshoot := int64(time.Second) * int64(runtime.NumCPU()) * 101 / 100
+	if got := cpuUsagePercent(0, overshoot, time.Second); got != 100.0 {
+		t.Errorf("Expected overshoot clamped to 100, got %f", got)
+	}
+	if got := cpuUsagePercent(100, 0, time.Second); got != 0 {
+		t.Errorf("Expected negative delta clamped to 0, got %f", got)
+	}
+}
+
+// BenchmarkHexConcurrent benchmarks /hex/1000 at concurrency 100 with the pooled (default) and
+// seeded (single locked) random sources
+func BenchmarkHexConcurrent(b *testing.B) {
+	router := setupRouter()
+	defer loadRand.unseed()
+
+	for _, seeded := range []bool{false, true} {
+		name := "pooled"
+		if seeded {
+			name = "locked"
+			loadRand.Seed(1)
+		}
+		b.Run(name, func(b *testing.B) {
+			b.SetParallelism(100)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					w := httptest.NewRecorder()
+					req, _ := http.NewRequest("GET", "/hex/1000?metrics=false", nil)
+					router.ServeHTTP(w, req)
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkParseIntOrRange benchmarks the abstracted parsing function
+func BenchmarkParseIntOrRange(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		parseIntOrRange(context.Background(), "100..500", 1000, "test")
+	}
+}
+
+// BenchmarkAllocateMemory benchmarks memory allocation
+func BenchmarkAllocateMemory(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		allocateMemory(context.Background(), "1", MaxMemoryKB)
+	}
+}
+
+// BenchmarkFibonacci benchmarks Fibonacci calculation
+func BenchmarkFibonacci(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		fibonacci(context.Background(), "10", MaxFibonacci, false)
+	}
+}
+
+// BenchmarkGeneratePrimes benchmarks prime generation
+func BenchmarkGeneratePrimes(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		generatePrimes(context.Background(), "10", MaxPrimes)
+	}
+}
+
+// BenchmarkCreateHexString benchmarks hex string generation
+func BenchmarkCreateHexString(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		createHexString(context.Background(), "1", MaxHexKB)
+	}
+}
+
+// BenchmarkFillHex compares fillHex's bulk read + hex.Encode with drawing one Intn(16) per character
+func BenchmarkFillHex(b *testing.B) {
+	buf := make([]byte, 1000*1024)
+	b.Run("encode", func(b *testing.B) {
+		b.SetBytes(int64(len(buf)))
+		for i := 0; i < b.N; i++ {
+			fillHex(context.Background(), buf)
+		}
+	})
+	b.Run("intn", func(b *testing.B) {
+		const hexChars = "0123456789abcdef"
+		b.SetBytes(int64(len(buf)))
+		for i := 0; i < b.N; i++ {
+			loadRand.with(func(r *rand.Rand) {
+				for j := range buf {
+					buf[j] = hexChars[r.Intn(16)]
+				}
+			})
+		}
+	})
+}
+
+// BenchmarkCreateHexString1000 benchmarks the /hex/1000 payload; with pooled scratch buffers the
+// result string should be the only ~1 MB allocation per op (go test -bench CreateHexString1000 -benchmem)
+func BenchmarkCreateHexString1000(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		createHexString(context.Background(), "1000", MaxHexKB)
+	}
+}
+
+// BenchmarkSpinUntil benchmarks a 1ms allocation-free spin; run with -benchmem to confirm 0 allocs/op
+func BenchmarkSpinUntil(b *testing.B) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		spinUntil(ctx, time.Now().Add(time.Millisecond))
+	}
+}
+
+// setupRouter creates a test router with all routes
+func setupRouter() *gin.Engine {
+	return setupRouterWithLimits(defaultLoadLimits())
+}
+
+// setupRouterWithLimits creates a test router with all routes using the given limits
+func setupRouterWithLimits(limits loadLimits) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	newAPIServer(limits).registerRoutes(router)
+	return router
+}
+
+// errorFields returns the "error" object of a decoded ErrorResponse, or nil if there isn't one
+func errorFields(response map[string]interface{}) map[string]interface{} {
+	fields, _ := response["error"].(map[string]interface{})
+	return fields
+}
+
+// TestGetOpenAPI tests that /openapi.json is valid JSON describing the routes, limits, and schemas
+func TestGetOpenAPI(t *testing.T) {
+	limits := defaultLoadLimits()
+	limits.Primes = 500
+	router := setupRouterWithLimits(limits)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/openapi.json", nil)
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Paths   map[string]map[string]struct {
+			Parameters []struct {
+				Name        string `json:"name"`
+				In          string `json:"in"`
+				Description string `json:"description"`
+				Schema      struct {
+					Pattern string `json:"pattern"`
+				} `json:"schema"`
+			} `json:"parameters"`
+			Responses map[string]json.RawMessage `json:"responses"`
+		} `json:"paths"`
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("Expected valid JSON: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("Expected an OpenAPI 3 document, got version %q", doc.OpenAPI)
+	}
+
+	primes, ok := doc.Paths["/primes/{p}"]["get"]
+	if !ok {
+		t.Fatalf("Expected GET /primes/{p} in paths, got %d paths", len(doc.Paths))
+	}
+	if len(primes.Parameters) == 0 || primes.Parameters[0].Name != "p" || primes.Parameters[0].In != "path" {
+		t.Fatalf("Expected the p path parameter first, got %+v", primes.Parameters)
+	}
+	if p := primes.Parameters[0]; !strings.Contains(p.Description, "(max 500)") {
+		t.Errorf("Expected the configured limit in the description, got %q", p.Description)
+	}
+	pattern := regexp.MustCompile(primes.Parameters[0].Schema.Pattern)
+	for _, value := range []string{"100", "100..200", "100..200..50", "100,150,200"} {
+		if !pattern.MatchString(value) {
+			t.Errorf("Expected pattern %s to match %q", pattern, value)
+		}
+	}
+	for _, status := range []string{"200", "400", "503"} {
+		if _, ok := primes.Responses[status]; !ok {
+			t.Errorf("Expected a %s response for /primes/{p}", status)
+		}
+	}
+	for _, schema := range []string{"PrimeResult", "RequestMetrics", "ErrorResponse", "ErrorDetail"} {
+		if _, ok := doc.Components.Schemas[schema]; !ok {
+			t.Errorf("Expected schema %s in components", schema)
+		}
+	}
+	if _, ok := doc.Paths["/gc"]; ok {
+		t.Error("Expected the disabled /gc route to be left out")
+	}
+}
+
+// TestOpenAPICoversRoutes tests that every route, including the optional ones, has an openAPIRoutes entry
+func TestOpenAPICoversRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := newAPIServer(defaultLoadLimits())
+	server.gcEndpoint = true
+	server.pprofEndpoints = true
+	server.diskEndpoints = true
+	server.adminEndpoints = true
+	server.triggerShutdown = func(string) {}
+	server.expvars = newExpvarMetrics(server.holds)
+	readFile, err := newDiskReadFile(t.TempDir(), 1)
+	if err != nil {
+		t.Fatalf("Failed to create backing file: %v", err)
+	}
+	defer readFile.close()
+	server.diskReadFile = readFile
+	server.registerRoutes(gin.New())
+
+	for _, route := range server.routes {
+		if _, ok := openAPIRoutes[route.Method+" "+route.Path]; !ok {
+			t.Errorf("Route %s %s is missing from openAPIRoutes", route.Method, route.Path)
+		}
+	}
+	if len(server.routes) != len(openAPIRoutes) {
+		t.Errorf("Expected %d routes to match the %d openAPIRoutes entries", len(server.routes), len(openAPIRoutes))
+	}
+}
+
+// TestOpenAPIPath tests the conversion of gin route paths to OpenAPI syntax
+func TestOpenAPIPath(t *testing.T) {
+	tests := map[string]string{
+		"/":                           "/",
+		"/primes/:p":                  "/primes/{p}",
+		"/primes/hex/memory/:p/:h/:m": "/primes/hex/memory/{p}/{h}/{m}",
+		"/debug/pprof/*profile":       "/debug/pprof/{profile}",
+	}
+	for path, expected := range tests {
+		if got := openAPIPath(path); got != expected {
+			t.Errorf("openAPIPath(%q) = %q, expected %q", path, got, expected)
+		}
+	}
+}
+
+// TestGetIndex tests the HTML homepage endpoint
+func TestGetIndex(t *testing.T) {
+	router := setupRouter()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+
+	body := w.Body.String()
 
 	if !strings.Contains(body, "Apex Load Generator API") {
 		t.Error("Expected homepage to contain 'Apex Load Generator API'")
@@ -780,507 +2179,6234 @@ func TestGetMemory(t *testing.T) {
 	}
 }
 
-// TestGetFibonacci tests the Fibonacci calculation endpoint
-func TestGetFibonacci(t *testing.T) {
-	router := setupRouter()
+// TestMemoryHoldRegistry tests that held allocations accumulate and are released after expiry
+func TestMemoryHoldRegistry(t *testing.T) {
+	registry := newMemoryHoldRegistry()
 
-	tests := []struct {
-		name           string
-		param          string
-		expectedStatus int
-		expectError    bool
-	}{
-		{
-			name:           "Valid Fibonacci calculation",
-			param:          "5",
-			expectedStatus: http.StatusOK,
-			expectError:    false,
-		},
-		{
-			name:           "Valid Fibonacci range",
-			param:          "3..7",
-			expectedStatus: http.StatusOK,
-			expectError:    false,
-		},
-		{
-			name:           "Invalid parameter",
-			param:          "invalid",
-			expectedStatus: http.StatusBadRequest,
-			expectError:    true,
-		},
-		{
-			name:           "Exceeds maximum",
-			param:          "50",
-			expectedStatus: http.StatusBadRequest,
-			expectError:    true,
-		},
+	if total, err := registry.hold(make([]byte, 1024), time.Minute, 4096); err != nil || total != 1024 {
+		t.Errorf("Expected 1024 held bytes, got %d (%v)", total, err)
+	}
+	if total, err := registry.hold(make([]byte, 2048), time.Hour, 4096); err != nil || total != 3072 {
+		t.Errorf("Expected 3072 held bytes after second hold, got %d (%v)", total, err)
+	}
+	if total, err := registry.hold(make([]byte, 2048), time.Hour, 4096); err == nil || total != 3072 {
+		t.Errorf("Expected hold past the cap to be refused with 3072 bytes held, got %d (%v)", total, err)
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			w := httptest.NewRecorder()
-			req, _ := http.NewRequest("GET", "/fibonacci/"+tt.param, nil)
-			router.ServeHTTP(w, req)
+	if released := registry.releaseExpired(time.Now()); released != 0 {
+		t.Errorf("Expected nothing released before expiry, got %d", released)
+	}
 
-			if w.Code != tt.expectedStatus {
-				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
-			}
+	if released := registry.releaseExpired(time.Now().Add(2 * time.Minute)); released != 1 {
+		t.Errorf("Expected 1 hold released, got %d", released)
+	}
+	if held := registry.heldBytes(); held != 2048 {
+		t.Errorf("Expected 2048 held bytes after first expiry, got %d", held)
+	}
 
-			if !tt.expectError {
-				var response map[string]interface{}
-				err := json.Unmarshal(w.Body.Bytes(), &response)
-				if err != nil {
-					t.Errorf("Failed to parse JSON response: %v", err)
-				}
+	if released := registry.releaseExpired(time.Now().Add(2 * time.Hour)); released != 1 {
+		t.Errorf("Expected 1 hold released, got %d", released)
+	}
+	if held := registry.heldBytes(); held != 0 {
+		t.Errorf("Expected 0 held bytes after all expired, got %d", held)
+	}
 
-				if _, ok := response["data"]; !ok {
-					t.Error("Expected 'data' field in response")
-				}
-				if _, ok := response["request_metrics"]; !ok {
-					t.Error("Expected 'request_metrics' field in response")
-				}
-			}
-		})
+	// Reservations count against the cap until they are committed or cancelled
+	if err := registry.reserve(3072, 4096); err != nil {
+		t.Fatalf("Expected a reservation under the cap, got %v", err)
+	}
+	if _, err := registry.hold(make([]byte, 2048), time.Hour, 4096); err == nil {
+		t.Error("Expected a hold past the cap with reserved bytes to be refused")
+	}
+	registry.cancel(3072)
+	if total, err := registry.hold(make([]byte, 2048), time.Hour, 4096); err != nil || total != 2048 {
+		t.Errorf("Expected 2048 held bytes after the reservation was cancelled, got %d (%v)", total, err)
 	}
 }
 
-// TestGetPrimes tests the prime generation endpoint
-func TestGetPrimes(t *testing.T) {
+// TestAllocateMemoryBufferAdmit tests that admit sees the chosen size before anything is
+// allocated and that a refusal allocates nothing
+func TestAllocateMemoryBufferAdmit(t *testing.T) {
+	var admitted int64
+	refuse := errorWithCode(CodeOutOfRange, "over the cap")
+	result, buffers, err := allocateMemoryBuffer(context.Background(), "64", MaxMemoryKB, 0, DefaultMemoryTouch, PageSize, "", func(size int64) error {
+		admitted = size
+		return refuse
+	})
+	if err != refuse || buffers != nil || result.SizeKB != 0 {
+		t.Errorf("Expected the refusal and no buffers, got %v, %d buffers, %+v", err, len(buffers), result)
+	}
+	if admitted != 64*1024 {
+		t.Errorf("Expected admit to see 65536 bytes, got %d", admitted)
+	}
+}
+
+// TestMemoryHoldJanitor tests that the background janitor releases expired holds
+func TestMemoryHoldJanitor(t *testing.T) {
+	registry := newMemoryHoldRegistry()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go registry.run(ctx, 5*time.Millisecond)
+
+	registry.hold(make([]byte, 4096), 10*time.Millisecond, 4096)
+
+	deadline := time.Now().Add(time.Second)
+	for registry.heldBytes() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected janitor to release hold, still holding %d bytes", registry.heldBytes())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestMemoryHeadroom tests that allocations beyond the allowed share of available memory are
+// rejected with a 507 on every path that allocates, using a mocked availability
+func TestMemoryHeadroom(t *testing.T) {
+	original := *memoryGuard
+	defer func() { *memoryGuard = original }()
+
+	// 4 MB available at the default 0.8 fraction allows 3,276 KB
+	memoryGuard.fraction = DefaultMemoryAvailableFraction
+	memoryGuard.available = func() (int64, bool) { return 4 * 1024 * 1024, true }
 	router := setupRouter()
 
 	tests := []struct {
-		name           string
-		param          string
-		expectedStatus int
-		expectError    bool
+		path   string
+		status int
+		param  string
 	}{
-		{
-			name:           "Valid prime generation",
-			param:          "5",
-			expectedStatus: http.StatusOK,
-			expectError:    false,
-		},
-		{
-			name:           "Valid prime range",
-			param:          "3..7",
-			expectedStatus: http.StatusOK,
-			expectError:    false,
-		},
-		{
-			name:           "Invalid parameter",
-			param:          "invalid",
-			expectedStatus: http.StatusBadRequest,
-			expectError:    true,
-		},
-		{
-			name:           "Exceeds maximum",
-			param:          "50000",
-			expectedStatus: http.StatusBadRequest,
-			expectError:    true,
-		},
+		{"/memory/3276", http.StatusOK, ""},
+		{"/memory/3277", http.StatusInsufficientStorage, "m"},
+		{"/memory/8MB", http.StatusInsufficientStorage, "m"},
+		{"/primes/hex/memory/10/1/4096", http.StatusInsufficientStorage, "m"},
+		{"/load?primes=10&memory=4096", http.StatusInsufficientStorage, "memory"},
+		// The configured cap is still checked first
+		{"/memory/2000000", http.StatusBadRequest, "m"},
 	}
-
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
+		t.Run(tt.path, func(t *testing.T) {
 			w := httptest.NewRecorder()
-			req, _ := http.NewRequest("GET", "/primes/"+tt.param, nil)
-			router.ServeHTTP(w, req)
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.status == http.StatusOK {
+				return
+			}
+			detail := decodeStrict[ErrorResponse](t, w.Body.Bytes()).Error
+			expectedCode := CodeInsufficientMemory
+			if tt.status == http.StatusBadRequest {
+				expectedCode = CodeOutOfRange
+			}
+			if detail.Param != tt.param || detail.Code != expectedCode {
+				t.Errorf("Expected param %q code %q, got %+v", tt.param, expectedCode, detail)
+			}
+		})
+	}
+
+	// A lower fraction tightens the limit, and unknown availability leaves only the cap
+	memoryGuard.fraction = 0.25
+	if err := memoryGuard.check(1024*1024 + 1); errorCode(err) != CodeInsufficientMemory {
+		t.Errorf("Expected just over 1 MB to exceed a quarter of 4 MB, got %v", err)
+	}
+	memoryGuard.available = func() (int64, bool) { return 0, false }
+	if err := memoryGuard.check(1 << 40); err != nil {
+		t.Errorf("Expected no check when availability is unknown, got %v", err)
+	}
+}
+
+// TestAllocateMemoryChunks tests that chunked allocation splits the request into chunk-sized
+// slices whose total equals the requested size
+func TestAllocateMemoryChunks(t *testing.T) {
+	tests := []struct {
+		param     string
+		chunkKB   int
+		chunks    int
+		lastChunk int
+	}{
+		{"1024", 0, 1, 1024 * 1024},
+		{"1024", 256, 4, 256 * 1024},
+		{"1000", 256, 4, 232 * 1024},
+		{"100", 1024, 1, 100 * 1024},
+		{"1MB", 1, 1024, 1024},
+		{"0", 64, 0, 0},
+	}
+	for _, tt := range tests {
+		result, buffers, err := allocateMemoryBuffer(context.Background(), tt.param, MaxMemoryKB, tt.chunkKB, DefaultMemoryTouch, PageSize, "", nil)
+		if err != nil {
+			t.Fatalf("allocateMemoryBuffer(%q, chunk %d) failed: %v", tt.param, tt.chunkKB, err)
+		}
+		var total int
+		for _, buffer := range buffers {
+			total += len(buffer)
+		}
+		if total != result.SizeKB*1024 || len(buffers) != tt.chunks {
+			t.Errorf("%q in %d KB chunks: expected %d KB in %d chunks, got %d bytes in %d", tt.param, tt.chunkKB, result.SizeKB, tt.chunks, total, len(buffers))
+		}
+		if tt.chunks > 0 && len(buffers[len(buffers)-1]) != tt.lastChunk {
+			t.Errorf("%q in %d KB chunks: expected a %d-byte last chunk, got %d", tt.param, tt.chunkKB, tt.lastChunk, len(buffers[len(buffers)-1]))
+		}
+		expectedChunks := tt.chunks
+		if tt.chunkKB == 0 {
+			expectedChunks = 0
+		}
+		if result.Chunks != expectedChunks {
+			t.Errorf("%q in %d KB chunks: expected chunks %d, got %d", tt.param, tt.chunkKB, expectedChunks, result.Chunks)
+		}
+	}
+}
+
+// TestGetMemoryChunked tests ?chunk= on /memory, including holding every chunk
+func TestGetMemoryChunked(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := newAPIServer(defaultLoadLimits())
+	router := gin.New()
+	server.registerRoutes(router)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/memory/10MB?chunk=4MB&hold=1m", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	result := decodeStrict[Response[MemoryResult]](t, w.Body.Bytes()).Data
+	if result.SizeKB != 10240 || result.Chunks != 3 || result.TotalHeldBytes != 10240*1024 {
+		t.Errorf("Expected 10240 KB in 3 chunks all held, got %+v", result)
+	}
+	if held := server.holds.heldBytes(); held != 10240*1024 {
+		t.Errorf("Expected %d bytes held, got %d", 10240*1024, held)
+	}
+	server.holds.releaseExpired(time.Now().Add(2 * time.Minute))
+	if held := server.holds.heldBytes(); held != 0 {
+		t.Errorf("Expected the chunks to be released together, got %d bytes held", held)
+	}
+
+	for _, chunk := range []string{"0", "abc", "2GB"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/memory/10?chunk="+chunk, nil))
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"param": "chunk"`) {
+			t.Errorf("Expected a 400 for chunk %q, got %d: %s", chunk, w.Code, w.Body.String())
+		}
+	}
+}
+
+// TestAllocateMemoryTouch tests that every touch mode and stride allocates the requested size
+func TestAllocateMemoryTouch(t *testing.T) {
+	tests := []struct {
+		touch  string
+		stride int
+	}{
+		{"all", PageSize},
+		{"stride", 1},
+		{"stride", 64},
+		{"stride", PageSize},
+		{"stride", 1 << 30},
+		{"none", PageSize},
+	}
+	for _, tt := range tests {
+		result, buffers, err := allocateMemoryBuffer(context.Background(), "1000", MaxMemoryKB, 256, tt.touch, tt.stride, "", nil)
+		if err != nil {
+			t.Fatalf("touch %s stride %d failed: %v", tt.touch, tt.stride, err)
+		}
+		if result.SizeKB != 1000 || len(buffers) != 4 {
+			t.Errorf("touch %s stride %d: expected 1000 KB in 4 chunks, got %+v", tt.touch, tt.stride, result)
+		}
+		if tt.touch != "none" && buffers[0][0] != 1 {
+			t.Errorf("touch %s stride %d: expected the first byte written", tt.touch, tt.stride)
+		}
+	}
+
+	if _, _, err := allocateMemoryBuffer(context.Background(), "10", MaxMemoryKB, 0, "stride", 0, "", nil); errorCode(err) != CodeOutOfRange {
+		t.Errorf("Expected out_of_range for stride 0, got %v", err)
+	}
+	if _, _, err := allocateMemoryBuffer(context.Background(), "10", MaxMemoryKB, 0, "some", PageSize, "", nil); errorCode(err) != CodeUnsupportedValue {
+		t.Errorf("Expected unsupported_value for touch some, got %v", err)
+	}
+}
+
+// TestGetMemoryTouch tests ?touch= and ?stride= on /memory
+func TestGetMemoryTouch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := newAPIServer(defaultLoadLimits())
+	router := gin.New()
+	server.registerRoutes(router)
+
+	tests := []struct {
+		query  string
+		touch  string
+		stride int
+	}{
+		{"", "", 0},
+		{"?touch=all", "all", 0},
+		{"?touch=none", "none", 0},
+		{"?touch=stride", "stride", PageSize},
+		{"?stride=64", "stride", 64},
+		{"?touch=stride&stride=2097152&chunk=512", "stride", 2097152},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/memory/2048"+tt.query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", tt.query, w.Code, w.Body.String())
+		}
+		result := decodeStrict[Response[MemoryResult]](t, w.Body.Bytes()).Data
+		if result.SizeKB != 2048 || result.Touch != tt.touch || result.Stride != tt.stride {
+			t.Errorf("%s: expected 2048 KB with touch %q stride %d, got %+v", tt.query, tt.touch, tt.stride, result)
+		}
+	}
+
+	for _, query := range []string{"touch=some", "stride=0", "stride=-1", "stride=abc", "stride=99999999999", "touch=all&stride=64"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/memory/10?"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected a 400 for %s, got %d: %s", query, w.Code, w.Body.String())
+		}
+	}
+}
+
+// TestGetMemoryFill tests each ?fill= mode, including the buffer contents it leaves behind, and
+// the rejection of unknown modes and of fill combined with touch or stride
+func TestGetMemoryFill(t *testing.T) {
+	for _, fill := range memoryFillNames() {
+		_, buffers, err := allocateMemoryBuffer(context.Background(), "64", MaxMemoryKB, 16, DefaultMemoryTouch, PageSize, fill, nil)
+		if err != nil {
+			t.Fatalf("fill=%s: allocateMemoryBuffer failed: %v", fill, err)
+		}
+		var total, nonZero int
+		for _, buffer := range buffers {
+			total += len(buffer)
+			nonZero += len(buffer) - bytes.Count(buffer, []byte{0})
+		}
+		if total != 64*1024 {
+			t.Errorf("fill=%s: expected 64 KB across the buffers, got %d bytes", fill, total)
+		}
+		if wantRandom := fill == "random"; (nonZero > total/2) != wantRandom {
+			t.Errorf("fill=%s: got %d non-zero bytes of %d", fill, nonZero, total)
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	server := newAPIServer(defaultLoadLimits())
+	router := gin.New()
+	server.registerRoutes(router)
+
+	for _, fill := range []string{"zero", "random", "none"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/memory/2MB?fill="+fill, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("fill=%s: expected status 200, got %d: %s", fill, w.Code, w.Body.String())
+		}
+		result := decodeStrict[Response[MemoryResult]](t, w.Body.Bytes()).Data
+		if result.SizeKB != 2048 || result.Fill != fill || result.Touch != "" {
+			t.Errorf("fill=%s: expected 2048 KB with fill %q and no touch, got %+v", fill, fill, result)
+		}
+	}
+
+	for _, query := range []string{"fill=ones", "fill=zero&touch=all", "fill=random&stride=64"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/memory/10?"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected a 400 for %s, got %d: %s", query, w.Code, w.Body.String())
+		}
+	}
+}
+
+// TestGetMemoryHold tests holding memory across requests via ?hold=
+func TestGetMemoryHold(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := newAPIServer(defaultLoadLimits())
+	router := gin.New()
+	server.registerRoutes(router)
+
+	var lastTotal float64
+	for i := 1; i <= 2; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/memory/10?hold=1m", nil)
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+
+		var response map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to parse JSON response: %v", err)
+		}
+		data := response["data"].(map[string]interface{})
+
+		if data["held_for"] != "1m0s" {
+			t.Errorf("Expected held_for '1m0s', got %v", data["held_for"])
+		}
+		lastTotal, _ = data["total_held_bytes"].(float64)
+		if int(lastTotal) != i*10*1024 {
+			t.Errorf("Expected %d total held bytes, got %v", i*10*1024, data["total_held_bytes"])
+		}
+	}
+
+	server.holds.releaseExpired(time.Now().Add(2 * time.Minute))
+	if held := server.holds.heldBytes(); held != 0 {
+		t.Errorf("Expected held memory to be released, got %d bytes", held)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/memory/10?hold=forever", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid hold, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/memory/10", nil)
+	router.ServeHTTP(w, req)
+	if strings.Contains(w.Body.String(), "held_for") {
+		t.Error("Expected no held_for field without ?hold")
+	}
+}
+
+// TestGetMemoryHoldCap tests that holds exceeding the total held-memory cap are rejected
+func TestGetMemoryHoldCap(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limits := defaultLoadLimits()
+	limits.HeldKB = 15
+	server := newAPIServer(limits)
+	router := gin.New()
+	server.registerRoutes(router)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/memory/10?hold=1m", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected first hold within the cap to succeed, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/memory/10?hold=1m", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 for hold past the cap, got %d", w.Code)
+	}
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+	if errorFields(response)["param"] != "hold" {
+		t.Errorf("Expected param 'hold', got %v", errorFields(response)["param"])
+	}
+	if held := server.holds.heldBytes(); held != 10*1024 {
+		t.Errorf("Expected only the first hold to be retained, got %d bytes", held)
+	}
+	if server.holds.reservedBytes != 0 {
+		t.Errorf("Expected no bytes left reserved, got %d", server.holds.reservedBytes)
+	}
+
+	// Without ?hold the cap does not apply
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/memory/10", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected unheld allocation to succeed, got %d", w.Code)
+	}
+}
+
+// TestPprofEndpoints tests that /debug/pprof/ is served only when enabled
+func TestPprofEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	paths := []struct {
+		method   string
+		path     string
+		contains string
+	}{
+		{"GET", "/debug/pprof/", "goroutine"},
+		{"GET", "/debug/pprof/heap?debug=1", "heap profile"},
+		{"GET", "/debug/pprof/goroutine?debug=1", "goroutine profile"},
+		{"GET", "/debug/pprof/cmdline", ""},
+		{"GET", "/debug/pprof/profile?seconds=1", ""},
+		{"POST", "/debug/pprof/symbol", ""},
+	}
+
+	for _, enabled := range []bool{true, false} {
+		server := newAPIServer(defaultLoadLimits())
+		server.pprofEndpoints = enabled
+		router := gin.New()
+		server.registerRoutes(router)
+
+		for _, tt := range paths {
+			t.Run(fmt.Sprintf("%s %s enabled=%v", tt.method, tt.path, enabled), func(t *testing.T) {
+				w := httptest.NewRecorder()
+				req, _ := http.NewRequest(tt.method, tt.path, strings.NewReader(""))
+				router.ServeHTTP(w, req)
+
+				if !enabled {
+					if w.Code != http.StatusNotFound {
+						t.Errorf("Expected status 404 when disabled, got %d", w.Code)
+					}
+					return
+				}
+				if w.Code != http.StatusOK {
+					t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+				}
+				if !strings.Contains(w.Body.String(), tt.contains) {
+					t.Errorf("Expected body to contain %q", tt.contains)
+				}
+			})
+		}
+	}
+}
+
+// TestExpvarEndpoint tests that /debug/vars is only served when enabled and that its
+// request counters update after a request
+func TestExpvarEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	disabled := gin.New()
+	newAPIServer(defaultLoadLimits()).registerRoutes(disabled)
+	w := httptest.NewRecorder()
+	disabled.ServeHTTP(w, httptest.NewRequest("GET", "/debug/vars", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 when disabled, got %d", w.Code)
+	}
+
+	server := newAPIServer(defaultLoadLimits())
+	server.expvars = newExpvarMetrics(server.holds)
+	router := gin.New()
+	server.registerRoutes(router)
+
+	type vars struct {
+		Cmdline    []string               `json:"cmdline"`
+		Memstats   map[string]interface{} `json:"memstats"`
+		HeldBytes  int64                  `json:"apex_held_memory_bytes"`
+		ByEndpoint map[string]int64       `json:"apex_requests_by_endpoint"`
+		Requests   int64                  `json:"apex_requests_total"`
+	}
+	getVars := func() vars {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/debug/vars", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		var v vars
+		if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+			t.Fatalf("Failed to parse /debug/vars: %v\n%s", err, w.Body.String())
+		}
+		return v
+	}
+
+	before := getVars()
+	if len(before.Cmdline) == 0 || before.Memstats == nil {
+		t.Errorf("Expected the standard cmdline and memstats variables")
+	}
+	if before.Requests != 0 || before.HeldBytes != 0 {
+		t.Errorf("Expected fresh counters, got %+v", before)
+	}
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/primes/10", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/memory/1?hold=1m", nil))
+	after := getVars()
+
+	// The first /debug/vars request is counted only after its response was written
+	if after.Requests != 3 {
+		t.Errorf("Expected 3 requests, got %d", after.Requests)
+	}
+	if after.ByEndpoint["/primes/:p"] != 1 || after.ByEndpoint["/memory/:m"] != 1 || after.ByEndpoint["/debug/vars"] != 1 {
+		t.Errorf("Unexpected per-endpoint counts %v", after.ByEndpoint)
+	}
+	if after.HeldBytes != 1024 {
+		t.Errorf("Expected 1024 held bytes, got %d", after.HeldBytes)
+	}
+}
+
+// TestPostGC tests the forced garbage collection endpoint when enabled and disabled
+func TestPostGC(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("Enabled", func(t *testing.T) {
+		server := newAPIServer(defaultLoadLimits())
+		server.gcEndpoint = true
+		router := gin.New()
+		server.registerRoutes(router)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/gc", nil)
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+
+		var response map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to parse JSON response: %v", err)
+		}
+		data := response["data"].(map[string]interface{})
+
+		for _, field := range []string{"before", "after", "reclaimed_bytes", "held_bytes", "duration_us", "duration_ms"} {
+			if _, ok := data[field]; !ok {
+				t.Errorf("Expected %q in data", field)
+			}
+		}
+
+		before := data["before"].(map[string]interface{})
+		after := data["after"].(map[string]interface{})
+		for _, field := range []string{"heap_alloc", "heap_inuse", "num_gc"} {
+			if _, ok := before[field]; !ok {
+				t.Errorf("Expected %q in before snapshot", field)
+			}
+		}
+		if after["num_gc"].(float64) <= before["num_gc"].(float64) {
+			t.Errorf("Expected num_gc to increase, before %v after %v", before["num_gc"], after["num_gc"])
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		router := setupRouter()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/gc", nil)
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %d", w.Code)
+		}
+	})
+}
+
+// TestPostMaxProcs tests that the GOMAXPROCS setter returns the applied value
+func TestPostMaxProcs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	original := runtime.GOMAXPROCS(0)
+	defer runtime.GOMAXPROCS(original)
+
+	t.Run("Enabled", func(t *testing.T) {
+		server := newAPIServer(defaultLoadLimits())
+		server.adminEndpoints = true
+		router := gin.New()
+		server.registerRoutes(router)
+
+		for _, n := range []int{1, 3, original} {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", fmt.Sprintf("/admin/maxprocs/%d", n), nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("n=%d: expected status 200, got %d: %s", n, w.Code, w.Body.String())
+			}
+			response := decodeStrict[Response[MaxProcsResult]](t, w.Body.Bytes())
+			if response.Data.GOMAXPROCS != n {
+				t.Errorf("n=%d: expected gomaxprocs %d, got %d", n, n, response.Data.GOMAXPROCS)
+			}
+			if got := runtime.GOMAXPROCS(0); got != n {
+				t.Errorf("n=%d: expected runtime GOMAXPROCS %d, got %d", n, n, got)
+			}
+		}
+
+		for _, param := range []string{"0", "1025", "abc"} {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/admin/maxprocs/"+param, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("n=%s: expected status 400, got %d", param, w.Code)
+			}
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		router := setupRouter()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/admin/maxprocs/2", nil)
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %d", w.Code)
+		}
+	})
+}
+
+// TestPostGCPercent tests that the GOGC setter returns the previous value as debug.SetGCPercent
+// does, and that /sysinfo reports the value in effect
+func TestPostGCPercent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	original := debug.SetGCPercent(100)
+	defer debug.SetGCPercent(original)
+
+	if result := setGCPercent(50); result.Previous != 100 || result.GOGC != 50 {
+		t.Errorf("Expected previous 100 and gogc 50, got %+v", result)
+	}
+	if previous := debug.SetGCPercent(100); previous != 50 {
+		t.Errorf("Expected debug.SetGCPercent to report 50 as the previous value, got %d", previous)
+	}
+
+	server := newAPIServer(defaultLoadLimits())
+	server.adminEndpoints = true
+	router := gin.New()
+	server.registerRoutes(router)
+
+	previous := 100
+	for _, tt := range []struct {
+		param string
+		want  int
+	}{{"25", 25}, {"off", -1}, {"0", 0}, {"100", 100}} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/admin/gogc/"+tt.param, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("pct=%s: expected status 200, got %d: %s", tt.param, w.Code, w.Body.String())
+		}
+		result := decodeStrict[Response[GCPercentResult]](t, w.Body.Bytes()).Data
+		if result.Previous != previous || result.GOGC != tt.want {
+			t.Errorf("pct=%s: expected previous %d and gogc %d, got %+v", tt.param, previous, tt.want, result)
+		}
+		if got := server.sysInfo().GOGC; got != tt.want {
+			t.Errorf("pct=%s: expected /sysinfo gogc %d, got %d", tt.param, tt.want, got)
+		}
+		previous = tt.want
+	}
+
+	for _, param := range []string{"-2", "10001", "abc"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/admin/gogc/"+param, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("pct=%s: expected status 400, got %d", param, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	setupRouter().ServeHTTP(w, httptest.NewRequest("POST", "/admin/gogc/50", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 without admin endpoints, got %d", w.Code)
+	}
+}
+
+// TestBallast tests that a configured ballast raises the live heap reported by /sysinfo and that
+// /admin/ballast/release drops it
+func TestBallast(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := newAPIServer(defaultLoadLimits())
+	server.adminEndpoints = true
+	router := gin.New()
+	server.registerRoutes(router)
+
+	const ballastMB = 16
+	runtime.GC()
+	before := server.sysInfo()
+	server.setBallast(ballastMB)
+	after := server.sysInfo()
+	if after.BallastBytes != ballastMB<<20 {
+		t.Errorf("Expected ballast_bytes %d, got %d", ballastMB<<20, after.BallastBytes)
+	}
+	if grown := int64(after.HeapAllocBytes) - int64(before.HeapAllocBytes); grown < (ballastMB-1)<<20 {
+		t.Errorf("Expected the heap to grow by about %d MB, grew by %d bytes", ballastMB, grown)
+	}
+
+	for _, want := range []int64{ballastMB << 20, 0} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/admin/ballast/release", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if released := decodeStrict[Response[BallastReleaseResult]](t, w.Body.Bytes()).Data.ReleasedBytes; released != want {
+			t.Errorf("Expected released_bytes %d, got %d", want, released)
+		}
+	}
+	if ballast := server.sysInfo().BallastBytes; ballast != 0 {
+		t.Errorf("Expected no ballast after release, got %d bytes", ballast)
+	}
+
+	for _, raw := range []string{"-1", "16385", "abc"} {
+		if _, err := parseBallastMB(raw); err == nil {
+			t.Errorf("Expected parseBallastMB(%q) to fail", raw)
+		}
+	}
+}
+
+// TestGetConfig tests that /config reports the resolved limits and features with the auth token
+// redacted, and only exists with admin endpoints enabled
+func TestGetConfig(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limits := defaultLoadLimits()
+	limits.Primes = 1234
+	limits.RequestTimeout = 5 * time.Second
+	config := defaultConfig()
+	config.Limits = limits
+	config.AuthToken = "s3cret"
+	config.RateLimit = RateLimitConfig{RPS: 50, Burst: 10}
+	config.Features.Admin = true
+
+	server := newAPIServer(limits)
+	server.setConfig(config)
+	server.adminEndpoints = true
+	server.authToken = config.AuthToken
+	server.enabledRoutes = map[string]bool{"primes": true, "hex": true}
+	router := gin.New()
+	server.registerRoutes(router)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/config", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "s3cret") {
+		t.Errorf("Expected the auth token to be redacted, got %s", w.Body.String())
+	}
+
+	var response struct {
+		Data struct {
+			Config struct {
+				Port      int             `json:"port"`
+				AuthToken string          `json:"auth_token"`
+				RateLimit RateLimitConfig `json:"rate_limit"`
+				Features  struct {
+					Admin bool `json:"admin"`
+				} `json:"features"`
+				Limits struct {
+					Primes         int    `json:"primes"`
+					RequestTimeout string `json:"request_timeout"`
+				} `json:"limits"`
+			} `json:"config"`
+			EnabledEndpoints []string `json:"enabled_endpoints"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	resolved := response.Data.Config
+	if resolved.AuthToken != redactedValue {
+		t.Errorf("Expected auth_token %q, got %q", redactedValue, resolved.AuthToken)
+	}
+	if resolved.Port != HTTPPort || resolved.Limits.Primes != 1234 || resolved.Limits.RequestTimeout != "5s" {
+		t.Errorf("Expected port %d, primes limit 1234, and request_timeout 5s, got %+v", HTTPPort, resolved)
+	}
+	if resolved.RateLimit != config.RateLimit || !resolved.Features.Admin {
+		t.Errorf("Expected rate limit %+v and the admin feature, got %+v", config.RateLimit, resolved)
+	}
+	if !slices.Equal(response.Data.EnabledEndpoints, []string{"hex", "primes"}) {
+		t.Errorf("Expected enabled endpoints [hex primes], got %v", response.Data.EnabledEndpoints)
+	}
+
+	w = httptest.NewRecorder()
+	setupRouter().ServeHTTP(w, httptest.NewRequest("GET", "/config", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 without admin endpoints, got %d", w.Code)
+	}
+}
+
+// TestPostShutdown tests that /admin/shutdown answers 202 and invokes the shutdown function
+func TestPostShutdown(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := newAPIServer(defaultLoadLimits())
+	server.adminEndpoints = true
+	var reasons []string
+	server.triggerShutdown = func(reason string) { reasons = append(reasons, reason) }
+	router := gin.New()
+	server.registerRoutes(router)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/admin/shutdown", nil))
+	if w.Code != http.StatusAccepted || !strings.Contains(w.Body.String(), `"shutting down"`) {
+		t.Errorf("Expected a 202 shutting down, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(reasons) != 1 || !strings.Contains(reasons[0], "/admin/shutdown") {
+		t.Errorf("Expected one shutdown request, got %q", reasons)
+	}
+
+	// Without the admin flag, or without a shutdown function to call, the route doesn't exist
+	for _, admin := range []bool{false, true} {
+		server := newAPIServer(defaultLoadLimits())
+		server.adminEndpoints = admin
+		if !admin {
+			server.triggerShutdown = func(string) { t.Error("Expected no shutdown with admin endpoints disabled") }
+		}
+		router := gin.New()
+		server.registerRoutes(router)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/admin/shutdown", nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("admin %t: expected status 404, got %d", admin, w.Code)
+		}
+	}
+}
+
+// TestGetFibonacci tests the Fibonacci calculation endpoint
+func TestGetFibonacci(t *testing.T) {
+	router := setupRouter()
+	fibonacciCache.reset()
+	defer fibonacciCache.reset()
+
+	for _, expectedMemo := range []string{"miss", "hit"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/fibonacci/20?memo=1", nil)
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 with memo, got %d", w.Code)
+		}
+		var response map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to parse JSON response: %v", err)
+		}
+		data := response["data"].(map[string]interface{})
+		if data["result"].(float64) != 6765 || data["memo"] != expectedMemo {
+			t.Errorf("Expected fib(20) = 6765 with memo %q, got %v", expectedMemo, data)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/fibonacci/20?memo=maybe", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid memo flag, got %d", w.Code)
+	}
+
+	tests := []struct {
+		name           string
+		param          string
+		expectedStatus int
+		expectError    bool
+	}{
+		{
+			name:           "Valid Fibonacci calculation",
+			param:          "5",
+			expectedStatus: http.StatusOK,
+			expectError:    false,
+		},
+		{
+			name:           "Valid Fibonacci range",
+			param:          "3..7",
+			expectedStatus: http.StatusOK,
+			expectError:    false,
+		},
+		{
+			name:           "Invalid parameter",
+			param:          "invalid",
+			expectedStatus: http.StatusBadRequest,
+			expectError:    true,
+		},
+		{
+			name:           "Exceeds maximum",
+			param:          "50",
+			expectedStatus: http.StatusBadRequest,
+			expectError:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/fibonacci/"+tt.param, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if !tt.expectError {
+				var response map[string]interface{}
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				if err != nil {
+					t.Errorf("Failed to parse JSON response: %v", err)
+				}
+
+				if _, ok := response["data"]; !ok {
+					t.Error("Expected 'data' field in response")
+				}
+				if _, ok := response["request_metrics"]; !ok {
+					t.Error("Expected 'request_metrics' field in response")
+				}
+			}
+		})
+	}
+}
+
+// TestGetPrimes tests the prime generation endpoint
+func TestGetPrimes(t *testing.T) {
+	router := setupRouter()
+
+	tests := []struct {
+		name           string
+		param          string
+		expectedStatus int
+		expectError    bool
+	}{
+		{
+			name:           "Valid prime generation",
+			param:          "5",
+			expectedStatus: http.StatusOK,
+			expectError:    false,
+		},
+		{
+			name:           "Valid prime range",
+			param:          "3..7",
+			expectedStatus: http.StatusOK,
+			expectError:    false,
+		},
+		{
+			name:           "Invalid parameter",
+			param:          "invalid",
+			expectedStatus: http.StatusBadRequest,
+			expectError:    true,
+		},
+		{
+			name:           "Exceeds maximum",
+			param:          "50000",
+			expectedStatus: http.StatusBadRequest,
+			expectError:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/primes/"+tt.param, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if !tt.expectError {
+				var response map[string]interface{}
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				if err != nil {
+					t.Errorf("Failed to parse JSON response: %v", err)
+				}
+
+				if _, ok := response["data"]; !ok {
+					t.Error("Expected 'data' field in response")
+				}
+				if _, ok := response["request_metrics"]; !ok {
+					t.Error("Expected 'request_metrics' field in response")
+				}
+			}
+		})
+	}
+}
+
+// TestGetPrimesParallel tests the ?parallel= option on the primes endpoint
+func TestGetPrimesParallel(t *testing.T) {
+	router := setupRouter()
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+	}{
+		{"Two workers", "/primes/1000?parallel=2", http.StatusOK},
+		{"Capped workers", "/primes/1000?parallel=1000", http.StatusOK},
+		{"Zero workers", "/primes/1000?parallel=0", http.StatusBadRequest},
+		{"Invalid workers", "/primes/1000?parallel=lots", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse JSON response: %v", err)
+			}
+			data := response["data"].(map[string]interface{})
+
+			if data["last_prime"].(float64) != 7919 {
+				t.Errorf("Expected last prime 7919, got %v", data["last_prime"])
+			}
+			if workers, _ := data["workers"].(float64); int(workers) > runtime.GOMAXPROCS(0) {
+				t.Errorf("Expected at most %d workers, got %v", runtime.GOMAXPROCS(0), data["workers"])
+			}
+		})
+	}
+}
+
+// TestGetPrimesCache tests that ?cache=1 matches uncached results and grows the shared cache on misses
+func TestGetPrimesCache(t *testing.T) {
+	router := setupRouter()
+	primeCache.reset()
+	defer primeCache.reset()
+
+	tests := []struct {
+		count     string
+		cache     string
+		cacheSize int
+	}{
+		{"100", "miss", 100},
+		{"50", "hit", 100},
+		{"100", "hit", 100},
+		{"1000", "miss", 1000},
+		{"1", "hit", 1000},
+		{"0", "hit", 1000},
+		{"10000", "miss", 10000},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/primes/"+tt.count+"?cache=1", nil)
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d", tt.count, w.Code)
+		}
+		cached := decodeStrict[Response[PrimeResult]](t, w.Body.Bytes()).Data
+
+		uncached, err := generatePrimes(context.Background(), tt.count, MaxPrimes)
+		if err != nil {
+			t.Fatalf("generatePrimes(%s): %v", tt.count, err)
+		}
+		if cached.Count != uncached.Count || cached.LastPrime != uncached.LastPrime {
+			t.Errorf("%s: cached result %d/%d does not match uncached %d/%d",
+				tt.count, cached.Count, cached.LastPrime, uncached.Count, uncached.LastPrime)
+		}
+		if cached.Cache != tt.cache {
+			t.Errorf("%s: expected cache %q, got %q", tt.count, tt.cache, cached.Cache)
+		}
+		if size := primeCache.size(); size != tt.cacheSize {
+			t.Errorf("%s: expected %d cached primes, got %d", tt.count, tt.cacheSize, size)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/primes/100?cache=maybe", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid cache flag, got %d", w.Code)
+	}
+}
+
+// TestGetPrimesStats tests the ?stats=1 density figures for small n and that the default response
+// has no stats
+func TestGetPrimesStats(t *testing.T) {
+	router := setupRouter()
+
+	tests := []struct {
+		count    string
+		last     int
+		density  float64
+		pntRatio float64
+	}{
+		{"0", 0, 0, 0},
+		{"1", 2, 0.5, 0},
+		{"2", 3, 2.0 / 3, 3 / (2 * math.Log(2))},
+		{"10", 29, 10.0 / 29, 29 / (10 * math.Log(10))},
+		{"100", 541, 100.0 / 541, 541 / (100 * math.Log(100))},
+	}
+	for _, tt := range tests {
+		for _, query := range []string{"?stats=1", "?stats=1&parallel=2", "?stats=true&cache=1", "?stats=1&algo=sieve"} {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/primes/"+tt.count+query, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("%s%s: expected status 200, got %d: %s", tt.count, query, w.Code, w.Body.String())
+			}
+			result := decodeStrict[Response[PrimeResult]](t, w.Body.Bytes()).Data
+			if result.LastPrime != tt.last || result.Stats == nil {
+				t.Fatalf("%s%s: expected last prime %d with stats, got %+v", tt.count, query, tt.last, result)
+			}
+			if math.Abs(result.Stats.Density-tt.density) > 1e-9 || math.Abs(result.Stats.PNTRatio-tt.pntRatio) > 1e-9 {
+				t.Errorf("%s%s: expected density %g and pnt_ratio %g, got %+v", tt.count, query, tt.density, tt.pntRatio, *result.Stats)
+			}
+			if result.Stats.DurationUs < 0 {
+				t.Errorf("%s%s: expected non-negative timing, got %+v", tt.count, query, *result.Stats)
+			}
+		}
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/primes/10", nil))
+	if strings.Contains(w.Body.String(), `"stats"`) {
+		t.Errorf("Expected no stats without ?stats=1, got %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/primes/10?stats=maybe", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid stats flag, got %d", w.Code)
+	}
+}
+
+// TestGetPrimesSSE tests that /primes/sse streams each prime as an SSE data event, then a summary event
+func TestGetPrimesSSE(t *testing.T) {
+	server := httptest.NewServer(setupRouter())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/primes/sse/100")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Content-Type"); !strings.HasPrefix(got, "text/event-stream") {
+		t.Errorf("Expected text/event-stream Content-Type, got %s", got)
+	}
+
+	// Collect the events; each is a block of "field: value" lines ending in a blank line
+	var primes []int
+	var summary string
+	event := map[string]string{}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" {
+			field, value, _ := strings.Cut(line, ": ")
+			event[field] = value
+			continue
+		}
+		if event["event"] == "summary" {
+			summary = event["data"]
+		} else {
+			prime, err := strconv.Atoi(event["data"])
+			if err != nil {
+				t.Fatalf("Invalid prime event %v: %v", event, err)
+			}
+			primes = append(primes, prime)
+		}
+		event = map[string]string{}
+	}
+
+	if len(primes) != 100 {
+		t.Fatalf("Expected 100 prime events, got %d", len(primes))
+	}
+	isPrime := func(n int) bool {
+		for d := 2; d*d <= n; d++ {
+			if n%d == 0 {
+				return false
+			}
+		}
+		return n >= 2
+	}
+	for i, prime := range primes {
+		if !isPrime(prime) || (i > 0 && prime <= primes[i-1]) {
+			t.Fatalf("Event %d: %d is not the next prime after %v", i, prime, primes[:i])
+		}
+	}
+	var result PrimeResult
+	if err := json.Unmarshal([]byte(summary), &result); err != nil {
+		t.Fatalf("Failed to parse summary event %q: %v", summary, err)
+	}
+	if result.Count != 100 || result.LastPrime != 541 {
+		t.Errorf("Expected summary count 100 and last prime 541, got %d and %d", result.Count, result.LastPrime)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/primes/sse/10001", nil)
+	setupRouter().ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a count over the limit, got %d", w.Code)
+	}
+}
+
+// TestGetPrimesUpTo tests the sieve endpoint
+func TestGetPrimesUpTo(t *testing.T) {
+	router := setupRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/primes/upto/1000", nil)
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var response map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+	data := response["data"].(map[string]interface{})
+	if data["count"].(float64) != 168 || data["largest_prime"].(float64) != 997 {
+		t.Errorf("Expected 168 primes up to 997, got %v up to %v", data["count"], data["largest_prime"])
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/primes/upto/99999999", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for limit over the maximum, got %d", w.Code)
+	}
+}
+
+// TestGetNthPrime tests the /primes/nth endpoint
+func TestGetNthPrime(t *testing.T) {
+	router := setupRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/primes/nth/5", nil)
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var response map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+	data := response["data"].(map[string]interface{})
+	if data["n"].(float64) != 5 || data["prime"].(float64) != 11 {
+		t.Errorf("Expected the 5th prime to be 11, got %v", data)
+	}
+
+	for _, path := range []string{"/primes/nth/0", "/primes/nth/10001"} {
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", path, w.Code)
+		}
+	}
+}
+
+// TestGetHash tests the hashing endpoint, including algorithm selection and validation
+func TestGetHash(t *testing.T) {
+	router := setupRouter()
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		expectedAlgo   string
+		digestLength   int
+		expectedParam  string
+	}{
+		{"Default algorithm", "/hash/100", http.StatusOK, "sha256", 64, ""},
+		{"sha512", "/hash/100?algo=sha512", http.StatusOK, "sha512", 128, ""},
+		{"Range", "/hash/10..20", http.StatusOK, "sha256", 64, ""},
+		{"Unknown algorithm", "/hash/100?algo=md5", http.StatusBadRequest, "", 0, "algo"},
+		{"Over limit", "/hash/100001", http.StatusBadRequest, "", 0, "n"},
+		{"Invalid", "/hash/abc", http.StatusBadRequest, "", 0, "n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			var response map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse JSON response: %v", err)
+			}
+
+			if tt.expectedStatus != http.StatusOK {
+				if errorFields(response)["param"] != tt.expectedParam {
+					t.Errorf("Expected param %q, got %v", tt.expectedParam, errorFields(response)["param"])
+				}
+				return
+			}
+
+			data := response["data"].(map[string]interface{})
+			if data["algorithm"] != tt.expectedAlgo {
+				t.Errorf("Expected algorithm %s, got %v", tt.expectedAlgo, data["algorithm"])
+			}
+			if digest, _ := data["digest"].(string); len(digest) != tt.digestLength {
+				t.Errorf("Expected digest length %d, got %d", tt.digestLength, len(digest))
+			}
+		})
+	}
+}
+
+// TestGetEncrypt tests the encryption endpoint, including mode selection and validation
+func TestGetEncrypt(t *testing.T) {
+	router := setupRouter()
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		expectedMode   string
+		expectedParam  string
+	}{
+		{"Default mode", "/encrypt/16", http.StatusOK, "gcm", ""},
+		{"CBC mode", "/encrypt/16?mode=cbc", http.StatusOK, "cbc", ""},
+		{"Unknown mode", "/encrypt/16?mode=ecb", http.StatusBadRequest, "", "mode"},
+		{"Over limit", "/encrypt/10001", http.StatusBadRequest, "", "kb"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			var response map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse JSON response: %v", err)
+			}
+
+			if tt.expectedStatus != http.StatusOK {
+				if errorFields(response)["param"] != tt.expectedParam {
+					t.Errorf("Expected param %q, got %v", tt.expectedParam, errorFields(response)["param"])
+				}
+				return
+			}
+
+			data := response["data"].(map[string]interface{})
+			if data["mode"] != tt.expectedMode {
+				t.Errorf("Expected mode %s, got %v", tt.expectedMode, data["mode"])
+			}
+			if data["plaintext_bytes"].(float64) != 16*1024 {
+				t.Errorf("Expected 16384 plaintext bytes, got %v", data["plaintext_bytes"])
+			}
+			if data["throughput_mb_per_sec"].(float64) <= 0 {
+				t.Errorf("Expected positive throughput, got %v", data["throughput_mb_per_sec"])
+			}
+			if _, ok := data["ciphertext"]; ok {
+				t.Error("Expected ciphertext to be omitted from the response")
+			}
+		})
+	}
+}
+
+// TestGetCompress tests the compression endpoint with default and explicit levels
+func TestGetCompress(t *testing.T) {
+	router := setupRouter()
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		expectedLevel  float64
+		expectedParam  string
+	}{
+		{"Default level", "/compress/32", http.StatusOK, -1, ""},
+		{"Explicit level", "/compress/32?level=9", http.StatusOK, 9, ""},
+		{"Level out of range", "/compress/32?level=12", http.StatusBadRequest, 0, "level"},
+		{"Over limit", "/compress/10001", http.StatusBadRequest, 0, "kb"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			var response map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse JSON response: %v", err)
+			}
+
+			if tt.expectedStatus != http.StatusOK {
+				if errorFields(response)["param"] != tt.expectedParam {
+					t.Errorf("Expected param %q, got %v", tt.expectedParam, errorFields(response)["param"])
+				}
+				return
+			}
+
+			data := response["data"].(map[string]interface{})
+			if data["level"].(float64) != tt.expectedLevel {
+				t.Errorf("Expected level %v, got %v", tt.expectedLevel, data["level"])
+			}
+			if ratio, _ := data["compression_ratio"].(float64); ratio <= 0 {
+				t.Errorf("Expected populated compression_ratio, got %v", data["compression_ratio"])
+			}
+		})
+	}
+}
+
+// TestGetHexStream tests that the streamed hex body has the requested length and only hex characters.
+// c.Stream needs a real connection (the recorder has no CloseNotify), so this runs against a test server.
+func TestGetHexStream(t *testing.T) {
+	server := httptest.NewServer(setupRouter())
+	defer server.Close()
+	// Go's client asks for gzip by default, which would drop Content-Length; request identity bytes
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+
+	for _, size := range []int{0, 1, 100, 1000} {
+		t.Run(strconv.Itoa(size)+"KB", func(t *testing.T) {
+			resp, err := client.Get(server.URL + "/hex/stream/" + strconv.Itoa(size))
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+			}
+			if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+				t.Errorf("Expected text/plain Content-Type, got %s", resp.Header.Get("Content-Type"))
+			}
+			if resp.ContentLength != int64(size*1024) {
+				t.Errorf("Expected Content-Length %d, got %d", size*1024, resp.ContentLength)
+			}
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("Failed to read body: %v", err)
+			}
+			if len(body) != size*1024 {
+				t.Fatalf("Expected %d body bytes, got %d", size*1024, len(body))
+			}
+			for i, b := range body {
+				if !strings.ContainsRune("0123456789abcdef", rune(b)) {
+					t.Fatalf("Invalid hex byte %q at offset %d", b, i)
+				}
+			}
+		})
+	}
+
+	resp, err := client.Get(server.URL + "/hex/stream/10001")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for size over the limit, got %d", resp.StatusCode)
+	}
+}
+
+// TestHexContentLength tests that buffered hex responses carry a Content-Length matching the body
+// in every format, instead of falling back to chunked encoding
+func TestHexContentLength(t *testing.T) {
+	server := httptest.NewServer(setupRouter())
+	defer server.Close()
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+
+	for _, tt := range []struct{ name, path, accept string }{
+		{"Indented JSON", "/hex/100", ""},
+		{"Compact JSON", "/hex/100?pretty=0", ""},
+		{"Base64 JSON", "/hex/100?encoding=base64", ""},
+		{"Plain text", "/hex/100", "text/plain"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", server.URL+tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("Failed to read body: %v", err)
+			}
+
+			if len(resp.TransferEncoding) != 0 {
+				t.Errorf("Expected no transfer encoding, got %v", resp.TransferEncoding)
+			}
+			if resp.ContentLength != int64(len(body)) || len(body) < 100*1024 {
+				t.Errorf("Expected Content-Length to match the %d-byte body, got %d", len(body), resp.ContentLength)
+			}
+		})
+	}
+}
+
+// TestChunkedJSON tests that ?chunked=1 streams a valid JSON envelope with chunked transfer
+// encoding, for both plain and combined endpoints and both JSON styles
+func TestChunkedJSON(t *testing.T) {
+	server := httptest.NewServer(setupRouter())
+	defer server.Close()
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+
+	for _, path := range []string{"/hex/100?chunked=1", "/hex/100?chunked=1&pretty=0", "/primes/hex/memory/10/100/1?chunked=true"} {
+		t.Run(path, func(t *testing.T) {
+			resp, err := client.Get(server.URL + path)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("Failed to read body: %v", err)
+			}
+
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d: %s", resp.StatusCode, body)
+			}
+			if !slices.Equal(resp.TransferEncoding, []string{"chunked"}) || resp.ContentLength != -1 {
+				t.Errorf("Expected chunked encoding without Content-Length, got %v and %d", resp.TransferEncoding, resp.ContentLength)
+			}
+			if contentType := resp.Header.Get("Content-Type"); contentType != "application/json; charset=utf-8" {
+				t.Errorf("Expected JSON content type, got %q", contentType)
+			}
+			var response struct {
+				Data           map[string]interface{} `json:"data"`
+				RequestMetrics *RequestMetrics        `json:"request_metrics"`
+			}
+			if err := json.Unmarshal(body, &response); err != nil {
+				t.Fatalf("Failed to decode chunked response: %v", err)
+			}
+			if len(response.Data) == 0 || response.RequestMetrics == nil {
+				t.Errorf("Expected data and request_metrics, got %s", body)
+			}
+		})
+	}
+}
+
+// TestHexBase64Encoding tests that ?encoding=base64 returns valid base64 of exactly h KB of random
+// bytes on both /hex and /hex/stream, and that unknown encodings are rejected
+func TestHexBase64Encoding(t *testing.T) {
+	router := setupRouter()
+	server := httptest.NewServer(router)
+	defer server.Close()
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+
+	for _, size := range []int{0, 1, 3, 100} {
+		t.Run(strconv.Itoa(size)+"KB", func(t *testing.T) {
+			encodedLen := base64.StdEncoding.EncodedLen(size * 1024)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", fmt.Sprintf("/hex/%d?encoding=base64", size), nil)
+			router.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", w.Code)
+			}
+			result := decodeStrict[Response[HexResult]](t, w.Body.Bytes()).Data
+			if result.Encoding != "base64" || result.Length != encodedLen || len(result.HexString) != encodedLen {
+				t.Errorf("Expected base64 of length %d, got encoding %q, length %d (%d)", encodedLen, result.Encoding, result.Length, len(result.HexString))
+			}
+			decoded, err := base64.StdEncoding.DecodeString(result.HexString)
+			if err != nil || len(decoded) != size*1024 {
+				t.Errorf("Expected %d decoded bytes, got %d (%v)", size*1024, len(decoded), err)
+			}
+
+			resp, err := client.Get(fmt.Sprintf("%s/hex/stream/%d?encoding=base64", server.URL, size))
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("Failed to read body: %v", err)
+			}
+			if resp.ContentLength != int64(encodedLen) || len(body) != encodedLen {
+				t.Errorf("Expected %d streamed bytes, got Content-Length %d and %d bytes", encodedLen, resp.ContentLength, len(body))
+			}
+			decoded, err = base64.StdEncoding.DecodeString(string(body))
+			if err != nil || len(decoded) != size*1024 {
+				t.Errorf("Expected %d decoded streamed bytes, got %d (%v)", size*1024, len(decoded), err)
+			}
+		})
+	}
+
+	for _, path := range []string{"/hex/1?encoding=base32", "/hex/stream/1?encoding=base32"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", path, w.Code)
+		}
+	}
+}
+
+// TestWebSocket tests that /ws answers JSON commands with results over one connection
+func TestWebSocket(t *testing.T) {
+	server := httptest.NewServer(setupRouter())
+	defer server.Close()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", "", server.URL)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer ws.Close()
+
+	type reply struct {
+		Op         string          `json:"op"`
+		Value      string          `json:"value"`
+		DurationMs float64         `json:"duration_ms"`
+		Result     json.RawMessage `json:"result"`
+		Error      *ErrorDetail    `json:"error"`
+	}
+	send := func(message string) reply {
+		t.Helper()
+		if _, err := ws.Write([]byte(message)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		var r reply
+		if err := websocket.JSON.Receive(ws, &r); err != nil {
+			t.Fatalf("Receive failed: %v", err)
+		}
+		return r
+	}
+
+	r := send(`{"op":"primes","value":"10"}`)
+	if r.Op != "primes" || r.Value != "10" || r.Error != nil {
+		t.Fatalf("Expected a primes result, got %+v", r)
+	}
+	var primes PrimeResult
+	if err := json.Unmarshal(r.Result, &primes); err != nil {
+		t.Fatalf("Failed to parse result: %v", err)
+	}
+	if primes.Count != 10 || primes.LastPrime != 29 {
+		t.Errorf("Expected 10 primes ending in 29, got %d ending in %d", primes.Count, primes.LastPrime)
+	}
+
+	// Errors are answered in-band and the session keeps going
+	if r := send(`{"op":"nope","value":"1"}`); r.Error == nil || r.Error.Param != "op" || r.Error.Code != CodeUnsupportedValue {
+		t.Errorf("Expected an unsupported op error, got %+v", r)
+	}
+	if r := send(`{"op":"primes","value":"10001"}`); r.Error == nil || r.Error.Code != CodeOutOfRange {
+		t.Errorf("Expected an out of range error, got %+v", r)
+	}
+	if r := send(`not json`); r.Error == nil || r.Error.Param != "body" {
+		t.Errorf("Expected a body error, got %+v", r)
+	}
+	if r := send(`{"op":"hex","value":"1"}`); r.Error != nil || len(r.Result) == 0 {
+		t.Errorf("Expected a hex result after the errors, got %+v", r)
+	}
+}
+
+// TestGetDrip tests that /drip trickles the requested bytes over roughly the requested duration
+func TestGetDrip(t *testing.T) {
+	server := httptest.NewServer(setupRouter())
+	defer server.Close()
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+
+	start := time.Now()
+	resp, err := client.Get(server.URL + "/drip?bytes=5000&duration=500ms")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if resp.ContentLength != 5000 {
+		t.Errorf("Expected Content-Length 5000, got %d", resp.ContentLength)
+	}
+	if waited := time.Since(start); waited > 250*time.Millisecond {
+		t.Errorf("Expected headers before the drip, waited %s", waited)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read body: %v", err)
+	}
+	elapsed := time.Since(start)
+	if len(body) != 5000 {
+		t.Fatalf("Expected 5000 body bytes, got %d", len(body))
+	}
+	for i, b := range body {
+		if !strings.ContainsRune("0123456789abcdef", rune(b)) {
+			t.Fatalf("Invalid hex byte %q at offset %d", b, i)
+		}
+	}
+	if elapsed < 500*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("Expected the drip to take about 500ms, took %s", elapsed)
+	}
+
+	for _, query := range []string{"bytes=-1", "bytes=10485761", "duration=61s", "duration=soon"} {
+		resp, err := client.Get(server.URL + "/drip?" + query)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", query, resp.StatusCode)
+		}
+	}
+}
+
+// TestGetDripCanceled tests that a client disconnect stops the drip early
+func TestGetDripCanceled(t *testing.T) {
+	server := httptest.NewServer(setupRouter())
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/drip?bytes=100&duration=10s", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	time.AfterFunc(300*time.Millisecond, cancel)
+
+	start := time.Now()
+	body, err := io.ReadAll(resp.Body)
+	if err == nil {
+		t.Fatalf("Expected the read to fail after cancellation, got %d bytes", len(body))
+	}
+	if len(body) >= 100 || time.Since(start) > 2*time.Second {
+		t.Errorf("Expected a short partial body soon after cancel, got %d bytes after %s", len(body), time.Since(start))
+	}
+}
+
+// TestSortAlgorithms tests each sort implementation against edge-case inputs
+func TestSortAlgorithms(t *testing.T) {
+	inputs := map[string][]int{
+		"empty":      {},
+		"single":     {42},
+		"sorted":     {1, 2, 3, 4, 5, 6, 7, 8},
+		"reversed":   {9, 8, 7, 6, 5, 4, 3, 2, 1},
+		"duplicates": {3, 1, 3, 3, 2, 1, 2, 3, 1},
+		"negative":   {0, -5, 12, -1, 7, -5, 3},
+		"odd length": {5, 2, 9, 1, 7},
+	}
+
+	for _, algo := range sortAlgorithmNames() {
+		for name, input := range inputs {
+			t.Run(algo+"/"+name, func(t *testing.T) {
+				data := append([]int(nil), input...)
+				expected := append([]int(nil), input...)
+				sort.Ints(expected)
+
+				sortAlgorithms[algo](data)
+				for i := range expected {
+					if data[i] != expected[i] {
+						t.Fatalf("Expected %v, got %v", expected, data)
+					}
+				}
+			})
+		}
+	}
+}
+
+// TestSortData tests that generated data is sorted and n is respected
+func TestSortData(t *testing.T) {
+	tests := []struct {
+		name        string
+		param       string
+		algo        string
+		reverse     bool
+		expectError bool
+		minCount    int
+		maxCount    int
+	}{
+		{"std", "10000", "std", false, false, 10000, 10000},
+		{"quick", "10000", "quick", false, false, 10000, 10000},
+		{"merge", "10001", "merge", false, false, 10001, 10001},
+		{"heap", "9999", "heap", false, false, 9999, 9999},
+		{"quick reversed", "10000", "quick", true, false, 10000, 10000},
+		{"merge reversed", "10000", "merge", true, false, 10000, 10000},
+		{"range", "100..200", "std", false, false, 100, 200},
+		{"zero", "0", "heap", false, false, 0, 0},
+		{"over limit", "1000001", "std", false, true, 0, 0},
+		{"unknown algorithm", "10", "bogo", false, true, 0, 0},
+		{"invalid", "lots", "std", false, true, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := sortData(context.Background(), tt.param, tt.algo, tt.reverse, MaxSortN)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error for %q with %s", tt.param, tt.algo)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result.Count < tt.minCount || result.Count > tt.maxCount {
+				t.Errorf("Expected count between %d and %d, got %d", tt.minCount, tt.maxCount, result.Count)
+			}
+			if !result.Sorted {
+				t.Error("Expected the output to be sorted")
+			}
+			if result.Algorithm != tt.algo || result.Reversed != tt.reverse {
+				t.Errorf("Expected algorithm %s reversed=%v, got %+v", tt.algo, tt.reverse, result)
+			}
+			if result.SortDurationUs > result.DurationUs {
+				t.Errorf("Expected sort time within total time, got %+v", result)
+			}
+		})
+	}
+}
+
+// TestGetSort tests the /sort endpoint and its query parameters
+func TestGetSort(t *testing.T) {
+	router := setupRouterWithLimits(func() loadLimits {
+		limits := defaultLoadLimits()
+		limits.SortN = 5000
+		return limits
+	}())
+
+	tests := []struct {
+		url            string
+		expectedStatus int
+		errorParam     string
+	}{
+		{"/sort/1000", http.StatusOK, ""},
+		{"/sort/1000?algo=heap&reverse=1", http.StatusOK, ""},
+		{"/sort/100..500?algo=merge", http.StatusOK, ""},
+		{"/sort/5001", http.StatusBadRequest, "n"},
+		{"/sort/100?algo=bubble", http.StatusBadRequest, "algo"},
+		{"/sort/100?reverse=maybe", http.StatusBadRequest, "reverse"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			var response map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if tt.errorParam != "" {
+				if errorFields(response)["param"] != tt.errorParam {
+					t.Errorf("Expected error for %q, got %v", tt.errorParam, errorFields(response)["param"])
+				}
+				return
+			}
+			data := response["data"].(map[string]interface{})
+			if data["sorted"] != true {
+				t.Errorf("Expected sorted output, got %v", data)
+			}
+		})
+	}
+}
+
+// TestMultiplyMatrices tests matrix multiplication sizing, FLOP counting, and throughput reporting
+func TestMultiplyMatrices(t *testing.T) {
+	tests := []struct {
+		name        string
+		param       string
+		expectError bool
+		minDim      int
+		maxDim      int
+	}{
+		{"small", "64", false, 64, 64},
+		{"one", "1", false, 1, 1},
+		{"range", "16..32", false, 16, 32},
+		{"zero", "0", false, 0, 0},
+		{"over limit", "1025", true, 0, 0},
+		{"invalid", "big", true, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := multiplyMatrices(context.Background(), tt.param, MaxMatmulDim)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error for %q", tt.param)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result.Dim < tt.minDim || result.Dim > tt.maxDim {
+				t.Errorf("Expected dim between %d and %d, got %d", tt.minDim, tt.maxDim, result.Dim)
+			}
+			if result.RowsComputed != result.Dim {
+				t.Errorf("Expected all %d rows computed, got %d", result.Dim, result.RowsComputed)
+			}
+			dim := int64(result.Dim)
+			if result.FLOPs != 2*dim*dim*dim {
+				t.Errorf("Expected %d FLOPs, got %d", 2*dim*dim*dim, result.FLOPs)
+			}
+			if result.Dim >= 64 && result.GFLOPS <= 0 {
+				t.Errorf("Expected positive GFLOPS, got %f", result.GFLOPS)
+			}
+			// Entries of a and b are in [0, 1), so each product entry is in [0, dim)
+			if result.Checksum < 0 || (dim > 0 && result.Checksum >= float64(dim*dim*dim)) {
+				t.Errorf("Checksum %f out of range for dim %d", result.Checksum, dim)
+			}
+		})
+	}
+}
+
+// TestGetMatmul tests the /matmul endpoint
+func TestGetMatmul(t *testing.T) {
+	router := setupRouterWithLimits(func() loadLimits {
+		limits := defaultLoadLimits()
+		limits.MatmulDim = 128
+		return limits
+	}())
+
+	tests := []struct {
+		url            string
+		expectedStatus int
+	}{
+		{"/matmul/32", http.StatusOK},
+		{"/matmul/16..64", http.StatusOK},
+		{"/matmul/129", http.StatusBadRequest},
+		{"/matmul/abc", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			var response map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				if errorFields(response)["param"] != "dim" || errorFields(response)["limit"] != "128" {
+					t.Errorf("Expected a dim error with limit 128, got %v", response)
+				}
+				return
+			}
+			data := response["data"].(map[string]interface{})
+			if data["dim"].(float64) != data["rows_computed"].(float64) {
+				t.Errorf("Expected every row computed, got %v", data)
+			}
+		})
+	}
+}
+
+// TestWriteDiskFile tests disk writes: the full size is written and synced, throughput is
+// reported, and the temp file is always removed
+func TestWriteDiskFile(t *testing.T) {
+	tests := []struct {
+		name        string
+		param       string
+		expectError bool
+		minKB       int
+		maxKB       int
+	}{
+		{"small", "256", false, 256, 256},
+		{"partial chunk", "100", false, 100, 100},
+		{"range", "10..20", false, 10, 20},
+		{"zero", "0", false, 0, 0},
+		{"over limit", "1025", true, 0, 0},
+		{"invalid", "disk", true, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			result, err := writeDiskFile(context.Background(), dir, tt.param, 1024)
+
+			entries, readErr := os.ReadDir(dir)
+			if readErr != nil {
+				t.Fatalf("Failed to read temp dir: %v", readErr)
+			}
+			if len(entries) != 0 {
+				t.Errorf("Expected the temp file to be removed, found %d entries", len(entries))
+			}
+
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error for %q", tt.param)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result.SizeKB < tt.minKB || result.SizeKB > tt.maxKB {
+				t.Errorf("Expected size between %d and %d KB, got %d", tt.minKB, tt.maxKB, result.SizeKB)
+			}
+			if result.BytesWritten != int64(result.SizeKB)*1024 {
+				t.Errorf("Expected %d bytes written, got %d", result.SizeKB*1024, result.BytesWritten)
+			}
+			if result.SizeKB > 0 && result.ThroughputMBps <= 0 {
+				t.Errorf("Expected positive throughput, got %f", result.ThroughputMBps)
+			}
+		})
+	}
+
+	t.Run("missing dir", func(t *testing.T) {
+		_, err := writeDiskFile(context.Background(), filepath.Join(t.TempDir(), "missing"), "1", 1024)
+		var pathErr *fs.PathError
+		if !errors.As(err, &pathErr) {
+			t.Errorf("Expected a filesystem error, got %v", err)
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		dir := t.TempDir()
+		result, err := writeDiskFile(ctx, dir, "1024", 1024)
+		if !errors.Is(err, context.Canceled) || result.BytesWritten != 0 {
+			t.Errorf("Expected context.Canceled with nothing written, got %+v, %v", result, err)
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Errorf("Expected the temp file to be removed, found %d entries", len(entries))
+		}
+	})
+}
+
+// TestDiskWriteEndpoint tests that /disk/write is only registered when enabled and writes to the
+// configured directory
+func TestDiskWriteEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		enabled        bool
+		tmpDir         string
+		url            string
+		expectedStatus int
+	}{
+		{"disabled", false, "", "/disk/write/16", http.StatusNotFound},
+		{"enabled", true, t.TempDir(), "/disk/write/16", http.StatusOK},
+		{"over limit", true, t.TempDir(), "/disk/write/100001", http.StatusBadRequest},
+		{"missing dir", true, filepath.Join(t.TempDir(), "missing"), "/disk/write/16", http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newAPIServer(defaultLoadLimits())
+			server.diskEndpoints = tt.enabled
+			server.tmpDir = tt.tmpDir
+			router := gin.New()
+			server.registerRoutes(router)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var response map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			data := response["data"].(map[string]interface{})
+			if data["bytes_written"].(float64) != 16*1024 {
+				t.Errorf("Expected 16 KB written, got %v", data["bytes_written"])
+			}
+			if entries, _ := os.ReadDir(tt.tmpDir); len(entries) != 0 {
+				t.Errorf("Expected the temp file to be removed, found %d entries", len(entries))
+			}
+		})
+	}
+}
+
+// TestDiskReadFile tests reads from the backing file: sizes beyond the file wrap around, every
+// read reports positive throughput, and close removes the file
+func TestDiskReadFile(t *testing.T) {
+	dir := t.TempDir()
+	readFile, err := newDiskReadFile(dir, 64)
+	if err != nil {
+		t.Fatalf("Failed to create backing file: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		param       string
+		expectError bool
+		wraps       int
+	}{
+		{"within file", "16", false, 0},
+		{"whole file", "64", false, 0},
+		{"wraps once", "100", false, 1},
+		{"wraps several times", "320", false, 4},
+		{"over limit", "1025", true, 0},
+		{"invalid", "disk", true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := readFile.read(context.Background(), tt.param, 1024)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error for %q", tt.param)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result.BytesRead != int64(result.SizeKB)*1024 {
+				t.Errorf("Expected %d bytes read, got %d", result.SizeKB*1024, result.BytesRead)
+			}
+			if result.FileBytes != 64*1024 || result.Wraps != tt.wraps {
+				t.Errorf("Expected a 64 KB file with %d wraps, got %+v", tt.wraps, result)
+			}
+			if result.ThroughputMBps <= 0 {
+				t.Errorf("Expected positive throughput, got %f", result.ThroughputMBps)
+			}
+		})
+	}
+
+	if err := readFile.close(); err != nil {
+		t.Fatalf("Failed to close backing file: %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected the backing file to be removed, found %d entries", len(entries))
+	}
+	if _, err := newDiskReadFile(dir, 0); err == nil {
+		t.Error("Expected an error for an empty backing file")
+	}
+}
+
+// TestDiskReadEndpoint tests that /disk/read is served from the backing file when disk endpoints are enabled
+func TestDiskReadEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	readFile, err := newDiskReadFile(t.TempDir(), 32)
+	if err != nil {
+		t.Fatalf("Failed to create backing file: %v", err)
+	}
+	defer readFile.close()
+
+	for _, enabled := range []bool{true, false} {
+		server := newAPIServer(defaultLoadLimits())
+		server.diskEndpoints = enabled
+		server.diskReadFile = readFile
+		router := gin.New()
+		server.registerRoutes(router)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/disk/read/48", nil)
+		router.ServeHTTP(w, req)
+
+		if !enabled {
+			if w.Code != http.StatusNotFound {
+				t.Errorf("Expected status 404 when disabled, got %d", w.Code)
+			}
+			continue
+		}
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var response map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		data := response["data"].(map[string]interface{})
+		if data["bytes_read"].(float64) != 48*1024 || data["wraps"].(float64) != 1 {
+			t.Errorf("Expected 48 KB read with one wrap, got %v", data)
+		}
+	}
+}
+
+// TestParseFetchAllowlist tests parsing of APEX_FETCH_ALLOWLIST and host matching
+func TestParseFetchAllowlist(t *testing.T) {
+	server := newAPIServer(defaultLoadLimits())
+	server.fetchAllowlist = parseFetchAllowlist(" Example.com, ,127.0.0.1:8080 ")
+	if len(server.fetchAllowlist) != 2 {
+		t.Fatalf("Expected 2 entries, got %v", server.fetchAllowlist)
+	}
+
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"http://example.com/data", true},
+		{"https://EXAMPLE.com:8443/data", true},
+		{"http://127.0.0.1:8080/", true},
+		{"http://127.0.0.1:9090/", false},
+		{"http://example.org/", false},
+		{"ftp://example.com/", false},
+		{"file:///etc/passwd", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatalf("Failed to parse URL: %v", err)
+			}
+			if err := server.checkFetchURL(u); (err == nil) != tt.allowed {
+				t.Errorf("Expected allowed=%v, got %v", tt.allowed, err)
+			}
+		})
+	}
+}
+
+// TestGetFetch tests /fetch against an httptest server: byte limits, the allowlist (including
+// redirects), and upstream failures
+func TestGetFetch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	payload := strings.Repeat("x", 64*1024)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/redirect":
+			http.Redirect(w, r, "http://example.invalid/", http.StatusFound)
+		case "/missing":
+			http.NotFound(w, r)
+		default:
+			io.WriteString(w, payload)
+		}
+	}))
+	defer upstream.Close()
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closedURL := closed.URL
+	closed.Close()
+
+	server := newAPIServer(defaultLoadLimits())
+	server.fetchAllowlist = []string{"127.0.0.1"}
+	router := gin.New()
+	server.registerRoutes(router)
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		bytesRead      float64
+		upstreamStatus float64
+	}{
+		{"limited read", "url=" + upstream.URL + "/data&bytes=1000", http.StatusOK, 1000, 200},
+		{"whole body", "url=" + upstream.URL + "/data&bytes=1000000", http.StatusOK, 64 * 1024, 200},
+		{"default limit", "url=" + upstream.URL + "/data", http.StatusOK, 64 * 1024, 200},
+		{"upstream status reported", "url=" + upstream.URL + "/missing&bytes=1000", http.StatusOK, 19, 404},
+		{"host not allowed", "url=http://example.com/&bytes=10", http.StatusForbidden, 0, 0},
+		{"redirect not allowed", "url=" + upstream.URL + "/redirect&bytes=10", http.StatusForbidden, 0, 0},
+		{"missing url", "bytes=10", http.StatusBadRequest, 0, 0},
+		{"bad scheme", "url=file:///etc/passwd", http.StatusBadRequest, 0, 0},
+		{"bytes over limit", "url=" + upstream.URL + "&bytes=104857601", http.StatusBadRequest, 0, 0},
+		{"upstream down", "url=" + closedURL + "&bytes=10", http.StatusBadGateway, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/fetch?"+tt.query, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			var response map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			data := response["data"].(map[string]interface{})
+			if data["bytes_read"] != tt.bytesRead || data["status_code"] != tt.upstreamStatus {
+				t.Errorf("Expected %v bytes with status %v, got %v", tt.bytesRead, tt.upstreamStatus, data)
+			}
+			if data["throughput_mb_per_sec"].(float64) <= 0 {
+				t.Errorf("Expected positive throughput, got %v", data["throughput_mb_per_sec"])
+			}
+		})
+	}
+}
+
+// TestPostEcho tests that /echo reports the body's size and SHA-256, echoes it back on request,
+// and rejects bodies over the limit with 413
+func TestPostEcho(t *testing.T) {
+	limits := defaultLoadLimits()
+	limits.EchoBytes = 200 * 1024
+	router := setupRouterWithLimits(limits)
+
+	body := make([]byte, 150*1024)
+	rand.New(rand.NewSource(1)).Read(body)
+	digest := sha256.Sum256(body)
+
+	post := func(path string, payload []byte) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/x-test")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("/echo", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var response Response[EchoResult]
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+	if response.Data.BytesRead != int64(len(body)) || response.Data.MaxBytes != limits.EchoBytes {
+		t.Errorf("Expected %d of %d bytes read, got %+v", len(body), limits.EchoBytes, response.Data)
+	}
+	if response.Data.SHA256 != hex.EncodeToString(digest[:]) {
+		t.Errorf("Expected digest %x, got %s", digest, response.Data.SHA256)
+	}
+
+	w = post("/echo?echo=1", body)
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), body) {
+		t.Errorf("Expected the body echoed back, got status %d and %d bytes", w.Code, w.Body.Len())
+	}
+	if w.Header().Get("Content-Type") != "application/x-test" || w.Header().Get("Content-Length") != strconv.Itoa(len(body)) {
+		t.Errorf("Expected the request's Content-Type and length, got %q and %q", w.Header().Get("Content-Type"), w.Header().Get("Content-Length"))
+	}
+
+	w = post("/echo", nil)
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || response.Data.BytesRead != 0 {
+		t.Errorf("Expected an empty body to report 0 bytes, got %s", w.Body.String())
+	}
+
+	w = post("/echo", make([]byte, limits.EchoBytes+1))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected status 413, got %d", w.Code)
+	}
+	var errResponse ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &errResponse); err != nil {
+		t.Fatalf("Failed to parse error response: %v", err)
+	}
+	if errResponse.Error.Code != CodeBodyTooLarge || errResponse.Error.Limit != strconv.Itoa(limits.EchoBytes) {
+		t.Errorf("Expected body_too_large with the limit, got %+v", errResponse.Error)
+	}
+
+	if w = post("/echo?echo=maybe", body); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid echo flag, got %d", w.Code)
+	}
+}
+
+// TestFillHex tests that every length, including odd ones and partial blocks, is filled exactly with lowercase hex
+func TestFillHex(t *testing.T) {
+	for _, size := range []int{0, 1, 2, 3, 2*hexRandBlock - 1, 2 * hexRandBlock, 2*hexRandBlock + 1, 64*1024 + 3} {
+		buf := make([]byte, size+1)
+		buf[size] = '!'
+		filled, err := fillHex(context.Background(), buf[:size])
+		if err != nil || filled != size {
+			t.Errorf("fillHex(%d): expected %d bytes filled, got %d (%v)", size, size, filled, err)
+		}
+		if strings.Trim(string(buf[:size]), "0123456789abcdef") != "" {
+			t.Errorf("fillHex(%d): output is not lowercase hex", size)
+		}
+		if buf[size] != '!' {
+			t.Errorf("fillHex(%d): wrote past the end of the buffer", size)
+		}
+	}
+}
+
+// TestCreateHexStringAllocs tests that pooled scratch buffers leave the result string (and range
+// parsing) as the only allocations, and that a reused buffer still yields exactly n KB of hex
+func TestCreateHexStringAllocs(t *testing.T) {
+	ctx := context.Background()
+	for _, param := range []string{"64", "8", "64", "1"} {
+		result, err := createHexString(ctx, param, MaxHexKB)
+		if err != nil {
+			t.Fatalf("createHexString(%s): %v", param, err)
+		}
+		kb, _ := strconv.Atoi(param)
+		if len(result.HexString) != kb*1024 || result.Length != kb*1024 {
+			t.Errorf("createHexString(%s): expected length %d, got %d (Length %d)", param, kb*1024, len(result.HexString), result.Length)
+		}
+		if strings.Trim(result.HexString, "0123456789abcdef") != "" {
+			t.Errorf("createHexString(%s): output is not lowercase hex", param)
+		}
+	}
+
+	if raceEnabled {
+		t.Skip("sync.Pool drops items under the race detector, so pooled buffers aren't reused reliably")
+	}
+	allocs := testing.AllocsPerRun(20, func() {
+		createHexString(ctx, "64", MaxHexKB)
+	})
+	if allocs > 2 {
+		t.Errorf("Expected at most 2 allocations per createHexString, got %v", allocs)
+	}
+}
+
+// TestHexBufferClass tests rounding buffer sizes up to power-of-two pool classes
+func TestHexBufferClass(t *testing.T) {
+	tests := []struct {
+		size, class int
+	}{
+		{0, 0},
+		{1024, 0},
+		{1025, 1},
+		{2048, 1},
+		{HexStreamChunkSize, 5},
+		{10000 * 1024, 14},
+		{16 << 20, 14},
+		{16<<20 + 1, -1},
+	}
+	for _, tt := range tests {
+		if got := hexBufferClass(tt.size); got != tt.class {
+			t.Errorf("hexBufferClass(%d) = %d, expected %d", tt.size, got, tt.class)
+		}
+	}
+}
+
+// TestGetHexString tests the hex string generation endpoint
+func TestGetHexString(t *testing.T) {
+	router := setupRouter()
+
+	tests := []struct {
+		name           string
+		param          string
+		expectedStatus int
+		expectError    bool
+	}{
+		{
+			name:           "Valid hex generation",
+			param:          "1",
+			expectedStatus: http.StatusOK,
+			expectError:    false,
+		},
+		{
+			name:           "Valid hex range",
+			param:          "1..3",
+			expectedStatus: http.StatusOK,
+			expectError:    false,
+		},
+		{
+			name:           "Invalid parameter",
+			param:          "invalid",
+			expectedStatus: http.StatusBadRequest,
+			expectError:    true,
+		},
+		{
+			name:           "Exceeds maximum",
+			param:          "50000",
+			expectedStatus: http.StatusBadRequest,
+			expectError:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/hex/"+tt.param, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if !tt.expectError {
+				var response map[string]interface{}
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				if err != nil {
+					t.Errorf("Failed to parse JSON response: %v", err)
+				}
+
+				if _, ok := response["data"]; !ok {
+					t.Error("Expected 'data' field in response")
+				}
+				if _, ok := response["request_metrics"]; !ok {
+					t.Error("Expected 'request_metrics' field in response")
+				}
+			}
+		})
+	}
+}
+
+// TestGetFibonacciHex tests the combined Fibonacci + hex endpoint
+func TestGetFibonacciHex(t *testing.T) {
+	router := setupRouter()
+
+	tests := []struct {
+		name           string
+		fibParam       string
+		hexParam       string
+		expectedStatus int
+		expectError    bool
+	}{
+		{
+			name:           "Valid combined operation",
+			fibParam:       "5",
+			hexParam:       "1",
+			expectedStatus: http.StatusOK,
+			expectError:    false,
+		},
+		{
+			name:           "Valid with ranges",
+			fibParam:       "3..7",
+			hexParam:       "1..3",
+			expectedStatus: http.StatusOK,
+			expectError:    false,
+		},
+		{
+			name:           "Invalid fibonacci parameter",
+			fibParam:       "invalid",
+			hexParam:       "1",
+			expectedStatus: http.StatusBadRequest,
+			expectError:    true,
+		},
+		{
+			name:           "Invalid hex parameter",
+			fibParam:       "5",
+			hexParam:       "invalid",
+			expectedStatus: http.StatusBadRequest,
+			expectError:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/fibonacci/hex/"+tt.fibParam+"/"+tt.hexParam, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if !tt.expectError {
+				var response map[string]interface{}
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				if err != nil {
+					t.Errorf("Failed to parse JSON response: %v", err)
+				}
+
+				data, ok := response["data"].(map[string]interface{})
+				if !ok {
+					t.Error("Expected 'data' field to be an object")
+				}
+
+				if _, ok := data["fibonacci_result"]; !ok {
+					t.Error("Expected 'fibonacci_result' in data")
+				}
+				if _, ok := data["hex_result"]; !ok {
+					t.Error("Expected 'hex_result' in data")
+				}
+			}
+		})
+	}
+}
+
+// TestGetPrimesHex tests the combined primes + hex endpoint
+func TestGetPrimesHex(t *testing.T) {
+	router := setupRouter()
+
+	tests := []struct {
+		name           string
+		primeParam     string
+		hexParam       string
+		expectedStatus int
+		expectError    bool
+	}{
+		{
+			name:           "Valid combined operation",
+			primeParam:     "5",
+			hexParam:       "1",
+			expectedStatus: http.StatusOK,
+			expectError:    false,
+		},
+		{
+			name:           "Valid with ranges",
+			primeParam:     "3..7",
+			hexParam:       "1..3",
+			expectedStatus: http.StatusOK,
+			expectError:    false,
+		},
+		{
+			name:           "Invalid prime parameter",
+			primeParam:     "invalid",
+			hexParam:       "1",
+			expectedStatus: http.StatusBadRequest,
+			expectError:    true,
+		},
+		{
+			name:           "Invalid hex parameter",
+			primeParam:     "5",
+			hexParam:       "invalid",
+			expectedStatus: http.StatusBadRequest,
+			expectError:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/primes/hex/"+tt.primeParam+"/"+tt.hexParam, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if !tt.expectError {
+				var response map[string]interface{}
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				if err != nil {
+					t.Errorf("Failed to parse JSON response: %v", err)
+				}
+
+				data, ok := response["data"].(map[string]interface{})
+				if !ok {
+					t.Error("Expected 'data' field to be an object")
+				}
+
+				if _, ok := data["prime_result"]; !ok {
+					t.Error("Expected 'prime_result' in data")
+				}
+				if _, ok := data["hex_result"]; !ok {
+					t.Error("Expected 'hex_result' in data")
+				}
+			}
+		})
+	}
+}
+
+// TestFibonacciHexMemory tests the triple combined endpoint
+func TestFibonacciHexMemory(t *testing.T) {
+	router := setupRouter()
+
+	tests := []struct {
+		name           string
+		fibParam       string
+		hexParam       string
+		memParam       string
+		expectedStatus int
+		expectError    bool
+	}{
+		{
+			name:           "Valid triple operation",
+			fibParam:       "5",
+			hexParam:       "1",
+			memParam:       "10",
+			expectedStatus: http.StatusOK,
+			expectError:    false,
+		},
+		{
+			name:           "Valid with ranges",
+			fibParam:       "3..7",
+			hexParam:       "1..3",
+			memParam:       "5..15",
+			expectedStatus: http.StatusOK,
+			expectError:    false,
+		},
+		{
+			name:           "Invalid fibonacci parameter",
+			fibParam:       "invalid",
+			hexParam:       "1",
+			memParam:       "10",
+			expectedStatus: http.StatusBadRequest,
+			expectError:    true,
+		},
+		{
+			name:           "Invalid memory parameter",
+			fibParam:       "5",
+			hexParam:       "1",
+			memParam:       "invalid",
+			expectedStatus: http.StatusBadRequest,
+			expectError:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/fibonacci/hex/memory/"+tt.fibParam+"/"+tt.hexParam+"/"+tt.memParam, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if !tt.expectError {
+				var response map[string]interface{}
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				if err != nil {
+					t.Errorf("Failed to parse JSON response: %v", err)
+				}
+
+				data, ok := response["data"].(map[string]interface{})
+				if !ok {
+					t.Error("Expected 'data' field to be an object")
+				}
+
+				if _, ok := data["fibonacci_result"]; !ok {
+					t.Error("Expected 'fibonacci_result' in data")
+				}
+				if _, ok := data["hex_result"]; !ok {
+					t.Error("Expected 'hex_result' in data")
+				}
+				if _, ok := data["memory_result"]; !ok {
+					t.Error("Expected 'memory_result' in data")
+				}
+			}
+		})
+	}
+}
+
+// TestPrimesHexMemory tests the triple combined endpoint with primes
+func TestPrimesHexMemory(t *testing.T) {
+	router := setupRouter()
+
+	tests := []struct {
+		name           string
+		primeParam     string
+		hexParam       string
+		memParam       string
+		expectedStatus int
+		expectError    bool
+	}{
+		{
+			name:           "Valid triple operation",
+			primeParam:     "5",
+			hexParam:       "1",
+			memParam:       "10",
+			expectedStatus: http.StatusOK,
+			expectError:    false,
+		},
+		{
+			name:           "Valid with ranges",
+			primeParam:     "3..7",
+			hexParam:       "1..3",
+			memParam:       "5..15",
+			expectedStatus: http.StatusOK,
+			expectError:    false,
+		},
+		{
+			name:           "Invalid prime parameter",
+			primeParam:     "invalid",
+			hexParam:       "1",
+			memParam:       "10",
+			expectedStatus: http.StatusBadRequest,
+			expectError:    true,
+		},
+		{
+			name:           "Invalid memory parameter",
+			primeParam:     "5",
+			hexParam:       "1",
+			memParam:       "invalid",
+			expectedStatus: http.StatusBadRequest,
+			expectError:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/primes/hex/memory/"+tt.primeParam+"/"+tt.hexParam+"/"+tt.memParam, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if !tt.expectError {
+				var response map[string]interface{}
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				if err != nil {
+					t.Errorf("Failed to parse JSON response: %v", err)
+				}
+
+				data, ok := response["data"].(map[string]interface{})
+				if !ok {
+					t.Error("Expected 'data' field to be an object")
+				}
+
+				if _, ok := data["prime_result"]; !ok {
+					t.Error("Expected 'prime_result' in data")
+				}
+				if _, ok := data["hex_result"]; !ok {
+					t.Error("Expected 'hex_result' in data")
+				}
+				if _, ok := data["memory_result"]; !ok {
+					t.Error("Expected 'memory_result' in data")
+				}
+			}
+		})
+	}
+}
+
+// TestPrimesHexMemoryBudget tests that ?budget= on /primes/hex/memory always completes the primes
+// stage, skips the stages a spent budget leaves no time for, and runs everything with room to spare
+func TestPrimesHexMemoryBudget(t *testing.T) {
+	router := setupRouter()
+
+	tests := []struct {
+		query   string
+		budget  string
+		skipped []string
+	}{
+		{"?budget=1ns", "1ns", []string{"hex", "memory"}},
+		{"?budget=0s", "0s", []string{"hex", "memory"}},
+		{"?budget=30s", "30s", nil},
+		{"", "", nil},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/primes/hex/memory/1000/100/1024"+tt.query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%q: expected status 200, got %d: %s", tt.query, w.Code, w.Body.String())
+		}
+		response := decodeStrict[CombinedResponse[PrimeHexMemoryResult]](t, w.Body.Bytes())
+		result := response.Data
+		if result.PrimeResult.Count != 1000 || result.PrimeResult.LastPrime != 7919 {
+			t.Errorf("%q: expected the primes stage to complete, got %+v", tt.query, result.PrimeResult)
+		}
+		if result.Budget != tt.budget || !slices.Equal(result.Skipped, tt.skipped) {
+			t.Errorf("%q: expected budget %q and skipped %v, got %q and %v", tt.query, tt.budget, tt.skipped, result.Budget, result.Skipped)
+		}
+		if ran := !slices.Contains(tt.skipped, "hex"); (result.HexResult.Length == 100*1024) != ran {
+			t.Errorf("%q: expected hex to have run: %t, got length %d", tt.query, ran, result.HexResult.Length)
+		}
+		if ran := !slices.Contains(tt.skipped, "memory"); (result.MemoryResult.SizeKB == 1024) != ran {
+			t.Errorf("%q: expected memory to have run: %t, got %d KB", tt.query, ran, result.MemoryResult.SizeKB)
+		}
+		for _, stage := range tt.skipped {
+			if _, ok := response.RequestMetrics.Stages[stage]; ok {
+				t.Errorf("%q: expected no stage metrics for skipped %s", tt.query, stage)
+			}
+		}
+	}
+
+	// A budget far shorter than the primes stage still lets it run to completion
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/primes/hex/memory/10000/1/1?budget=1ns", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("budget=1ns: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if result := decodeStrict[CombinedResponse[PrimeHexMemoryResult]](t, w.Body.Bytes()).Data; result.PrimeResult.Count != 10000 {
+		t.Errorf("budget=1ns: expected all 10000 primes, got %+v", result.PrimeResult)
+	}
+
+	// Every param is validated before any stage runs, so a spent budget doesn't hide a bad h or m
+	for _, tt := range []struct {
+		path  string
+		param string
+	}{
+		{"/primes/hex/memory/abc/1/1", "p"},
+		{"/primes/hex/memory/10000/abc/zzz", "h"},
+		{"/primes/hex/memory/10000/99999999/99999999999", "h"},
+		{"/primes/hex/memory/10000/1/zzz", "m"},
+		{"/primes/hex/memory/10000/1/99999999999", "m"},
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", tt.path+"?budget=1ns", nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", tt.path, w.Code)
+			continue
+		}
+		if param := decodeStrict[ErrorResponse](t, w.Body.Bytes()).Error.Param; param != tt.param {
+			t.Errorf("%s: expected an error for %s, got %s", tt.path, tt.param, param)
+		}
+	}
+
+	for _, budget := range []string{"soon", "-1s", "2m"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/primes/hex/memory/10/1/1?budget="+budget, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("budget=%s: expected status 400, got %d", budget, w.Code)
+		}
+	}
+}
+
+// TestCombinedOperationDuration tests that combined endpoints report the sum of their
+// sub-operation durations next to data
+func TestCombinedOperationDuration(t *testing.T) {
+	router := setupRouter()
+	get := func(t *testing.T, url string) []byte {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		return w.Body.Bytes()
+	}
+	check := func(t *testing.T, totalUs int64, totalMs float64, durationsUs []int64, durationsMs []float64, metrics *RequestMetrics) {
+		t.Helper()
+		var sumUs int64
+		var sumMs float64
+		for i := range durationsUs {
+			sumUs += durationsUs[i]
+			sumMs += durationsMs[i]
+		}
+		if totalUs != sumUs {
+			t.Errorf("Expected total_operation_duration_us %d, got %d", sumUs, totalUs)
+		}
+		if math.Abs(totalMs-sumMs) > 1e-9 {
+			t.Errorf("Expected total_operation_duration_ms %f, got %f", sumMs, totalMs)
+		}
+		if metrics == nil || totalMs > metrics.DurationMs {
+			t.Errorf("Expected the operation total %f ms within the request's %+v", totalMs, metrics)
+		}
+	}
+
+	t.Run("Fibonacci hex", func(t *testing.T) {
+		r := decodeStrict[CombinedResponse[FibonacciHexResult]](t, get(t, "/fibonacci/hex/20/100"))
+		check(t, r.TotalOperationDurationUs, r.TotalOperationDurationMs,
+			[]int64{r.Data.FibonacciResult.DurationUs, r.Data.HexResult.DurationUs},
+			[]float64{r.Data.FibonacciResult.DurationMs, r.Data.HexResult.DurationMs}, r.RequestMetrics)
+	})
+	t.Run("Primes hex", func(t *testing.T) {
+		r := decodeStrict[CombinedResponse[PrimeHexResult]](t, get(t, "/primes/hex/1000/100"))
+		check(t, r.TotalOperationDurationUs, r.TotalOperationDurationMs,
+			[]int64{r.Data.PrimeResult.DurationUs, r.Data.HexResult.DurationUs},
+			[]float64{r.Data.PrimeResult.DurationMs, r.Data.HexResult.DurationMs}, r.RequestMetrics)
+	})
+	t.Run("Fibonacci hex memory", func(t *testing.T) {
+		r := decodeStrict[CombinedResponse[FibonacciHexMemoryResult]](t, get(t, "/fibonacci/hex/memory/20/100/1024"))
+		check(t, r.TotalOperationDurationUs, r.TotalOperationDurationMs,
+			[]int64{r.Data.FibonacciResult.DurationUs, r.Data.HexResult.DurationUs, r.Data.MemoryResult.DurationUs},
+			[]float64{r.Data.FibonacciResult.DurationMs, r.Data.HexResult.DurationMs, r.Data.MemoryResult.DurationMs}, r.RequestMetrics)
+	})
+	t.Run("Primes hex memory", func(t *testing.T) {
+		r := decodeStrict[CombinedResponse[PrimeHexMemoryResult]](t, get(t, "/primes/hex/memory/1000/100/1024"))
+		check(t, r.TotalOperationDurationUs, r.TotalOperationDurationMs,
+			[]int64{r.Data.PrimeResult.DurationUs, r.Data.HexResult.DurationUs, r.Data.MemoryResult.DurationUs},
+			[]float64{r.Data.PrimeResult.DurationMs, r.Data.HexResult.DurationMs, r.Data.MemoryResult.DurationMs}, r.RequestMetrics)
+	})
+}
+
+// decodeStrict unmarshals body into a T, failing the test on any field T doesn't declare
+func decodeStrict[T any](t *testing.T, body []byte) T {
+	t.Helper()
+	var value T
+	decoder := json.NewDecoder(strings.NewReader(string(body)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&value); err != nil {
+		t.Fatalf("Failed to decode %T: %v\n%s", value, err, body)
+	}
+	return value
+}
+
+// TestTypedResponses tests that response bodies decode into their typed structs with no leftover fields
+func TestTypedResponses(t *testing.T) {
+	router := setupRouter()
+	get := func(t *testing.T, url string, expectedStatus int) []byte {
+		t.Helper()
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		router.ServeHTTP(w, req)
+		if w.Code != expectedStatus {
+			t.Fatalf("Expected status %d, got %d", expectedStatus, w.Code)
+		}
+		return w.Body.Bytes()
+	}
+
+	t.Run("Fibonacci hex", func(t *testing.T) {
+		response := decodeStrict[CombinedResponse[FibonacciHexResult]](t, get(t, "/fibonacci/hex/10/1", http.StatusOK))
+		if response.Data.FibonacciResult.Result != 55 || response.Data.HexResult.Length != 1024 {
+			t.Errorf("Expected fib(10)=55 and 1024 hex bytes, got %+v", response.Data)
+		}
+		if response.RequestMetrics == nil || len(response.RequestMetrics.Stages) != 2 {
+			t.Errorf("Expected request_metrics with 2 stages, got %+v", response.RequestMetrics)
+		}
+	})
+
+	t.Run("Primes hex", func(t *testing.T) {
+		response := decodeStrict[CombinedResponse[PrimeHexResult]](t, get(t, "/primes/hex/5/1", http.StatusOK))
+		if response.Data.PrimeResult.LastPrime != 11 || response.Data.HexResult.Length != 1024 {
+			t.Errorf("Expected 5th prime 11 and 1024 hex bytes, got %+v", response.Data)
+		}
+	})
+
+	t.Run("Fibonacci hex memory", func(t *testing.T) {
+		response := decodeStrict[CombinedResponse[FibonacciHexMemoryResult]](t, get(t, "/fibonacci/hex/memory/10/1/8", http.StatusOK))
+		if response.Data.MemoryResult.SizeKB != 8 {
+			t.Errorf("Expected 8 KB allocated, got %+v", response.Data.MemoryResult)
+		}
+	})
+
+	t.Run("Primes hex memory", func(t *testing.T) {
+		response := decodeStrict[CombinedResponse[PrimeHexMemoryResult]](t, get(t, "/primes/hex/memory/5/1/8", http.StatusOK))
+		if response.Data.PrimeResult.Count != 5 || response.Data.MemoryResult.SizeKB != 8 {
+			t.Errorf("Expected 5 primes and 8 KB allocated, got %+v", response.Data)
+		}
+	})
+
+	t.Run("Load", func(t *testing.T) {
+		response := decodeStrict[Response[LoadResult]](t, get(t, "/load?primes=5&hex=1", http.StatusOK))
+		if _, ok := response.Data["prime_result"]; !ok || len(response.Data) != 2 {
+			t.Errorf("Expected prime_result and hex_result, got %v", response.Data)
+		}
+	})
+
+	t.Run("Healthz", func(t *testing.T) {
+		if response := decodeStrict[StatusResponse](t, get(t, "/healthz", http.StatusOK)); response.Status != "ok" {
+			t.Errorf("Expected status ok, got %q", response.Status)
+		}
+	})
+
+	t.Run("Stats", func(t *testing.T) {
+		response := decodeStrict[Response[StatsResult]](t, get(t, "/stats", http.StatusOK))
+		if response.RequestMetrics != nil {
+			t.Errorf("Expected no request_metrics on /stats, got %+v", response.RequestMetrics)
+		}
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		response := decodeStrict[ErrorResponse](t, get(t, "/primes/99999", http.StatusBadRequest))
+		if response.Error.Param != "p" || response.Error.Code != CodeOutOfRange {
+			t.Errorf("Expected an out_of_range error for p, got %+v", response.Error)
+		}
+	})
+}
+
+// TestCombinedStageMetrics tests that combined endpoints break request_metrics down per stage
+func TestCombinedStageMetrics(t *testing.T) {
+	router := setupRouter()
+
+	tests := []struct {
+		url    string
+		stages []string
+	}{
+		{"/primes/hex/memory/100/2/64", []string{"primes", "hex", "memory"}},
+		{"/fibonacci/hex/memory/10/2/64", []string{"fibonacci", "hex", "memory"}},
+		{"/primes/hex/100/2", []string{"primes", "hex"}},
+		{"/fibonacci/hex/10/2", []string{"fibonacci", "hex"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", w.Code)
+			}
+			var response struct {
+				RequestMetrics RequestMetrics `json:"request_metrics"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+
+			stages := response.RequestMetrics.Stages
+			if len(stages) != len(tt.stages) {
+				t.Errorf("Expected stages %v, got %v", tt.stages, stages)
+			}
+			for _, name := range tt.stages {
+				stage, ok := stages[name]
+				if !ok {
+					t.Errorf("Expected a %q stage", name)
+					continue
+				}
+				if stage.DurationUs < 0 || stage.DurationMs < 0 {
+					t.Errorf("Expected non-negative %s durations, got %+v", name, stage)
+				}
+			}
+			// 2 KB of hex is at least 2048 bytes allocated, however GC behaves
+			if stages["hex"].MemoryAllocatedBytes < 2048 {
+				t.Errorf("Expected the hex stage to allocate at least 2048 bytes, got %d", stages["hex"].MemoryAllocatedBytes)
+			}
+			if memory, ok := stages["memory"]; ok && memory.MemoryAllocatedBytes < 64*1024 {
+				t.Errorf("Expected the memory stage to allocate at least 64 KB, got %d", memory.MemoryAllocatedBytes)
+			}
+		})
+	}
+
+	t.Run("metrics disabled", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/primes/hex/memory/10/1/1?metrics=false", nil)
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "stages") {
+			t.Errorf("Expected a 200 without stage metrics, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+}
+
+// TestGetLoad tests composing operations from /load query parameters
+func TestGetLoad(t *testing.T) {
+	router := setupRouter()
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedKeys   []string
+		errorParam     string
+	}{
+		{"Empty", "", http.StatusOK, []string{}, ""},
+		{"Primes only", "?primes=100", http.StatusOK, []string{"prime_result"}, ""},
+		{"Requested mix", "?primes=1000&hex=10&memory=64&cpu=5ms", http.StatusOK, []string{"prime_result", "hex_result", "memory_result", "cpu_result"}, ""},
+		{"Ranges", "?hex=1..5&query=10..50", http.StatusOK, []string{"hex_result", "query_result"}, ""},
+		{
+			"Every operation",
+			"?primes=10&sieve=1000&hash=10&encrypt=1&compress=1&sort=100&matmul=8&hex=1&memory=1&query=10&cpu=1ms",
+			http.StatusOK,
+			[]string{"prime_result", "sieve_result", "hash_result", "encrypt_result", "compress_result", "sort_result", "matmul_result", "hex_result", "memory_result", "query_result", "cpu_result"},
+			"",
+		},
+		{"Unknown parameters ignored", "?primes=10&bogus=1", http.StatusOK, []string{"prime_result"}, ""},
+		{"Invalid hex", "?primes=10&hex=invalid", http.StatusBadRequest, nil, "hex"},
+		{"Empty value", "?memory=", http.StatusBadRequest, nil, "memory"},
+		{"CPU over limit", "?cpu=1h", http.StatusBadRequest, nil, "cpu"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/load"+tt.query, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+
+			var response map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+
+			if tt.errorParam != "" {
+				if errorFields(response)["param"] != tt.errorParam {
+					t.Errorf("Expected error for param %q, got %v", tt.errorParam, errorFields(response)["param"])
+				}
+				return
+			}
+
+			data, ok := response["data"].(map[string]interface{})
+			if !ok {
+				t.Fatalf("Expected data object, got %v", response["data"])
+			}
+			if len(data) != len(tt.expectedKeys) {
+				t.Errorf("Expected keys %v, got %v", tt.expectedKeys, data)
+			}
+			for _, key := range tt.expectedKeys {
+				if _, ok := data[key]; !ok {
+					t.Errorf("Expected %q in data", key)
+				}
+			}
+
+			metrics, _ := response["request_metrics"].(map[string]interface{})
+			stages, _ := metrics["stages"].(map[string]interface{})
+			if len(stages) != len(tt.expectedKeys) {
+				t.Errorf("Expected one stage per operation, got %v", stages)
+			}
+		})
+	}
+}
+
+// TestPostBatch tests running a JSON array of operations in order
+func TestPostBatch(t *testing.T) {
+	router := setupRouterWithLimits(func() loadLimits {
+		limits := defaultLoadLimits()
+		limits.BatchOps = 3
+		return limits
+	}())
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/batch", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("multi-op batch", func(t *testing.T) {
+		w := post(`[{"op":"primes","value":"100"},{"op":"memory","value":"500..1000"},{"op":"primes","value":"5"}]`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var response struct {
+			Data struct {
+				Results []struct {
+					Op         string                 `json:"op"`
+					Value      string                 `json:"value"`
+					DurationMs float64                `json:"duration_ms"`
+					Result     map[string]interface{} `json:"result"`
+				} `json:"results"`
+				TotalDurationMs float64 `json:"total_duration_ms"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+
+		results := response.Data.Results
+		if len(results) != 3 {
+			t.Fatalf("Expected 3 results, got %d", len(results))
+		}
+		if results[0].Op != "primes" || results[0].Result["count"] != float64(100) {
+			t.Errorf("Expected 100 primes first, got %+v", results[0])
+		}
+		if sizeKB, _ := results[1].Result["size_kb"].(float64); results[1].Op != "memory" || sizeKB < 500 || sizeKB > 1000 {
+			t.Errorf("Expected a 500-1000 KB allocation second, got %+v", results[1])
+		}
+		if results[2].Result["count"] != float64(5) {
+			t.Errorf("Expected 5 primes last, got %+v", results[2])
+		}
+
+		var sum float64
+		for _, result := range results {
+			if result.DurationMs < 0 {
+				t.Errorf("Expected non-negative duration, got %+v", result)
+			}
+			sum += result.DurationMs
+		}
+		if response.Data.TotalDurationMs < sum {
+			t.Errorf("Expected total_duration_ms %.3f to cover the per-op sum %.3f", response.Data.TotalDurationMs, sum)
+		}
+	})
+
+	t.Run("empty batch", func(t *testing.T) {
+		w := post(`[]`)
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"results": []`) {
+			t.Errorf("Expected an empty result list, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	errorTests := []struct {
+		name    string
+		body    string
+		param   string
+		message string
+	}{
+		{"invalid op", `[{"op":"primes","value":"10"},{"op":"mine_bitcoin","value":"1"}]`, "op", `unknown operation "mine_bitcoin" at index 1`},
+		{"invalid value", `[{"op":"primes","value":"10"},{"op":"hex","value":"lots"}]`, "hex", "operation 1:"},
+		{"malformed JSON", `{"op":"primes"}`, "body", "cannot unmarshal"},
+		{"too many operations", `[{"op":"primes","value":"1"},{"op":"primes","value":"1"},{"op":"primes","value":"1"},{"op":"primes","value":"1"}]`, "body", "exceeding the limit"},
+	}
+
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := post(tt.body)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status 400, got %d: %s", w.Code, w.Body.String())
+			}
+			var response map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if errorFields(response)["param"] != tt.param {
+				t.Errorf("Expected param %q, got %v", tt.param, errorFields(response)["param"])
+			}
+			if message, _ := errorFields(response)["message"].(string); !strings.Contains(message, tt.message) {
+				t.Errorf("Expected message containing %q, got %q", tt.message, message)
+			}
+		})
+	}
+}
+
+// TestPostWarmup tests that /warmup runs every load operation and leaves later requests measured
+func TestPostWarmup(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := newAPIServer(defaultLoadLimits())
+	router := gin.New()
+	server.registerRoutes(router)
+
+	// A second warmup must behave exactly like the first
+	for run := 1; run <= 2; run++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/warmup", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Warmup %d: expected status 200, got %d: %s", run, w.Code, w.Body.String())
+		}
+		response := decodeStrict[Response[WarmupResult]](t, w.Body.Bytes())
+		if len(response.Data.Operations) != len(loadOperations) {
+			t.Fatalf("Warmup %d: expected %d operations, got %+v", run, len(loadOperations), response.Data.Operations)
+		}
+		for i, op := range response.Data.Operations {
+			if op.Op != loadOperations[i].name || op.Value != loadOperations[i].warmup {
+				t.Errorf("Warmup %d: expected %s=%s at %d, got %+v", run, loadOperations[i].name, loadOperations[i].warmup, i, op)
+			}
+		}
+		if response.RequestMetrics == nil || len(response.RequestMetrics.Stages) != len(loadOperations) {
+			t.Errorf("Warmup %d: expected a request_metrics stage per operation, got %+v", run, response.RequestMetrics)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/primes/1000", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 after warmup, got %d: %s", w.Code, w.Body.String())
+	}
+	response := decodeStrict[Response[PrimeResult]](t, w.Body.Bytes())
+	if response.RequestMetrics == nil || response.RequestMetrics.DurationUs <= 0 || response.RequestMetrics.GoroutinesBefore == 0 {
+		t.Errorf("Expected populated request metrics after warmup, got %+v", response.RequestMetrics)
+	}
+}
+
+// TestStageMetrics tests the stage helper directly, including the nil (metrics disabled) receiver
+func TestStageMetrics(t *testing.T) {
+	expectedErr := errors.New("stage failed")
+
+	var disabled *RequestMetrics
+	ran := false
+	if err := disabled.stage(context.Background(), "noop", func() error { ran = true; return expectedErr }); err != expectedErr || !ran {
+		t.Errorf("Expected nil metrics to run the stage and return its error, got ran=%v err=%v", ran, err)
+	}
+
+	metrics := startRequestMetrics()
+	if err := metrics.stage(context.Background(), "fail", func() error { return expectedErr }); err != expectedErr {
+		t.Errorf("Expected the stage error to be returned, got %v", err)
+	}
+	if _, ok := metrics.Stages["fail"]; !ok {
+		t.Error("Expected a failed stage to still be recorded")
+	}
+}
+
+// TestSimulateQuery tests the simulated database query workload
+func TestSimulateQuery(t *testing.T) {
+	tests := []struct {
+		name        string
+		param       string
+		joins       int
+		expectError bool
+		minRows     int
+		maxRows     int
+	}{
+		{"No joins", "100", 0, false, 100, 100},
+		{"Three joins", "50", 3, false, 50, 50},
+		{"Range of rows", "10..20", 1, false, 10, 20},
+		{"Zero rows", "0", 2, false, 0, 0},
+		{"Invalid rows", "invalid", 1, true, 0, 0},
+		{"Exceeds max rows", "6000", 1, true, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := simulateQuery(context.Background(), tt.param, tt.joins, MaxQueryRows)
+
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if result.Rows < tt.minRows || result.Rows > tt.maxRows {
+				t.Errorf("Expected rows between %d-%d, got %d", tt.minRows, tt.maxRows, result.Rows)
+			}
+
+			if result.Joins != tt.joins {
+				t.Errorf("Expected %d joins, got %d", tt.joins, result.Joins)
+			}
+
+			// scan + each join + filter + sort
+			if len(result.Phases) != tt.joins+3 {
+				t.Errorf("Expected %d phases, got %d", tt.joins+3, len(result.Phases))
+			}
+
+			if result.ResultRows < 0 || result.ResultRows > result.Rows {
+				t.Errorf("Expected result rows between 0-%d, got %d", result.Rows, result.ResultRows)
+			}
+
+			if result.RowsProcessed < result.Rows {
+				t.Errorf("Expected at least %d rows processed, got %d", result.Rows, result.RowsProcessed)
+			}
+
+			for _, phase := range result.Phases {
+				if phase.DurationUs < 0 {
+					t.Errorf("Expected non-negative duration for phase %s", phase.Name)
+				}
+			}
+		})
+	}
+}
+
+// TestGetQuery tests the simulated database query endpoint
+func TestGetQuery(t *testing.T) {
+	router := setupRouter()
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		expectedParam  string
+	}{
+		{"Default joins", "/query/100", http.StatusOK, ""},
+		{"Explicit joins", "/query/100?joins=3", http.StatusOK, ""},
+		{"Range of rows", "/query/50..150?joins=2", http.StatusOK, ""},
+		{"Rows exceed max", "/query/6000", http.StatusBadRequest, "n"},
+		{"Joins exceed max", "/query/100?joins=10", http.StatusBadRequest, "joins"},
+		{"Invalid joins", "/query/100?joins=many", http.StatusBadRequest, "joins"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			var response map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse JSON response: %v", err)
+			}
+
+			if tt.expectedStatus != http.StatusOK {
+				if errorFields(response)["param"] != tt.expectedParam {
+					t.Errorf("Expected param %q, got %v", tt.expectedParam, errorFields(response)["param"])
+				}
+				return
+			}
+
+			data, ok := response["data"].(map[string]interface{})
+			if !ok {
+				t.Fatal("Expected 'data' field to be an object")
+			}
+			if _, ok := data["phases"].([]interface{}); !ok {
+				t.Error("Expected 'phases' array in data")
+			}
+			if _, ok := data["rows_processed"]; !ok {
+				t.Error("Expected 'rows_processed' in data")
+			}
+		})
+	}
+}
+
+// TestParseDurationParam tests parsing and capping of duration parameters
+func TestParseDurationParam(t *testing.T) {
+	tests := []struct {
+		name        string
+		param       string
+		expected    time.Duration
+		expectError bool
+	}{
+		{"Milliseconds", "500ms", 500 * time.Millisecond, false},
+		{"Seconds", "2s", 2 * time.Second, false},
+		{"Zero", "0s", 0, false},
+		{"At cap", "30s", 30 * time.Second, false},
+		{"Over cap", "31s", 0, true},
+		{"Negative", "-1s", 0, true},
+		{"Missing unit", "500", 0, true},
+		{"Invalid", "soon", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := parseDurationParam(tt.param, MaxCPUDuration)
+
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if d != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, d)
+			}
+		})
+	}
+}
+
+// TestRequestTimeout tests that ?timeout= stops long operations with a 503 and partial progress
+func TestRequestTimeout(t *testing.T) {
+	router := setupRouter()
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		param          string
+	}{
+		{"Tiny timeout on large prime count", "/primes/10000?timeout=1ns", http.StatusServiceUnavailable, "p"},
+		{"Parallel primes", "/primes/10000?parallel=4&timeout=1ns", http.StatusServiceUnavailable, "p"},
+		{"Hex", "/hex/10000?timeout=1ns", http.StatusServiceUnavailable, "h"},
+		{"CPU burn cut short", "/cpu/5s?timeout=20ms", http.StatusServiceUnavailable, "d"},
+		{"Combined endpoint", "/primes/hex/10000/1?timeout=1ns", http.StatusServiceUnavailable, "p"},
+		{"Composable load", "/load?primes=10000&hex=1&timeout=1ns", http.StatusServiceUnavailable, "primes"},
+		{"Generous timeout", "/primes/100?timeout=10s", http.StatusOK, ""},
+		{"Invalid timeout", "/primes/100?timeout=soon", http.StatusBadRequest, "timeout"},
+		{"Timeout over the limit", "/primes/100?timeout=2m", http.StatusBadRequest, "timeout"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("Expected the request to stop promptly, took %s", elapsed)
+			}
+			if tt.param == "" {
+				return
+			}
+
+			var response map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if errorFields(response)["param"] != tt.param {
+				t.Errorf("Expected param %q, got %v", tt.param, errorFields(response)["param"])
+			}
+			if tt.expectedStatus == http.StatusServiceUnavailable {
+				if _, ok := errorFields(response)["partial"]; !ok {
+					t.Error("Expected partial progress in the response")
+				}
+				if errorFields(response)["timeout"] == nil || !strings.Contains(errorFields(response)["message"].(string), "timeout") {
+					t.Errorf("Expected the timeout to be reported, got %v", response)
+				}
+			}
+		})
+	}
+
+	t.Run("Partial prime progress", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/primes/10000?timeout=1ns", nil)
+		router.ServeHTTP(w, req)
+
+		var response struct {
+			Error struct {
+				Code    string      `json:"code"`
+				Partial PrimeResult `json:"partial"`
+				Timeout string      `json:"timeout"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		if response.Error.Code != CodeTimeout || response.Error.Partial.Count >= 10000 || response.Error.Timeout != "1ns" {
+			t.Errorf("Expected partial progress short of 10000 primes with timeout 1ns, got %+v", response)
+		}
+	})
+}
+
+// TestComputeLoopsObserveContext tests that the compute loops return promptly with ctx.Err()
+// once their context has ended
+func TestComputeLoopsObserveContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if result, err := generatePrimes(ctx, "10000", MaxPrimes); !errors.Is(err, context.Canceled) || result.Count >= 10000 {
+		t.Errorf("generatePrimes: expected context.Canceled with partial count, got %d, %v", result.Count, err)
+	}
+	if result, err := generatePrimesParallel(ctx, "10000", MaxPrimes, 4); !errors.Is(err, context.Canceled) || result.LastPrime != 0 {
+		t.Errorf("generatePrimesParallel: expected context.Canceled without a last prime, got %+v, %v", result, err)
+	}
+	if result, err := multiplyMatrices(ctx, "100", MaxMatmulDim); !errors.Is(err, context.Canceled) || result.RowsComputed != 0 {
+		t.Errorf("multiplyMatrices: expected context.Canceled with no rows computed, got %+v, %v", result, err)
+	}
+	if result, err := createHexString(ctx, "100", MaxHexKB); !errors.Is(err, context.Canceled) || result.Length != 0 || result.HexString != "" {
+		t.Errorf("createHexString: expected context.Canceled with nothing generated, got length %d, %v", result.Length, err)
+	}
+
+	start := time.Now()
+	if _, err := burnCPU(ctx, 5*time.Second); !errors.Is(err, context.Canceled) {
+		t.Errorf("burnCPU: expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("burnCPU: expected an immediate return, took %s", elapsed)
+	}
+}
+
+// TestPrimeLoopStopsOnCancel tests that a running prime search returns promptly once its context
+// is canceled, as happens when the client disconnects
+func TestPrimeLoopStopsOnCancel(t *testing.T) {
+	// Far beyond any request limit, so the loop is still running when cancel fires
+	const count = 5000000
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	var result PrimeResult
+	var err error
+	go func() {
+		defer close(done)
+		result, err = generatePrimes(ctx, strconv.Itoa(count), count)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	canceledAt := time.Now()
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected generatePrimes to return within 1s of cancel")
+	}
+	if elapsed := time.Since(canceledAt); elapsed > 100*time.Millisecond {
+		t.Errorf("Expected a prompt return after cancel, took %s", elapsed)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if result.Count <= 0 || result.Count >= count {
+		t.Errorf("Expected partial progress, got count %d", result.Count)
+	}
+}
+
+// TestClientDisconnect tests that abandoned requests stop computing: after the client cancels a
+// long CPU burn, the handler returns promptly and records 499
+func TestClientDisconnect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := newAPIServer(defaultLoadLimits())
+	router := gin.New()
+	server.registerRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	tests := []struct {
+		path  string
+		route string
+	}{
+		{"/cpu/10s", "/cpu/:d"},
+		{"/load?cpu=10s", "/load"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL+tt.path, nil)
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				cancel()
+			}()
+			if _, err := http.DefaultClient.Do(req); err == nil {
+				t.Fatal("Expected the canceled request to fail on the client side")
+			}
+
+			// The stats middleware records the request once the handler has returned
+			deadline := time.Now().Add(2 * time.Second)
+			for server.stats.snapshot().Endpoints[tt.route].Errors == 0 {
+				if time.Now().After(deadline) {
+					t.Fatal("Expected the handler to stop within 2s of the client disconnecting")
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+		})
+	}
+}
+
+// TestBurnCPU tests that the CPU burner runs for the requested duration
+func TestBurnCPU(t *testing.T) {
+	result, err := burnCPU(context.Background(), 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if result.Iterations <= 0 {
+		t.Errorf("Expected positive iterations, got %d", result.Iterations)
+	}
+	if result.PrimesFound <= 0 || result.PrimesFound > result.Iterations {
+		t.Errorf("Expected primes found between 1-%d, got %d", result.Iterations, result.PrimesFound)
+	}
+	if result.DurationMs < 20 {
+		t.Errorf("Expected duration of at least 20ms, got %f", result.DurationMs)
+	}
+	if result.RequestedDuration != "20ms" {
+		t.Errorf("Expected requested duration '20ms', got %s", result.RequestedDuration)
+	}
+}
+
+// TestGetSpin tests the allocation-free spin endpoint
+func TestGetSpin(t *testing.T) {
+	router := setupRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/spin/10ms", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	result := decodeStrict[Response[SpinResult]](t, w.Body.Bytes()).Data
+	if result.Iterations <= 0 || result.RequestedDuration != "10ms" {
+		t.Errorf("Expected a positive iteration count for 10ms, got %+v", result)
+	}
+
+	for _, param := range []string{"1h", "fast"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/spin/"+param, nil)
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", param, w.Code)
+		}
+	}
+}
+
+// TestSpinUntilAllocs tests that the spin loop allocates nothing, so it can't trigger a GC
+func TestSpinUntilAllocs(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	allocs := testing.AllocsPerRun(10, func() {
+		spinUntil(ctx, time.Now().Add(time.Millisecond))
+	})
+	if allocs != 0 {
+		t.Errorf("Expected 0 allocations per spin, got %v", allocs)
+	}
+}
+
+// TestGetCPUBurn tests the time-bounded CPU burn endpoint
+func TestGetCPUBurn(t *testing.T) {
+	router := setupRouter()
+
+	tests := []struct {
+		name           string
+		param          string
+		expectedStatus int
+	}{
+		{"Valid duration", "10ms", http.StatusOK},
+		{"Over cap", "1h", http.StatusBadRequest},
+		{"Invalid duration", "fast", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/cpu/"+tt.param, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			var response map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse JSON response: %v", err)
+			}
+
+			if tt.expectedStatus != http.StatusOK {
+				if errorFields(response)["limit"] != MaxCPUDuration.String() {
+					t.Errorf("Expected limit %s, got %v", MaxCPUDuration, errorFields(response)["limit"])
+				}
+				return
+			}
+
+			data, ok := response["data"].(map[string]interface{})
+			if !ok {
+				t.Fatal("Expected 'data' field to be an object")
+			}
+			if iterations, _ := data["iterations"].(float64); iterations <= 0 {
+				t.Errorf("Expected positive iteration count, got %v", data["iterations"])
+			}
+		})
+	}
+}
+
+// TestGetCollatz tests the Collatz stopping-time search against known maxima
+func TestGetCollatz(t *testing.T) {
+	router := setupRouter()
+
+	tests := []struct {
+		param           string
+		expectedStatus  int
+		maxStoppingTime int
+		maxStartingN    int
+	}{
+		{"1", http.StatusOK, 0, 1},
+		{"10", http.StatusOK, 19, 9},
+		{"100", http.StatusOK, 118, 97},
+		{"1000", http.StatusOK, 178, 871},
+		{"0", http.StatusOK, 0, 0},
+		{"1000001", http.StatusBadRequest, 0, 0},
+		{"abc", http.StatusBadRequest, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.param, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/collatz/"+tt.param, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			result := decodeStrict[Response[CollatzResult]](t, w.Body.Bytes()).Data
+			if result.MaxStoppingTime != tt.maxStoppingTime || result.MaxStartingN != tt.maxStartingN {
+				t.Errorf("Expected max stopping time %d at %d, got %d at %d",
+					tt.maxStoppingTime, tt.maxStartingN, result.MaxStoppingTime, result.MaxStartingN)
+			}
+		})
+	}
+}
+
+// TestGetGoroutines tests that the requested goroutine count is spawned and that all of them exit
+func TestGetGoroutines(t *testing.T) {
+	router := setupRouter()
+
+	tests := []struct {
+		param          string
+		expectedStatus int
+		spawned        int
+	}{
+		{"0", http.StatusOK, 0},
+		{"1", http.StatusOK, 1},
+		{"1000", http.StatusOK, 1000},
+		{"100001", http.StatusBadRequest, 0},
+		{"abc", http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.param, func(t *testing.T) {
+			baseline := runtime.NumGoroutine()
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/goroutines/"+tt.param, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			response := decodeStrict[Response[GoroutinesResult]](t, w.Body.Bytes())
+			result := response.Data
+			if result.Spawned != tt.spawned {
+				t.Errorf("Expected %d goroutines spawned, got %d", tt.spawned, result.Spawned)
+			}
+			if result.PeakConcurrent > int64(tt.spawned) || (tt.spawned > 0 && result.PeakConcurrent < 1) {
+				t.Errorf("Expected peak_concurrent in 1..%d, got %d", tt.spawned, result.PeakConcurrent)
+			}
+
+			// goroutines_after is sampled once every spawned goroutine has called Done; a few may
+			// still be returning, but the bulk must already be gone.
+			metrics := response.RequestMetrics
+			if metrics.GoroutinesAfter-metrics.GoroutinesBefore > tt.spawned/10+1 {
+				t.Errorf("Expected goroutines_after near %d, got %d", metrics.GoroutinesBefore, metrics.GoroutinesAfter)
+			}
+			deadline := time.Now().Add(time.Second)
+			for runtime.NumGoroutine() > baseline && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			if got := runtime.NumGoroutine(); got > baseline {
+				t.Errorf("Expected goroutine count to return to %d, got %d", baseline, got)
+			}
+		})
+	}
+}
+
+// TestGetJSON tests JSON roundtrips with the default and an explicit iteration count
+func TestGetJSON(t *testing.T) {
+	router := setupRouter()
+
+	tests := []struct {
+		name               string
+		url                string
+		expectedStatus     int
+		expectedIterations int
+	}{
+		{"Default iterations", "/json/10", http.StatusOK, 1},
+		{"Explicit iterations", "/json/10?iterations=5", http.StatusOK, 5},
+		{"Empty document", "/json/0", http.StatusOK, 1},
+		{"Size over limit", "/json/1001", http.StatusBadRequest, 0},
+		{"Iterations over limit", "/json/10?iterations=1001", http.StatusBadRequest, 0},
+		{"Zero iterations", "/json/10?iterations=0", http.StatusBadRequest, 0},
+		{"Invalid iterations", "/json/10?iterations=many", http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			result := decodeStrict[Response[JSONResult]](t, w.Body.Bytes()).Data
+			if result.Iterations != tt.expectedIterations {
+				t.Errorf("Expected %d iterations, got %d", tt.expectedIterations, result.Iterations)
+			}
+			if result.DocumentBytes < result.SizeKB*1024 {
+				t.Errorf("Expected a document of at least %d KB, got %d bytes", result.SizeKB, result.DocumentBytes)
+			}
+			if result.BytesProcessed != 2*int64(result.DocumentBytes)*int64(result.Iterations) {
+				t.Errorf("Expected bytes_processed to count encode and decode per iteration, got %+v", result)
+			}
+		})
+	}
+}
+
+// TestGetRegex tests regex matching with the default pattern and a custom one
+func TestGetRegex(t *testing.T) {
+	router := setupRouter()
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		check          func(RegexResult) bool
+	}{
+		{"Default pattern", "/regex/1000", http.StatusOK, func(r RegexResult) bool {
+			// Half the generated statuses are 4xx/5xx
+			return r.Pattern == defaultRegexPattern && r.Matches > 300 && r.Matches < 700
+		}},
+		{"Custom pattern matching all", "/regex/500?pattern=" + url.QueryEscape(`^\d+\.`), http.StatusOK, func(r RegexResult) bool {
+			return r.Matches == 500 && r.BytesScanned > 0
+		}},
+		{"Custom pattern matching none", "/regex/500?pattern=" + url.QueryEscape("^$"), http.StatusOK, func(r RegexResult) bool {
+			return r.Matches == 0
+		}},
+		{"Range", "/regex/10..20", http.StatusOK, func(r RegexResult) bool {
+			return r.Lines >= 10 && r.Lines <= 20 && r.RequestedRange == "10..20"
+		}},
+		{"Invalid pattern", "/regex/10?pattern=" + url.QueryEscape("(a"), http.StatusBadRequest, nil},
+		{"Pattern too long", "/regex/10?pattern=" + strings.Repeat("a", MaxRegexPatternLen+1), http.StatusBadRequest, nil},
+		{"Over limit", "/regex/100001", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.check == nil {
+				return
+			}
+			result := decodeStrict[Response[RegexResult]](t, w.Body.Bytes()).Data
+			if !tt.check(result) {
+				t.Errorf("Unexpected result: %+v", result)
+			}
+		})
+	}
+}
+
+// TestGetBcrypt tests bcrypt hashing, cost validation, and that a higher cost takes longer
+func TestGetBcrypt(t *testing.T) {
+	router := setupRouter()
+
+	hash := func(cost string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/bcrypt/"+cost, nil)
+		router.ServeHTTP(w, req)
+		var response map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to parse JSON response: %v", err)
+		}
+		return w.Code, response
+	}
+
+	for _, cost := range []string{"3", "16", "-1", "ten", "4..6"} {
+		status, response := hash(cost)
+		if status != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for cost %s, got %d", cost, status)
+			continue
+		}
+		if fields := errorFields(response); fields["param"] != "cost" || fields["limit"] != "4-15" {
+			t.Errorf("Expected a cost error with limit 4-15, got %v", fields)
+		}
+	}
+
+	durations := map[int]float64{}
+	for _, cost := range []int{MinBcryptCost, 10} {
+		status, response := hash(strconv.Itoa(cost))
+		if status != http.StatusOK {
+			t.Fatalf("Expected status 200 for cost %d, got %d", cost, status)
+		}
+		data := response["data"].(map[string]interface{})
+		if data["cost"] != float64(cost) {
+			t.Errorf("Expected cost %d, got %v", cost, data["cost"])
+		}
+		hashed, _ := data["hash"].(string)
+		if err := bcrypt.CompareHashAndPassword([]byte(hashed), []byte(bcryptPassword)); err != nil {
+			t.Errorf("Hash %q does not match the password: %v", hashed, err)
+		}
+		durations[cost] = data["duration_ms"].(float64)
+	}
+	// Cost 10 is 64x the work of cost 4
+	if durations[10] <= durations[MinBcryptCost] {
+		t.Errorf("Expected cost 10 to take longer than cost %d, got %v", MinBcryptCost, durations)
+	}
+}
+
+// TestParamErrorReportsLimit tests that validation errors name the rejected parameter, its limit,
+// and the error code
+func TestParamErrorReportsLimit(t *testing.T) {
+	router := setupRouter()
+
+	tests := []struct {
+		name          string
+		url           string
+		expectedParam string
+		expectedLimit int
+		expectedCode  string
+	}{
+		{"Fibonacci out of range", "/fibonacci/100", "f", MaxFibonacci, CodeOutOfRange},
+		{"Primes out of range", "/primes/20000", "p", MaxPrimes, CodeOutOfRange},
+		{"Hex out of range", "/hex/20000", "h", MaxHexKB, CodeOutOfRange},
+		{"Memory out of range", "/memory/2000000", "m", MaxMemoryKB, CodeOutOfRange},
+		{"Memory invalid number", "/memory/invalid", "m", MaxMemoryKB, CodeInvalidNumber},
+		{"Primes invalid range", "/primes/10..5", "p", MaxPrimes, CodeInvalidRange},
+		{"Primes invalid range bound", "/primes/1..x", "p", MaxPrimes, CodeInvalidNumber},
+		{"Primes range out of range", "/primes/1..20000", "p", MaxPrimes, CodeOutOfRange},
+		{"Fibonacci hex rejects hex", "/fibonacci/hex/5/20000", "h", MaxHexKB, CodeOutOfRange},
+		{"Primes hex rejects primes", "/primes/hex/20000/1", "p", MaxPrimes, CodeOutOfRange},
+		{"Fibonacci hex memory rejects fibonacci", "/fibonacci/hex/memory/100/1/10", "f", MaxFibonacci, CodeOutOfRange},
+		{"Primes hex memory rejects memory", "/primes/hex/memory/5/1/2000000", "m", MaxMemoryKB, CodeOutOfRange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status 400, got %d", w.Code)
+			}
+
+			var response map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse JSON response: %v", err)
+			}
+
+			if errorFields(response)["param"] != tt.expectedParam {
+				t.Errorf("Expected param %q, got %v", tt.expectedParam, errorFields(response)["param"])
+			}
+
+			if errorFields(response)["limit"] != strconv.Itoa(tt.expectedLimit) {
+				t.Errorf("Expected limit %q, got %v", strconv.Itoa(tt.expectedLimit), errorFields(response)["limit"])
+			}
+
+			if errorFields(response)["code"] != tt.expectedCode {
+				t.Errorf("Expected code %q, got %v", tt.expectedCode, errorFields(response)["code"])
+			}
+		})
+	}
+}
+
+// TestErrorEnvelope tests the exact shape of an ErrorResponse
+func TestErrorEnvelope(t *testing.T) {
+	router := setupRouter()
+
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"/memory/2000000", `{"error":{"param":"m","message":"number out of range (0-1000000)","code":"out_of_range","limit":"1000000"}}`},
+		{"/memory/lots", `{"error":{"param":"m","message":"invalid number: strconv.Atoi: parsing \"lots\": invalid syntax","code":"invalid_number","limit":"1000000"}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.url+"?pretty=0", nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status 400, got %d", w.Code)
+			}
+			if body := strings.TrimSpace(w.Body.String()); body != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, body)
+			}
+		})
+	}
+}
+
+// TestLoadLimitsFromEnv tests that APEX_MAX_* environment variables override the default limits
+func TestLoadLimitsFromEnv(t *testing.T) {
+	t.Run("Defaults when unset", func(t *testing.T) {
+		if limits := loadLimitsFromEnv(); limits != defaultLoadLimits() {
+			t.Errorf("Expected default limits %+v, got %+v", defaultLoadLimits(), limits)
+		}
+	})
+
+	t.Run("Overrides applied", func(t *testing.T) {
+		t.Setenv("APEX_MAX_MEMORY_KB", "2000000")
+		t.Setenv("APEX_MAX_FIBONACCI", "30")
+		t.Setenv("APEX_MAX_PRIMES", "50000")
+		t.Setenv("APEX_MAX_HEX_KB", "20000")
+
+		expected := defaultLoadLimits()
+		expected.MemoryKB = 2000000
+		expected.Fibonacci = 30
+		expected.Primes = 50000
+		expected.HexKB = 20000
+		if limits := loadLimitsFromEnv(); limits != expected {
+			t.Errorf("Expected limits %+v, got %+v", expected, limits)
+		}
+	})
+
+	t.Run("Invalid values fall back to defaults", func(t *testing.T) {
+		t.Setenv("APEX_MAX_MEMORY_KB", "lots")
+		t.Setenv("APEX_MAX_FIBONACCI", "-5")
+		t.Setenv("APEX_MAX_PRIMES", "0")
+		t.Setenv("APEX_MAX_HEX_KB", "")
+
+		if limits := loadLimitsFromEnv(); limits != defaultLoadLimits() {
+			t.Errorf("Expected default limits %+v, got %+v", defaultLoadLimits(), limits)
+		}
+	})
+}
+
+// TestLoadConfig tests that a YAML config file is parsed over the defaults and that bad files are rejected
+func TestLoadConfig(t *testing.T) {
+	writeConfig := func(t *testing.T, contents string) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "apex.yaml")
+		if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+		return path
+	}
+
+	t.Run("Sample file parsed", func(t *testing.T) {
+		path := writeConfig(t, `
+port: 9090
+tls_port: 8443
+seed: "42"
+auth_token: s3cret
+rate_limit:
+  rps: 50
+  burst: 100
+max_concurrency: 8
+concurrency_queue_timeout: 2s
+error_rate: 0.1
+error_status: 503
+features:
+  gc_endpoint: true
+  pprof: true
+  expvar: true
+  disable_metrics: true
+limits:
+  memory_kb: 2000000
+  fibonacci: 30
+  cpu_duration: 5s
+`)
+		expected := defaultConfig()
+		expected.Port = 9090
+		expected.TLSPort = 8443
+		expected.Seed = "42"
+		expected.AuthToken = "s3cret"
+		expected.RateLimit = RateLimitConfig{RPS: 50, Burst: 100}
+		expected.MaxConcurrency = 8
+		expected.ConcurrencyQueueTimeout = 2 * time.Second
+		expected.ErrorRate = 0.1
+		expected.ErrorStatus = 503
+		expected.Features = FeatureConfig{GCEndpoint: true, Pprof: true, Expvar: true, DisableMetrics: true}
+		expected.Limits.MemoryKB = 2000000
+		expected.Limits.Fibonacci = 30
+		expected.Limits.CPUDuration = 5 * time.Second
+
+		config, err := loadConfig(path)
+		if err != nil {
+			t.Fatalf("Expected config to load, got %v", err)
+		}
+		if config != expected {
+			t.Errorf("Expected config %+v, got %+v", expected, config)
+		}
+	})
+
+	t.Run("Missing and empty files yield defaults", func(t *testing.T) {
+		for _, path := range []string{"", filepath.Join(t.TempDir(), "missing.yaml"), writeConfig(t, "")} {
+			config, err := loadConfig(path)
+			if err != nil {
+				t.Fatalf("Expected defaults for %q, got error %v", path, err)
+			}
+			if config != defaultConfig() {
+				t.Errorf("Expected defaults for %q, got %+v", path, config)
+			}
+		}
+	})
+
+	invalid := map[string]string{
+		"Unknown key":        "prot: 9090\n",
+		"Unknown limit":      "limits:\n  memory_mb: 10\n",
+		"Malformed value":    "port: eighty\n",
+		"Port out of range":  "port: 70000\n",
+		"Negative rate":      "rate_limit:\n  rps: -1\n",
+		"Non-positive limit": "limits:\n  primes: 0\n",
+		"Error rate above 1": "error_rate: 1.5\n",
+		"Error status 2xx":   "error_status: 200\n",
+	}
+	for name, contents := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if _, err := loadConfig(writeConfig(t, contents)); err == nil {
+				t.Errorf("Expected an error for %q", contents)
+			}
+		})
+	}
+}
+
+// TestConfigPrecedence tests that env vars override the config file and flags override env vars
+func TestConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "apex.yaml")
+	contents := "port: 9090\nseed: file\nauth_token: file-token\nfeatures:\n  pprof: true\nlimits:\n  primes: 50000\n  fibonacci: 30\n"
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	t.Setenv("APEX_PORT", "9191")
+	t.Setenv("APEX_RAND_SEED", "env")
+	t.Setenv("APEX_ENABLE_PPROF", "false")
+	t.Setenv("APEX_MAX_PRIMES", "60000")
+
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("Expected config to load, got %v", err)
+	}
+	config.applyEnv()
+
+	flags := flag.NewFlagSet("apex", flag.ContinueOnError)
+	flags.Int("port", HTTPPort, "")
+	flags.Int("tls-port", 0, "")
+	flags.String("seed", "", "")
+	if err := flags.Parse([]string{"-port", "9292"}); err != nil {
+		t.Fatalf("Failed to parse flags: %v", err)
+	}
+	config.applyFlags(flags)
+
+	if config.Port != 9292 {
+		t.Errorf("Expected -port to win, got %d", config.Port)
+	}
+	if config.Seed != "env" {
+		t.Errorf("Expected APEX_RAND_SEED to override the file, got %q", config.Seed)
+	}
+	if config.AuthToken != "file-token" {
+		t.Errorf("Expected the file's auth token without an env override, got %q", config.AuthToken)
+	}
+	if config.Features.Pprof {
+		t.Error("Expected APEX_ENABLE_PPROF=false to override the file")
+	}
+	if config.Limits.Primes != 60000 || config.Limits.Fibonacci != 30 {
+		t.Errorf("Expected primes from env and fibonacci from file, got %d and %d", config.Limits.Primes, config.Limits.Fibonacci)
+	}
+	if config.TLSPort != 0 {
+		t.Errorf("Expected unset -tls-port to leave the default, got %d", config.TLSPort)
+	}
+}
+
+// TestReloadConfig tests that a reload picks up changed limits, rate limit, and error injection,
+// ignores changes that need a restart, and keeps the running config when the file is invalid
+func TestReloadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "apex.yaml")
+	write := func(contents string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+	}
+	flags := flag.NewFlagSet("apex", flag.ContinueOnError)
+
+	write("port: 9090\nlimits:\n  primes: 100\n")
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("Expected config to load, got %v", err)
+	}
+	server := newAPIServer(config.Limits)
+	server.setConfig(config)
+	if server.rateLimiter.Load() != nil {
+		t.Fatal("Expected no rate limiter before reload")
+	}
+
+	write("port: 9191\nauth_token: new\nrate_limit:\n  rps: 5\nerror_rate: 0.25\nerror_status: 503\nlimits:\n  primes: 200\n")
+	if err := server.reloadConfig(path, flags); err != nil {
+		t.Fatalf("Expected reload to succeed, got %v", err)
+	}
+	reloaded := server.config.Load()
+	if server.limits().Primes != 200 {
+		t.Errorf("Expected reloaded primes limit 200, got %d", server.limits().Primes)
+	}
+	if limiter := server.rateLimiter.Load(); limiter == nil || limiter.rps != 5 || limiter.burst != 5 {
+		t.Errorf("Expected a 5 rps limiter with burst 5, got %+v", limiter)
+	}
+	if reloaded.ErrorRate != 0.25 || reloaded.ErrorStatus != 503 {
+		t.Errorf("Expected error injection 0.25/503, got %g/%d", reloaded.ErrorRate, reloaded.ErrorStatus)
+	}
+	if reloaded.Port != 9090 || reloaded.AuthToken != "" {
+		t.Errorf("Expected port and auth token to keep their startup values, got %d and %q", reloaded.Port, reloaded.AuthToken)
+	}
+
+	router := gin.New()
+	server.registerRoutes(router)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/primes/150?error_rate=0", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected the reloaded limit to allow 150 primes, got status %d", w.Code)
+	}
+
+	limiter := server.rateLimiter.Load()
+	write("limits:\n  primes: 0\n")
+	if err := server.reloadConfig(path, flags); err == nil {
+		t.Error("Expected an invalid file to fail the reload")
+	}
+	if server.limits().Primes != 200 || server.rateLimiter.Load() != limiter {
+		t.Error("Expected a failed reload to keep the running config")
+	}
+}
+
+// TestEnvLimitsApplyToEndpoints tests that overridden limits are enforced and reported by the handlers
+func TestEnvLimitsApplyToEndpoints(t *testing.T) {
+	t.Setenv("APEX_MAX_PRIMES", "20000")
+	t.Setenv("APEX_MAX_HEX_KB", "5")
+	router := setupRouterWithLimits(loadLimitsFromEnv())
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/primes/15000", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected raised primes limit to allow 15000, got status %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/hex/10", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected lowered hex limit to reject 10, got status %d", w.Code)
+	}
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+	if errorFields(response)["limit"] != "5" {
+		t.Errorf("Expected reported limit \"5\", got %v", errorFields(response)["limit"])
+	}
+}
+
+// TestFormatLimit tests that every kind of limit is rendered as a string
+func TestFormatLimit(t *testing.T) {
+	tests := []struct {
+		limit    interface{}
+		expected string
+	}{
+		{10000, "10000"},
+		{30 * time.Second, "30s"},
+		{10 * time.Minute, "10m0s"},
+		{[]string{"sha256", "sha512"}, "sha256,sha512"},
+		{"custom", "custom"},
+	}
+
+	for _, tt := range tests {
+		if got := formatLimit(tt.limit); got != tt.expected {
+			t.Errorf("formatLimit(%v) = %q, expected %q", tt.limit, got, tt.expected)
+		}
+	}
+}
+
+// TestPrometheusMetrics tests that requests are counted and exposed at /metrics
+func TestPrometheusMetrics(t *testing.T) {
+	router := setupRouter()
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/primes/10", nil)
+		router.ServeHTTP(w, req)
+	}
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/primes/invalid", nil)
+	router.ServeHTTP(w, req)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/metrics", nil)
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("Expected text/plain Content-Type, got %s", w.Header().Get("Content-Type"))
+	}
+
+	body := w.Body.String()
+	expectedLines := []string{
+		`http_requests_total{path="/primes/:p",status="200"} 2`,
+		`http_requests_total{path="/primes/:p",status="400"} 1`,
+		`http_request_errors_total{path="/primes/:p"} 1`,
+		`http_request_duration_seconds_bucket{path="/primes/:p",le="+Inf"} 3`,
+		`http_request_duration_seconds_count{path="/primes/:p"} 3`,
+		"# TYPE http_request_duration_seconds histogram",
+		"# TYPE go_goroutines gauge",
+		"# TYPE go_memstats_heap_alloc_bytes gauge",
+		"# TYPE go_gc_duration_seconds summary",
+	}
+	for _, line := range expectedLines {
+		if !strings.Contains(body, line) {
+			t.Errorf("Expected /metrics output to contain %q", line)
+		}
+	}
+}
+
+// TestStatsAggregator tests totals and percentile estimates over known latencies
+func TestStatsAggregator(t *testing.T) {
+	sa := newStatsAggregator()
+	for i := 1; i <= 100; i++ {
+		status := http.StatusOK
+		if i%10 == 0 {
+			status = http.StatusBadRequest
+		}
+		sa.record("/primes/:p", status, time.Duration(i)*time.Millisecond)
+	}
+	sa.record("/hex/:h", http.StatusOK, 5*time.Millisecond)
+
+	stats := sa.snapshot()
+	if stats.TotalRequests != 101 || stats.TotalErrors != 10 {
+		t.Errorf("Expected 101 requests and 10 errors, got %d and %d", stats.TotalRequests, stats.TotalErrors)
+	}
+
+	latency := stats.Endpoints["/primes/:p"].Latency
+	expected := LatencySummary{Count: 100, MinMs: 1, MaxMs: 100, MeanMs: 50.5, P50Ms: 50, P95Ms: 95, P99Ms: 99}
+	if latency != expected {
+		t.Errorf("Expected latency summary %+v, got %+v", expected, latency)
+	}
+	if hex := stats.Endpoints["/hex/:h"]; hex.Requests != 1 || hex.Latency.P99Ms != 5 {
+		t.Errorf("Expected a single 5ms /hex/:h sample, got %+v", hex)
+	}
+
+	sa.reset()
+	if stats := sa.snapshot(); stats.TotalRequests != 0 || len(stats.Endpoints) != 0 {
+		t.Errorf("Expected empty stats after reset, got %+v", stats)
+	}
+}
+
+// TestStatsAggregatorReservoir tests that percentiles stay sane once the reservoir is full
+func TestStatsAggregatorReservoir(t *testing.T) {
+	sa := newStatsAggregator()
+	n := StatsReservoirSize * 10
+	for i := 1; i <= n; i++ {
+		sa.record("/cpu/:d", http.StatusOK, time.Duration(i)*time.Microsecond)
+	}
+
+	latency := sa.snapshot().Endpoints["/cpu/:d"].Latency
+	if latency.Count != int64(n) {
+		t.Errorf("Expected count %d, got %d", n, latency.Count)
+	}
+	if !(latency.MinMs <= latency.P50Ms && latency.P50Ms <= latency.P95Ms &&
+		latency.P95Ms <= latency.P99Ms && latency.P99Ms <= latency.MaxMs) {
+		t.Errorf("Expected ordered percentiles, got %+v", latency)
+	}
+	// Uniform latencies from 0 to ~10.24ms: the sampled median should land near the middle
+	if latency.P50Ms < latency.MaxMs*0.4 || latency.P50Ms > latency.MaxMs*0.6 {
+		t.Errorf("Expected p50 near %.2fms, got %.2fms", latency.MaxMs/2, latency.P50Ms)
+	}
+}
+
+// TestStatsAggregatorHistogram tests that latencies accumulate in the right buckets
+func TestStatsAggregatorHistogram(t *testing.T) {
+	sa := newStatsAggregator()
+	sa.bucketsMs = []float64{1, 10, 100}
+	for _, d := range []time.Duration{500 * time.Microsecond, time.Millisecond, 2 * time.Millisecond, 10 * time.Millisecond, 50 * time.Millisecond, time.Second} {
+		sa.record("/cpu/:d", http.StatusOK, d)
+	}
+	sa.record("/hex/:h", http.StatusOK, 5*time.Millisecond)
+
+	histogram := sa.histogram("/cpu/:d").Endpoints["/cpu/:d"]
+	expected := []HistogramBucket{{LeMs: 1, Count: 2}, {LeMs: 10, Count: 2}, {LeMs: 100, Count: 1}}
+	if histogram.Count != 6 || histogram.Overflow != 1 || !slices.Equal(histogram.Buckets, expected) {
+		t.Errorf("Expected 6 requests in %+v plus 1 overflow, got %+v", expected, histogram)
+	}
+
+	if all := sa.histogram(); len(all.Endpoints) != 2 || all.Endpoints["/hex/:h"].Buckets[1].Count != 1 {
+		t.Errorf("Expected both routes with /hex/:h in the 10ms bucket, got %+v", all)
+	}
+	if empty := sa.histogram("/primes/:p").Endpoints["/primes/:p"]; empty.Count != 0 || len(empty.Buckets) != 3 {
+		t.Errorf("Expected empty buckets for an unrecorded route, got %+v", empty)
+	}
+}
+
+// TestParseHistogramBuckets tests APEX_STATS_HISTOGRAM_BUCKETS parsing
+func TestParseHistogramBuckets(t *testing.T) {
+	buckets, err := parseHistogramBuckets("0.5, 1,10,100")
+	if err != nil || !slices.Equal(buckets, []float64{0.5, 1, 10, 100}) {
+		t.Errorf("Expected [0.5 1 10 100], got %v, %v", buckets, err)
+	}
+	for _, raw := range []string{"", "abc", "0", "-1", "1,1", "10,5", "1,,2", "Inf"} {
+		if _, err := parseHistogramBuckets(raw); err == nil {
+			t.Errorf("Expected an error for %q", raw)
+		}
+	}
+}
+
+// TestGetStatsHistogram tests that /stats/histogram accumulates requests by route
+func TestGetStatsHistogram(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := newAPIServer(defaultLoadLimits())
+	router := gin.New()
+	server.registerRoutes(router)
+
+	for _, path := range []string{"/primes/100", "/primes/200", "/primes/300", "/hex/1"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d", path, w.Code)
+		}
+	}
+
+	tests := []struct {
+		query  string
+		routes map[string]int64
+	}{
+		{"", map[string]int64{"/primes/:p": 3, "/hex/:h": 1}},
+		{"?path=/primes/100", map[string]int64{"/primes/:p": 3}},
+		{"?path=/primes/:p", map[string]int64{"/primes/:p": 3}},
+		{"?path=/primes/nth/5", map[string]int64{"/primes/nth/:n": 0}},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/stats/histogram"+tt.query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", tt.query, w.Code, w.Body.String())
+		}
+		result := decodeStrict[Response[HistogramResult]](t, w.Body.Bytes()).Data
+		if len(result.Endpoints) != len(tt.routes) {
+			t.Errorf("%s: expected routes %v, got %+v", tt.query, tt.routes, result.Endpoints)
+		}
+		for route, count := range tt.routes {
+			histogram, ok := result.Endpoints[route]
+			var bucketed int64
+			for _, bucket := range histogram.Buckets {
+				bucketed += bucket.Count
+			}
+			if !ok || histogram.Count != count || bucketed+histogram.Overflow != count || len(histogram.Buckets) != len(DefaultHistogramBucketsMs) {
+				t.Errorf("%s: expected %d requests across the buckets of %s, got %+v", tt.query, count, route, histogram)
+			}
+		}
+	}
+
+	for _, path := range []string{"/nope", "/primes", "/primes/1/2/3/4"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/stats/histogram?path="+path, nil))
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"param": "path"`) {
+			t.Errorf("Expected a 400 for path %s, got %d: %s", path, w.Code, w.Body.String())
+		}
+	}
+
+	template := strings.Split("/debug/pprof/*profile", "/")
+	if params, ok := matchRouteSegments(template, strings.Split("/debug/pprof/heap", "/")); !ok || params != 1 {
+		t.Errorf("Expected the wildcard to match /debug/pprof/heap, got %d, %t", params, ok)
+	}
+	if _, ok := matchRouteSegments(template, strings.Split("/debug", "/")); ok {
+		t.Error("Expected the wildcard not to match /debug")
+	}
+}
+
+// TestGetSysInfo tests that /sysinfo reports the host and runtime fields
+func TestGetSysInfo(t *testing.T) {
+	router := setupRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/sysinfo", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var response map[string]map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	for _, field := range []string{"hostname", "go_version", "os", "arch", "num_cpu", "gomaxprocs", "gogc", "goroutines",
+		"heap_alloc_bytes", "heap_sys_bytes", "num_gc", "ballast_bytes", "started_at", "uptime_seconds"} {
+		if _, ok := response["data"][field]; !ok {
+			t.Errorf("Expected field %s in %s", field, w.Body.String())
+		}
+	}
+
+	info := decodeStrict[Response[SysInfoResult]](t, w.Body.Bytes()).Data
+	if info.NumCPU <= 0 || info.GOMAXPROCS <= 0 {
+		t.Errorf("Expected positive CPU counts, got num_cpu=%d gomaxprocs=%d", info.NumCPU, info.GOMAXPROCS)
+	}
+	if info.GoVersion != runtime.Version() || info.HeapSysBytes < info.HeapAllocBytes || info.UptimeSeconds < 0 {
+		t.Errorf("Unexpected runtime fields: %+v", info)
+	}
+}
+
+// TestStatsdMiddleware tests that each request sends its timing and count to the StatsD address
+func TestStatsdMiddleware(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket failed: %v", err)
+	}
+	defer listener.Close()
+
+	client, err := newStatsdClient(listener.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("newStatsdClient failed: %v", err)
+	}
+	defer client.close()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	server := newAPIServer(defaultLoadLimits())
+	server.statsd = client
+	server.registerRoutes(router)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/primes/10", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	buf := make([]byte, 1500)
+	listener.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := listener.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("No StatsD packet received: %v", err)
+	}
+	lines := strings.Split(string(buf[:n]), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 metrics in the packet, got %q", buf[:n])
+	}
+	if !regexp.MustCompile(`^apex\.request\.duration:\d+\.\d{3}\|ms\|#endpoint:/primes/:p,status:200$`).MatchString(lines[0]) {
+		t.Errorf("Unexpected duration metric %q", lines[0])
+	}
+	if lines[1] != "apex.request.count:1|c|#endpoint:/primes/:p,status:200" {
+		t.Errorf("Unexpected count metric %q", lines[1])
+	}
+}
+
+// TestTracingSpans tests that a traced combined request exports a server span joined to the
+// incoming traceparent and one child span per sub-operation
+func TestTracingSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer provider.Shutdown(context.Background())
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	server := newAPIServer(defaultLoadLimits())
+	server.tracer = provider.Tracer(tracerName)
+	server.registerRoutes(router)
+
+	const traceID, parentID = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	req := httptest.NewRequest("GET", "/primes/hex/memory/10/1/1", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-"+parentID+"-01")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	// Spans are exported as they end, so the children precede the server span
+	spans := exporter.GetSpans()
+	if len(spans) != 4 {
+		t.Fatalf("Expected 4 spans, got %d", len(spans))
+	}
+	root := spans[3]
+	if root.Name != "GET /primes/hex/memory/:p/:h/:m" || root.SpanKind != trace.SpanKindServer {
+		t.Errorf("Unexpected server span %q (kind %s)", root.Name, root.SpanKind)
+	}
+	if root.SpanContext.TraceID().String() != traceID || root.Parent.SpanID().String() != parentID || !root.Parent.IsRemote() {
+		t.Errorf("Server span did not join the incoming trace: trace %s parent %s", root.SpanContext.TraceID(), root.Parent.SpanID())
+	}
+	if !slices.Contains(root.Attributes, attribute.Int("http.response.status_code", http.StatusOK)) {
+		t.Errorf("Expected status attribute 200, got %v", root.Attributes)
+	}
+	for i, name := range []string{"primes", "hex", "memory"} {
+		child := spans[i]
+		if child.Name != name || child.Parent.SpanID() != root.SpanContext.SpanID() || child.SpanContext.TraceID() != root.SpanContext.TraceID() || child.SpanKind != trace.SpanKindInternal {
+			t.Errorf("Child span %d: expected %q under the server span, got %q with parent %s", i, name, child.Name, child.Parent.SpanID())
+		}
+		if child.StartTime.Before(root.StartTime) || child.EndTime.After(root.EndTime) {
+			t.Errorf("Child span %q is not within the server span", name)
+		}
+	}
+
+	// An unsampled parent is honored, and a request without one starts a new trace
+	exporter.Reset()
+	req = httptest.NewRequest("GET", "/primes/10", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-"+parentID+"-00")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if spans := exporter.GetSpans(); len(spans) != 0 {
+		t.Errorf("Expected no spans for an unsampled parent, got %d", len(spans))
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/primes/10", nil))
+	if spans := exporter.GetSpans(); len(spans) != 1 || spans[0].SpanContext.TraceID() == root.SpanContext.TraceID() || spans[0].Parent.IsValid() {
+		t.Errorf("Expected one new root span, got %d", len(spans))
+	}
+}
+
+// TestNewTracerProvider tests that tracing follows the OTEL_* variables and exports OTLP/HTTP
+// protobuf with the configured headers and service name
+func TestNewTracerProvider(t *testing.T) {
+	var request coltracepb.ExportTraceServiceRequest
+	var auth string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Errorf("Unexpected export %s with content type %q", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := proto.Unmarshal(body, &request); err != nil {
+			t.Errorf("Failed to decode export: %v", err)
+		}
+	}))
+	defer collector.Close()
+
+	if provider, err := newTracerProvider(context.Background()); provider != nil || err != nil {
+		t.Errorf("Expected tracing off without an endpoint, got %v, %v", provider, err)
+	}
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", collector.URL)
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "Authorization=Bearer%20abc")
+	t.Setenv("OTEL_SERVICE_NAME", "loadgen")
+	provider, err := newTracerProvider(context.Background())
+	if provider == nil || err != nil {
+		t.Fatalf("Expected a tracer provider, got %v, %v", provider, err)
+	}
+	_, span := provider.Tracer(tracerName).Start(context.Background(), "GET /primes/:p")
+	span.End()
+	if err := provider.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	if auth != "Bearer abc" {
+		t.Errorf("Expected the OTLP header to be sent, got %q", auth)
+	}
+	if len(request.ResourceSpans) != 1 {
+		t.Fatalf("Expected one resource in the export, got %d", len(request.ResourceSpans))
+	}
+	var serviceName string
+	for _, kv := range request.ResourceSpans[0].Resource.Attributes {
+		if kv.Key == "service.name" {
+			serviceName = kv.Value.GetStringValue()
+		}
+	}
+	if serviceName != "loadgen" {
+		t.Errorf("Expected service.name loadgen, got %q", serviceName)
+	}
+	if spans := request.ResourceSpans[0].ScopeSpans[0].Spans; len(spans) != 1 || spans[0].Name != "GET /primes/:p" {
+		t.Errorf("Expected the span to be exported, got %v", spans)
+	}
+
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "http/json")
+	if _, err := newTracerProvider(context.Background()); err == nil {
+		t.Error("Expected an error for an unsupported protocol")
+	}
+	t.Setenv("OTEL_TRACES_EXPORTER", "none")
+	if provider, _ := newTracerProvider(context.Background()); provider != nil {
+		t.Error("Expected OTEL_TRACES_EXPORTER=none to disable tracing")
+	}
+}
+
+// TestGetStats tests that /stats reflects handled requests and /stats/reset clears them
+func TestGetStats(t *testing.T) {
+	router := setupRouter()
+
+	for _, url := range []string{"/primes/10", "/primes/20", "/primes/invalid", "/hex/1"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		router.ServeHTTP(w, req)
+	}
+
+	getStats := func() StatsResult {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/stats", nil)
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		var response struct {
+			Data StatsResult `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		return response.Data
+	}
+
+	stats := getStats()
+	primes := stats.Endpoints["/primes/:p"]
+	if primes.Requests != 3 || primes.Errors != 1 {
+		t.Errorf("Expected 3 /primes/:p requests with 1 error, got %+v", primes)
+	}
+	if primes.Latency.MinMs <= 0 || primes.Latency.MinMs > primes.Latency.MaxMs {
+		t.Errorf("Expected positive, ordered latencies, got %+v", primes.Latency)
+	}
+	if stats.Endpoints["/hex/:h"].Requests != 1 {
+		t.Errorf("Expected 1 /hex/:h request, got %+v", stats.Endpoints["/hex/:h"])
+	}
+	if stats.TotalRequests != 4 || stats.TotalErrors != 1 {
+		t.Errorf("Expected 4 requests and 1 error in total, got %d and %d", stats.TotalRequests, stats.TotalErrors)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/stats/reset", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 from reset, got %d", w.Code)
+	}
+
+	// The reset request itself is recorded after it clears the totals
+	stats = getStats()
+	if stats.TotalRequests != 1 || stats.Endpoints["/stats/reset"].Requests != 1 || stats.Endpoints["/primes/:p"].Requests != 0 {
+		t.Errorf("Expected stats to be cleared by reset, got %+v", stats)
+	}
+}
+
+// TestDisableRequestMetrics tests that request_metrics is omitted when disabled per request or server-wide
+func TestDisableRequestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	enabledRouter := setupRouter()
+
+	disabledServer := newAPIServer(defaultLoadLimits())
+	disabledServer.metricsDisabled = true
+	disabledRouter := gin.New()
+	disabledServer.registerRoutes(disabledRouter)
+
+	tests := []struct {
+		name          string
+		router        *gin.Engine
+		url           string
+		expectMetrics bool
+	}{
+		{"Enabled by default", enabledRouter, "/primes/10", true},
+		{"Explicitly enabled", enabledRouter, "/primes/10?metrics=true", true},
+		{"Disabled per request", enabledRouter, "/primes/10?metrics=false", false},
+		{"Disabled per request on combined endpoint", enabledRouter, "/primes/hex/memory/5/1/10?metrics=0", false},
+		{"Disabled server-wide", disabledRouter, "/hex/1", false},
+		{"Server-wide setting wins over query", disabledRouter, "/hex/1?metrics=true", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			tt.router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", w.Code)
+			}
+
+			var response map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse JSON response: %v", err)
+			}
+
+			if _, ok := response["data"]; !ok {
+				t.Error("Expected 'data' field in response")
+			}
+			if _, ok := response["request_metrics"]; ok != tt.expectMetrics {
+				t.Errorf("Expected request_metrics present=%v, got %v", tt.expectMetrics, ok)
+			}
+		})
+	}
+}
+
+// TestEnvBool tests boolean environment variable parsing
+func TestEnvBool(t *testing.T) {
+	if envBool("APEX_TEST_BOOL", true) != true {
+		t.Error("Expected default when unset")
+	}
+
+	t.Setenv("APEX_TEST_BOOL", "true")
+	if envBool("APEX_TEST_BOOL", false) != true {
+		t.Error("Expected true when set to 'true'")
+	}
+
+	t.Setenv("APEX_TEST_BOOL", "maybe")
+	if envBool("APEX_TEST_BOOL", false) != false {
+		t.Error("Expected default for invalid value")
+	}
+}
+
+// TestEnvPositiveFloat tests positive float environment variable parsing
+func TestEnvPositiveFloat(t *testing.T) {
+	if envPositiveFloat("APEX_TEST_FLOAT", 2.5) != 2.5 {
+		t.Error("Expected default when unset")
+	}
+
+	t.Setenv("APEX_TEST_FLOAT", "0.5")
+	if envPositiveFloat("APEX_TEST_FLOAT", 2.5) != 0.5 {
+		t.Error("Expected 0.5 when set to '0.5'")
+	}
+
+	for _, raw := range []string{"-1", "0", "fast", "Inf", "NaN"} {
+		t.Setenv("APEX_TEST_FLOAT", raw)
+		if envPositiveFloat("APEX_TEST_FLOAT", 2.5) != 2.5 {
+			t.Errorf("Expected default for invalid value %q", raw)
+		}
+	}
+}
+
+// TestShutdown tests that the graceful shutdown helper succeeds on a fresh server
+func TestShutdown(t *testing.T) {
+	server := newAPIServer(defaultLoadLimits())
+	srv := &http.Server{Handler: http.NewServeMux()}
+
+	if err := server.shutdown(time.Second, "test", srv); err != nil {
+		t.Errorf("Expected shutdown to succeed, got %v", err)
+	}
+}
+
+// TestResolveTLSConfig tests TLS configuration from APEX_TLS_CERT, APEX_TLS_KEY, and -tls-port
+func TestResolveTLSConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		certFile  string
+		keyFile   string
+		port      int
+		expectTLS bool
+		expectErr string
+	}{
+		{name: "Neither set", expectTLS: false},
+		{name: "Both set", certFile: "cert.pem", keyFile: "key.pem", expectTLS: true},
+		{name: "Both set with separate port", certFile: "cert.pem", keyFile: "key.pem", port: 8443, expectTLS: true},
+		{name: "Only cert", certFile: "cert.pem", expectErr: "APEX_TLS_KEY"},
+		{name: "Only key", keyFile: "key.pem", expectErr: "APEX_TLS_CERT"},
+		{name: "Port without files", port: 8443, expectErr: "requires APEX_TLS_CERT and APEX_TLS_KEY"},
+		{name: "Port out of range", certFile: "cert.pem", keyFile: "key.pem", port: 70000, expectErr: "out of range"},
+		{name: "Port clashes with HTTP", certFile: "cert.pem", keyFile: "key.pem", port: HTTPPort, expectErr: "plain HTTP port"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := resolveTLSConfig(tt.certFile, tt.keyFile, tt.port, HTTPPort)
+			if tt.expectErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectErr) {
+					t.Errorf("Expected an error mentioning %q, got %v", tt.expectErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if (config != nil) != tt.expectTLS {
+				t.Fatalf("Expected TLS enabled=%v, got %+v", tt.expectTLS, config)
+			}
+			if config != nil && (config.certFile != tt.certFile || config.keyFile != tt.keyFile || config.port != tt.port) {
+				t.Errorf("Expected %s, %s, port %d, got %+v", tt.certFile, tt.keyFile, tt.port, config)
+			}
+		})
+	}
+}
+
+// TestTrackInFlight tests that in-flight requests are counted while being handled
+func TestTrackInFlight(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := newAPIServer(defaultLoadLimits())
+	router := gin.New()
+	router.Use(server.trackInFlight())
+
+	var during int64
+	router.GET("/probe", func(c *gin.Context) {
+		during = server.inFlight.Load()
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/probe", nil)
+	router.ServeHTTP(w, req)
+
+	if during != 1 {
+		t.Errorf("Expected 1 in-flight request during handling, got %d", during)
+	}
+	if after := server.inFlight.Load(); after != 0 {
+		t.Errorf("Expected 0 in-flight requests after handling, got %d", after)
+	}
+}
+
+// TestLimitConcurrency tests that with N load slots the N+1th concurrent load request is rejected
+// with a 503 (or queued when a queue timeout is set), while operational routes bypass the limit
+func TestLimitConcurrency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const slots = 2
+
+	newServer := func(queueTimeout time.Duration) (*gin.Engine, chan struct{}, *sync.WaitGroup) {
+		server := newAPIServer(defaultLoadLimits())
+		server.ready.Store(true)
+		server.loadSlots = make(chan struct{}, slots)
+		server.queueTimeout = queueTimeout
+		router := gin.New()
+		server.registerRoutes(router)
+
+		release := make(chan struct{})
+		var started sync.WaitGroup
+		router.GET("/block", func(c *gin.Context) {
+			started.Done()
+			<-release
+			c.Status(http.StatusOK)
+		})
+		return router, release, &started
+	}
+
+	// fill occupies every slot with a blocked request and returns a WaitGroup for their completion
+	fill := func(router *gin.Engine, started *sync.WaitGroup) *sync.WaitGroup {
+		var done sync.WaitGroup
+		started.Add(slots)
+		for i := 0; i < slots; i++ {
+			done.Add(1)
+			go func() {
+				defer done.Done()
+				w := httptest.NewRecorder()
+				req, _ := http.NewRequest("GET", "/block", nil)
+				router.ServeHTTP(w, req)
+			}()
+		}
+		started.Wait()
+		return &done
+	}
+
+	t.Run("Reject when full", func(t *testing.T) {
+		router, release, started := newServer(0)
+		done := fill(router, started)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/primes/10", nil)
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected status 503 for request %d, got %d", slots+1, w.Code)
+		}
+		if w.Header().Get("Retry-After") == "" {
+			t.Error("Expected a Retry-After header")
+		}
+
+		for _, path := range []string{"/healthz", "/readyz", "/metrics", "/stats"} {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", path, nil)
+			router.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Errorf("Expected %s to bypass the limiter, got %d", path, w.Code)
+			}
+		}
+
+		close(release)
+		done.Wait()
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/primes/10", nil)
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status 200 once slots are free, got %d", w.Code)
+		}
+	})
+
+	t.Run("Queue until a slot frees", func(t *testing.T) {
+		router, release, started := newServer(5 * time.Second)
+		done := fill(router, started)
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			close(release)
+		}()
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/primes/10", nil)
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected the queued request to succeed, got %d", w.Code)
+		}
+		done.Wait()
+	})
+
+	t.Run("Queue timeout", func(t *testing.T) {
+		router, release, started := newServer(20 * time.Millisecond)
+		done := fill(router, started)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/primes/10", nil)
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected status 503 after the queue timeout, got %d", w.Code)
+		}
+
+		close(release)
+		done.Wait()
+	})
+}
+
+// TestRateLimiterRefill tests the per-route limiter: a full burst, then one token per 1/rate seconds
+func TestRateLimiterRefill(t *testing.T) {
+	limiter := newRateLimiter(2, 3)
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.allow("/primes/:p", now); !ok {
+			t.Fatalf("Expected request %d of the burst to be allowed", i+1)
+		}
+	}
+	ok, wait := limiter.allow("/primes/:p", now)
+	if ok || wait != 500*time.Millisecond {
+		t.Errorf("Expected rejection with a 500ms wait, got %v, %s", ok, wait)
+	}
+	if ok, _ := limiter.allow("/hash/:n", now); !ok {
+		t.Error("Expected a separate bucket per route")
+	}
+
+	if ok, _ := limiter.allow("/primes/:p", now.Add(500*time.Millisecond)); !ok {
+		t.Error("Expected a token after 1/rate seconds")
+	}
+	if ok, _ := limiter.allow("/primes/:p", now.Add(500*time.Millisecond)); ok {
+		t.Error("Expected only one token after 1/rate seconds")
+	}
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.allow("/primes/:p", now.Add(time.Hour)); !ok {
+			t.Fatalf("Expected a full burst after a long idle period, rejected request %d", i+1)
+		}
+	}
+	if ok, _ := limiter.allow("/primes/:p", now.Add(time.Hour)); ok {
+		t.Error("Expected refill to stop at the burst size")
+	}
+}
+
+// TestLimitRate tests that load requests beyond the rate get 429 with Retry-After while
+// health and metrics requests are never limited
+func TestLimitRate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := newAPIServer(defaultLoadLimits())
+	server.rateLimiter.Store(newRateLimiter(0.5, 2))
+	router := gin.New()
+	server.registerRoutes(router)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := get("/primes/10"); w.Code != http.StatusOK {
+			t.Fatalf("Expected burst request %d to succeed, got %d", i+1, w.Code)
+		}
+	}
+	w := get("/primes/10")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status 429 beyond the rate, got %d", w.Code)
+	}
+	if retryAfter := w.Header().Get("Retry-After"); retryAfter != "2" {
+		t.Errorf("Expected Retry-After: 2, got %q", retryAfter)
+	}
+	if w := get("/primes/20"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the same route with another value to share the bucket, got %d", w.Code)
+	}
+	if w := get("/hash/10"); w.Code != http.StatusOK {
+		t.Errorf("Expected another endpoint to have its own bucket, got %d", w.Code)
+	}
+
+	for i := 0; i < 5; i++ {
+		for _, path := range []string{"/healthz", "/metrics"} {
+			if w := get(path); w.Code != http.StatusOK {
+				t.Errorf("Expected %s to bypass the rate limit, got %d", path, w.Code)
+			}
+		}
+	}
+}
+
+// TestRequireAuth tests bearer-token auth with a valid token, an invalid token, and auth disabled
+func TestRequireAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	newRouter := func(token string) *gin.Engine {
+		server := newAPIServer(defaultLoadLimits())
+		server.authToken = token
+		server.ready.Store(true)
+		router := gin.New()
+		server.registerRoutes(router)
+		return router
+	}
+	get := func(router *gin.Engine, path, authorization string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Valid token", func(t *testing.T) {
+		router := newRouter("s3cret")
+		if w := get(router, "/primes/10", "Bearer s3cret"); w.Code != http.StatusOK {
+			t.Errorf("Expected status 200 with the right token, got %d", w.Code)
+		}
+	})
+
+	t.Run("Invalid token", func(t *testing.T) {
+		router := newRouter("s3cret")
+		for _, authorization := range []string{"", "Bearer wrong", "Bearer s3cret2", "Basic s3cret", "s3cret"} {
+			w := get(router, "/primes/10", authorization)
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("Expected status 401 for Authorization %q, got %d", authorization, w.Code)
+				continue
+			}
+			if w.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("Expected a WWW-Authenticate challenge for Authorization %q", authorization)
+			}
+			var response ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || response.Error.Code != CodeUnauthorized {
+				t.Errorf("Expected an unauthorized error, got %s", w.Body.String())
+			}
+		}
+	})
+
+	t.Run("Probes stay open", func(t *testing.T) {
+		router := newRouter("s3cret")
+		for _, path := range []string{"/healthz", "/readyz"} {
+			if w := get(router, path, ""); w.Code != http.StatusOK {
+				t.Errorf("Expected %s to skip auth, got %d", path, w.Code)
+			}
+		}
+		if w := get(router, "/metrics", ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected /metrics to require the token, got %d", w.Code)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		router := newRouter("")
+		for _, authorization := range []string{"", "Bearer anything"} {
+			if w := get(router, "/primes/10", authorization); w.Code != http.StatusOK {
+				t.Errorf("Expected status 200 with auth disabled and Authorization %q, got %d", authorization, w.Code)
+			}
+		}
+	})
+}
+
+// TestParseCORSOrigins tests splitting APEX_CORS_ORIGINS
+func TestParseCORSOrigins(t *testing.T) {
+	got := parseCORSOrigins(" https://a.example.com ,,http://localhost:3000")
+	expected := []string{"https://a.example.com", "http://localhost:3000"}
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+	if origins := parseCORSOrigins(""); len(origins) != 0 {
+		t.Errorf("Expected no origins for an empty value, got %v", origins)
+	}
+}
+
+// TestParseEnabledEndpoints tests APEX_ENABLED_ENDPOINTS parsing
+func TestParseEnabledEndpoints(t *testing.T) {
+	enabled, err := parseEnabledEndpoints(" primes, Memory,,disk ")
+	if err != nil || len(enabled) != 3 || !enabled["primes"] || !enabled["memory"] || !enabled["disk"] {
+		t.Errorf("Expected primes, memory, and disk, got %v, %v", enabled, err)
+	}
+	if enabled, err := parseEnabledEndpoints(""); enabled != nil || err != nil {
+		t.Errorf("Expected nil (everything enabled) for an empty list, got %v, %v", enabled, err)
+	}
+	for _, raw := range []string{"prime", "primes,healthz", "/primes"} {
+		if _, err := parseEnabledEndpoints(raw); err == nil {
+			t.Errorf("Expected an error for %q", raw)
+		}
+	}
+}
+
+// TestEnabledEndpoints tests that only the enabled load routes are registered
+func TestEnabledEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := newAPIServer(defaultLoadLimits())
+	server.enabledRoutes = map[string]bool{"primes": true}
+	router := gin.New()
+	server.registerRoutes(router)
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{"GET", "/primes/10", http.StatusOK},
+		{"GET", "/primes/nth/10", http.StatusOK},
+		{"HEAD", "/primes/10", http.StatusOK},
+		{"GET", "/memory/10", http.StatusNotFound},
+		{"HEAD", "/memory/10", http.StatusNotFound},
+		{"GET", "/fibonacci/10", http.StatusNotFound},
+		{"GET", "/load?primes=10", http.StatusNotFound},
+		{"POST", "/warmup", http.StatusNotFound},
+		{"GET", "/healthz", http.StatusOK},
+		{"GET", "/stats", http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.path, tt.status, w.Code)
+		}
+	}
+
+	for _, route := range server.routes {
+		if !operationalRoutes[route.Path] && endpointName(route.Path) != "primes" {
+			t.Errorf("Expected only /primes load routes, found %s %s", route.Method, route.Path)
+		}
+	}
+}
+
+// TestCORS tests preflight handling and origin echoing
+func TestCORS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	newRouter := func(origins ...string) *gin.Engine {
+		server := newAPIServer(defaultLoadLimits())
+		server.corsOrigins = origins
+		server.authToken = "s3cret"
+		router := gin.New()
+		server.registerRoutes(router)
+		return router
+	}
+	do := func(router *gin.Engine, method, origin string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/primes/10", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Authorization", "Bearer s3cret")
+		if method == http.MethodOptions {
+			req.Header.Del("Authorization")
+			req.Header.Set("Access-Control-Request-Method", "GET")
+			req.Header.Set("Access-Control-Request-Headers", "authorization")
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Preflight", func(t *testing.T) {
+		w := do(newRouter("https://dash.example.com"), http.MethodOptions, "https://dash.example.com")
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("Expected status 204 for an uncredentialed preflight, got %d", w.Code)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://dash.example.com" {
+			t.Errorf("Expected the origin echoed, got %q", got)
+		}
+		if methods := w.Header().Get("Access-Control-Allow-Methods"); !strings.Contains(methods, "GET") {
+			t.Errorf("Expected GET in Access-Control-Allow-Methods, got %q", methods)
+		}
+		if headers := w.Header().Get("Access-Control-Allow-Headers"); !strings.Contains(headers, "Authorization") {
+			t.Errorf("Expected Authorization in Access-Control-Allow-Headers, got %q", headers)
+		}
+	})
+
+	t.Run("Allowed origin", func(t *testing.T) {
+		w := do(newRouter("https://dash.example.com", "http://localhost:3000"), http.MethodGet, "http://localhost:3000")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != "http://localhost:3000" {
+			t.Errorf("Expected the origin echoed, got %q", got)
+		}
+		if vary := w.Header().Get("Vary"); !strings.Contains(vary, "Origin") {
+			t.Errorf("Expected Vary: Origin, got %q", vary)
+		}
+	})
+
+	t.Run("Any origin", func(t *testing.T) {
+		w := do(newRouter("*"), http.MethodGet, "https://anywhere.example.com")
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+			t.Errorf("Expected *, got %q", got)
+		}
+	})
+
+	t.Run("Other origin", func(t *testing.T) {
+		router := newRouter("https://dash.example.com")
+		if w := do(router, http.MethodGet, "https://evil.example.com"); w.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("Expected no CORS headers for an unlisted origin, got %v", w.Header())
+		}
+		if w := do(router, http.MethodOptions, "https://evil.example.com"); w.Code == http.StatusNoContent {
+			t.Error("Expected no preflight answer for an unlisted origin")
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		router := newRouter()
+		if w := do(router, http.MethodGet, "https://dash.example.com"); w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("Expected unchanged behavior with no origins, got %d %v", w.Code, w.Header())
+		}
+	})
+}
 
-			if w.Code != tt.expectedStatus {
-				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+// TestParseErrorInjection tests validation of the error rate and status
+func TestParseErrorInjection(t *testing.T) {
+	for raw, expected := range map[string]float64{"0": 0, "0.25": 0.25, "1": 1, " 1.0 ": 1} {
+		if rate, err := parseErrorRate(raw); err != nil || rate != expected {
+			t.Errorf("parseErrorRate(%q) = %g, %v; expected %g", raw, rate, err, expected)
+		}
+	}
+	for raw, code := range map[string]string{"often": CodeInvalidNumber, "-0.1": CodeOutOfRange, "1.5": CodeOutOfRange, "NaN": CodeOutOfRange} {
+		if _, err := parseErrorRate(raw); errorCode(err) != code {
+			t.Errorf("parseErrorRate(%q) error = %v, expected code %s", raw, err, code)
+		}
+	}
+	if status, err := parseErrorStatus("503"); err != nil || status != 503 {
+		t.Errorf("parseErrorStatus(\"503\") = %d, %v", status, err)
+	}
+	for _, raw := range []string{"200", "600", "oops"} {
+		if _, err := parseErrorStatus(raw); err == nil {
+			t.Errorf("Expected an error for status %q", raw)
+		}
+	}
+}
+
+// TestInjectErrors tests that error_rate=1 always fails, error_rate=0 never does, and the defaults apply
+func TestInjectErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	newRouter := func(rate float64, status int) *gin.Engine {
+		server := newAPIServer(defaultLoadLimits())
+		config := defaultConfig()
+		config.ErrorRate = rate
+		if status != 0 {
+			config.ErrorStatus = status
+		}
+		server.setConfig(config)
+		router := gin.New()
+		server.registerRoutes(router)
+		return router
+	}
+	get := func(router *gin.Engine, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	router := newRouter(0, 0)
+	t.Run("Rate 1 always errors", func(t *testing.T) {
+		for i := 0; i < 50; i++ {
+			w := get(router, "/primes/10?error_rate=1")
+			if w.Code != http.StatusInternalServerError {
+				t.Fatalf("Expected status 500 on request %d, got %d", i+1, w.Code)
 			}
+			var response ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || response.Error.Code != CodeInjectedFault {
+				t.Fatalf("Expected an injected_fault error, got %s", w.Body.String())
+			}
+		}
+	})
 
-			if !tt.expectError {
-				var response map[string]interface{}
-				err := json.Unmarshal(w.Body.Bytes(), &response)
-				if err != nil {
-					t.Errorf("Failed to parse JSON response: %v", err)
-				}
+	t.Run("Rate 0 never errors", func(t *testing.T) {
+		for i := 0; i < 50; i++ {
+			if w := get(router, "/primes/10?error_rate=0"); w.Code != http.StatusOK {
+				t.Fatalf("Expected status 200 on request %d, got %d", i+1, w.Code)
+			}
+		}
+	})
 
-				if _, ok := response["data"]; !ok {
-					t.Error("Expected 'data' field in response")
-				}
-				if _, ok := response["request_metrics"]; !ok {
-					t.Error("Expected 'request_metrics' field in response")
-				}
+	t.Run("Custom status", func(t *testing.T) {
+		if w := get(router, "/primes/10?error_rate=1&error_status=503"); w.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected status 503, got %d", w.Code)
+		}
+	})
+
+	t.Run("Invalid parameters", func(t *testing.T) {
+		for _, query := range []string{"error_rate=2", "error_rate=x", "error_rate=1&error_status=200"} {
+			if w := get(router, "/primes/10?"+query); w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status 400 for %s, got %d", query, w.Code)
 			}
-		})
+		}
+	})
+
+	t.Run("Server defaults", func(t *testing.T) {
+		router := newRouter(1, http.StatusBadGateway)
+		if w := get(router, "/primes/10"); w.Code != http.StatusBadGateway {
+			t.Errorf("Expected the APEX_ERROR_STATUS default 502, got %d", w.Code)
+		}
+		if w := get(router, "/primes/10?error_rate=0"); w.Code != http.StatusOK {
+			t.Errorf("Expected ?error_rate=0 to override the default, got %d", w.Code)
+		}
+		if w := get(router, "/healthz"); w.Code != http.StatusOK {
+			t.Errorf("Expected operational routes to be spared, got %d", w.Code)
+		}
+	})
+}
+
+// TestParseDurationRange tests fixed and jittered duration parsing
+func TestParseDurationRange(t *testing.T) {
+	r := newRandSource()
+	if d, err := parseDurationRange("200ms", time.Second, r); err != nil || d != 200*time.Millisecond {
+		t.Errorf("Expected 200ms, got %s, %v", d, err)
+	}
+	for i := 0; i < 100; i++ {
+		d, err := parseDurationRange("100ms..500ms", time.Second, r)
+		if err != nil || d < 100*time.Millisecond || d > 500*time.Millisecond {
+			t.Fatalf("Expected a duration within 100ms..500ms, got %s, %v", d, err)
+		}
+	}
+	tests := map[string]string{
+		"soon":        CodeInvalidDuration,
+		"2s":          CodeOutOfRange,
+		"100ms..2s":   CodeOutOfRange,
+		"500ms..1x":   CodeInvalidDuration,
+		"500ms..10ms": CodeInvalidRange,
+	}
+	for param, code := range tests {
+		if _, err := parseDurationRange(param, time.Second, r); errorCode(err) != code {
+			t.Errorf("parseDurationRange(%q) error = %v, expected code %s", param, err, code)
+		}
 	}
 }
 
-// TestGetHexString tests the hex string generation endpoint
-func TestGetHexString(t *testing.T) {
+// TestInjectLatency tests that ?delay= slows responses and that cancellation cuts the sleep short
+func TestInjectLatency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := newAPIServer(defaultLoadLimits())
+	router := gin.New()
+	server.registerRoutes(router)
+
+	timed := func(req *http.Request) (*httptest.ResponseRecorder, time.Duration) {
+		w := httptest.NewRecorder()
+		start := time.Now()
+		router.ServeHTTP(w, req)
+		return w, time.Since(start)
+	}
+
+	t.Run("Fixed delay", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/primes/10?delay=100ms", nil)
+		w, elapsed := timed(req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		if elapsed < 100*time.Millisecond {
+			t.Errorf("Expected at least 100ms, took %s", elapsed)
+		}
+	})
+
+	t.Run("Jittered delay", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/primes/10?delay=20ms..60ms", nil)
+		if w, elapsed := timed(req); w.Code != http.StatusOK || elapsed < 20*time.Millisecond {
+			t.Errorf("Expected status 200 after at least 20ms, got %d after %s", w.Code, elapsed)
+		}
+	})
+
+	t.Run("Client cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+		req, _ := http.NewRequestWithContext(ctx, "GET", "/primes/10?delay=10s", nil)
+		w, elapsed := timed(req)
+		if elapsed > 2*time.Second {
+			t.Errorf("Expected cancellation to end the sleep early, took %s", elapsed)
+		}
+		if w.Code != StatusClientClosedRequest {
+			t.Errorf("Expected status %d for an abandoned request, got %d", StatusClientClosedRequest, w.Code)
+		}
+	})
+
+	t.Run("Request timeout", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/primes/10?delay=10s&timeout=50ms", nil)
+		w, elapsed := timed(req)
+		if w.Code != http.StatusServiceUnavailable || elapsed > 2*time.Second {
+			t.Errorf("Expected a prompt 503, got %d after %s", w.Code, elapsed)
+		}
+	})
+
+	t.Run("Invalid delay", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/primes/10?delay=1h", nil)
+		if w, _ := timed(req); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 over the limit, got %d", w.Code)
+		}
+	})
+
+	t.Run("Server default", func(t *testing.T) {
+		server := newAPIServer(defaultLoadLimits())
+		server.delay = "60ms"
+		router := gin.New()
+		server.registerRoutes(router)
+		start := time.Now()
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/primes/10", nil)
+		router.ServeHTTP(w, req)
+		if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+			t.Errorf("Expected the APEX_DELAY default to apply, took %s", elapsed)
+		}
+
+		start = time.Now()
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/healthz", nil)
+		router.ServeHTTP(w, req)
+		if elapsed := time.Since(start); elapsed >= 60*time.Millisecond {
+			t.Errorf("Expected operational routes to skip the delay, took %s", elapsed)
+		}
+	})
+}
+
+// TestGetStatusCode tests that /status/:code answers with the requested status
+func TestGetStatusCode(t *testing.T) {
 	router := setupRouter()
 
 	tests := []struct {
-		name           string
-		param          string
+		url            string
 		expectedStatus int
-		expectError    bool
+		expectedText   string
 	}{
-		{
-			name:           "Valid hex generation",
-			param:          "1",
-			expectedStatus: http.StatusOK,
-			expectError:    false,
-		},
-		{
-			name:           "Valid hex range",
-			param:          "1..3",
-			expectedStatus: http.StatusOK,
-			expectError:    false,
-		},
-		{
-			name:           "Invalid parameter",
-			param:          "invalid",
-			expectedStatus: http.StatusBadRequest,
-			expectError:    true,
-		},
-		{
-			name:           "Exceeds maximum",
-			param:          "50000",
-			expectedStatus: http.StatusBadRequest,
-			expectError:    true,
-		},
+		{"/status/404", http.StatusNotFound, "Not Found"},
+		{"/status/503", http.StatusServiceUnavailable, "Service Unavailable"},
+		{"/status/200", http.StatusOK, "OK"},
+		{"/status/204", http.StatusNoContent, ""},
+		{"/status/600", http.StatusBadRequest, ""},
+		{"/status/99", http.StatusBadRequest, ""},
+		{"/status/teapot", http.StatusBadRequest, ""},
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
+		t.Run(tt.url, func(t *testing.T) {
 			w := httptest.NewRecorder()
-			req, _ := http.NewRequest("GET", "/hex/"+tt.param, nil)
+			req, _ := http.NewRequest("GET", tt.url, nil)
 			router.ServeHTTP(w, req)
 
 			if w.Code != tt.expectedStatus {
-				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
 			}
-
-			if !tt.expectError {
-				var response map[string]interface{}
-				err := json.Unmarshal(w.Body.Bytes(), &response)
-				if err != nil {
-					t.Errorf("Failed to parse JSON response: %v", err)
+			switch {
+			case tt.expectedStatus == http.StatusBadRequest:
+				var response ErrorResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || response.Error.Param != "code" {
+					t.Errorf("Expected an error for param code, got %s", w.Body.String())
 				}
-
-				if _, ok := response["data"]; !ok {
-					t.Error("Expected 'data' field in response")
+			case tt.expectedText == "":
+				if w.Body.Len() != 0 {
+					t.Errorf("Expected no body, got %q", w.Body.String())
 				}
-				if _, ok := response["request_metrics"]; !ok {
-					t.Error("Expected 'request_metrics' field in response")
+			default:
+				response := decodeStrict[Response[StatusCodeResult]](t, w.Body.Bytes())
+				if response.Data.StatusCode != tt.expectedStatus || response.Data.StatusText != tt.expectedText {
+					t.Errorf("Expected %d %q, got %+v", tt.expectedStatus, tt.expectedText, response.Data)
 				}
 			}
 		})
 	}
 }
 
-// TestGetFibonacciHex tests the combined Fibonacci + hex endpoint
-func TestGetFibonacciHex(t *testing.T) {
+// TestHeadLoadRoutes tests that HEAD on load routes returns GET's status and Content-Type with no
+// body and without doing (or validating) the work
+func TestHeadLoadRoutes(t *testing.T) {
+	router := setupRouter()
+
+	tests := []struct {
+		path, accept, contentType string
+		status                    int
+	}{
+		{"/primes/100", "", "application/json; charset=utf-8", http.StatusOK},
+		{"/primes/100", "text/plain", "text/plain; charset=utf-8", http.StatusOK},
+		{"/primes/999999999?error_rate=1", "", "application/json; charset=utf-8", http.StatusOK},
+		{"/hex/stream/10", "", "text/plain; charset=utf-8", http.StatusOK},
+		{"/primes/sse/10", "", "text/event-stream", http.StatusOK},
+		{"/status/503", "", "application/json; charset=utf-8", http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("HEAD", tt.path, nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		router.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Errorf("HEAD %s: expected status %d, got %d", tt.path, tt.status, w.Code)
+		}
+		if got := w.Header().Get("Content-Type"); got != tt.contentType {
+			t.Errorf("HEAD %s: expected Content-Type %q, got %q", tt.path, tt.contentType, got)
+		}
+		if tt.path != "/status/503" && w.Body.Len() != 0 {
+			t.Errorf("HEAD %s: expected no body, got %d bytes", tt.path, w.Body.Len())
+		}
+	}
+
+	for _, path := range []string{"/ws", "/healthz"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("HEAD", path, nil)
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("HEAD %s: expected status 404, got %d", path, w.Code)
+		}
+	}
+}
+
+// TestGetHealthz tests the liveness endpoint
+func TestGetHealthz(t *testing.T) {
 	router := setupRouter()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/healthz", nil)
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+
+	if response["status"] != "ok" {
+		t.Errorf("Expected status 'ok', got %v", response["status"])
+	}
+	if _, ok := response["request_metrics"]; ok {
+		t.Error("Expected no 'request_metrics' in liveness response")
+	}
+}
+
+// TestGetReadyz tests that the readiness endpoint follows the ready flag
+func TestGetReadyz(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := newAPIServer(defaultLoadLimits())
+	router := gin.New()
+	server.registerRoutes(router)
 
 	tests := []struct {
 		name           string
-		fibParam       string
-		hexParam       string
+		ready          bool
 		expectedStatus int
-		expectError    bool
+		expectedBody   string
 	}{
-		{
-			name:           "Valid combined operation",
-			fibParam:       "5",
-			hexParam:       "1",
-			expectedStatus: http.StatusOK,
-			expectError:    false,
-		},
-		{
-			name:           "Valid with ranges",
-			fibParam:       "3..7",
-			hexParam:       "1..3",
-			expectedStatus: http.StatusOK,
-			expectError:    false,
-		},
-		{
-			name:           "Invalid fibonacci parameter",
-			fibParam:       "invalid",
-			hexParam:       "1",
-			expectedStatus: http.StatusBadRequest,
-			expectError:    true,
-		},
-		{
-			name:           "Invalid hex parameter",
-			fibParam:       "5",
-			hexParam:       "invalid",
-			expectedStatus: http.StatusBadRequest,
-			expectError:    true,
-		},
+		{"Not ready before warmup", false, http.StatusServiceUnavailable, "not ready"},
+		{"Ready after warmup", true, http.StatusOK, "ready"},
+		{"Not ready again during shutdown", false, http.StatusServiceUnavailable, "not ready"},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			server.ready.Store(tt.ready)
+
 			w := httptest.NewRecorder()
-			req, _ := http.NewRequest("GET", "/fibonacci/hex/"+tt.fibParam+"/"+tt.hexParam, nil)
+			req, _ := http.NewRequest("GET", "/readyz", nil)
 			router.ServeHTTP(w, req)
 
 			if w.Code != tt.expectedStatus {
 				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
 			}
 
-			if !tt.expectError {
-				var response map[string]interface{}
-				err := json.Unmarshal(w.Body.Bytes(), &response)
-				if err != nil {
-					t.Errorf("Failed to parse JSON response: %v", err)
-				}
+			var response map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse JSON response: %v", err)
+			}
+			if response["status"] != tt.expectedBody {
+				t.Errorf("Expected status %q, got %v", tt.expectedBody, response["status"])
+			}
+		})
+	}
+}
 
-				data, ok := response["data"].(map[string]interface{})
-				if !ok {
-					t.Error("Expected 'data' field to be an object")
-				}
+// TestRequestLogger tests the structured per-request log line and X-Request-ID handling
+func TestRequestLogger(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf strings.Builder
+	server := newAPIServer(defaultLoadLimits())
+	server.logger = newLogger(&buf, "json", slog.LevelInfo)
+	router := gin.New()
+	server.registerRoutes(router)
 
-				if _, ok := data["fibonacci_result"]; !ok {
-					t.Error("Expected 'fibonacci_result' in data")
-				}
-				if _, ok := data["hex_result"]; !ok {
-					t.Error("Expected 'hex_result' in data")
-				}
+	t.Run("generated ID", func(t *testing.T) {
+		buf.Reset()
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/primes/10", nil)
+		router.ServeHTTP(w, req)
+
+		id := w.Header().Get("X-Request-ID")
+		if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(id) {
+			t.Fatalf("Expected a generated UUID in X-Request-ID, got %q", id)
+		}
+
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(buf.String()), &entry); err != nil {
+			t.Fatalf("Expected one JSON log line, got %q: %v", buf.String(), err)
+		}
+		expected := map[string]interface{}{
+			"level":      "INFO",
+			"msg":        "request",
+			"method":     "GET",
+			"path":       "/primes/10",
+			"route":      "/primes/:p",
+			"status":     float64(200),
+			"bytes":      float64(w.Body.Len()),
+			"client_ip":  "",
+			"request_id": id,
+		}
+		for key, value := range expected {
+			if entry[key] != value {
+				t.Errorf("Expected %s=%v, got %v", key, value, entry[key])
 			}
-		})
+		}
+		if duration, ok := entry["duration_ms"].(float64); !ok || duration <= 0 {
+			t.Errorf("Expected positive duration_ms, got %v", entry["duration_ms"])
+		}
+	})
+
+	t.Run("propagated ID", func(t *testing.T) {
+		buf.Reset()
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/primes/invalid", nil)
+		req.Header.Set("X-Request-ID", "load-run-42")
+		router.ServeHTTP(w, req)
+
+		if got := w.Header().Get("X-Request-ID"); got != "load-run-42" {
+			t.Errorf("Expected X-Request-ID to be echoed, got %q", got)
+		}
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(buf.String()), &entry); err != nil {
+			t.Fatalf("Expected one JSON log line, got %q: %v", buf.String(), err)
+		}
+		if entry["request_id"] != "load-run-42" || entry["level"] != "WARN" || entry["status"] != float64(400) {
+			t.Errorf("Expected a WARN line for the 400 with the propagated ID, got %v", entry)
+		}
+	})
+
+	t.Run("text format", func(t *testing.T) {
+		buf.Reset()
+		server.logger = newLogger(&buf, "text", slog.LevelInfo)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/healthz", nil)
+		router.ServeHTTP(w, req)
+
+		for _, field := range []string{"msg=request", "method=GET", "path=/healthz", "status=200", "duration_ms=", "bytes=", "client_ip=", "request_id="} {
+			if !strings.Contains(buf.String(), field) {
+				t.Errorf("Expected text log line to contain %q, got %q", field, buf.String())
+			}
+		}
+	})
+
+	t.Run("level filter", func(t *testing.T) {
+		buf.Reset()
+		server.logger = newLogger(&buf, "json", slog.LevelWarn)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/healthz", nil)
+		router.ServeHTTP(w, req)
+
+		if buf.Len() != 0 {
+			t.Errorf("Expected successful requests to be filtered at warn level, got %q", buf.String())
+		}
+	})
+}
+
+// TestRecoverPanics tests that a panicking handler produces a JSON 500 and a logged stack trace
+// carrying the request ID, and that the 500 is counted in the stats
+func TestRecoverPanics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf strings.Builder
+	server := newAPIServer(defaultLoadLimits())
+	server.logger = newLogger(&buf, "json", slog.LevelInfo)
+	router := gin.New()
+	server.registerRoutes(router)
+	router.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/panic", nil)
+	req.Header.Set("X-Request-ID", "panic-test")
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status 500, got %d", w.Code)
+	}
+	var response map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Expected a JSON body, got %q: %v", w.Body.String(), err)
+	}
+	if fields := errorFields(response); len(response) != 1 || fields["code"] != CodeInternal || fields["message"] != "boom" {
+		t.Errorf("Expected {\"error\":{\"message\":\"boom\",\"code\":\"internal\"}}, got %v", response)
+	}
+
+	var panicEntry, requestEntry map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Expected JSON log lines, got %q: %v", line, err)
+		}
+		switch entry["msg"] {
+		case "panic recovered":
+			panicEntry = entry
+		case "request":
+			requestEntry = entry
+		}
+	}
+	if panicEntry == nil || panicEntry["request_id"] != "panic-test" || panicEntry["panic"] != "boom" {
+		t.Errorf("Expected a panic log line with the request ID, got %v", panicEntry)
+	}
+	if stack, _ := panicEntry["stack"].(string); !strings.Contains(stack, "TestRecoverPanics") {
+		t.Errorf("Expected the stack trace to include the panicking handler, got %q", stack)
+	}
+	if requestEntry == nil || requestEntry["status"] != float64(500) {
+		t.Errorf("Expected the request line to record status 500, got %v", requestEntry)
+	}
+	if stats := server.stats.snapshot().Endpoints["/panic"]; stats.Errors != 1 {
+		t.Errorf("Expected the panic to be counted as an error in /stats, got %+v", stats)
+	}
+}
+
+// TestValidRequestID tests which client-supplied request IDs are reused
+func TestValidRequestID(t *testing.T) {
+	tests := []struct {
+		id    string
+		valid bool
+	}{
+		{"load-run-42", true},
+		{newRequestID(), true},
+		{"", false},
+		{"has space", false},
+		{"line\nbreak", false},
+		{strings.Repeat("a", 128), true},
+		{strings.Repeat("a", 129), false},
+	}
+
+	for _, tt := range tests {
+		if got := validRequestID(tt.id); got != tt.valid {
+			t.Errorf("validRequestID(%q) = %v, expected %v", tt.id, got, tt.valid)
+		}
+	}
+}
+
+// TestLoggerFromEnv tests APEX_LOG_FORMAT and APEX_LOG_LEVEL handling
+func TestLoggerFromEnv(t *testing.T) {
+	tests := []struct {
+		format    string
+		level     string
+		jsonLine  bool
+		debugLogs bool
+	}{
+		{"", "", true, false},
+		{"json", "debug", true, true},
+		{"text", "info", false, false},
+		{"TEXT", "DEBUG", false, true},
+		{"xml", "verbose", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("APEX_LOG_FORMAT", tt.format)
+		t.Setenv("APEX_LOG_LEVEL", tt.level)
+		var buf strings.Builder
+		logger := loggerFromEnv(&buf)
+		logger.Info("hello")
+
+		if isJSON := strings.HasPrefix(buf.String(), "{"); isJSON != tt.jsonLine {
+			t.Errorf("format=%q: expected JSON %v, got %q", tt.format, tt.jsonLine, buf.String())
+		}
+		if enabled := logger.Enabled(context.Background(), slog.LevelDebug); enabled != tt.debugLogs {
+			t.Errorf("level=%q: expected debug enabled %v, got %v", tt.level, tt.debugLogs, enabled)
+		}
 	}
 }
 
-// TestGetPrimesHex tests the combined primes + hex endpoint
-func TestGetPrimesHex(t *testing.T) {
+// TestGzipResponses tests that responses are compressed for gzip clients unless ?raw=1 is set
+func TestGzipResponses(t *testing.T) {
 	router := setupRouter()
 
-	tests := []struct {
-		name           string
-		primeParam     string
-		hexParam       string
-		expectedStatus int
-		expectError    bool
-	}{
-		{
-			name:           "Valid combined operation",
-			primeParam:     "5",
-			hexParam:       "1",
-			expectedStatus: http.StatusOK,
-			expectError:    false,
-		},
-		{
-			name:           "Valid with ranges",
-			primeParam:     "3..7",
-			hexParam:       "1..3",
-			expectedStatus: http.StatusOK,
-			expectError:    false,
-		},
-		{
-			name:           "Invalid prime parameter",
-			primeParam:     "invalid",
-			hexParam:       "1",
-			expectedStatus: http.StatusBadRequest,
-			expectError:    true,
-		},
-		{
-			name:           "Invalid hex parameter",
-			primeParam:     "5",
-			hexParam:       "invalid",
-			expectedStatus: http.StatusBadRequest,
-			expectError:    true,
-		},
+	fetch := func(url string, acceptGzip bool) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		if acceptGzip {
+			req.Header.Set("Accept-Encoding", "gzip")
+		}
+		router.ServeHTTP(w, req)
+		return w
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			w := httptest.NewRecorder()
-			req, _ := http.NewRequest("GET", "/primes/hex/"+tt.primeParam+"/"+tt.hexParam, nil)
-			router.ServeHTTP(w, req)
+	plain := fetch("/hex/100", false)
+	compressed := fetch("/hex/100", true)
 
-			if w.Code != tt.expectedStatus {
-				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
-			}
+	if plain.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected no Content-Encoding without Accept-Encoding, got %q", plain.Header().Get("Content-Encoding"))
+	}
+	if compressed.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected gzip Content-Encoding, got %q", compressed.Header().Get("Content-Encoding"))
+	}
+	if compressed.Header().Get("Content-Length") != "" {
+		t.Errorf("Expected no Content-Length on compressed response, got %s", compressed.Header().Get("Content-Length"))
+	}
+	if compressed.Body.Len() >= plain.Body.Len() {
+		t.Errorf("Expected compressed body (%d bytes) to be smaller than uncompressed (%d bytes)", compressed.Body.Len(), plain.Body.Len())
+	}
 
-			if !tt.expectError {
-				var response map[string]interface{}
-				err := json.Unmarshal(w.Body.Bytes(), &response)
-				if err != nil {
-					t.Errorf("Failed to parse JSON response: %v", err)
-				}
+	reader, err := gzip.NewReader(compressed.Body)
+	if err != nil {
+		t.Fatalf("Failed to open gzip body: %v", err)
+	}
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Failed to decompress body: %v", err)
+	}
+	var response map[string]interface{}
+	if err := json.Unmarshal(decompressed, &response); err != nil {
+		t.Fatalf("Failed to parse decompressed JSON: %v", err)
+	}
+	data := response["data"].(map[string]interface{})
+	if data["length"].(float64) != 100*1024 {
+		t.Errorf("Expected hex length %d, got %v", 100*1024, data["length"])
+	}
 
-				data, ok := response["data"].(map[string]interface{})
-				if !ok {
-					t.Error("Expected 'data' field to be an object")
-				}
+	raw := fetch("/hex/100?raw=1", true)
+	if raw.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected ?raw=1 to skip compression, got Content-Encoding %q", raw.Header().Get("Content-Encoding"))
+	}
+	if err := json.Unmarshal(raw.Body.Bytes(), &response); err != nil {
+		t.Errorf("Expected raw JSON body with ?raw=1: %v", err)
+	}
 
-				if _, ok := data["prime_result"]; !ok {
-					t.Error("Expected 'prime_result' in data")
-				}
-				if _, ok := data["hex_result"]; !ok {
-					t.Error("Expected 'hex_result' in data")
-				}
-			}
-		})
+	// promhttp compresses /metrics itself; the middleware must not compress it twice
+	metrics := fetch("/metrics", true)
+	reader, err = gzip.NewReader(metrics.Body)
+	if err != nil {
+		t.Fatalf("Failed to open gzip /metrics body: %v", err)
+	}
+	body, _ := io.ReadAll(reader)
+	if !strings.Contains(string(body), "http_requests_total") {
+		t.Error("Expected /metrics to be gzip-encoded exactly once")
 	}
 }
 
-// TestFibonacciHexMemory tests the triple combined endpoint
-func TestFibonacciHexMemory(t *testing.T) {
-	router := setupRouter()
+// TestAcceptsGzip tests Accept-Encoding parsing
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"deflate, gzip;q=0.8", true},
+		{"GZIP", true},
+		{"gzip;q=0", false},
+		{"gzip; q=0.0, deflate", false},
+		{"br, deflate", false},
+	}
+
+	for _, tt := range tests {
+		if got := acceptsGzip(tt.header); got != tt.expected {
+			t.Errorf("acceptsGzip(%q) = %v, expected %v", tt.header, got, tt.expected)
+		}
+	}
+}
+
+// TestJSONStyle tests switching between indented and compact JSON
+func TestJSONStyle(t *testing.T) {
+	gin.SetMode(gin.TestMode)
 
 	tests := []struct {
-		name           string
-		fibParam       string
-		hexParam       string
-		memParam       string
-		expectedStatus int
-		expectError    bool
+		name     string
+		compact  bool
+		url      string
+		indented bool
 	}{
-		{
-			name:           "Valid triple operation",
-			fibParam:       "5",
-			hexParam:       "1",
-			memParam:       "10",
-			expectedStatus: http.StatusOK,
-			expectError:    false,
-		},
-		{
-			name:           "Valid with ranges",
-			fibParam:       "3..7",
-			hexParam:       "1..3",
-			memParam:       "5..15",
-			expectedStatus: http.StatusOK,
-			expectError:    false,
-		},
-		{
-			name:           "Invalid fibonacci parameter",
-			fibParam:       "invalid",
-			hexParam:       "1",
-			memParam:       "10",
-			expectedStatus: http.StatusBadRequest,
-			expectError:    true,
-		},
-		{
-			name:           "Invalid memory parameter",
-			fibParam:       "5",
-			hexParam:       "1",
-			memParam:       "invalid",
-			expectedStatus: http.StatusBadRequest,
-			expectError:    true,
-		},
+		{"Default is pretty", false, "/primes/10", true},
+		{"pretty=0", false, "/primes/10?pretty=0", false},
+		{"pretty=false", false, "/primes/10?pretty=false", false},
+		{"Invalid value keeps default", false, "/primes/10?pretty=maybe", true},
+		{"Errors honor pretty=0", false, "/primes/invalid?pretty=0", false},
+		{"Probes honor pretty=0", false, "/healthz?pretty=0", false},
+		{"Server default compact", true, "/primes/10", false},
+		{"pretty=1 overrides compact default", true, "/primes/10?pretty=1", true},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			server := newAPIServer(defaultLoadLimits())
+			server.compactJSON = tt.compact
+			router := gin.New()
+			server.registerRoutes(router)
+
 			w := httptest.NewRecorder()
-			req, _ := http.NewRequest("GET", "/fibonacci/hex/memory/"+tt.fibParam+"/"+tt.hexParam+"/"+tt.memParam, nil)
+			req, _ := http.NewRequest("GET", tt.url, nil)
 			router.ServeHTTP(w, req)
 
-			if w.Code != tt.expectedStatus {
-				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			body := w.Body.String()
+			if !json.Valid([]byte(body)) {
+				t.Fatalf("Expected valid JSON, got %q", body)
 			}
-
-			if !tt.expectError {
-				var response map[string]interface{}
-				err := json.Unmarshal(w.Body.Bytes(), &response)
-				if err != nil {
-					t.Errorf("Failed to parse JSON response: %v", err)
-				}
-
-				data, ok := response["data"].(map[string]interface{})
-				if !ok {
-					t.Error("Expected 'data' field to be an object")
-				}
-
-				if _, ok := data["fibonacci_result"]; !ok {
-					t.Error("Expected 'fibonacci_result' in data")
-				}
-				if _, ok := data["hex_result"]; !ok {
-					t.Error("Expected 'hex_result' in data")
-				}
-				if _, ok := data["memory_result"]; !ok {
-					t.Error("Expected 'memory_result' in data")
-				}
+			if indented := strings.Contains(body, "\n    \""); indented != tt.indented {
+				t.Errorf("Expected indented=%v, got body %q", tt.indented, body)
 			}
 		})
 	}
 }
 
-// TestPrimesHexMemory tests the triple combined endpoint with primes
-func TestPrimesHexMemory(t *testing.T) {
+// TestContentNegotiation tests that handlers honor the Accept header
+func TestContentNegotiation(t *testing.T) {
 	router := setupRouter()
 
-	tests := []struct {
-		name           string
-		primeParam     string
-		hexParam       string
-		memParam       string
-		expectedStatus int
-		expectError    bool
-	}{
-		{
-			name:           "Valid triple operation",
-			primeParam:     "5",
-			hexParam:       "1",
-			memParam:       "10",
-			expectedStatus: http.StatusOK,
-			expectError:    false,
-		},
-		{
-			name:           "Valid with ranges",
-			primeParam:     "3..7",
-			hexParam:       "1..3",
-			memParam:       "5..15",
-			expectedStatus: http.StatusOK,
-			expectError:    false,
-		},
-		{
-			name:           "Invalid prime parameter",
-			primeParam:     "invalid",
-			hexParam:       "1",
-			memParam:       "10",
-			expectedStatus: http.StatusBadRequest,
-			expectError:    true,
-		},
-		{
-			name:           "Invalid memory parameter",
-			primeParam:     "5",
-			hexParam:       "1",
-			memParam:       "invalid",
-			expectedStatus: http.StatusBadRequest,
-			expectError:    true,
-		},
-	}
+	t.Run("JSON for application/json", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/primes/100", nil)
+		req.Header.Set("Accept", "application/json")
+		router.ServeHTTP(w, req)
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			w := httptest.NewRecorder()
-			req, _ := http.NewRequest("GET", "/primes/hex/memory/"+tt.primeParam+"/"+tt.hexParam+"/"+tt.memParam, nil)
-			router.ServeHTTP(w, req)
+		if !strings.Contains(w.Header().Get("Content-Type"), "application/json") {
+			t.Errorf("Expected application/json Content-Type, got %s", w.Header().Get("Content-Type"))
+		}
 
-			if w.Code != tt.expectedStatus {
-				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+		var response map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to parse JSON response: %v", err)
+		}
+		if _, ok := response["data"]; !ok {
+			t.Error("Expected 'data' field in response")
+		}
+	})
+
+	t.Run("JSON when Accept is missing", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/primes/100", nil)
+		router.ServeHTTP(w, req)
+
+		if !strings.Contains(w.Header().Get("Content-Type"), "application/json") {
+			t.Errorf("Expected application/json Content-Type, got %s", w.Header().Get("Content-Type"))
+		}
+	})
+
+	t.Run("Key-value lines for text/plain", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/primes/100", nil)
+		req.Header.Set("Accept", "text/plain")
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		if !strings.Contains(w.Header().Get("Content-Type"), "text/plain") {
+			t.Errorf("Expected text/plain Content-Type, got %s", w.Header().Get("Content-Type"))
+		}
+
+		body := w.Body.String()
+		for _, line := range []string{"count=100\n", "last_prime=541\n", "request_metrics.duration_us="} {
+			if !strings.Contains(body, line) {
+				t.Errorf("Expected body to contain %q, got:\n%s", line, body)
 			}
+		}
+		if strings.Contains(body, "{") {
+			t.Errorf("Expected no JSON in plain text body, got:\n%s", body)
+		}
+	})
 
-			if !tt.expectError {
-				var response map[string]interface{}
-				err := json.Unmarshal(w.Body.Bytes(), &response)
-				if err != nil {
-					t.Errorf("Failed to parse JSON response: %v", err)
-				}
+	t.Run("Key-value lines for text/plain errors", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/primes/20000", nil)
+		req.Header.Set("Accept", "text/plain")
+		router.ServeHTTP(w, req)
 
-				data, ok := response["data"].(map[string]interface{})
-				if !ok {
-					t.Error("Expected 'data' field to be an object")
-				}
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status 400, got %d", w.Code)
+		}
+		body := w.Body.String()
+		for _, line := range []string{"error.code=out_of_range\n", "error.param=p\n", "error.limit=10000\n", "error.message=number out of range"} {
+			if !strings.Contains(body, line) {
+				t.Errorf("Expected body to contain %q, got:\n%s", line, body)
+			}
+		}
+	})
 
-				if _, ok := data["prime_result"]; !ok {
-					t.Error("Expected 'prime_result' in data")
-				}
-				if _, ok := data["hex_result"]; !ok {
-					t.Error("Expected 'hex_result' in data")
-				}
-				if _, ok := data["memory_result"]; !ok {
-					t.Error("Expected 'memory_result' in data")
-				}
+	t.Run("Key-value lines for probes", func(t *testing.T) {
+		gin.SetMode(gin.TestMode)
+		server := newAPIServer(defaultLoadLimits())
+		probeRouter := gin.New()
+		server.registerRoutes(probeRouter)
+
+		probes := []struct {
+			url            string
+			ready          bool
+			expectedStatus int
+			expectedBody   string
+		}{
+			{"/healthz", false, http.StatusOK, "status=ok\n"},
+			{"/readyz", false, http.StatusServiceUnavailable, "status=not ready\n"},
+			{"/readyz", true, http.StatusOK, "status=ready\n"},
+		}
+
+		for _, probe := range probes {
+			server.ready.Store(probe.ready)
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", probe.url, nil)
+			req.Header.Set("Accept", "text/plain")
+			probeRouter.ServeHTTP(w, req)
+
+			if w.Code != probe.expectedStatus {
+				t.Errorf("%s: expected status %d, got %d", probe.url, probe.expectedStatus, w.Code)
 			}
-		})
+			if w.Body.String() != probe.expectedBody {
+				t.Errorf("%s: expected body %q, got %q", probe.url, probe.expectedBody, w.Body.String())
+			}
+		}
+	})
+}
+
+// TestFormatKeyValues tests flattening of nested response bodies
+func TestFormatKeyValues(t *testing.T) {
+	body := gin.H{
+		"data": map[string]interface{}{
+			"prime_result": PrimeResult{Count: 3, LastPrime: 5},
+		},
+		"request_metrics": map[string]interface{}{"duration_us": 12},
+	}
+
+	text, err := formatKeyValues(body)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := "prime_result.count=3\n" +
+		"prime_result.duration_ms=0\n" +
+		"prime_result.duration_us=0\n" +
+		"prime_result.last_prime=5\n" +
+		"request_metrics.duration_us=12\n"
+	if text != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, text)
 	}
 }
 
@@ -1297,18 +8423,10 @@ func TestMainFunction(t *testing.T) {
 	// Test router creation (similar to what main does)
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
-	router.GET("/", getIndex)
-	router.GET("/fibonacci/:f", getFibonacci)
-	router.GET("/primes/:p", getPrimes)
-	router.GET("/hex/:h", getHexString)
-	router.GET("/memory/:m", getMemory)
-	router.GET("/fibonacci/hex/:f/:h", getFibonacciHex)
-	router.GET("/primes/hex/:p/:h", getPrimesHex)
-	router.GET("/fibonacci/hex/memory/:f/:h/:m", fibonacciHexMemory)
-	router.GET("/primes/hex/memory/:p/:h/:m", primesHexMemory)
+	newAPIServer(loadLimitsFromEnv()).registerRoutes(router)
 
 	// Verify router was created successfully
 	if router == nil {
 		t.Error("Router creation failed")
 	}
-}
\ No newline at end of file
+}
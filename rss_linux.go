@@ -0,0 +1,101 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"strconv"
+)
+
+// readRSS returns the process's resident set size in bytes from /proc/self/statm, or 0 if it
+// cannot be read.
+func readRSS() int64 {
+	statm, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0
+	}
+	// statm is "size resident shared text lib data dt", all in pages
+	fields := bytes.Fields(statm)
+	if len(fields) < 2 {
+		return 0
+	}
+	pages, err := strconv.ParseInt(string(fields[1]), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return pages * int64(os.Getpagesize())
+}
+
+// readAvailableMemory returns the bytes that can still be allocated without swapping or hitting
+// the container limit: MemAvailable from /proc/meminfo, lowered to the cgroup's remaining room
+// (limit minus usage) when the process runs under a cgroup memory limit. ok is false when
+// /proc/meminfo can't be read.
+func readAvailableMemory() (int64, bool) {
+	meminfo, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0, false
+	}
+	available, ok := parseMemAvailable(meminfo)
+	if !ok {
+		return 0, false
+	}
+	if room, ok := cgroupMemoryRoom(); ok && room < available {
+		available = room
+	}
+	return available, true
+}
+
+// parseMemAvailable extracts MemAvailable (reported in kB) from /proc/meminfo contents, in bytes
+func parseMemAvailable(meminfo []byte) (int64, bool) {
+	for _, line := range bytes.Split(meminfo, []byte("\n")) {
+		fields := bytes.Fields(line)
+		if len(fields) < 2 || string(fields[0]) != "MemAvailable:" {
+			continue
+		}
+		kb, err := strconv.ParseInt(string(fields[1]), 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		return kb * 1024, true
+	}
+	return 0, false
+}
+
+// cgroupMemoryRoom returns how far the process's cgroup is below its memory limit, trying
+// cgroup v2 and then v1. ok is false when there is no cgroup limit ("max", or v1's huge sentinel).
+func cgroupMemoryRoom() (int64, bool) {
+	for _, files := range [][2]string{
+		{"/sys/fs/cgroup/memory.max", "/sys/fs/cgroup/memory.current"},
+		{"/sys/fs/cgroup/memory/memory.limit_in_bytes", "/sys/fs/cgroup/memory/memory.usage_in_bytes"},
+	} {
+		limit, ok := readCgroupValue(files[0])
+		if !ok {
+			continue
+		}
+		usage, ok := readCgroupValue(files[1])
+		if !ok {
+			continue
+		}
+		// v1 reports "no limit" as a page-rounded max int64
+		if limit >= math.MaxInt64/2 {
+			return 0, false
+		}
+		return max(limit-usage, 0), true
+	}
+	return 0, false
+}
+
+// readCgroupValue reads a single integer cgroup file; "max" and unreadable files report ok=false
+func readCgroupValue(path string) (int64, bool) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	value, err := strconv.ParseInt(string(bytes.TrimSpace(raw)), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return value, true
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package main
+
+// readRSS reports that the current resident set size is unavailable on this platform. getrusage's
+// ru_maxrss is only the peak, which can't show memory being released, so it isn't used here.
+func readRSS() int64 {
+	return 0
+}
+
+// readAvailableMemory reports that available system memory is unknown on this platform, which
+// leaves allocations limited only by APEX_MAX_MEMORY_KB.
+func readAvailableMemory() (int64, bool) {
+	return 0, false
+}